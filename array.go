@@ -0,0 +1,149 @@
+package gologix
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/lib"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//ArrayResult 多维数组读取结果，Values 按行优先顺序排列(最后一维变化最快)，与控制器内存顺序一致
+type ArrayResult struct {
+	TagResult
+	Dims []int //结果形状，Arr[2,3,4] 读取 Arr[1] 时为 [3,4]
+}
+
+//At 按结果形状的下标读取元素
+func (a *ArrayResult) At(indexes ...int) (interface{}, error) {
+	dims := make([]uint32, len(a.Dims))
+	for i, dim := range a.Dims {
+		dims[i] = uint32(dim)
+	}
+	index, err := linearIndex(indexes, dims)
+	if err != nil {
+		return nil, err
+	}
+	if index >= len(a.Values) {
+		return nil, errors.New("数组数据不完整")
+	}
+	return a.Values[index], nil
+}
+
+//Nested 按形状转换为嵌套切片，二维为 [][]interface{} 形式的 []interface{}，一维直接返回 Values
+func (a *ArrayResult) Nested() []interface{} {
+	return nestValues(a.Values, a.Dims)
+}
+
+func nestValues(values []interface{}, dims []int) []interface{} {
+	if len(dims) <= 1 {
+		return values
+	}
+	stride := 1
+	for _, dim := range dims[1:] {
+		stride *= dim
+	}
+	rows := make([]interface{}, 0, dims[0])
+	for i := 0; i < dims[0] && (i+1)*stride <= len(values); i++ {
+		rows = append(rows, nestValues(values[i*stride:(i+1)*stride], dims[1:]))
+	}
+	return rows
+}
+
+//linearIndex 行优先计算线性下标，Arr[i,j,k] = (i*dim1+j)*dim2+k
+func linearIndex(indexes []int, dims []uint32) (int, error) {
+	if len(indexes) != len(dims) {
+		return 0, fmt.Errorf("下标数量 %d 与数组维数 %d 不一致", len(indexes), len(dims))
+	}
+	index := 0
+	for i, dim := range dims {
+		if indexes[i] < 0 || indexes[i] >= int(dim) {
+			return 0, fmt.Errorf("下标 %d 超出第 %d 维范围 %d", indexes[i], i, dim)
+		}
+		index = index*int(dim) + indexes[i]
+	}
+	return index, nil
+}
+
+//arrayIndexes 线性下标转换为各维下标
+func arrayIndexes(index int, dims []uint32) []int {
+	indexes := make([]int, len(dims))
+	for i := len(dims) - 1; i >= 0; i-- {
+		indexes[i] = index % int(dims[i])
+		index /= int(dims[i])
+	}
+	return indexes
+}
+
+//arrayTagName 生成带下标的标签名称
+func arrayTagName(baseTag string, indexes []int) string {
+	items := make([]string, len(indexes))
+	for i, index := range indexes {
+		items[i] = strconv.Itoa(index)
+	}
+	return baseTag + "[" + strings.Join(items, ",") + "]"
+}
+
+//arrayDims 顶层数组标签的维度，成员路径或未知标签返回 nil
+func (p *PLC) arrayDims(baseTag string) []uint32 {
+	_, path := splitScope(baseTag)
+	if strings.Contains(path, ".") {
+		return nil
+	}
+	symbol, err := p.LookupSymbol(baseTag)
+	if err != nil {
+		return nil
+	}
+	return symbol.Dims
+}
+
+//offsetTagName 计算标签之后第 offset 个元素的名称，多维数组按行优先进位到高维
+func (p *PLC) offsetTagName(tagName string, offset int) string {
+	baseTag, indexs := lib.ParseTagName(tagName)
+	if len(indexs) > 1 {
+		dims := p.arrayDims(baseTag)
+		if index, err := linearIndex(indexs, dims); err == nil {
+			return arrayTagName(baseTag, arrayIndexes(index+offset, dims))
+		}
+	}
+	return baseTag + "[" + strconv.Itoa(indexs[0]+offset) + "]"
+}
+
+//ReadArray 按控制器中的维度读取多维数组，标签可带前几维下标读取子数组，
+//例如 Arr[2,3,4] 读取 "Arr" 返回形状 [2,3,4]，读取 "Arr[1]" 返回 Arr[1,*,*] 形状 [3,4]
+func (p *PLC) ReadArray(tagName string) (*ArrayResult, error) {
+	baseTag, prefix := tagName, []int(nil)
+	if strings.HasSuffix(tagName, "]") {
+		baseTag, prefix = lib.ParseTagName(tagName)
+	}
+	dims := p.arrayDims(baseTag)
+	if len(dims) == 0 {
+		return nil, errors.New(baseTag + " 不是数组标签")
+	}
+	if len(prefix) > len(dims) {
+		return nil, fmt.Errorf("下标数量 %d 超出数组维数 %d", len(prefix), len(dims))
+	}
+	indexes := make([]int, len(dims))
+	copy(indexes, prefix)
+	if _, err := linearIndex(indexes, dims); err != nil {
+		return nil, err
+	}
+	shape := make([]int, 0, len(dims)-len(prefix))
+	elements := 1
+	for _, dim := range dims[len(prefix):] {
+		shape = append(shape, int(dim))
+		elements *= int(dim)
+	}
+	if elements > math.MaxUint16 {
+		return nil, fmt.Errorf("数组元素数量 %d 超出单次读取范围", elements)
+	}
+	result, err := p.ReadTag(arrayTagName(baseTag, indexes), uint16(elements))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Values) != elements {
+		return nil, fmt.Errorf("读取 %s 元素数量 %d 与形状不一致", tagName, len(result.Values))
+	}
+	return &ArrayResult{TagResult: *result, Dims: shape}, nil
+}
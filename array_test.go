@@ -0,0 +1,50 @@
+package gologix
+
+import (
+	"github.com/wj008/gologix/types"
+	"testing"
+)
+
+func TestReadArray(t *testing.T) {
+	sim := newSimPLC(t)
+	values := make([]int32, 3*4*50)
+	for i := range values {
+		values[i] = int32(i)
+	}
+	sim.AddArray("Grid", types.DINT, []uint32{3, 4, 50}, values)
+	plc := connectSim(t, sim, ConnectionOptions{})
+	grid, err := plc.ReadArray("Grid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grid.Values) != len(values) || len(grid.Dims) != 3 {
+		t.Fatalf("读取数组形状错误 %v %d", grid.Dims, len(grid.Values))
+	}
+	//行优先: Grid[i,j,k] = (i*4+j)*50+k
+	value, err := grid.At(2, 1, 7)
+	if err != nil || value != int32((2*4+1)*50+7) {
+		t.Fatalf("Grid[2,1,7] 错误 %v %v", value, err)
+	}
+	nested := grid.Nested()
+	if nested[1].([]interface{})[3].([]interface{})[49] != int32((1*4+3)*50+49) {
+		t.Fatal("嵌套切片顺序错误")
+	}
+	sub, err := plc.ReadArray("Grid[1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.Dims) != 2 || sub.Dims[0] != 4 || sub.Values[0] != int32(200) || sub.Values[199] != int32(399) {
+		t.Fatalf("读取子数组错误 %v", sub.Dims)
+	}
+	//跨维读取时续读下标需进位到高维
+	result, err := plc.ReadTag("Grid[0,2,10]", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Values) != 300 || result.Values[299] != int32(2*50+10+299) {
+		t.Fatalf("续读错误 %d", len(result.Values))
+	}
+	if _, err = plc.ReadArray("Grid[3]"); err == nil {
+		t.Fatal("下标越界应返回错误")
+	}
+}
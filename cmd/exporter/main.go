@@ -0,0 +1,58 @@
+//exporter 按配置文件启动 Prometheus 导出器，指标地址 /metrics
+//
+//配置文件示例:
+//  {"listen": ":9108", "plcs": [{"name": "line1", "address": "192.168.0.100", "slot": 0}],
+//   "tags": {"line1": ["Speed", "Running"]}}
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/wj008/gologix/exporter"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	configPath := flag.String("config", "exporter.json", "配置文件路径")
+	listen := flag.String("listen", "", "监听地址，覆盖配置文件")
+	flag.Parse()
+	config := &exporter.Config{}
+	if err := pool.LoadConfig(*configPath, config); err != nil {
+		log.Fatal(err)
+	}
+	if *listen != "" {
+		config.Listen = *listen
+	}
+	if config.Listen == "" {
+		config.Listen = ":9108"
+	}
+	manager, err := pool.NewManager(config.PLCs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer manager.Close()
+	handler, err := exporter.New(manager, config.Tags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{Addr: config.Listen, Handler: mux}
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	log.Println("exporter 监听", config.Listen)
+	if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
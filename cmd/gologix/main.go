@@ -0,0 +1,350 @@
+//gologix 命令行工具: 查找设备、读取设备信息、读写标签、列出标签与监视标签变化
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `用法: gologix <命令> [参数] ...
+
+命令:
+  discover                  广播 ListIdentity 查找设备
+  info                      读取设备信息
+  read TAG[:count] ...      读取标签，count 为元素数量
+  write TAG=VALUE ...       写入标签，数组可用逗号分隔多个元素
+  list-tags                 列出控制器标签
+  watch TAG ...             监视标签变化，Ctrl+C 结束
+
+通用参数:
+  -addr 地址[:端口]         控制器地址，默认端口 44818
+  -slot 槽号                本地机架槽号，默认 0
+  -route 路由               RSLinx 风格路由，如 1,0,2,192.168.1.20,1,3
+  -micro800                 Micro800 模式(不使用背板路由)
+  -unconnected              使用非链接消息，不执行 ForwardOpen
+  -format text|csv|json     输出格式，json 为每行一个对象
+
+使用 gologix <命令> -h 查看命令参数`
+
+//options 通用参数
+type options struct {
+	addr        string
+	slot        int
+	route       string
+	micro800    bool
+	unconnected bool
+	format      string
+}
+
+func (o *options) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.addr, "addr", "", "控制器地址[:端口]")
+	flags.IntVar(&o.slot, "slot", 0, "本地机架槽号")
+	flags.StringVar(&o.route, "route", "", "RSLinx 风格路由字符串")
+	flags.BoolVar(&o.micro800, "micro800", false, "Micro800 模式")
+	flags.BoolVar(&o.unconnected, "unconnected", false, "使用非链接消息")
+	flags.StringVar(&o.format, "format", "text", "输出格式 text/csv/json")
+}
+
+//connect 按参数链接控制器并注册会话，默认打开链接
+func (o *options) connect() (*gologix.PLC, error) {
+	if o.addr == "" {
+		return nil, errors.New("缺少 -addr 参数")
+	}
+	if o.slot < 0 || o.slot > 255 {
+		return nil, fmt.Errorf("槽号 %d 不正确", o.slot)
+	}
+	return pool.Dial(&pool.Endpoint{
+		Address:     o.addr,
+		Slot:        uint8(o.slot),
+		Route:       o.route,
+		Micro800:    o.micro800,
+		Unconnected: o.unconnected,
+	})
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "help" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	commands := map[string]func([]string) error{
+		"discover":  runDiscover,
+		"info":      runInfo,
+		"read":      runRead,
+		"write":     runWrite,
+		"list-tags": runListTags,
+		"watch":     runWatch,
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "未知命令 "+os.Args[1])
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := command(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		os.Exit(1)
+	}
+}
+
+func runDiscover(args []string) error {
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	broadcast := flags.String("broadcast", "255.255.255.255:44818", "广播地址")
+	timeout := flags.Duration("timeout", 2*time.Second, "等待应答时间")
+	format := flags.String("format", "text", "输出格式 text/csv/json")
+	flags.Parse(args)
+	out, err := newOutput(os.Stdout, *format, "address", "product", "vendor", "device_type", "product_code", "revision", "serial", "status", "state")
+	if err != nil {
+		return err
+	}
+	identities, err := gologix.Discover(*broadcast, *timeout)
+	if err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		out.Row(identity.Address, identity.ProductName, identity.VendorID, identity.DeviceType, identity.ProductCode,
+			identity.Revision, fmt.Sprintf("%08x", identity.SerialNumber), fmt.Sprintf("0x%04x", identity.Status), identity.State)
+	}
+	return out.Flush()
+}
+
+func runInfo(args []string) error {
+	opts := &options{}
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	opts.register(flags)
+	flags.Parse(args)
+	out, err := newOutput(os.Stdout, opts.format, "name", "version", "serial", "status", "faulted",
+		"minor_recoverable", "minor_unrecoverable", "major_recoverable", "major_unrecoverable", "io_faulted")
+	if err != nil {
+		return err
+	}
+	plc, err := opts.connect()
+	if err != nil {
+		return err
+	}
+	defer pool.Hangup(plc)
+	if err = plc.ReadAttributeAll(); err != nil {
+		return err
+	}
+	info := plc.Info
+	out.Row(info.Name, info.Version, fmt.Sprintf("%08x", info.SerialNumber), fmt.Sprintf("0x%04x", info.Status), info.Faulted,
+		info.MinorRecoverableFault, info.MinorUnrecoverableFault, info.MajorRecoverableFault, info.MajorUnrecoverableFault, info.IoFaulted)
+	return out.Flush()
+}
+
+//splitCount 拆分 TAG:count，冒号后不是数字时整体作为标签名称(如 Program:MainProgram.Tag)
+func splitCount(arg string) (string, uint16, error) {
+	pos := strings.LastIndex(arg, ":")
+	if pos < 0 || strings.Trim(arg[pos+1:], "0123456789") != "" || pos == len(arg)-1 {
+		return arg, 1, nil
+	}
+	count, err := strconv.ParseUint(arg[pos+1:], 10, 16)
+	if err != nil || count == 0 {
+		return "", 0, fmt.Errorf("元素数量 %s 不正确", arg[pos+1:])
+	}
+	return arg[:pos], uint16(count), nil
+}
+
+func runRead(args []string) error {
+	opts := &options{}
+	flags := flag.NewFlagSet("read", flag.ExitOnError)
+	opts.register(flags)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("缺少标签名称")
+	}
+	out, err := newOutput(os.Stdout, opts.format, "tag", "index", "type", "value")
+	if err != nil {
+		return err
+	}
+	plc, err := opts.connect()
+	if err != nil {
+		return err
+	}
+	defer pool.Hangup(plc)
+	failed := 0
+	for _, arg := range flags.Args() {
+		tag, count, err := splitCount(arg)
+		if err != nil {
+			return err
+		}
+		values, err := plc.ReadValues(tag, count)
+		if err != nil {
+			log.Println(tag, err)
+			failed++
+			continue
+		}
+		for i, value := range values {
+			if opts.format == "json" {
+				out.Row(tag, i, value.DType.String(), value.Data)
+			} else {
+				out.Row(tag, i, value.DType.String(), value.String())
+			}
+		}
+	}
+	if err = out.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个标签读取失败", failed)
+	}
+	return nil
+}
+
+//parseValue 命令行数值，true/false 转换为布尔值，其他按字符串交由类型编码转换
+func parseValue(text string) interface{} {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return strings.TrimSpace(text)
+}
+
+func runWrite(args []string) error {
+	opts := &options{}
+	flags := flag.NewFlagSet("write", flag.ExitOnError)
+	opts.register(flags)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("缺少 TAG=VALUE")
+	}
+	out, err := newOutput(os.Stdout, opts.format, "tag", "value", "result")
+	if err != nil {
+		return err
+	}
+	plc, err := opts.connect()
+	if err != nil {
+		return err
+	}
+	defer pool.Hangup(plc)
+	failed := 0
+	for _, arg := range flags.Args() {
+		pos := strings.Index(arg, "=")
+		if pos <= 0 {
+			return fmt.Errorf("%s 格式不正确，应为 TAG=VALUE", arg)
+		}
+		tag, text := arg[:pos], arg[pos+1:]
+		info, err := plc.TagInfo(tag)
+		values := []interface{}{text}
+		//字符串与结构体不拆分逗号
+		if err != nil || !info.IsStruct() {
+			values = values[:0]
+			for _, item := range strings.Split(text, ",") {
+				values = append(values, parseValue(item))
+			}
+		}
+		result := "ok"
+		if err = plc.WriteTag(tag, values...); err != nil {
+			result = err.Error()
+			failed++
+		}
+		out.Row(tag, text, result)
+	}
+	if err = out.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个标签写入失败", failed)
+	}
+	return nil
+}
+
+func runListTags(args []string) error {
+	opts := &options{}
+	flags := flag.NewFlagSet("list-tags", flag.ExitOnError)
+	opts.register(flags)
+	program := flags.String("program", "", "程序作用域，如 Program:MainProgram")
+	all := flags.Bool("all", false, "包含系统标签")
+	flags.Parse(args)
+	out, err := newOutput(os.Stdout, opts.format, "name", "type", "template", "dims", "element_size")
+	if err != nil {
+		return err
+	}
+	plc, err := opts.connect()
+	if err != nil {
+		return err
+	}
+	defer pool.Hangup(plc)
+	symbols, err := plc.ListTags(*program)
+	if err != nil {
+		return err
+	}
+	for _, symbol := range symbols {
+		if symbol.System && !*all {
+			continue
+		}
+		template := ""
+		if symbol.IsStruct() {
+			if t, err := plc.ReadTemplate(symbol.TemplateID); err == nil {
+				template = t.Name
+			} else {
+				template = strconv.Itoa(int(symbol.TemplateID))
+			}
+		}
+		dims := make([]string, len(symbol.Dims))
+		for i, dim := range symbol.Dims {
+			dims[i] = strconv.Itoa(int(dim))
+		}
+		out.Row(symbol.Name, symbol.DType.String(), template, strings.Join(dims, ","), symbol.ElementSize)
+	}
+	return out.Flush()
+}
+
+func runWatch(args []string) error {
+	opts := &options{}
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	opts.register(flags)
+	rate := flags.Duration("rate", 500*time.Millisecond, "扫描周期")
+	deadband := flags.Float64("deadband", 0, "绝对值死区")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("缺少标签名称")
+	}
+	out, err := newOutput(os.Stdout, opts.format, "time", "tag", "type", "value", "quality", "error")
+	if err != nil {
+		return err
+	}
+	plc, err := opts.connect()
+	if err != nil {
+		return err
+	}
+	defer pool.Hangup(plc)
+	subscriber := gologix.NewSubscriber(plc, 256)
+	for _, tag := range flags.Args() {
+		if err = subscriber.Subscribe(tag, *rate, gologix.Deadband{Absolute: *deadband}); err != nil {
+			return err
+		}
+	}
+	subscriber.Start()
+	defer subscriber.Stop()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case event := <-subscriber.Events():
+			message := ""
+			if event.Err != nil {
+				message = event.Err.Error()
+			}
+			value := event.NewValue
+			if opts.format != "json" {
+				value = gologix.Value{DType: event.DType, Data: event.NewValue}.String()
+			}
+			out.Row(event.Time.Format(time.RFC3339Nano), event.Tag, event.DType.String(), value, event.Quality.String(), message)
+			out.Flush()
+		}
+	}
+}
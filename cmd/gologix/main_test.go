@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCount(t *testing.T) {
+	cases := []struct {
+		arg   string
+		tag   string
+		count uint16
+	}{
+		{"P_REAL", "P_REAL", 1},
+		{"P_REAL[2]:10", "P_REAL[2]", 10},
+		{"Program:MainProgram.Speed", "Program:MainProgram.Speed", 1},
+		{"Program:MainProgram.Trend:5", "Program:MainProgram.Trend", 5},
+	}
+	for _, c := range cases {
+		tag, count, err := splitCount(c.arg)
+		if err != nil || tag != c.tag || count != c.count {
+			t.Fatalf("%s 拆分错误 %s %d %v", c.arg, tag, count, err)
+		}
+	}
+	if _, _, err := splitCount("P_REAL:0"); err == nil {
+		t.Fatal("元素数量为 0 应返回错误")
+	}
+}
+
+func TestOutput(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	out, _ := newOutput(buffer, "csv", "tag", "value")
+	out.Row("A", 1.5)
+	out.Row("B,C", "x")
+	if buffer.String() != "tag,value\nA,1.5\n\"B,C\",x\n" {
+		t.Fatalf("csv 输出错误 %q", buffer.String())
+	}
+	buffer.Reset()
+	out, _ = newOutput(buffer, "json", "tag", "value")
+	out.Row("A", 1.5)
+	if buffer.String() != "{\"tag\":\"A\",\"value\":1.5}\n" {
+		t.Fatalf("json 输出错误 %q", buffer.String())
+	}
+	if _, err := newOutput(buffer, "xml"); err == nil {
+		t.Fatal("不支持的格式应返回错误")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+//output 按格式输出结果: text 对齐表格，csv 首行为表头，json 每行一个对象
+type output struct {
+	format  string
+	columns []string
+	text    *tabwriter.Writer
+	csv     *csv.Writer
+	json    *json.Encoder
+	header  bool
+}
+
+func newOutput(w io.Writer, format string, columns ...string) (*output, error) {
+	o := &output{format: format, columns: columns}
+	switch format {
+	case "text":
+		o.text = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	case "csv":
+		o.csv = csv.NewWriter(w)
+	case "json":
+		o.json = json.NewEncoder(w)
+	default:
+		return nil, fmt.Errorf("不支持的输出格式 %s，可选 text/csv/json", format)
+	}
+	return o, nil
+}
+
+//Row 输出一行，values 与列一一对应
+func (o *output) Row(values ...interface{}) error {
+	switch o.format {
+	case "json":
+		record := make(map[string]interface{}, len(values))
+		for i, value := range values {
+			record[o.columns[i]] = value
+		}
+		return o.json.Encode(record)
+	case "csv":
+		if !o.header {
+			o.header = true
+			if err := o.csv.Write(o.columns); err != nil {
+				return err
+			}
+		}
+		if err := o.csv.Write(o.strings(values)); err != nil {
+			return err
+		}
+		o.csv.Flush()
+		return o.csv.Error()
+	default:
+		if !o.header {
+			o.header = true
+			fmt.Fprintln(o.text, strings.Join(o.columns, "\t"))
+		}
+		fmt.Fprintln(o.text, strings.Join(o.strings(values), "\t"))
+		return nil
+	}
+}
+
+//Flush 输出缓存的表格，持续输出时每行后调用
+func (o *output) Flush() error {
+	if o.text != nil {
+		return o.text.Flush()
+	}
+	return nil
+}
+
+func (o *output) strings(values []interface{}) []string {
+	items := make([]string, len(values))
+	for i, value := range values {
+		switch data := value.(type) {
+		case nil:
+			items[i] = ""
+		case string:
+			items[i] = data
+		case []byte:
+			items[i] = fmt.Sprintf("% x", data)
+		default:
+			items[i] = fmt.Sprint(data)
+		}
+	}
+	return items
+}
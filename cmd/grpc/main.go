@@ -0,0 +1,56 @@
+//grpc 按配置文件启动 gRPC 服务，客户端在请求中指定 PLC 地址与路由
+//
+//配置文件示例:
+//  {"listen": ":50051", "cert_file": "server.crt", "key_file": "server.key",
+//   "allow": ["192.168.0.0/24"], "max_connections": 32}
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/wj008/gologix/grpcapi"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	configPath := flag.String("config", "grpc.json", "配置文件路径")
+	listen := flag.String("listen", "", "监听地址，覆盖配置文件")
+	flag.Parse()
+	config := &grpcapi.Config{}
+	if err := pool.LoadConfig(*configPath, config); err != nil {
+		log.Fatal(err)
+	}
+	if *listen != "" {
+		config.Listen = *listen
+	}
+	if config.Listen == "" {
+		config.Listen = ":50051"
+	}
+	if config.CertFile == "" || config.KeyFile == "" {
+		log.Fatal("需要设置 cert_file 与 key_file，HTTP/2 只在 TLS 上可用")
+	}
+	if len(config.Allow) == 0 {
+		log.Fatal("需要设置 allow，没有允许访问的 PLC 地址时拒绝启动")
+	}
+	server := grpcapi.New()
+	server.Allow = config.Allow
+	if config.MaxConnections > 0 {
+		server.MaxConnections = config.MaxConnections
+	}
+	defer server.Close()
+	httpServer := &http.Server{Addr: config.Listen, Handler: server}
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		httpServer.Close()
+	}()
+	log.Println("grpc 监听", config.Listen)
+	if err := httpServer.ListenAndServeTLS(config.CertFile, config.KeyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
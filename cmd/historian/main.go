@@ -0,0 +1,95 @@
+//historian 按配置文件采样 PLC 标签并写入 CSV/JSONL 文件或 InfluxDB
+//
+//配置文件示例:
+//  {"plcs": [{"name": "line1", "address": "192.168.0.100", "slot": 0}],
+//   "groups": [{"name": "fast", "plc": "line1", "tags": ["Speed"], "rate_ms": 500},
+//              {"name": "state", "plc": "line1", "tags": ["Running"], "mode": "change"}],
+//   "output": {"type": "csv", "dir": "history", "max_size_mb": 10, "max_age_hours": 168, "max_total_mb": 1024}}
+//
+//本程序不包含数据库驱动，写入数据库时在自己的程序中导入驱动并使用 historian.NewSQLSink。
+//type 为 influx 时按顶层 influx 配置写入 InfluxDB:
+//  "output": {"type": "influx"},
+//  "influx": {"url": "http://127.0.0.1:8086", "org": "plant", "bucket": "plc", "token": "...", "buffer_dir": "influx-buffer"}
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/wj008/gologix/historian"
+	"github.com/wj008/gologix/influx"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+//fileConfig 历史记录器配置与 InfluxDB 输出配置
+type fileConfig struct {
+	historian.Config
+	Influx *influx.Config `json:"influx"`
+}
+
+//openSink 按配置创建写入目标
+func openSink(config *fileConfig) (historian.Sink, error) {
+	output := &config.Output
+	switch output.Type {
+	case historian.FormatCSV, historian.FormatJSONL:
+		return historian.NewFileSink(historian.FileOptions{
+			Dir:          output.Dir,
+			Prefix:       output.Prefix,
+			Format:       output.Type,
+			MaxSize:      output.MaxSizeMB << 20,
+			RotateEvery:  time.Duration(output.RotateMinutes) * time.Minute,
+			MaxAge:       time.Duration(output.MaxAgeHours) * time.Hour,
+			MaxTotalSize: output.MaxTotalMB << 20,
+		})
+	case "influx":
+		if config.Influx == nil {
+			return nil, errors.New("缺少 influx 配置")
+		}
+		writer, err := influx.NewWriter(config.Influx.Options())
+		if err != nil {
+			return nil, err
+		}
+		return influx.NewSink(&config.Influx.Point, writer), nil
+	default:
+		return nil, errors.New("不支持的输出类型 " + output.Type + "，可选 csv/jsonl/influx")
+	}
+}
+
+func main() {
+	configPath := flag.String("config", "historian.json", "配置文件路径")
+	flag.Parse()
+	config := &fileConfig{}
+	if err := pool.LoadConfig(*configPath, config); err != nil {
+		log.Fatal(err)
+	}
+	manager, err := pool.NewManager(config.PLCs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer manager.Close()
+	sink, err := openSink(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	h, err := historian.New(manager, config.Groups, sink)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.FlushMs > 0 {
+		h.FlushInterval = time.Duration(config.FlushMs) * time.Millisecond
+	}
+	if config.Buffer > 0 {
+		h.MaxBuffer = config.Buffer
+	}
+	h.Start()
+	log.Println("historian 已启动")
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	if err = h.Stop(); err != nil {
+		log.Println("写入历史记录失败:", err)
+	}
+}
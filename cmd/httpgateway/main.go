@@ -0,0 +1,53 @@
+//httpgateway 按配置文件启动 REST/JSON 网关
+//
+//配置文件示例:
+//  {"listen": ":8080", "plcs": [{"name": "line1", "address": "192.168.0.100", "slot": 0}]}
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/wj008/gologix/httpgateway"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	configPath := flag.String("config", "gateway.json", "配置文件路径")
+	listen := flag.String("listen", "", "监听地址，覆盖配置文件")
+	flag.Parse()
+	config := &httpgateway.Config{}
+	if err := pool.LoadConfig(*configPath, config); err != nil {
+		log.Fatal(err)
+	}
+	if *listen != "" {
+		config.Listen = *listen
+	}
+	if config.Listen == "" {
+		config.Listen = ":8080"
+	}
+	manager, err := pool.NewManager(config.PLCs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer manager.Close()
+	gateway := httpgateway.New(manager)
+	defer gateway.Close()
+	server := &http.Server{Addr: config.Listen, Handler: gateway}
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	log.Println("httpgateway 监听", config.Listen)
+	if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,56 @@
+//modbus 按配置文件启动 Modbus TCP 服务，把寄存器与线圈映射到 Logix 标签
+//
+//配置文件示例:
+//  {"listen": ":502", "cache_ms": 500, "plcs": [{"name": "line1", "address": "192.168.0.100", "slot": 0}],
+//   "mappings": [{"table": "holding", "address": 0, "plc": "line1", "tag": "Speed", "type": "REAL"},
+//                {"table": "holding", "address": 2, "plc": "line1", "tag": "Count", "type": "DINT", "word_order": "low"},
+//                {"table": "coil", "address": 0, "plc": "line1", "tag": "Running"}]}
+package main
+
+import (
+	"flag"
+	"github.com/wj008/gologix/modbus"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	configPath := flag.String("config", "modbus.json", "配置文件路径")
+	listen := flag.String("listen", "", "监听地址，覆盖配置文件")
+	flag.Parse()
+	config := &modbus.Config{}
+	if err := pool.LoadConfig(*configPath, config); err != nil {
+		log.Fatal(err)
+	}
+	if *listen != "" {
+		config.Listen = *listen
+	}
+	if config.Listen == "" {
+		config.Listen = ":502"
+	}
+	manager, err := pool.NewManager(config.PLCs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer manager.Close()
+	server, err := modbus.New(manager, config.Mappings)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.CacheMs > 0 {
+		server.CacheTime = time.Duration(config.CacheMs) * time.Millisecond
+	}
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		server.Close()
+	}()
+	log.Println("modbus 监听", config.Listen)
+	if err = server.ListenAndServe(config.Listen); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,42 @@
+//mqttbridge 按配置文件启动 Sparkplug B 网桥
+//
+//配置文件示例:
+//  {"broker": "127.0.0.1:1883", "group": "plant", "node": "edge1",
+//   "plcs": [{"name": "line1", "address": "192.168.0.100", "slot": 0}],
+//   "devices": [{"name": "line1", "tags": ["Speed", "Running"], "rate_ms": 500}]}
+package main
+
+import (
+	"flag"
+	"github.com/wj008/gologix/mqttbridge"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	configPath := flag.String("config", "mqttbridge.json", "配置文件路径")
+	flag.Parse()
+	config := &mqttbridge.Config{}
+	if err := pool.LoadConfig(*configPath, config); err != nil {
+		log.Fatal(err)
+	}
+	manager, err := pool.NewManager(config.PLCs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer manager.Close()
+	bridge, err := mqttbridge.New(config, manager)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = bridge.Start(); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("mqttbridge 已链接", config.Broker)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	bridge.Stop()
+}
@@ -0,0 +1,53 @@
+//opcua 按配置文件启动 OPC UA 服务，把控制器的标签树映射为节点
+//
+//配置文件示例:
+//  {"listen": ":4840", "plcs": [{"name": "line1", "address": "192.168.0.100", "slot": 0}],
+//   "users": {"operator": "secret"}, "read_only": false, "max_struct_elements": 100}
+package main
+
+import (
+	"flag"
+	"github.com/wj008/gologix/opcua"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	configPath := flag.String("config", "opcua.json", "配置文件路径")
+	listen := flag.String("listen", "", "监听地址，覆盖配置文件")
+	flag.Parse()
+	config := &opcua.Config{}
+	if err := pool.LoadConfig(*configPath, config); err != nil {
+		log.Fatal(err)
+	}
+	if *listen != "" {
+		config.Listen = *listen
+	}
+	if config.Listen == "" {
+		config.Listen = ":4840"
+	}
+	manager, err := pool.NewManager(config.PLCs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer manager.Close()
+	server := opcua.New(manager)
+	server.EndpointURL = config.EndpointURL
+	server.ReadOnly = config.ReadOnly
+	server.Users = config.Users
+	if config.MaxStructElements > 0 {
+		server.MaxStructElements = config.MaxStructElements
+	}
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		server.Close()
+	}()
+	log.Println("opcua 监听", config.Listen)
+	if err = server.ListenAndServe(config.Listen); err != nil {
+		log.Fatal(err)
+	}
+}
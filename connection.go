@@ -0,0 +1,117 @@
+package gologix
+
+import (
+	"fmt"
+	"github.com/wj008/gologix/lib"
+	"sync/atomic"
+)
+
+//ConnectionOptions ForwardOpen 链接参数，零值字段使用默认值
+type ConnectionOptions struct {
+	Priority          uint8  //优先级/时间刻度 默认 0x0a
+	TimeoutTicks      uint8  //超时刻度 默认 0x0e
+	OTConnectionID    uint32 //建议的 O->T 链接ID(由目标决定) 默认 0x20000002
+	TOConnectionID    uint32 //T->O 链接ID 默认随机生成
+	OTRPI             uint32 //O->T 请求包间隔(微秒) 默认 0x00201234
+	TORPI             uint32 //T->O 请求包间隔(微秒) 默认 0x00204001
+	TimeoutMultiplier uint8  //超时倍数 默认 3
+	VendorID          uint16 //厂商ID 默认 0x1337，Micro800 为 0x01
+	OriginatorSerial  uint32 //发起方序列号 默认随机生成，同一进程内不重复
+	Count             int    //打开的链接数量 默认 1
+	WriteCount        int    //其中专用于写入的链接数量，须小于 Count 默认 0 与读取共用
+}
+
+//ConnectionReport ForwardOpen 协商结果
+type ConnectionReport struct {
+	Large            bool   //是否为大链接(Large Forward Open)
+	ConnectionSize   uint16 //实际链接大小
+	OTConnectionID   uint32 //目标分配的 O->T 链接ID
+	TOConnectionID   uint32 //T->O 链接ID
+	ConnectionSerial uint16
+	VendorID         uint16
+	OriginatorSerial uint32
+	OTAPI            uint32 //目标返回的 O->T 实际包间隔(微秒)
+	TOAPI            uint32 //目标返回的 T->O 实际包间隔(微秒)
+}
+
+var originatorSerialSeed = uint32(lib.RandInt64(0x7fffffff))
+
+//newOriginatorSerial 生成不重复的发起方序列号
+func newOriginatorSerial() uint32 {
+	serial := atomic.AddUint32(&originatorSerialSeed, 1)
+	if serial == 0 {
+		serial = atomic.AddUint32(&originatorSerialSeed, 1)
+	}
+	return serial
+}
+
+//withDefaults 填充默认值，写入链接数量不小于链接数量时返回错误
+func (o ConnectionOptions) withDefaults(micro800 bool) (ConnectionOptions, error) {
+	if o.Priority == 0 {
+		o.Priority = 0x0a
+	}
+	if o.TimeoutTicks == 0 {
+		o.TimeoutTicks = 0x0e
+	}
+	if o.OTConnectionID == 0 {
+		o.OTConnectionID = 0x20000002
+	}
+	if o.TOConnectionID == 0 {
+		o.TOConnectionID = uint32(lib.RandInt64(0x7fffffff)) + 1
+	}
+	if o.OTRPI == 0 {
+		o.OTRPI = 0x00201234
+	}
+	if o.TORPI == 0 {
+		o.TORPI = 0x00204001
+	}
+	if o.TimeoutMultiplier == 0 {
+		o.TimeoutMultiplier = 3
+	}
+	if o.VendorID == 0 {
+		if micro800 {
+			o.VendorID = 0x01
+		} else {
+			o.VendorID = 0x1337
+		}
+	}
+	if o.Count <= 0 {
+		o.Count = 1
+	}
+	if o.WriteCount < 0 || o.WriteCount >= o.Count {
+		return o, fmt.Errorf("写入链接数量 %d 必须小于链接数量 %d", o.WriteCount, o.Count)
+	}
+	if o.OriginatorSerial == 0 {
+		o.OriginatorSerial = newOriginatorSerial()
+	}
+	return o, nil
+}
+
+type trafficClass uint8
+
+const (
+	trafficRead trafficClass = iota
+	trafficWrite
+)
+
+//cipConnection 单个 Class3 链接
+type cipConnection struct {
+	report   *ConnectionReport
+	serialId uint16
+	sequence uint32
+	write    bool
+}
+
+//nextSequence 链接内的包序号，需持有 PLC.mutex
+func (c *cipConnection) nextSequence() uint32 {
+	c.sequence = (c.sequence + 1) % 0x10000
+	if c.sequence == 0 {
+		c.sequence = 1
+	}
+	return c.sequence
+}
+
+//sequenceKey 应答匹配键
+func sequenceKey(connectionID uint32, sequenceId uint32) uint64 {
+	return uint64(connectionID)<<32 | uint64(sequenceId)
+}
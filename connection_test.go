@@ -0,0 +1,133 @@
+package gologix
+
+import (
+	"github.com/wj008/gologix/types"
+	"sync"
+	"testing"
+)
+
+func TestMultipleConnections(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTag("P_REAL", types.REAL, []float32{1.5, 2.5, 3.5, 4.5})
+	plc := connectSim(t, sim, ConnectionOptions{Count: 3, WriteCount: 1})
+	reports := plc.ConnectionReports()
+	if len(reports) != 3 {
+		t.Fatalf("链接数量错误 %d", len(reports))
+	}
+	seen := make(map[uint32]bool)
+	for _, report := range reports {
+		if seen[report.TOConnectionID] {
+			t.Fatalf("T->O 链接ID重复 %x", report.TOConnectionID)
+		}
+		seen[report.TOConnectionID] = true
+		if !report.Large || report.ConnectionSize != 4002 {
+			t.Fatalf("链接大小协商错误 %+v", report)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			index := i % 4
+			result, err := plc.ReadTag("P_REAL["+string(rune('0'+index))+"]", 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want := float32(index) + 1.5; result.Values[0] != want {
+				t.Errorf("读取错误 %v != %v", result.Values[0], want)
+			}
+		}(i)
+	}
+	wg.Wait()
+	usage := sim.ConnectionUsage()
+	writeID := reports[2].OTConnectionID
+	if usage[writeID] != 0 {
+		t.Fatalf("读取请求不应使用写入链接")
+	}
+	for _, report := range reports[:2] {
+		if usage[report.OTConnectionID] == 0 {
+			t.Fatalf("读取请求未分配到链接 %x", report.OTConnectionID)
+		}
+	}
+}
+
+func TestConnectionIdentity(t *testing.T) {
+	sim := newSimPLC(t)
+	first := connectSim(t, sim, ConnectionOptions{})
+	second := connectSim(t, sim, ConnectionOptions{})
+	a, b := first.ConnectionReport(), second.ConnectionReport()
+	if a.OriginatorSerial == b.OriginatorSerial {
+		t.Fatalf("发起方序列号重复 %x", a.OriginatorSerial)
+	}
+	if a.TOConnectionID == b.TOConnectionID {
+		t.Fatalf("T->O 链接ID重复 %x", a.TOConnectionID)
+	}
+	opens := sim.OpenRequests()
+	if len(opens) != 2 || opens[0].OriginatorSerial != a.OriginatorSerial || opens[1].OriginatorSerial != b.OriginatorSerial {
+		t.Fatalf("ForwardOpen 请求的发起方序列号错误 %+v %+v", opens[0], opens[1])
+	}
+}
+
+func TestConnectionOptions(t *testing.T) {
+	sim := newSimPLC(t)
+	opts := ConnectionOptions{
+		Priority:          0x07,
+		TimeoutTicks:      0x9b,
+		OTConnectionID:    0x11223344,
+		TOConnectionID:    0x55667788,
+		OTRPI:             250000,
+		TORPI:             500000,
+		TimeoutMultiplier: 5,
+		VendorID:          0x0042,
+		OriginatorSerial:  0xcafe0001,
+	}
+	plc := connectSim(t, sim, opts)
+	opens := sim.OpenRequests()
+	if len(opens) != 1 {
+		t.Fatalf("ForwardOpen 请求数量错误 %d", len(opens))
+	}
+	open := opens[0]
+	if open.Priority != opts.Priority || open.TimeoutTicks != opts.TimeoutTicks || open.OTConnectionID != opts.OTConnectionID ||
+		open.TOConnectionID != opts.TOConnectionID || open.OTRPI != opts.OTRPI || open.TORPI != opts.TORPI ||
+		open.TimeoutMultiplier != opts.TimeoutMultiplier || open.VendorID != opts.VendorID || open.OriginatorSerial != opts.OriginatorSerial {
+		t.Fatalf("ForwardOpen 请求参数错误 %+v", open)
+	}
+	report := plc.ConnectionReport()
+	if report.TOConnectionID != opts.TOConnectionID || report.VendorID != opts.VendorID ||
+		report.OriginatorSerial != opts.OriginatorSerial || report.ConnectionSerial != open.ConnectionSerial {
+		t.Fatalf("链接报告错误 %+v", report)
+	}
+}
+
+func TestConnectionWriteCount(t *testing.T) {
+	sim := newSimPLC(t)
+	plc := NewPLC()
+	plc.ConnectionOptions = ConnectionOptions{Count: 2, WriteCount: 2}
+	if err := plc.Connect(sim.Addr(), 0); err == nil {
+		plc.Close()
+		t.Fatal("写入链接数量等于链接数量时应返回错误")
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	sim := newSimPLC(t)
+	plc := connectSim(t, sim, ConnectionOptions{Count: 2})
+	closed := 0
+	plc.OnClose = func() {
+		closed++
+	}
+	if err := plc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := plc.Close(); err != nil || closed != 1 {
+		t.Fatalf("重复关闭 %v %d", err, closed)
+	}
+	if plc.Connected() || plc.Registered() || plc.ForwardOpened() {
+		t.Fatal("关闭后状态未清除")
+	}
+	if plc.IsConnected || plc.IsRegistered || plc.IsForwardOpened {
+		t.Fatal("关闭后兼容字段未清除")
+	}
+}
@@ -0,0 +1,119 @@
+package gologix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/lib"
+	"net"
+	"time"
+)
+
+//Identity ListIdentity 应答中的设备信息
+type Identity struct {
+	Address      string //应答设备的 IP 地址
+	EncapVersion uint16
+	VendorID     uint16
+	DeviceType   uint16
+	ProductCode  uint16
+	Revision     string
+	Status       uint16
+	SerialNumber uint32
+	ProductName  string
+	State        uint8
+}
+
+//parseIdentity 解析 ListIdentity 应答包
+func parseIdentity(data []byte) (*Identity, error) {
+	reader := bytes.NewReader(data)
+	header := enip.Header{}
+	if reader.Len() < 24 {
+		return nil, errors.New("ListIdentity 应答长度不正确")
+	}
+	lib.ReadByte(reader, &header)
+	if header.Command != enip.CommandListIdentity {
+		return nil, fmt.Errorf("不是 ListIdentity 应答 0x%04x", uint16(header.Command))
+	}
+	if int(header.Length) > reader.Len() {
+		return nil, errors.New("ListIdentity 应答长度不正确")
+	}
+	for _, item := range enip.ParserCPF(data[24 : 24+int(header.Length)]) {
+		if item.TypeID != enip.CPFTypeListIdentity {
+			continue
+		}
+		//协议版本(2) 套接字地址(16, 大端) 厂商(2) 设备类型(2) 产品代码(2) 版本(2) 状态(2) 序列号(4) 名称长度(1)
+		if len(item.Data) < 33 {
+			return nil, errors.New("ListIdentity 设备信息不完整")
+		}
+		buf := item.Data
+		identity := &Identity{
+			EncapVersion: binary.LittleEndian.Uint16(buf[0:]),
+			Address:      net.IP(buf[6:10]).String(),
+			VendorID:     binary.LittleEndian.Uint16(buf[18:]),
+			DeviceType:   binary.LittleEndian.Uint16(buf[20:]),
+			ProductCode:  binary.LittleEndian.Uint16(buf[22:]),
+			Revision:     fmt.Sprintf("%d.%d", buf[24], buf[25]),
+			Status:       binary.LittleEndian.Uint16(buf[26:]),
+			SerialNumber: binary.LittleEndian.Uint32(buf[28:]),
+		}
+		nameLen := int(buf[32])
+		if len(buf) < 33+nameLen {
+			return nil, errors.New("ListIdentity 设备名称不完整")
+		}
+		identity.ProductName = string(buf[33 : 33+nameLen])
+		if len(buf) > 33+nameLen {
+			identity.State = buf[33+nameLen]
+		}
+		return identity, nil
+	}
+	return nil, errors.New("ListIdentity 应答没有设备信息")
+}
+
+//Discover 通过 UDP 广播 ListIdentity 查找设备，addr 为广播地址(如 192.168.0.255:44818)，
+//为空时使用 255.255.255.255:44818，在 timeout 内收集所有应答
+func Discover(addr string, timeout time.Duration) ([]*Identity, error) {
+	if addr == "" {
+		addr = "255.255.255.255:44818"
+	}
+	target, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err = conn.WriteToUDP(enip.NewPackage(enip.CommandListIdentity, nil).Buffer(), target); err != nil {
+		return nil, err
+	}
+	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	identities := make([]*Identity, 0)
+	seen := make(map[string]bool)
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return identities, nil
+			}
+			return identities, err
+		}
+		identity, err := parseIdentity(buf[:n])
+		if err != nil {
+			continue
+		}
+		//套接字地址可能为 0.0.0.0，以应答来源为准
+		identity.Address = from.IP.String()
+		if seen[identity.Address] {
+			continue
+		}
+		seen[identity.Address] = true
+		identities = append(identities, identity)
+	}
+}
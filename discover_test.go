@@ -0,0 +1,49 @@
+package gologix
+
+import (
+	"bytes"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/lib"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDiscover(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil || n < 24 {
+			return
+		}
+		item := new(bytes.Buffer)
+		lib.WriteByte(item, uint16(1))
+		item.Write([]byte{0, 2, 0xaf, 0x12, 127, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0})
+		lib.WriteByte(item, []uint16{0x01, 0x0e, 0x6c})
+		lib.WriteByte(item, []uint8{32, 11})
+		lib.WriteByte(item, uint16(0x3060))
+		lib.WriteByte(item, uint32(0x00c0ffee))
+		name := "1756-L83E/B"
+		lib.WriteByte(item, uint8(len(name)))
+		item.WriteString(name)
+		lib.WriteByte(item, uint8(3))
+		pack := enip.NewPackage(enip.CommandListIdentity, enip.BuildCPF([]*enip.CPFItem{{TypeID: enip.CPFTypeListIdentity, Data: item.Bytes()}}))
+		conn.WriteToUDP(pack.Buffer(), from)
+	}()
+	identities, err := Discover(conn.LocalAddr().String(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 {
+		t.Fatalf("应发现1个设备，实际 %d", len(identities))
+	}
+	identity := identities[0]
+	if identity.ProductName != "1756-L83E/B" || identity.Revision != "32.11" || identity.SerialNumber != 0x00c0ffee || identity.DeviceType != 0x0e || identity.State != 3 {
+		t.Fatalf("设备信息错误 %+v", identity)
+	}
+}
@@ -5,26 +5,29 @@ type CPFType uint16
 type CIPServType uint8
 
 const (
-	ServiceGetAttributeAll        CIPServType = 0x01
-	ServiceGetAttributeSingle     CIPServType = 0x0e
-	ServiceReset                  CIPServType = 0x05
-	ServiceStart                  CIPServType = 0x06
-	ServiceStop                   CIPServType = 0x07
-	ServiceCreate                 CIPServType = 0x08
-	ServiceDelete                 CIPServType = 0x09
-	ServiceMultipleServicePacket  CIPServType = 0x0a
-	ServiceApplyAttributes        CIPServType = 0x0d
-	ServiceSetAttributeSingle     CIPServType = 0x10
-	ServiceFindNext               CIPServType = 0x11
-	ServiceReadTag                CIPServType = 0x4c
-	ServiceWriteTag               CIPServType = 0x4d
-	ServiceReadTagFragmented      CIPServType = 0x52
-	ServiceWriteTagFragmented     CIPServType = 0x53
-	ServiceForwardOpen            CIPServType = 0x54
-	ServiceForwardOpenLarge       CIPServType = 0x5b
-	ServiceForwardClose           CIPServType = 0x4e
-	ServiceReadModifyWriteTag     CIPServType = 0x4e
-	ServiceUnconnectedSendService CIPServType = 0x52
+	ServiceGetAttributeAll          CIPServType = 0x01
+	ServiceGetAttributeList         CIPServType = 0x03
+	ServiceGetAttributeSingle       CIPServType = 0x0e
+	ServiceReset                    CIPServType = 0x05
+	ServiceStart                    CIPServType = 0x06
+	ServiceStop                     CIPServType = 0x07
+	ServiceCreate                   CIPServType = 0x08
+	ServiceDelete                   CIPServType = 0x09
+	ServiceMultipleServicePacket    CIPServType = 0x0a
+	ServiceApplyAttributes          CIPServType = 0x0d
+	ServiceSetAttributeSingle       CIPServType = 0x10
+	ServiceFindNext                 CIPServType = 0x11
+	ServiceReadTag                  CIPServType = 0x4c
+	ServiceWriteTag                 CIPServType = 0x4d
+	ServiceReadTagFragmented        CIPServType = 0x52
+	ServiceWriteTagFragmented       CIPServType = 0x53
+	ServiceForwardOpen              CIPServType = 0x54
+	ServiceForwardOpenLarge         CIPServType = 0x5b
+	ServiceForwardClose             CIPServType = 0x4e
+	ServiceReadModifyWriteTag       CIPServType = 0x4e
+	ServiceUnconnectedSendService   CIPServType = 0x52
+	ServiceGetInstanceAttributeList CIPServType = 0x55
+	ServiceReadTemplate             CIPServType = 0x4c
 )
 const (
 	CommandNOP               Command = 0x0000
@@ -0,0 +1,593 @@
+package enip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/epath"
+	"github.com/wj008/gologix/types"
+	"strings"
+)
+
+//Node 数据包解析树节点
+type Node struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value,omitempty"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+//Add 添加子节点
+func (n *Node) Add(name string, value interface{}) *Node {
+	child := &Node{Name: name}
+	if value != nil {
+		child.Value = fmt.Sprint(value)
+	}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+//Text 输出缩进文本
+func (n *Node) Text() string {
+	builder := new(strings.Builder)
+	n.writeText(builder, 0)
+	return builder.String()
+}
+
+func (n *Node) writeText(builder *strings.Builder, depth int) {
+	builder.WriteString(strings.Repeat("  ", depth))
+	builder.WriteString(n.Name)
+	if n.Value != "" {
+		builder.WriteString(": ")
+		builder.WriteString(n.Value)
+	}
+	builder.WriteString("\n")
+	for _, child := range n.Children {
+		child.writeText(builder, depth+1)
+	}
+}
+
+//JSON 输出JSON
+func (n *Node) JSON() ([]byte, error) {
+	return json.Marshal(n)
+}
+
+func (c Command) String() string {
+	switch c {
+	case CommandNOP:
+		return "NOP"
+	case CommandListServices:
+		return "ListServices"
+	case CommandListIdentity:
+		return "ListIdentity"
+	case CommandListInterfaces:
+		return "ListInterfaces"
+	case CommandRegisterSession:
+		return "RegisterSession"
+	case CommandUnRegisterSession:
+		return "UnRegisterSession"
+	case CommandSendRRData:
+		return "SendRRData"
+	case CommandSendUnitData:
+		return "SendUnitData"
+	case CommandIndicateStatus:
+		return "IndicateStatus"
+	case CommandCancel:
+		return "Cancel"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(c))
+	}
+}
+
+func (t CPFType) String() string {
+	switch t {
+	case CPFTypeNull:
+		return "Null Address"
+	case CPFTypeListIdentity:
+		return "List Identity"
+	case CPFTypeConnectionBased:
+		return "Connected Address"
+	case CPFTypeConnectedTransportPacket:
+		return "Connected Data"
+	case CPFTypeUnconnectedMessage:
+		return "Unconnected Data"
+	case CPFTypeListServices:
+		return "List Services"
+	case CPFTypeSockInfoO2T:
+		return "Sockaddr O->T"
+	case CPFTypeSockInfoT2O:
+		return "Sockaddr T->O"
+	case CPFTypeSequencedAddrItem:
+		return "Sequenced Address"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(t))
+	}
+}
+
+//ServiceName 服务名称，部分服务码需要结合对象类区分
+func ServiceName(service CIPServType, classID uint32) string {
+	name := ""
+	switch service &^ 0x80 {
+	case ServiceGetAttributeAll:
+		name = "Get Attributes All"
+	case ServiceGetAttributeSingle:
+		name = "Get Attribute Single"
+	case ServiceReset:
+		name = "Reset"
+	case ServiceStart:
+		name = "Start"
+	case ServiceStop:
+		name = "Stop"
+	case ServiceCreate:
+		name = "Create"
+	case ServiceDelete:
+		name = "Delete"
+	case ServiceMultipleServicePacket:
+		name = "Multiple Service Packet"
+	case ServiceApplyAttributes:
+		name = "Apply Attributes"
+	case ServiceSetAttributeSingle:
+		name = "Set Attribute Single"
+	case ServiceFindNext:
+		name = "Find Next"
+	case ServiceReadTag:
+		name = "Read Tag"
+	case ServiceWriteTag:
+		name = "Write Tag"
+	case ServiceReadTagFragmented:
+		if classID == 0x06 {
+			name = "Unconnected Send"
+		} else {
+			name = "Read Tag Fragmented"
+		}
+	case ServiceWriteTagFragmented:
+		name = "Write Tag Fragmented"
+	case ServiceForwardOpen:
+		name = "Forward Open"
+	case ServiceForwardOpenLarge:
+		name = "Large Forward Open"
+	case ServiceForwardClose:
+		if classID == 0x06 {
+			name = "Forward Close"
+		} else {
+			name = "Read Modify Write Tag"
+		}
+	default:
+		name = fmt.Sprintf("0x%02x", uint8(service&^0x80))
+	}
+	if service&0x80 > 0 {
+		return name + " Reply"
+	}
+	return name
+}
+
+//Dissect 将原始数据帧解析为树
+func Dissect(frame []byte) (*Node, error) {
+	if len(frame) < 24 {
+		return nil, errors.New("数据帧长度不足24字节")
+	}
+	header := Header{}
+	header.Command = Command(binary.LittleEndian.Uint16(frame[0:2]))
+	header.Length = binary.LittleEndian.Uint16(frame[2:4])
+	header.SessionId = binary.LittleEndian.Uint32(frame[4:8])
+	header.Status = Status(binary.LittleEndian.Uint32(frame[8:12]))
+	header.ContextId = binary.LittleEndian.Uint64(frame[12:20])
+	header.Options = binary.LittleEndian.Uint32(frame[20:24])
+	root := &Node{Name: "EtherNet/IP", Value: header.Command.String()}
+	head := root.Add("Encapsulation Header", nil)
+	head.Add("Command", fmt.Sprintf("%s (0x%04x)", header.Command, uint16(header.Command)))
+	head.Add("Length", header.Length)
+	head.Add("Session Handle", fmt.Sprintf("0x%08x", header.SessionId))
+	head.Add("Status", ParseStatus(header.Status))
+	head.Add("Sender Context", fmt.Sprintf("0x%016x", header.ContextId))
+	head.Add("Options", header.Options)
+	body := frame[24:]
+	if int(header.Length) < len(body) {
+		body = body[:header.Length]
+	}
+	err := dissectBody(root, header.Command, body)
+	return root, err
+}
+
+func dissectBody(root *Node, cmd Command, body []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("数据解析失败: %v", r)
+		}
+	}()
+	switch cmd {
+	case CommandRegisterSession:
+		if len(body) >= 4 {
+			node := root.Add("Register Session", nil)
+			node.Add("Protocol Version", binary.LittleEndian.Uint16(body[0:2]))
+			node.Add("Option Flags", binary.LittleEndian.Uint16(body[2:4]))
+		}
+	case CommandSendRRData, CommandSendUnitData:
+		if len(body) < 6 {
+			return errors.New("数据长度不足")
+		}
+		node := root.Add(cmd.String(), nil)
+		node.Add("Interface Handle", binary.LittleEndian.Uint32(body[0:4]))
+		node.Add("Timeout", binary.LittleEndian.Uint16(body[4:6]))
+		items := ParserCPF(body[6:])
+		cpf := node.Add("Common Packet Format", fmt.Sprintf("%d items", len(items)))
+		for _, item := range items {
+			dissectCPFItem(cpf, item)
+		}
+	default:
+		if len(body) > 0 {
+			root.Add("Data", hexString(body))
+		}
+	}
+	return nil
+}
+
+func dissectCPFItem(parent *Node, item *CPFItem) {
+	node := parent.Add(item.TypeID.String(), fmt.Sprintf("type 0x%04x, length %d", uint16(item.TypeID), item.Length))
+	switch item.TypeID {
+	case CPFTypeConnectionBased:
+		if len(item.Data) >= 4 {
+			node.Add("Connection ID", fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(item.Data[0:4])))
+		}
+	case CPFTypeSequencedAddrItem:
+		if len(item.Data) >= 8 {
+			node.Add("Connection ID", fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(item.Data[0:4])))
+			node.Add("Sequence", binary.LittleEndian.Uint32(item.Data[4:8]))
+		}
+	case CPFTypeConnectedTransportPacket:
+		if len(item.Data) >= 2 {
+			node.Add("Sequence", binary.LittleEndian.Uint16(item.Data[0:2]))
+			DissectMessage(node, item.Data[2:])
+		}
+	case CPFTypeUnconnectedMessage:
+		DissectMessage(node, item.Data)
+	default:
+		if len(item.Data) > 0 {
+			node.Add("Data", hexString(item.Data))
+		}
+	}
+}
+
+//DissectMessage 解析消息路由请求或应答
+func DissectMessage(parent *Node, data []byte) {
+	if len(data) < 2 {
+		if len(data) > 0 {
+			parent.Add("Data", hexString(data))
+		}
+		return
+	}
+	service := CIPServType(data[0])
+	if service&0x80 > 0 {
+		dissectReply(parent, data)
+	} else {
+		dissectRequest(parent, data)
+	}
+}
+
+func dissectRequest(parent *Node, data []byte) {
+	service := CIPServType(data[0])
+	pathLen := int(data[1]) * 2
+	if len(data) < 2+pathLen {
+		parent.Add("Message Router Request", hexString(data))
+		return
+	}
+	pathBytes := data[2 : 2+pathLen]
+	reqData := data[2+pathLen:]
+	segments, pathErr := epath.Decode(pathBytes, true)
+	classID := uint32(0xffffffff)
+	for _, seg := range segments {
+		if logical, ok := seg.(*epath.LogicalSegment); ok && logical.Kind == epath.LogicalTypeClassID {
+			classID = logical.Value
+			break
+		}
+	}
+	node := parent.Add("Message Router Request", ServiceName(service, classID))
+	node.Add("Service", fmt.Sprintf("%s (0x%02x)", ServiceName(service, classID), uint8(service)))
+	dissectPath(node, "Request Path", pathBytes, segments, pathErr)
+	if len(reqData) == 0 {
+		return
+	}
+	reader := bytes.NewReader(reqData)
+	switch {
+	case service == ServiceUnconnectedSendService && classID == 0x06:
+		dissectUnconnectedSend(node, reqData)
+	case (service == ServiceForwardOpen || service == ServiceForwardOpenLarge) && classID == 0x06:
+		dissectForwardOpen(node, reqData, service == ServiceForwardOpenLarge)
+	case service == ServiceForwardClose && classID == 0x06:
+		dissectForwardClose(node, reqData)
+	case service == ServiceMultipleServicePacket:
+		dissectMultiple(node, reqData, false)
+	case service == ServiceReadTag:
+		var elements uint16
+		binary.Read(reader, binary.LittleEndian, &elements)
+		node.Add("Elements", elements)
+	case service == ServiceReadTagFragmented:
+		var elements uint16
+		var offset uint32
+		binary.Read(reader, binary.LittleEndian, &elements)
+		binary.Read(reader, binary.LittleEndian, &offset)
+		node.Add("Elements", elements)
+		node.Add("Offset", offset)
+	case service == ServiceWriteTag || service == ServiceWriteTagFragmented:
+		dataType := types.DataType(0)
+		binary.Read(reader, binary.LittleEndian, &dataType)
+		node.Add("Data Type", dataType)
+		if dataType == types.STRUCT {
+			var handle uint16
+			binary.Read(reader, binary.LittleEndian, &handle)
+			node.Add("Structure Handle", fmt.Sprintf("0x%04x", handle))
+		}
+		var elements uint16
+		binary.Read(reader, binary.LittleEndian, &elements)
+		node.Add("Elements", elements)
+		if service == ServiceWriteTagFragmented {
+			var offset uint32
+			binary.Read(reader, binary.LittleEndian, &offset)
+			node.Add("Offset", offset)
+		}
+		dissectValues(node, dataType, reader)
+	default:
+		node.Add("Request Data", hexString(reqData))
+	}
+}
+
+func dissectReply(parent *Node, data []byte) {
+	service := CIPServType(data[0])
+	node := parent.Add("Message Router Reply", ServiceName(service, 0xffffffff))
+	if len(data) < 4 {
+		node.Add("Data", hexString(data))
+		return
+	}
+	status := data[2]
+	extSize := int(data[3]) * 2
+	node.Add("Service", fmt.Sprintf("0x%02x", uint8(service)))
+	node.Add("General Status", fmt.Sprintf("0x%02x %s", status, ParseGeneralStatus(status)))
+	pos := 4
+	if extSize > 0 && len(data) >= pos+extSize {
+		node.Add("Additional Status", hexString(data[pos:pos+extSize]))
+		pos += extSize
+	}
+	replyData := data[pos:]
+	if len(replyData) == 0 || (status != 0 && status != 6) {
+		return
+	}
+	switch service &^ 0x80 {
+	case ServiceMultipleServicePacket:
+		dissectMultiple(node, replyData, true)
+	case ServiceReadTag, ServiceReadTagFragmented:
+		reader := bytes.NewReader(replyData)
+		dataType := types.DataType(0)
+		binary.Read(reader, binary.LittleEndian, &dataType)
+		node.Add("Data Type", dataType)
+		dissectValues(node, dataType, reader)
+	case ServiceForwardOpen, ServiceForwardOpenLarge:
+		if len(replyData) >= 26 {
+			node.Add("O->T Connection ID", fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(replyData[0:4])))
+			node.Add("T->O Connection ID", fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(replyData[4:8])))
+			node.Add("Connection Serial", binary.LittleEndian.Uint16(replyData[8:10]))
+			node.Add("Vendor ID", fmt.Sprintf("0x%04x", binary.LittleEndian.Uint16(replyData[10:12])))
+			node.Add("Originator Serial", binary.LittleEndian.Uint32(replyData[12:16]))
+			node.Add("O->T API", binary.LittleEndian.Uint32(replyData[16:20]))
+			node.Add("T->O API", binary.LittleEndian.Uint32(replyData[20:24]))
+		} else {
+			node.Add("Reply Data", hexString(replyData))
+		}
+	default:
+		node.Add("Reply Data", hexString(replyData))
+	}
+}
+
+func dissectPath(parent *Node, name string, pathBytes []byte, segments []epath.Segment, err error) {
+	path := parent.Add(name, fmt.Sprintf("%d words", len(pathBytes)/2))
+	for _, seg := range segments {
+		path.Add(segmentName(seg), seg.String())
+	}
+	if err != nil {
+		path.Add("Error", err.Error())
+		path.Add("Raw", hexString(pathBytes))
+	}
+}
+
+func segmentName(seg epath.Segment) string {
+	switch seg.(type) {
+	case *epath.PortSegment:
+		return "Port Segment"
+	case *epath.LogicalSegment:
+		return "Logical Segment"
+	case *epath.ElectronicKeySegment:
+		return "Electronic Key"
+	case *epath.SymbolicSegment, *epath.NumericSymbolSegment:
+		return "Symbolic Segment"
+	case *epath.DataSegment:
+		return "Data Segment"
+	case *epath.NetworkSegment:
+		return "Network Segment"
+	case *epath.DataTypeSegment:
+		return "Data Type Segment"
+	default:
+		return "Segment"
+	}
+}
+
+func dissectUnconnectedSend(parent *Node, data []byte) {
+	if len(data) < 4 {
+		parent.Add("Request Data", hexString(data))
+		return
+	}
+	parent.Add("Priority/Time Tick", data[0])
+	parent.Add("Timeout Ticks", data[1])
+	msgLen := int(binary.LittleEndian.Uint16(data[2:4]))
+	pos := 4
+	if len(data) < pos+msgLen {
+		parent.Add("Request Data", hexString(data))
+		return
+	}
+	embedded := parent.Add("Embedded Message", fmt.Sprintf("%d bytes", msgLen))
+	DissectMessage(embedded, data[pos:pos+msgLen])
+	pos += msgLen
+	if msgLen%2 == 1 {
+		pos++
+	}
+	if len(data) < pos+2 {
+		return
+	}
+	routeLen := int(data[pos]) * 2
+	pos += 2
+	if len(data) < pos+routeLen {
+		return
+	}
+	route := data[pos : pos+routeLen]
+	segments, err := epath.Decode(route, true)
+	dissectPath(parent, "Route Path", route, segments, err)
+}
+
+func dissectForwardOpen(parent *Node, data []byte, large bool) {
+	reader := bytes.NewReader(data)
+	var priority, timeoutTicks uint8
+	var otID, toID, originatorSerial, multiplier, otRPI, toRPI uint32
+	var serial, vendor uint16
+	binary.Read(reader, binary.LittleEndian, &priority)
+	binary.Read(reader, binary.LittleEndian, &timeoutTicks)
+	binary.Read(reader, binary.LittleEndian, &otID)
+	binary.Read(reader, binary.LittleEndian, &toID)
+	binary.Read(reader, binary.LittleEndian, &serial)
+	binary.Read(reader, binary.LittleEndian, &vendor)
+	binary.Read(reader, binary.LittleEndian, &originatorSerial)
+	binary.Read(reader, binary.LittleEndian, &multiplier)
+	parent.Add("Priority/Time Tick", priority)
+	parent.Add("Timeout Ticks", timeoutTicks)
+	parent.Add("O->T Connection ID", fmt.Sprintf("0x%08x", otID))
+	parent.Add("T->O Connection ID", fmt.Sprintf("0x%08x", toID))
+	parent.Add("Connection Serial", serial)
+	parent.Add("Vendor ID", fmt.Sprintf("0x%04x", vendor))
+	parent.Add("Originator Serial", originatorSerial)
+	parent.Add("Timeout Multiplier", multiplier&0xff)
+	binary.Read(reader, binary.LittleEndian, &otRPI)
+	parent.Add("O->T RPI", otRPI)
+	if large {
+		var params uint32
+		binary.Read(reader, binary.LittleEndian, &params)
+		parent.Add("O->T Parameters", fmt.Sprintf("0x%08x (size %d)", params, params&0xffff))
+	} else {
+		var params uint16
+		binary.Read(reader, binary.LittleEndian, &params)
+		parent.Add("O->T Parameters", fmt.Sprintf("0x%04x (size %d)", params, params&0x1ff))
+	}
+	binary.Read(reader, binary.LittleEndian, &toRPI)
+	parent.Add("T->O RPI", toRPI)
+	if large {
+		var params uint32
+		binary.Read(reader, binary.LittleEndian, &params)
+		parent.Add("T->O Parameters", fmt.Sprintf("0x%08x (size %d)", params, params&0xffff))
+	} else {
+		var params uint16
+		binary.Read(reader, binary.LittleEndian, &params)
+		parent.Add("T->O Parameters", fmt.Sprintf("0x%04x (size %d)", params, params&0x1ff))
+	}
+	var trigger, pathSize uint8
+	binary.Read(reader, binary.LittleEndian, &trigger)
+	binary.Read(reader, binary.LittleEndian, &pathSize)
+	parent.Add("Transport Type/Trigger", fmt.Sprintf("0x%02x", trigger))
+	path := make([]byte, int(pathSize)*2)
+	if n, _ := reader.Read(path); n == len(path) {
+		segments, err := epath.Decode(path, true)
+		dissectPath(parent, "Connection Path", path, segments, err)
+	}
+}
+
+func dissectForwardClose(parent *Node, data []byte) {
+	reader := bytes.NewReader(data)
+	var priority, timeoutTicks, pathSize, reserved uint8
+	var serial, vendor uint16
+	var originatorSerial uint32
+	binary.Read(reader, binary.LittleEndian, &priority)
+	binary.Read(reader, binary.LittleEndian, &timeoutTicks)
+	binary.Read(reader, binary.LittleEndian, &serial)
+	binary.Read(reader, binary.LittleEndian, &vendor)
+	binary.Read(reader, binary.LittleEndian, &originatorSerial)
+	binary.Read(reader, binary.LittleEndian, &pathSize)
+	parent.Add("Priority/Time Tick", priority)
+	parent.Add("Timeout Ticks", timeoutTicks)
+	parent.Add("Connection Serial", serial)
+	parent.Add("Vendor ID", fmt.Sprintf("0x%04x", vendor))
+	parent.Add("Originator Serial", originatorSerial)
+	//标准格式在路径长度后有保留字节
+	if reader.Len() > int(pathSize)*2 {
+		binary.Read(reader, binary.LittleEndian, &reserved)
+	}
+	path := make([]byte, int(pathSize)*2)
+	if n, _ := reader.Read(path); n == len(path) {
+		segments, err := epath.Decode(path, true)
+		dissectPath(parent, "Connection Path", path, segments, err)
+	}
+}
+
+func dissectMultiple(parent *Node, data []byte, reply bool) {
+	if len(data) < 2 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint16(data[0:2]))
+	if len(data) < 2+count*2 {
+		parent.Add("Data", hexString(data))
+		return
+	}
+	parent.Add("Service Count", count)
+	offsets := make([]int, count)
+	for i := 0; i < count; i++ {
+		offsets[i] = int(binary.LittleEndian.Uint16(data[2+i*2:]))
+	}
+	for i, offset := range offsets {
+		end := len(data)
+		if i+1 < count {
+			end = offsets[i+1]
+		}
+		if offset > end || end > len(data) {
+			parent.Add(fmt.Sprintf("Service #%d", i+1), "偏移量错误")
+			continue
+		}
+		node := parent.Add(fmt.Sprintf("Service #%d", i+1), fmt.Sprintf("offset %d", offset))
+		if reply {
+			dissectReply(node, data[offset:end])
+		} else if end-offset >= 2 {
+			dissectRequest(node, data[offset:end])
+		}
+	}
+}
+
+//dissectValues 解析标签数据值
+func dissectValues(parent *Node, dataType types.DataType, reader *bytes.Reader) {
+	if dataType == types.STRUCT {
+		var handle uint16
+		binary.Read(reader, binary.LittleEndian, &handle)
+		parent.Add("Structure Handle", fmt.Sprintf("0x%04x", handle))
+		rest := make([]byte, reader.Len())
+		reader.Read(rest)
+		parent.Add("Data", hexString(rest))
+		return
+	}
+	if types.GetByteCount(dataType) == 0 {
+		rest := make([]byte, reader.Len())
+		reader.Read(rest)
+		parent.Add("Data", hexString(rest))
+		return
+	}
+	values := make([]string, 0)
+	for reader.Len() >= int(types.GetByteCount(dataType)) {
+		value, _, err := types.GetTypeValue(reader, dataType)
+		if err != nil {
+			break
+		}
+		values = append(values, fmt.Sprint(value))
+	}
+	parent.Add("Values", strings.Join(values, ", "))
+	if reader.Len() > 0 {
+		rest := make([]byte, reader.Len())
+		reader.Read(rest)
+		parent.Add("Trailing", hexString(rest))
+	}
+}
+
+func hexString(buf []byte) string {
+	return fmt.Sprintf("% x", buf)
+}
@@ -0,0 +1,52 @@
+package enip
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/wj008/gologix/epath"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/types"
+	"strings"
+	"testing"
+)
+
+func TestDissectUnconnectedRead(t *testing.T) {
+	request := AddReadIOI(BuildTagIOI("P_REAL[3]", types.REAL), 2)
+	pack := BuildUnconnectedSend(epath.PortBuild([]byte{0}, 1, true), request)
+	tree, err := Dissect(pack.Buffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := tree.Text()
+	for _, want := range []string{"SendRRData", "Unconnected Send", "Read Tag", "Symbol(P_REAL)", "Member(3)", "Elements: 2", "Port(1, 0)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("缺少 %q:\n%s", want, text)
+		}
+	}
+	if _, err := tree.JSON(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDissectReadReply(t *testing.T) {
+	reply := new(bytes.Buffer)
+	lib.WriteByte(reply, []byte{0xcc, 0x00, 0x00, 0x00})
+	lib.WriteByte(reply, uint16(types.REAL))
+	lib.WriteByte(reply, []float32{1.5, -2})
+	pack := BuildRRData(reply.Bytes(), 0)
+	tree, err := Dissect(pack.Buffer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := tree.JSON()
+	node := &Node{}
+	if err := json.Unmarshal(out, node); err != nil {
+		t.Fatal(err)
+	}
+	text := node.Text()
+	for _, want := range []string{"Read Tag Reply", "Data Type: REAL", "Values: 1.5, -2"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("缺少 %q:\n%s", want, text)
+		}
+	}
+}
@@ -114,8 +114,11 @@ func BuildUnitData(data []byte, connectionID uint32, sequenceId uint32) *Package
 	return pack
 }
 
-//BuildUnconnectedSend 不连接封包
+//BuildUnconnectedSend 不连接封包，路由路径为空时直接发送到目标的消息路由器
 func BuildUnconnectedSend(path []byte, request []byte) *Package {
+	if len(path) == 0 {
+		return BuildRRData(request, 10)
+	}
 	ucmm := &UnconnectedSend{}
 	//2000ms  2,250
 	ucmm.TimeTick = 2
@@ -289,3 +292,50 @@ func GenerateEncodedTimeout(timeout int) (uint8, uint8) {
 	}
 	return timeTick, ticks
 }
+
+//BuildTypeInfo 写入请求中的数据类型，结构体需附带结构体句柄
+func BuildTypeInfo(dataType types.DataType, handle uint16) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, uint16(dataType))
+	if dataType == types.STRUCT {
+		lib.WriteByte(buffer, handle)
+	}
+	return buffer.Bytes()
+}
+
+//AddWriteIOI 写入字段数据包
+func AddWriteIOI(tagIOI []byte, typeInfo []byte, elements uint16, data []byte) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, uint8(ServiceWriteTag))
+	lib.WriteByte(buffer, uint8(len(tagIOI)/2))
+	buffer.Write(tagIOI)
+	buffer.Write(typeInfo)
+	lib.WriteByte(buffer, elements)
+	buffer.Write(data)
+	return buffer.Bytes()
+}
+
+//AddPartialWriteIOI 分段写入字段数据包
+func AddPartialWriteIOI(tagIOI []byte, typeInfo []byte, elements uint16, offset uint32, data []byte) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, uint8(ServiceWriteTagFragmented))
+	lib.WriteByte(buffer, uint8(len(tagIOI)/2))
+	buffer.Write(tagIOI)
+	buffer.Write(typeInfo)
+	lib.WriteByte(buffer, elements)
+	lib.WriteByte(buffer, offset)
+	buffer.Write(data)
+	return buffer.Bytes()
+}
+
+//AddReadModifyWriteIOI 按位修改字段数据包，OR 掩码置位，AND 掩码清位
+func AddReadModifyWriteIOI(tagIOI []byte, orMask []byte, andMask []byte) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, uint8(ServiceReadModifyWriteTag))
+	lib.WriteByte(buffer, uint8(len(tagIOI)/2))
+	buffer.Write(tagIOI)
+	lib.WriteByte(buffer, uint16(len(orMask)))
+	buffer.Write(orMask)
+	buffer.Write(andMask)
+	return buffer.Bytes()
+}
@@ -38,3 +38,23 @@ func ParserResponse(data []byte, readSeq bool) *Response {
 	}
 	return res
 }
+
+//ParserRawResponse 解析应答，不读取数据类型，用于非标签服务
+func ParserRawResponse(data []byte, readSeq bool) *Response {
+	res := &Response{}
+	reader := bytes.NewReader(data)
+	if readSeq {
+		lib.ReadByte(reader, &res.Sequence)
+	}
+	lib.ReadByte(reader, &res.Service)
+	lib.ReadByte(reader, &res.Reserved)
+	lib.ReadByte(reader, &res.Status)
+	lib.ReadByte(reader, &res.SizeOfAdditionalStatus)
+	if res.SizeOfAdditionalStatus > 0 {
+		res.AdditionalStatus = make([]byte, int(res.SizeOfAdditionalStatus)*2)
+		lib.ReadByte(reader, res.AdditionalStatus)
+	}
+	res.Data = make([]byte, reader.Len())
+	lib.ReadByte(reader, res.Data)
+	return res
+}
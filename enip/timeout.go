@@ -5,6 +5,9 @@ import (
 	"time"
 )
 
+//ErrTimeout 等待应答超时
+var ErrTimeout = errors.New("超时读取数据")
+
 type TimeOut struct {
 	ch      chan *Package
 	timeOut time.Duration
@@ -22,7 +25,7 @@ func (t *TimeOut) Read() (*Package, error) {
 	case pack := <-t.ch:
 		return pack, nil
 	case <-time.After(t.timeOut):
-		return nil, errors.New("超时读取数据")
+		return nil, ErrTimeout
 	}
 }
 
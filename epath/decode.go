@@ -0,0 +1,270 @@
+package epath
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/epath/segment"
+	"unicode/utf16"
+)
+
+//Decode 解析路径 padded 为填充格式
+func Decode(buf []byte, padded bool) (Path, error) {
+	result := make(Path, 0)
+	pos := 0
+	for pos < len(buf) {
+		seg, n, err := decodeSegment(buf[pos:], padded)
+		if err != nil {
+			return result, fmt.Errorf("路径位置 %d 解析失败: %w", pos, err)
+		}
+		result = append(result, seg)
+		pos += n
+	}
+	return result, nil
+}
+
+//decodeSegment 解析单个路径段，返回读取的字节数
+func decodeSegment(buf []byte, padded bool) (Segment, int, error) {
+	first := buf[0]
+	switch SegmentType(first) {
+	case segment.SegmentTypePort:
+		return decodePort(buf, padded)
+	case segment.SegmentTypeLogical:
+		if LogicalType(first&0x1c) == LogicalTypeSpecial {
+			return decodeElectronicKey(buf)
+		}
+		return decodeLogical(buf, padded)
+	case segment.SegmentTypeNetwork:
+		return decodeNetwork(buf)
+	case segment.SegmentTypeSymbolic:
+		return decodeSymbol(buf, padded)
+	case segment.SegmentTypeData:
+		if first == 0x91 {
+			return decodeExtendedSymbol(buf, padded)
+		}
+		return decodeData(buf)
+	case segment.SegmentTypeDataType1:
+		if len(buf) < 2 || len(buf) < 2+int(buf[1]) {
+			return nil, 0, errors.New("数据类型段长度不足")
+		}
+		size := int(buf[1])
+		seg := &DataTypeSegment{Code: first, Data: append([]byte{}, buf[2:2+size]...)}
+		return seg, padLen(2+size, len(buf), padded), nil
+	case segment.SegmentTypeDataType2:
+		return &DataTypeSegment{Code: first}, 1, nil
+	default:
+		return nil, 0, fmt.Errorf("不支持的路径段类型 0x%02x", first)
+	}
+}
+
+//padLen 计算填充后长度
+func padLen(pos int, total int, padded bool) int {
+	if padded && pos%2 == 1 && pos < total {
+		return pos + 1
+	}
+	return pos
+}
+
+func decodePort(buf []byte, padded bool) (Segment, int, error) {
+	first := buf[0]
+	pos := 1
+	linkLen := 1
+	if first&0x10 > 0 {
+		if len(buf) < pos+1 {
+			return nil, 0, errors.New("端口段长度不足")
+		}
+		linkLen = int(buf[pos])
+		pos++
+	}
+	seg := &PortSegment{Port: uint16(first & 0x0f)}
+	if seg.Port == 0x0f {
+		if len(buf) < pos+2 {
+			return nil, 0, errors.New("端口段长度不足")
+		}
+		seg.Port = binary.LittleEndian.Uint16(buf[pos:])
+		pos += 2
+	}
+	if len(buf) < pos+linkLen {
+		return nil, 0, errors.New("端口段长度不足")
+	}
+	seg.Link = append([]byte{}, buf[pos:pos+linkLen]...)
+	pos += linkLen
+	return seg, padLen(pos, len(buf), padded), nil
+}
+
+func decodeLogical(buf []byte, padded bool) (Segment, int, error) {
+	first := buf[0]
+	seg := &LogicalSegment{Kind: LogicalType(first & 0x1c)}
+	pos := 1
+	size := 0
+	switch first & 0x03 {
+	case 0:
+		size = 1
+	case 1:
+		size = 2
+	case 2:
+		size = 4
+	default:
+		return nil, 0, fmt.Errorf("不支持的逻辑段格式 0x%02x", first)
+	}
+	if padded && size > 1 {
+		pos++
+	}
+	if len(buf) < pos+size {
+		return nil, 0, errors.New("逻辑段长度不足")
+	}
+	switch size {
+	case 1:
+		seg.Value = uint32(buf[pos])
+	case 2:
+		seg.Value = uint32(binary.LittleEndian.Uint16(buf[pos:]))
+	case 4:
+		seg.Value = binary.LittleEndian.Uint32(buf[pos:])
+	}
+	pos += size
+	return seg, pos, nil
+}
+
+func decodeElectronicKey(buf []byte) (Segment, int, error) {
+	if len(buf) < 2 {
+		return nil, 0, errors.New("电子钥匙段长度不足")
+	}
+	if buf[1] != 0x04 {
+		return nil, 0, fmt.Errorf("不支持的电子钥匙格式 0x%02x", buf[1])
+	}
+	if len(buf) < 10 {
+		return nil, 0, errors.New("电子钥匙段长度不足")
+	}
+	seg := &ElectronicKeySegment{}
+	seg.VendorID = binary.LittleEndian.Uint16(buf[2:4])
+	seg.DeviceType = binary.LittleEndian.Uint16(buf[4:6])
+	seg.ProductCode = binary.LittleEndian.Uint16(buf[6:8])
+	seg.Compatibility = buf[8]&0x80 > 0
+	seg.MajorRevision = buf[8] & 0x7f
+	seg.MinorRevision = buf[9]
+	return seg, 10, nil
+}
+
+func decodeNetwork(buf []byte) (Segment, int, error) {
+	if len(buf) < 2 {
+		return nil, 0, errors.New("网络段长度不足")
+	}
+	seg := &NetworkSegment{SubType: buf[0] & 0x1f}
+	if seg.SubType&0x10 == 0 {
+		seg.Data = []byte{buf[1]}
+		return seg, 2, nil
+	}
+	size := int(buf[1]) * 2
+	if len(buf) < 2+size {
+		return nil, 0, errors.New("网络段长度不足")
+	}
+	seg.Data = append([]byte{}, buf[2:2+size]...)
+	return seg, 2 + size, nil
+}
+
+func decodeSymbol(buf []byte, padded bool) (Segment, int, error) {
+	size := int(buf[0] & 0x1f)
+	if size == 0 {
+		return decodeSymbolExtendedFormat(buf, padded)
+	}
+	pos := 1
+	if len(buf) < pos+size {
+		return nil, 0, errors.New("符号段长度不足")
+	}
+	seg := &SymbolicSegment{Name: string(buf[pos : pos+size])}
+	pos += size
+	return seg, padLen(pos, len(buf), padded), nil
+}
+
+//decodeSymbolExtendedFormat 解析扩展格式符号段(双字节、三字节字符及数字符号)
+func decodeSymbolExtendedFormat(buf []byte, padded bool) (Segment, int, error) {
+	if len(buf) < 2 {
+		return nil, 0, errors.New("符号段长度不足")
+	}
+	format := buf[1]
+	pos := 2
+	switch format & 0xe0 {
+	case 0x20:
+		count := int(format & 0x1f)
+		if len(buf) < pos+count*2 {
+			return nil, 0, errors.New("符号段长度不足")
+		}
+		chars := make([]uint16, count)
+		for i := 0; i < count; i++ {
+			chars[i] = binary.LittleEndian.Uint16(buf[pos+i*2:])
+		}
+		pos += count * 2
+		return &SymbolicSegment{Name: string(utf16.Decode(chars))}, padLen(pos, len(buf), padded), nil
+	case 0x40:
+		count := int(format & 0x1f)
+		if len(buf) < pos+count*3 {
+			return nil, 0, errors.New("符号段长度不足")
+		}
+		runes := make([]rune, count)
+		for i := 0; i < count; i++ {
+			b := buf[pos+i*3:]
+			runes[i] = rune(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16)
+		}
+		pos += count * 3
+		return &SymbolicSegment{Name: string(runes)}, padLen(pos, len(buf), padded), nil
+	case 0xc0:
+		seg := &NumericSymbolSegment{}
+		switch format {
+		case 0xc6:
+			if len(buf) < pos+1 {
+				return nil, 0, errors.New("符号段长度不足")
+			}
+			seg.Value = uint32(buf[pos])
+			pos++
+		case 0xc7:
+			if len(buf) < pos+2 {
+				return nil, 0, errors.New("符号段长度不足")
+			}
+			seg.Value = uint32(binary.LittleEndian.Uint16(buf[pos:]))
+			pos += 2
+		case 0xc8:
+			if len(buf) < pos+4 {
+				return nil, 0, errors.New("符号段长度不足")
+			}
+			seg.Value = binary.LittleEndian.Uint32(buf[pos:])
+			pos += 4
+		default:
+			return nil, 0, fmt.Errorf("不支持的数字符号格式 0x%02x", format)
+		}
+		return seg, padLen(pos, len(buf), padded), nil
+	default:
+		return nil, 0, fmt.Errorf("不支持的符号段格式 0x%02x", format)
+	}
+}
+
+func decodeExtendedSymbol(buf []byte, padded bool) (Segment, int, error) {
+	if len(buf) < 2 {
+		return nil, 0, errors.New("符号段长度不足")
+	}
+	size := int(buf[1])
+	pos := 2
+	if len(buf) < pos+size {
+		return nil, 0, errors.New("符号段长度不足")
+	}
+	seg := &SymbolicSegment{Name: string(buf[pos : pos+size]), Extended: true}
+	pos += size
+	return seg, padLen(pos, len(buf), padded), nil
+}
+
+func decodeData(buf []byte) (Segment, int, error) {
+	if buf[0] != uint8(segment.SegmentTypeData) {
+		return nil, 0, fmt.Errorf("不支持的数据段类型 0x%02x", buf[0])
+	}
+	if len(buf) < 2 {
+		return nil, 0, errors.New("数据段长度不足")
+	}
+	count := int(buf[1])
+	if len(buf) < 2+count*2 {
+		return nil, 0, errors.New("数据段长度不足")
+	}
+	seg := &DataSegment{Data: make([]uint16, count)}
+	for i := 0; i < count; i++ {
+		seg.Data[i] = binary.LittleEndian.Uint16(buf[2+i*2:])
+	}
+	return seg, 2 + count*2, nil
+}
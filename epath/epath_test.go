@@ -0,0 +1,60 @@
+package epath
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	path, err := ParseRoute("1,0,2,192.168.1.20,1,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x01, 0x00,
+		0x12, 0x0c, '1', '9', '2', '.', '1', '6', '8', '.', '1', '.', '2', '0',
+		0x01, 0x03,
+	}
+	if got := path.Bytes(true); !bytes.Equal(got, want) {
+		t.Fatalf("编码错误\n got % x\nwant % x", got, want)
+	}
+	if route := path.Route(); route != "1,0,2,192.168.1.20,1,3" {
+		t.Fatalf("路由字符串错误 %s", route)
+	}
+	for _, bad := range []string{"1", "0,1", "1,300", "x,1"} {
+		if _, err := ParseRoute(bad); err == nil {
+			t.Errorf("路由 %q 应该解析失败", bad)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := Path{
+		&PortSegment{Port: 18, Link: []byte("10.0.0.1")},
+		&LogicalSegment{Kind: LogicalTypeClassID, Value: 0x6b},
+		&LogicalSegment{Kind: LogicalTypeInstanceID, Value: 0x1234},
+		&LogicalSegment{Kind: LogicalTypeAttributeID, Value: 0x12345678},
+		&ElectronicKeySegment{VendorID: 1, DeviceType: 14, ProductCode: 166, MajorRevision: 32, MinorRevision: 11, Compatibility: true},
+		&SymbolicSegment{Name: "Program:MainProgram", Extended: true},
+		&SymbolicSegment{Name: "abc"},
+		&NumericSymbolSegment{Value: 300},
+		&DataSegment{Data: []uint16{1, 2}},
+		&NetworkSegment{SubType: NetworkSchedule, Data: []byte{5}},
+		&NetworkSegment{SubType: NetworkSafety, Data: []byte{1, 2, 3, 4}},
+		&DataTypeSegment{Code: 0xc4},
+	}
+	buf := path.Bytes(true)
+	decoded, err := Decode(buf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(path) {
+		t.Fatalf("段数量错误 %d != %d: %s", len(decoded), len(path), decoded)
+	}
+	if decoded.String() != path.String() {
+		t.Fatalf("解码结果不一致\n got %s\nwant %s", decoded, path)
+	}
+	if !bytes.Equal(decoded.Bytes(true), buf) {
+		t.Fatal("重新编码结果不一致")
+	}
+}
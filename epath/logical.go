@@ -30,7 +30,7 @@ func LogicalBuild(tp LogicalType, address uint32, padded bool) []byte {
 	buffer := new(bytes.Buffer)
 	firstByte := uint8(segment.SegmentTypeLogical) | uint8(tp) | format
 	lib.WriteByte(buffer, firstByte)
-	if address > 255 && address <= 65535 && padded {
+	if address > 255 && padded {
 		lib.WriteByte(buffer, uint8(0))
 	}
 	if address <= 255 {
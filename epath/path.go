@@ -0,0 +1,283 @@
+package epath
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/wj008/gologix/epath/segment"
+	"github.com/wj008/gologix/lib"
+	"net"
+	"strconv"
+	"strings"
+)
+
+//Segment 路径段
+type Segment interface {
+	Bytes(padded bool) []byte
+	String() string
+}
+
+//Path 完整路径
+type Path []Segment
+
+//PortSegment 端口段
+type PortSegment struct {
+	Port uint16
+	Link []byte
+}
+
+//LogicalSegment 逻辑段
+type LogicalSegment struct {
+	Kind  LogicalType
+	Value uint32
+}
+
+//ElectronicKeySegment 电子钥匙段
+type ElectronicKeySegment struct {
+	VendorID      uint16
+	DeviceType    uint16
+	ProductCode   uint16
+	Compatibility bool
+	MajorRevision uint8
+	MinorRevision uint8
+}
+
+//SymbolicSegment 符号段 Extended 为 ANSI 扩展符号(0x91)
+type SymbolicSegment struct {
+	Name     string
+	Extended bool
+}
+
+//NumericSymbolSegment 数字符号段
+type NumericSymbolSegment struct {
+	Value uint32
+}
+
+//DataSegment 简单数据段
+type DataSegment struct {
+	Data []uint16
+}
+
+//NetworkSegment 网络段 SubType 为完整的段首字节低5位
+type NetworkSegment struct {
+	SubType uint8
+	Data    []byte
+}
+
+//DataTypeSegment 数据类型段 Code 为段首字节，构造类型附带原始数据
+type DataTypeSegment struct {
+	Code uint8
+	Data []byte
+}
+
+const (
+	NetworkSchedule          uint8 = 0x01
+	NetworkFixedTag          uint8 = 0x02
+	NetworkProductionInhibit uint8 = 0x03
+	NetworkSafety            uint8 = 0x10
+	NetworkExtended          uint8 = 0x1f
+)
+
+//Bytes 路径编码
+func (p Path) Bytes(padded bool) []byte {
+	buffer := new(bytes.Buffer)
+	for _, seg := range p {
+		buffer.Write(seg.Bytes(padded))
+	}
+	return buffer.Bytes()
+}
+
+func (p Path) String() string {
+	temp := make([]string, 0, len(p))
+	for _, seg := range p {
+		temp = append(temp, seg.String())
+	}
+	return strings.Join(temp, " ")
+}
+
+//Route 输出 RSLinx 风格的路由字符串，非端口段会被忽略
+func (p Path) Route() string {
+	temp := make([]string, 0)
+	for _, seg := range p {
+		port, ok := seg.(*PortSegment)
+		if !ok {
+			continue
+		}
+		temp = append(temp, strconv.Itoa(int(port.Port)))
+		if len(port.Link) == 1 {
+			temp = append(temp, strconv.Itoa(int(port.Link[0])))
+		} else {
+			temp = append(temp, string(port.Link))
+		}
+	}
+	return strings.Join(temp, ",")
+}
+
+func (s *PortSegment) Bytes(padded bool) []byte {
+	return PortBuild(s.Link, s.Port, padded)
+}
+
+func (s *PortSegment) String() string {
+	if len(s.Link) == 1 {
+		return fmt.Sprintf("Port(%d, %d)", s.Port, s.Link[0])
+	}
+	if ip := net.ParseIP(string(s.Link)); ip != nil {
+		return fmt.Sprintf("Port(%d, %s)", s.Port, string(s.Link))
+	}
+	return fmt.Sprintf("Port(%d, % x)", s.Port, s.Link)
+}
+
+func (s *LogicalSegment) Bytes(padded bool) []byte {
+	return LogicalBuild(s.Kind, s.Value, padded)
+}
+
+func (s *LogicalSegment) String() string {
+	return fmt.Sprintf("%s(%d)", s.Kind, s.Value)
+}
+
+func (s *ElectronicKeySegment) Bytes(padded bool) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, uint8(segment.SegmentTypeLogical)|uint8(LogicalTypeSpecial))
+	lib.WriteByte(buffer, uint8(0x04))
+	lib.WriteByte(buffer, s.VendorID)
+	lib.WriteByte(buffer, s.DeviceType)
+	lib.WriteByte(buffer, s.ProductCode)
+	major := s.MajorRevision & 0x7f
+	if s.Compatibility {
+		major |= 0x80
+	}
+	lib.WriteByte(buffer, major)
+	lib.WriteByte(buffer, s.MinorRevision)
+	return buffer.Bytes()
+}
+
+func (s *ElectronicKeySegment) String() string {
+	return fmt.Sprintf("Key(vendor %d, type %d, product %d, rev %d.%d, compat %t)",
+		s.VendorID, s.DeviceType, s.ProductCode, s.MajorRevision, s.MinorRevision, s.Compatibility)
+}
+
+func (s *SymbolicSegment) Bytes(padded bool) []byte {
+	buffer := new(bytes.Buffer)
+	name := []byte(s.Name)
+	if s.Extended {
+		lib.WriteByte(buffer, uint8(0x91))
+		lib.WriteByte(buffer, uint8(len(name)))
+	} else {
+		lib.WriteByte(buffer, uint8(segment.SegmentTypeSymbolic)|uint8(len(name)&0x1f))
+	}
+	buffer.Write(name)
+	if padded && buffer.Len()%2 == 1 {
+		lib.WriteByte(buffer, uint8(0))
+	}
+	return buffer.Bytes()
+}
+
+func (s *SymbolicSegment) String() string {
+	return fmt.Sprintf("Symbol(%s)", s.Name)
+}
+
+func (s *NumericSymbolSegment) Bytes(padded bool) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, uint8(segment.SegmentTypeSymbolic))
+	if s.Value <= 255 {
+		lib.WriteByte(buffer, uint8(0xc6))
+		lib.WriteByte(buffer, uint8(s.Value))
+	} else if s.Value <= 65535 {
+		lib.WriteByte(buffer, uint8(0xc7))
+		lib.WriteByte(buffer, uint16(s.Value))
+	} else {
+		lib.WriteByte(buffer, uint8(0xc8))
+		lib.WriteByte(buffer, s.Value)
+	}
+	if padded && buffer.Len()%2 == 1 {
+		lib.WriteByte(buffer, uint8(0))
+	}
+	return buffer.Bytes()
+}
+
+func (s *NumericSymbolSegment) String() string {
+	return fmt.Sprintf("Symbol(#%d)", s.Value)
+}
+
+func (s *DataSegment) Bytes(padded bool) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, uint8(segment.SegmentTypeData))
+	lib.WriteByte(buffer, uint8(len(s.Data)))
+	for _, word := range s.Data {
+		lib.WriteByte(buffer, word)
+	}
+	return buffer.Bytes()
+}
+
+func (s *DataSegment) String() string {
+	return fmt.Sprintf("Data(%v)", s.Data)
+}
+
+func (s *NetworkSegment) Bytes(padded bool) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, uint8(segment.SegmentTypeNetwork)|(s.SubType&0x1f))
+	if s.SubType&0x10 == 0 {
+		data := uint8(0)
+		if len(s.Data) > 0 {
+			data = s.Data[0]
+		}
+		lib.WriteByte(buffer, data)
+		return buffer.Bytes()
+	}
+	data := s.Data
+	if len(data)%2 == 1 {
+		data = append(append([]byte{}, data...), 0)
+	}
+	lib.WriteByte(buffer, uint8(len(data)/2))
+	buffer.Write(data)
+	return buffer.Bytes()
+}
+
+func (s *NetworkSegment) String() string {
+	return fmt.Sprintf("Network(0x%02x, % x)", s.SubType, s.Data)
+}
+
+func (s *DataTypeSegment) Bytes(padded bool) []byte {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, s.Code)
+	if SegmentType(s.Code) == segment.SegmentTypeDataType1 {
+		lib.WriteByte(buffer, uint8(len(s.Data)))
+		buffer.Write(s.Data)
+		if padded && buffer.Len()%2 == 1 {
+			lib.WriteByte(buffer, uint8(0))
+		}
+	}
+	return buffer.Bytes()
+}
+
+func (s *DataTypeSegment) String() string {
+	if len(s.Data) > 0 {
+		return fmt.Sprintf("DataType(0x%02x, % x)", s.Code, s.Data)
+	}
+	return fmt.Sprintf("DataType(0x%02x)", s.Code)
+}
+
+//SegmentType 取段首字节的段类型
+func SegmentType(first uint8) segment.SegmentType {
+	return segment.SegmentType(first & 0xe0)
+}
+
+func (t LogicalType) String() string {
+	switch t {
+	case LogicalTypeClassID:
+		return "Class"
+	case LogicalTypeInstanceID:
+		return "Instance"
+	case LogicalTypeMemberID:
+		return "Member"
+	case LogicalTypeConnPoint:
+		return "ConnPoint"
+	case LogicalTypeAttributeID:
+		return "Attribute"
+	case LogicalTypeSpecial:
+		return "Special"
+	case LogicalTypeServiceID:
+		return "Service"
+	default:
+		return fmt.Sprintf("Logical%d", uint8(t)>>2)
+	}
+}
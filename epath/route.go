@@ -0,0 +1,50 @@
+package epath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//ParseRoute 解析 RSLinx 风格的路由字符串，例如 "1,0,2,192.168.1.20,1,3"
+//每两项为一组(端口, 地址)，地址可以是槽号/节点号或 IP 地址
+func ParseRoute(route string) (Path, error) {
+	route = strings.TrimSpace(route)
+	if route == "" {
+		return Path{}, nil
+	}
+	items := strings.FieldsFunc(route, func(r rune) bool {
+		return r == ',' || r == '/'
+	})
+	if len(items)%2 != 0 {
+		return nil, fmt.Errorf("路由 %q 必须由端口和地址成对组成", route)
+	}
+	path := make(Path, 0, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		portStr := strings.TrimSpace(items[i])
+		linkStr := strings.TrimSpace(items[i+1])
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil || port == 0 {
+			return nil, fmt.Errorf("路由 %q 中端口 %q 不正确", route, portStr)
+		}
+		seg := &PortSegment{Port: uint16(port)}
+		if link, err := strconv.ParseUint(linkStr, 10, 8); err == nil {
+			seg.Link = []byte{uint8(link)}
+		} else if linkStr != "" && strings.Trim(linkStr, "0123456789") != "" && !strings.ContainsAny(linkStr, " \t") {
+			seg.Link = []byte(linkStr)
+		} else {
+			return nil, fmt.Errorf("路由 %q 中地址 %q 不正确", route, linkStr)
+		}
+		path = append(path, seg)
+	}
+	return path, nil
+}
+
+//MustParseRoute 解析路由字符串，出错时 panic
+func MustParseRoute(route string) Path {
+	path, err := ParseRoute(route)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
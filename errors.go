@@ -1,101 +1,119 @@
 package gologix
 
-import "strconv"
+import (
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/types"
+)
 
 //GetErrorCode 解析数据错误
 func GetErrorCode(status uint8) string {
-	switch status {
-	case 0:
-		return "Success"
-	case 1:
-		return "Connection failure"
-	case 2:
-		return "Resource unavailable"
-	case 3:
-		return "Invalid parameter value"
-	case 4:
-		return "Path segment error"
-	case 5:
-		return "Path destination unknown"
-	case 6:
-		return "Partial transfer"
-	case 7:
-		return "Connection lost"
-	case 8:
-		return "Service not supported"
-	case 9:
-		return "Invalid Attribute"
-	case 10:
-		return "Attribute list error"
-	case 11:
-		return "Already in requested mode/state"
-	case 12:
-		return "Object state conflict"
-	case 13:
-		return "Object already exists"
-	case 14:
-		return "Attribute not settable"
-	case 15:
-		return "Privilege violation"
-	case 16:
-		return "Device state conflict"
-	case 17:
-		return "Reply data too large"
-	case 18:
-		return "Fragmentation of a premitive value"
-	case 19:
-		return "Not enough data received"
-	case 20:
-		return "Attribute not supported"
-	case 21:
-		return "Too much data"
-	case 22:
-		return "Object does not exist"
-	case 23:
-		return "Service fragmentation sequence not in progress"
-	case 24:
-		return "No stored attribute data"
-	case 25:
-		return "Store operation failure"
-	case 26:
-		return "Routing failure, request packet too large"
-	case 27:
-		return "Routing failure, response packet too large"
-	case 28:
-		return "Missing attribute list entry data"
-	case 29:
-		return "Invalid attribute value list"
-	case 30:
-		return "Embedded service error"
-	case 31:
-		return "Vendor specific"
-	case 32:
-		return "Invalid Parameter"
-	case 33:
-		return "Write once value or medium already written"
-	case 34:
-		return "Invalid reply received"
-	case 35:
-		return "Buffer overflow"
-	case 36:
-		return "Invalid message format"
-	case 37:
-		return "Key failure in path"
-	case 38:
-		return "Path size invalid"
-	case 39:
-		return "Unexpected attribute in list"
-	case 40:
-		return "Invalid member ID"
-	case 41:
-		return "Member not settable"
-	case 42:
-		return "Group 2 only server general failure"
-	case 43:
-		return "Unknown Modbus error"
-	case 44:
-		return "Attribute not gettable"
+	return enip.ParseGeneralStatus(status)
+}
+
+//TagErrorKind 标签错误类别
+type TagErrorKind uint8
+
+const (
+	TagErrorStatus         TagErrorKind = iota //设备返回错误状态
+	TagErrorExtendedStatus                     //设备返回扩展状态
+	TagErrorShortReply                         //应答数据不完整
+	TagErrorDecode                             //数据解析失败
+)
+
+func (k TagErrorKind) String() string {
+	switch k {
+	case TagErrorStatus:
+		return "状态错误"
+	case TagErrorExtendedStatus:
+		return "扩展状态错误"
+	case TagErrorShortReply:
+		return "应答数据不完整"
+	case TagErrorDecode:
+		return "数据解析失败"
 	default:
-		return "Unknown error " + strconv.Itoa(int(status))
+		return "未知错误"
 	}
 }
+
+//TagError 单个标签的读取错误
+type TagError struct {
+	Tag    string
+	Kind   TagErrorKind
+	Status uint8
+	Err    error
+}
+
+func (e *TagError) Error() string {
+	switch {
+	case e.Kind == TagErrorStatus:
+		return fmt.Sprintf("%s: %s (0x%02x %s)", e.Tag, e.Kind, e.Status, GetErrorCode(e.Status))
+	case e.Err != nil:
+		return fmt.Sprintf("%s: %s: %v", e.Tag, e.Kind, e.Err)
+	default:
+		return fmt.Sprintf("%s: %s", e.Tag, e.Kind)
+	}
+}
+
+func (e *TagError) Unwrap() error {
+	return e.Err
+}
+
+//ErrorClass 错误类别，各接口据此映射为自己的状态码
+type ErrorClass uint8
+
+const (
+	ErrorOther       ErrorClass = iota //其它错误，如设备或链接错误
+	ErrorNotFound                      //标签不存在
+	ErrorForbidden                     //权限不足或标签不能写入
+	ErrorUnsupported                   //设备不支持该服务
+	ErrorInvalid                       //参数、数据类型或数据长度错误
+	ErrorOutOfRange                    //数值超出类型范围或丢失精度
+	ErrorConflict                      //设备状态冲突，如控制器处于编程模式
+)
+
+//ClassifyError 按 TagError 的 CIP 状态与编码、转换错误分类，链接错误归为 ErrorOther
+func ClassifyError(err error) ErrorClass {
+	var tagErr *TagError
+	var encodeErr *types.EncodeError
+	var conversionErr *ConversionError
+	switch {
+	case err == nil:
+		return ErrorOther
+	case errors.Is(err, ErrNotWritable):
+		return ErrorForbidden
+	case errors.Is(err, types.ErrOutOfRange), errors.Is(err, types.ErrPrecisionLoss):
+		return ErrorOutOfRange
+	case errors.Is(err, types.ErrTypeMismatch), errors.As(err, &encodeErr), errors.As(err, &conversionErr):
+		return ErrorInvalid
+	case errors.As(err, &tagErr) && tagErr.Kind == TagErrorStatus:
+		switch tagErr.Status {
+		case 0x04, 0x05:
+			//路径错误，标签不存在
+			return ErrorNotFound
+		case 0x0f:
+			//权限不足
+			return ErrorForbidden
+		case 0x08:
+			return ErrorUnsupported
+		case 0x03, 0x13, 0x15, 0x20, 0x26:
+			//参数、数据长度或路径长度错误
+			return ErrorInvalid
+		case 0x10:
+			return ErrorConflict
+		}
+	}
+	return ErrorOther
+}
+
+//ConversionError 数值类型转换错误
+type ConversionError struct {
+	DType types.DataType
+	Value interface{}
+	To    string
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("%s 类型的值 %v 无法转换为 %s", e.DType, e.Value, e.To)
+}
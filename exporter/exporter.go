@@ -0,0 +1,346 @@
+//Package exporter 以 Prometheus 文本格式导出 PLC 标签数值与链接健康指标
+//
+//标签数值在每次抓取时通过一次 MultiReadTags 读取；请求耗时与超时通过 PLC.OnRequest 统计；
+//控制器故障标志在每次抓取时通过 ReadAttributeAll 刷新，读取失败时不输出。
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/pool"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Config 导出器配置文件
+type Config struct {
+	Listen string              `json:"listen"` //监听地址 默认 :9108
+	PLCs   []*pool.Endpoint    `json:"plcs"`
+	Tags   map[string][]string `json:"tags"` //PLC 名称对应导出的标签，只导出数值与布尔标签
+}
+
+//DefaultBuckets 请求耗时直方图的默认区间(秒)
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//histogram 累计直方图
+type histogram struct {
+	counts []uint64 //与 buckets 对应，不含 +Inf
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, value float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	for i, bound := range buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+//requestKey 按 PLC 与服务统计
+type requestKey struct {
+	plc     string
+	service string
+}
+
+//Exporter 实现 http.Handler，输出所有 PLC 的指标
+type Exporter struct {
+	manager  *pool.Manager
+	tags     map[string][]string
+	mutex    sync.Mutex
+	latency  map[requestKey]*histogram
+	timeouts map[requestKey]uint64
+	//Buckets 请求耗时直方图区间，创建后不应修改
+	Buckets []float64
+}
+
+//New 创建导出器并为每个 PLC 设置请求统计回调，tags 为 PLC 名称对应的标签
+func New(manager *pool.Manager, tags map[string][]string) (*Exporter, error) {
+	e := &Exporter{
+		manager:  manager,
+		tags:     tags,
+		latency:  make(map[requestKey]*histogram),
+		timeouts: make(map[requestKey]uint64),
+		Buckets:  DefaultBuckets,
+	}
+	for name := range tags {
+		if _, err := manager.Client(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range manager.Names() {
+		client, _ := manager.Client(name)
+		name := name
+		client.OnConnect = func(plc *gologix.PLC) {
+			plc.OnRequest = func(service string, elapsed time.Duration, err error) {
+				e.observe(name, service, elapsed, err)
+			}
+		}
+	}
+	return e, nil
+}
+
+//observe 记录一次请求，超时单独计数
+func (e *Exporter) observe(name string, service string, elapsed time.Duration, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	key := requestKey{plc: name, service: service}
+	if errors.Is(err, enip.ErrTimeout) {
+		e.timeouts[key]++
+		return
+	}
+	h, ok := e.latency[key]
+	if !ok {
+		h = &histogram{}
+		e.latency[key] = h
+	}
+	h.observe(e.Buckets, elapsed.Seconds())
+}
+
+//sample 单个样本
+type sample struct {
+	labels string
+	value  float64
+}
+
+//family 同名指标
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+func (f *family) add(value float64, labels ...string) {
+	f.samples = append(f.samples, sample{labels: formatLabels(labels), value: value})
+}
+
+//formatLabels 按 name, value 成对格式化标签
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	items := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		items = append(items, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(items, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//plcState 单个 PLC 的抓取结果
+type plcState struct {
+	name           string
+	up             bool
+	identified     bool //设备信息读取成功，只有此时输出状态字与故障标志
+	status         pool.Status
+	connectionSize uint16
+	info           gologix.PLCInfo
+	values         map[string]float64
+	errors         map[string]bool
+}
+
+//scrape 读取 PLC 的设备信息与标签，设备信息读取失败时仍读取标签
+func (e *Exporter) scrape(name string) *plcState {
+	state := &plcState{name: name, values: make(map[string]float64), errors: make(map[string]bool)}
+	tags := e.tags[name]
+	requests := make([]gologix.ReadRequest, 0, len(tags))
+	for _, tag := range tags {
+		requests = append(requests, gologix.ReadRequest{Tag: tag, Elements: 1})
+	}
+	err := e.manager.Do(name, func(plc *gologix.PLC) error {
+		if err := plc.ReadAttributeAll(); err != nil {
+			if !plc.Connected() {
+				return err
+			}
+		} else {
+			state.identified = true
+			state.info = *plc.Info
+		}
+		state.connectionSize = plc.ConnectionSize
+		if len(requests) == 0 {
+			return nil
+		}
+		results, err := plc.MultiReadTags(requests)
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			values, err := results[tag].Elements(1)
+			var number float64
+			if err == nil {
+				number, err = values[0].Float()
+			}
+			if err != nil {
+				state.errors[tag] = true
+				continue
+			}
+			state.values[tag] = number
+		}
+		return nil
+	})
+	state.up = err == nil
+	client, _ := e.manager.Client(name)
+	state.status = client.Status()
+	return state
+}
+
+//Collect 抓取所有 PLC 并按 Prometheus 文本格式输出
+func (e *Exporter) Collect() []byte {
+	names := e.manager.Names()
+	states := make([]*plcState, len(names))
+	var wait sync.WaitGroup
+	for i, name := range names {
+		wait.Add(1)
+		go func(i int, name string) {
+			defer wait.Done()
+			states[i] = e.scrape(name)
+		}(i, name)
+	}
+	wait.Wait()
+
+	up := &family{name: "gologix_up", help: "PLC 是否可以链接", kind: "gauge"}
+	tagValue := &family{name: "gologix_tag_value", help: "标签数值，布尔值为 0/1", kind: "gauge"}
+	tagUp := &family{name: "gologix_tag_up", help: "标签是否读取成功", kind: "gauge"}
+	reconnects := &family{name: "gologix_reconnects_total", help: "重新链接成功的次数", kind: "counter"}
+	connectionSize := &family{name: "gologix_connection_size_bytes", help: "ForwardOpen 协商的链接大小", kind: "gauge"}
+	status := &family{name: "gologix_controller_status", help: "控制器状态字", kind: "gauge"}
+	fault := &family{name: "gologix_controller_fault", help: "控制器故障标志", kind: "gauge"}
+	for _, state := range states {
+		up.add(boolValue(state.up), "plc", state.name)
+		reconnects.add(float64(state.status.Reconnects), "plc", state.name)
+		for _, tag := range e.tags[state.name] {
+			if value, ok := state.values[tag]; ok {
+				tagValue.add(value, "plc", state.name, "tag", tag)
+			}
+			tagUp.add(boolValue(state.up && !state.errors[tag]), "plc", state.name, "tag", tag)
+		}
+		if !state.up {
+			continue
+		}
+		connectionSize.add(float64(state.connectionSize), "plc", state.name)
+		if !state.identified {
+			continue
+		}
+		status.add(float64(state.info.Status), "plc", state.name)
+		flags := []struct {
+			name  string
+			value bool
+		}{
+			{"faulted", state.info.Faulted},
+			{"minor_recoverable", state.info.MinorRecoverableFault},
+			{"minor_unrecoverable", state.info.MinorUnrecoverableFault},
+			{"major_recoverable", state.info.MajorRecoverableFault},
+			{"major_unrecoverable", state.info.MajorUnrecoverableFault},
+			{"io_faulted", state.info.IoFaulted},
+		}
+		for _, flag := range flags {
+			fault.add(boolValue(flag.value), "plc", state.name, "flag", flag.name)
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	for _, f := range []*family{up, tagValue, tagUp, reconnects, connectionSize, status, fault} {
+		writeFamily(buffer, f)
+	}
+	e.writeRequests(buffer)
+	return buffer.Bytes()
+}
+
+//writeRequests 输出请求耗时直方图与超时计数
+func (e *Exporter) writeRequests(buffer *bytes.Buffer) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	timeouts := &family{name: "gologix_request_timeouts_total", help: "等待应答超时的请求数", kind: "counter"}
+	for _, key := range sortedKeys(e.timeouts) {
+		timeouts.add(float64(e.timeouts[key]), "plc", key.plc, "service", key.service)
+	}
+	writeFamily(buffer, timeouts)
+	const name = "gologix_request_duration_seconds"
+	fmt.Fprintf(buffer, "# HELP %s 请求耗时\n# TYPE %s histogram\n", name, name)
+	keys := make([]requestKey, 0, len(e.latency))
+	for key := range e.latency {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	for _, key := range keys {
+		h := e.latency[key]
+		for i, bound := range e.Buckets {
+			labels := formatLabels([]string{"plc", key.plc, "service", key.service, "le", formatValue(bound)})
+			fmt.Fprintf(buffer, "%s_bucket%s %d\n", name, labels, h.counts[i])
+		}
+		labels := []string{"plc", key.plc, "service", key.service}
+		fmt.Fprintf(buffer, "%s_bucket%s %d\n", name, formatLabels(append(labels, "le", "+Inf")), h.count)
+		fmt.Fprintf(buffer, "%s_sum%s %s\n", name, formatLabels(labels), formatValue(h.sum))
+		fmt.Fprintf(buffer, "%s_count%s %d\n", name, formatLabels(labels), h.count)
+	}
+}
+
+func sortedKeys(m map[requestKey]uint64) []requestKey {
+	keys := make([]requestKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+	return keys
+}
+
+func sortKeys(keys []requestKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].plc != keys[j].plc {
+			return keys[i].plc < keys[j].plc
+		}
+		return keys[i].service < keys[j].service
+	})
+}
+
+func writeFamily(buffer *bytes.Buffer, f *family) {
+	fmt.Fprintf(buffer, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, s := range f.samples {
+		fmt.Fprintf(buffer, "%s%s %s\n", f.name, s.labels, formatValue(s.value))
+	}
+}
+
+//ServeHTTP 输出指标
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(e.Collect())
+}
@@ -0,0 +1,99 @@
+package exporter
+
+import (
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/types"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExporter(t *testing.T) {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.AddTag("Speed", types.REAL, []float32{12.5})
+	sim.AddTag("Running", types.BOOL, []bool{true})
+	manager, err := pool.NewManager([]*pool.Endpoint{
+		{Name: "line1", Address: sim.Addr()},
+		{Name: "line2", Address: "127.0.0.1:1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	if _, err = New(manager, map[string][]string{"line9": {"A"}}); err == nil {
+		t.Fatal("未配置的 PLC 应返回错误")
+	}
+	exporter, err := New(manager, map[string][]string{"line1": {"Speed", "Running", "Missing"}, "line2": {"Speed"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(exporter)
+	defer server.Close()
+	text := scrape(t, server)
+	for _, line := range []string{
+		`gologix_up{plc="line1"} 1`,
+		`gologix_up{plc="line2"} 0`,
+		`gologix_tag_value{plc="line1",tag="Speed"} 12.5`,
+		`gologix_tag_value{plc="line1",tag="Running"} 1`,
+		`gologix_tag_up{plc="line1",tag="Missing"} 0`,
+		`gologix_tag_up{plc="line2",tag="Speed"} 0`,
+		`gologix_controller_fault{plc="line1",flag="major_recoverable"} 0`,
+		`# TYPE gologix_request_duration_seconds histogram`,
+		`gologix_request_duration_seconds_bucket{plc="line1",service="multiple_service_packet",le="+Inf"}`,
+		`gologix_reconnects_total{plc="line1"} 0`,
+	} {
+		if !strings.Contains(text, line+"\n") && !strings.Contains(text, line+" ") {
+			t.Fatalf("缺少 %s\n%s", line, text)
+		}
+	}
+	if strings.Contains(text, `gologix_tag_value{plc="line1",tag="Missing"}`) {
+		t.Fatal("读取失败的标签不应输出数值")
+	}
+	if !strings.Contains(text, `gologix_connection_size_bytes{plc="line1"} `) {
+		t.Fatalf("缺少链接大小\n%s", text)
+	}
+	//设备信息读取失败时仍输出标签，但不输出故障标志
+	sim.FailIdentity(0x08)
+	text = scrape(t, server)
+	for _, line := range []string{
+		`gologix_up{plc="line1"} 1`,
+		`gologix_tag_value{plc="line1",tag="Speed"} 12.5`,
+		`gologix_tag_up{plc="line1",tag="Speed"} 1`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("设备信息读取失败后缺少 %s\n%s", line, text)
+		}
+	}
+	if strings.Contains(text, `gologix_controller_fault{plc="line1"`) || strings.Contains(text, `gologix_controller_status{plc="line1"`) {
+		t.Fatalf("设备信息读取失败时不应输出故障标志\n%s", text)
+	}
+}
+
+func scrape(t *testing.T, server *httptest.Server) string {
+	res, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body)
+}
+
+func TestFormat(t *testing.T) {
+	if labels := formatLabels([]string{"tag", `a"b\c` + "\n"}); labels != `{tag="a\"b\\c\n"}` {
+		t.Fatalf("标签转义错误 %s", labels)
+	}
+	h := &histogram{}
+	for _, v := range []float64{0.002, 0.02, 20} {
+		h.observe(DefaultBuckets, v)
+	}
+	if h.counts[0] != 0 || h.counts[2] != 1 || h.counts[len(h.counts)-1] != 2 || h.count != 3 {
+		t.Fatalf("直方图计数错误 %v", h.counts)
+	}
+}
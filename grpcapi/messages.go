@@ -0,0 +1,226 @@
+package grpcapi
+
+import (
+	"fmt"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/types"
+	"time"
+)
+
+//消息与 gologix.proto 一一对应，字段标签为 proto 字段序号
+
+//Target PLC 地址与路由，相同的 Target 共用一个链接
+type Target struct {
+	Address     string `protobuf:"1"`
+	Route       string `protobuf:"2"`
+	Slot        uint32 `protobuf:"3"`
+	Micro800    bool   `protobuf:"4"`
+	Unconnected bool   `protobuf:"5"`
+}
+
+//Value 带类型的数值，数据字段只设置一个
+type Value struct {
+	Type          types.DataType `protobuf:"1"`
+	BoolValue     *bool          `protobuf:"2"`
+	SintValue     *int8          `protobuf:"3,zigzag"`
+	IntValue      *int16         `protobuf:"4,zigzag"`
+	DintValue     *int32         `protobuf:"5,zigzag"`
+	LintValue     *int64         `protobuf:"6,zigzag"`
+	UsintValue    *uint8         `protobuf:"7"`
+	UintValue     *uint16        `protobuf:"8"`
+	UdintValue    *uint32        `protobuf:"9"`
+	UlintValue    *uint64        `protobuf:"10"`
+	RealValue     *float32       `protobuf:"11"`
+	LrealValue    *float64       `protobuf:"12"`
+	StringValue   *string        `protobuf:"13"`
+	TimeUnixNano  *int64         `protobuf:"14"`
+	DurationNanos *int64         `protobuf:"15"`
+	RawValue      []byte         `protobuf:"16"`
+}
+
+//Error 单个标签的错误
+type Error struct {
+	Code      uint32 `protobuf:"1"`
+	Message   string `protobuf:"2"`
+	Kind      string `protobuf:"3"`
+	CIPStatus uint32 `protobuf:"4"`
+}
+
+type ConnectRequest struct {
+	Target *Target `protobuf:"1"`
+}
+
+type ConnectResponse struct {
+	SessionID     uint32 `protobuf:"1"`
+	ForwardOpened bool   `protobuf:"2"`
+}
+
+type InfoRequest struct {
+	Target *Target `protobuf:"1"`
+}
+
+type InfoResponse struct {
+	SerialNumber            uint32 `protobuf:"1"`
+	Name                    string `protobuf:"2"`
+	Version                 string `protobuf:"3"`
+	Status                  uint32 `protobuf:"4"`
+	Faulted                 bool   `protobuf:"5"`
+	MinorRecoverableFault   bool   `protobuf:"6"`
+	MinorUnrecoverableFault bool   `protobuf:"7"`
+	MajorRecoverableFault   bool   `protobuf:"8"`
+	MajorUnrecoverableFault bool   `protobuf:"9"`
+	IoFaulted               bool   `protobuf:"10"`
+}
+
+type ReadRequest struct {
+	Target *Target `protobuf:"1"`
+	Tag    string  `protobuf:"2"`
+	Count  uint32  `protobuf:"3"`
+}
+
+type ReadResponse struct {
+	Tag    string   `protobuf:"1"`
+	Values []*Value `protobuf:"2"`
+}
+
+type WriteRequest struct {
+	Target *Target  `protobuf:"1"`
+	Tag    string   `protobuf:"2"`
+	Values []*Value `protobuf:"3"`
+}
+
+type WriteResponse struct{}
+
+type ReadItem struct {
+	Tag   string `protobuf:"1"`
+	Count uint32 `protobuf:"2"`
+}
+
+type MultiReadRequest struct {
+	Target *Target     `protobuf:"1"`
+	Items  []*ReadItem `protobuf:"2"`
+}
+
+type ReadResult struct {
+	Tag    string   `protobuf:"1"`
+	Values []*Value `protobuf:"2"`
+	Error  *Error   `protobuf:"3"`
+}
+
+type MultiReadResponse struct {
+	Results []*ReadResult `protobuf:"1"`
+}
+
+type ListTagsRequest struct {
+	Target        *Target `protobuf:"1"`
+	Program       string  `protobuf:"2"`
+	IncludeSystem bool    `protobuf:"3"`
+}
+
+type TagInfo struct {
+	Name        string         `protobuf:"1"`
+	Type        types.DataType `protobuf:"2"`
+	TemplateID  uint32         `protobuf:"3"`
+	ElementSize uint32         `protobuf:"4"`
+	Dims        []uint32       `protobuf:"5"`
+	System      bool           `protobuf:"6"`
+}
+
+type ListTagsResponse struct {
+	Tags []*TagInfo `protobuf:"1"`
+}
+
+type SubscribeRequest struct {
+	Target *Target  `protobuf:"1"`
+	Tags   []string `protobuf:"2"`
+	RateMs uint32   `protobuf:"3"`
+}
+
+type TagEvent struct {
+	Tag          string   `protobuf:"1"`
+	TimeUnixNano int64    `protobuf:"2"`
+	Values       []*Value `protobuf:"3"`
+	Error        *Error   `protobuf:"4"`
+}
+
+//NewValue 读取的数值转换为消息，不能识别的数据按原始字节返回
+func NewValue(value gologix.Value) *Value {
+	v := &Value{Type: value.DType}
+	switch data := value.Data.(type) {
+	case bool:
+		v.BoolValue = &data
+	case int8:
+		v.SintValue = &data
+	case int16:
+		v.IntValue = &data
+	case int32:
+		v.DintValue = &data
+	case int64:
+		v.LintValue = &data
+	case uint8:
+		v.UsintValue = &data
+	case uint16:
+		v.UintValue = &data
+	case uint32:
+		v.UdintValue = &data
+	case uint64:
+		v.UlintValue = &data
+	case float32:
+		v.RealValue = &data
+	case float64:
+		v.LrealValue = &data
+	case string:
+		v.StringValue = &data
+	case time.Time:
+		nanos := data.UnixNano()
+		v.TimeUnixNano = &nanos
+	case time.Duration:
+		nanos := int64(data)
+		v.DurationNanos = &nanos
+	default:
+		if raw, err := value.Raw(); err == nil {
+			v.RawValue = raw
+		} else {
+			v.RawValue = []byte{}
+		}
+	}
+	return v
+}
+
+//Data 消息中的数值，用于 WriteTag
+func (v *Value) Data() (interface{}, error) {
+	switch {
+	case v.BoolValue != nil:
+		return *v.BoolValue, nil
+	case v.SintValue != nil:
+		return *v.SintValue, nil
+	case v.IntValue != nil:
+		return *v.IntValue, nil
+	case v.DintValue != nil:
+		return *v.DintValue, nil
+	case v.LintValue != nil:
+		return *v.LintValue, nil
+	case v.UsintValue != nil:
+		return *v.UsintValue, nil
+	case v.UintValue != nil:
+		return *v.UintValue, nil
+	case v.UdintValue != nil:
+		return *v.UdintValue, nil
+	case v.UlintValue != nil:
+		return *v.UlintValue, nil
+	case v.RealValue != nil:
+		return *v.RealValue, nil
+	case v.LrealValue != nil:
+		return *v.LrealValue, nil
+	case v.StringValue != nil:
+		return *v.StringValue, nil
+	case v.TimeUnixNano != nil:
+		return time.Unix(0, *v.TimeUnixNano), nil
+	case v.DurationNanos != nil:
+		return time.Duration(*v.DurationNanos), nil
+	case v.RawValue != nil:
+		return v.RawValue, nil
+	default:
+		return nil, fmt.Errorf("%w: 数值为空", types.ErrTypeMismatch)
+	}
+}
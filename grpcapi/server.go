@@ -0,0 +1,697 @@
+//Package grpcapi 通过 gRPC 接口远程访问 PLC，服务定义见 gologix.proto
+//
+//Server 实现 http.Handler，按 gRPC over HTTP/2 协议处理请求，消息使用 protobuf 编码。
+//标准库只在 TLS 上支持 HTTP/2，因此需要证书，不支持 h2c 明文链接，例如:
+//  server := grpcapi.New()
+//  server.Allow = []string{"192.168.1.0/24"}
+//  http.ListenAndServeTLS(":50051", "server.crt", "server.key", server)
+//
+//每个请求携带 Target，相同 Target 的请求共用一个链接并串行执行，空闲超过 IdleTimeout 的链接被关闭。
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/protobuf"
+	"github.com/wj008/gologix/pool"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ServicePath 服务路径前缀，方法名称跟在其后
+const ServicePath = "/gologix.v1.PLC/"
+
+//gRPC 状态码
+const (
+	CodeOK                 = 0
+	CodeCanceled           = 1
+	CodeUnknown            = 2
+	CodeInvalidArgument    = 3
+	CodeDeadlineExceeded   = 4
+	CodeNotFound           = 5
+	CodePermissionDenied   = 7
+	CodeResourceExhausted  = 8
+	CodeFailedPrecondition = 9
+	CodeOutOfRange         = 11
+	CodeUnimplemented      = 12
+	CodeInternal           = 13
+	CodeUnavailable        = 14
+)
+
+//Config gRPC 服务配置文件
+type Config struct {
+	Listen         string   `json:"listen"`          //监听地址 默认 :50051
+	CertFile       string   `json:"cert_file"`       //TLS 证书
+	KeyFile        string   `json:"key_file"`        //TLS 私钥
+	Allow          []string `json:"allow"`           //允许访问的 PLC 地址或网段，必须设置
+	MaxConnections int      `json:"max_connections"` //最多同时保持的 PLC 链接 默认 32
+}
+
+//Status gRPC 错误，设备返回错误状态时包含 CIP 状态码
+type Status struct {
+	Code      uint32
+	Message   string
+	Kind      string
+	CIPStatus uint8
+	Tag       string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("gRPC 状态 %d: %s", s.Code, s.Message)
+}
+
+//entry 一个 Target 的链接，同一 Target 的订阅共用 subscriber
+type entry struct {
+	client     *pool.Client
+	subscriber *gologix.Subscriber
+	active     int
+	lastUsed   time.Time
+}
+
+//Server gRPC 服务，只能通过 TLS 上的 HTTP/2 访问，h2c 明文链接(包括 prior knowledge)不被接受
+type Server struct {
+	mutex   sync.Mutex
+	clients map[Target]*entry
+	closed  bool
+	done    chan struct{}
+	//Allow 允许访问的 PLC 地址或网段，如 192.168.0.10、192.168.1.0/24，为空时拒绝所有访问
+	Allow []string
+	//MaxConnections 最多同时保持的 PLC 链接 默认 32
+	MaxConnections int
+	//MaxMessageSize 请求消息的最大长度 默认 4MB
+	MaxMessageSize int
+	//MinRate 订阅的最小扫描周期 默认 100ms
+	MinRate time.Duration
+	//IdleTimeout 链接空闲超过该时间后关闭 默认 10 分钟
+	IdleTimeout time.Duration
+}
+
+//New 创建服务，链接在首次请求时建立
+func New() *Server {
+	return &Server{
+		clients:        make(map[Target]*entry),
+		done:           make(chan struct{}),
+		MaxConnections: 32,
+		MaxMessageSize: 4 << 20,
+		MinRate:        100 * time.Millisecond,
+		IdleTimeout:    10 * time.Minute,
+	}
+}
+
+//Close 关闭所有链接，订阅随之结束
+func (s *Server) Close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.done)
+	clients := s.clients
+	s.clients = make(map[Target]*entry)
+	s.mutex.Unlock()
+	for _, e := range clients {
+		e.close()
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+		http.Error(w, "只支持 HTTP/2 POST 请求", http.StatusBadRequest)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/grpc" && !strings.HasPrefix(contentType, "application/grpc+proto") {
+		http.Error(w, "不支持的内容类型 "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	ctx := r.Context()
+	if timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	st := &stream{w: w, body: r.Body, ctx: ctx, maxSize: s.MaxMessageSize}
+	var err error
+	switch method := strings.TrimPrefix(r.URL.Path, ServicePath); method {
+	case "Connect":
+		req := &ConnectRequest{}
+		if err = st.recv(req); err == nil {
+			err = st.reply(s.connect(req))
+		}
+	case "Info":
+		req := &InfoRequest{}
+		if err = st.recv(req); err == nil {
+			err = st.reply(s.info(req))
+		}
+	case "Read":
+		req := &ReadRequest{}
+		if err = st.recv(req); err == nil {
+			err = st.reply(s.read(req))
+		}
+	case "Write":
+		req := &WriteRequest{}
+		if err = st.recv(req); err == nil {
+			err = st.reply(s.write(req))
+		}
+	case "MultiRead":
+		req := &MultiReadRequest{}
+		if err = st.recv(req); err == nil {
+			err = st.reply(s.multiRead(req))
+		}
+	case "ListTags":
+		req := &ListTagsRequest{}
+		if err = st.recv(req); err == nil {
+			err = st.reply(s.listTags(req))
+		}
+	case "Subscribe":
+		req := &SubscribeRequest{}
+		if err = st.recv(req); err == nil {
+			err = s.subscribe(st, req)
+		}
+	default:
+		err = &Status{Code: CodeUnimplemented, Message: "不支持的方法 " + r.URL.Path}
+	}
+	st.finish(err)
+}
+
+//stream 一次 gRPC 调用，请求只有一个消息，应答可以有多个消息
+type stream struct {
+	w       http.ResponseWriter
+	body    io.Reader
+	ctx     context.Context
+	maxSize int
+	started bool
+}
+
+//recv 读取长度前缀的请求消息
+func (st *stream) recv(v interface{}) error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(st.body, header); err != nil {
+		return &Status{Code: CodeInvalidArgument, Message: "读取请求消息失败: " + err.Error()}
+	}
+	if header[0] != 0 {
+		return &Status{Code: CodeUnimplemented, Message: "不支持压缩的消息"}
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if int64(size) > int64(st.maxSize) {
+		return &Status{Code: CodeResourceExhausted, Message: fmt.Sprintf("请求消息长度 %d 超过限制 %d", size, st.maxSize)}
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(st.body, data); err != nil {
+		return &Status{Code: CodeInvalidArgument, Message: "读取请求消息失败: " + err.Error()}
+	}
+	if err := protobuf.Unmarshal(data, v); err != nil {
+		return &Status{Code: CodeInvalidArgument, Message: "解析请求消息失败: " + err.Error()}
+	}
+	return nil
+}
+
+func (st *stream) reply(v interface{}, err error) error {
+	if err != nil {
+		return err
+	}
+	return st.send(v)
+}
+
+//send 发送一个应答消息
+func (st *stream) send(v interface{}) error {
+	data, err := protobuf.Marshal(v)
+	if err != nil {
+		return &Status{Code: CodeInternal, Message: err.Error()}
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	st.start()
+	if _, err = st.w.Write(append(frame, data...)); err != nil {
+		return err
+	}
+	if flusher, ok := st.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (st *stream) start() {
+	if !st.started {
+		st.started = true
+		st.w.Header().Set("Content-Type", "application/grpc")
+		st.w.WriteHeader(http.StatusOK)
+	}
+}
+
+//finish 在 trailer 中写入状态
+func (st *stream) finish(err error) {
+	status := StatusOf(err)
+	st.start()
+	trailer := st.w.Header()
+	trailer.Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(status.Code)))
+	if status.Message != "" {
+		trailer.Set(http.TrailerPrefix+"Grpc-Message", encodeMessage(status.Message))
+	}
+	if status.Kind != "" {
+		trailer.Set(http.TrailerPrefix+"Gologix-Error-Kind", encodeMessage(status.Kind))
+		trailer.Set(http.TrailerPrefix+"Grpc-Status-Details-Bin", base64.RawStdEncoding.EncodeToString(statusDetails(status)))
+	}
+	if status.CIPStatus != 0 {
+		trailer.Set(http.TrailerPrefix+"Gologix-Cip-Status", fmt.Sprintf("0x%02x", status.CIPStatus))
+	}
+}
+
+//encodeMessage grpc-message 按百分号编码，保留可见的 ASCII 字符
+func encodeMessage(message string) string {
+	var builder strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		} else {
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+//parseTimeout 解析 grpc-timeout，如 100m、5S
+func parseTimeout(text string) (time.Duration, bool) {
+	if len(text) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(text[:len(text)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, ok := units[text[len(text)-1]]
+	if !ok || n > int64(1<<63-1)/int64(unit) {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+//rpcStatus 与 errorInfo 对应 google.rpc.Status 与 google.rpc.ErrorInfo
+type rpcStatus struct {
+	Code    int32       `protobuf:"1"`
+	Message string      `protobuf:"2"`
+	Details []*anyValue `protobuf:"3"`
+}
+
+type anyValue struct {
+	TypeURL string `protobuf:"1"`
+	Value   []byte `protobuf:"2"`
+}
+
+type errorInfo struct {
+	Reason   string           `protobuf:"1"`
+	Domain   string           `protobuf:"2"`
+	Metadata []*metadataEntry `protobuf:"3"`
+}
+
+type metadataEntry struct {
+	Key   string `protobuf:"1"`
+	Value string `protobuf:"2"`
+}
+
+//statusDetails grpc-status-details-bin 的内容
+func statusDetails(status *Status) []byte {
+	info := &errorInfo{Reason: "TAG_ERROR", Domain: "gologix", Metadata: []*metadataEntry{{Key: "kind", Value: status.Kind}}}
+	if status.CIPStatus != 0 {
+		info.Reason = "CIP_STATUS"
+		info.Metadata = append(info.Metadata,
+			&metadataEntry{Key: "cip_status", Value: fmt.Sprintf("0x%02x", status.CIPStatus)},
+			&metadataEntry{Key: "cip_status_text", Value: gologix.GetErrorCode(status.CIPStatus)})
+	}
+	if status.Tag != "" {
+		info.Metadata = append(info.Metadata, &metadataEntry{Key: "tag", Value: status.Tag})
+	}
+	detail, _ := protobuf.Marshal(info)
+	data, _ := protobuf.Marshal(&rpcStatus{
+		Code:    int32(status.Code),
+		Message: status.Message,
+		Details: []*anyValue{{TypeURL: "type.googleapis.com/google.rpc.ErrorInfo", Value: detail}},
+	})
+	return data
+}
+
+//StatusOf 错误对应的 gRPC 状态，nil 为 OK
+func StatusOf(err error) *Status {
+	if err == nil {
+		return &Status{Code: CodeOK}
+	}
+	var status *Status
+	if errors.As(err, &status) {
+		return status
+	}
+	status = &Status{Code: CodeUnknown, Message: err.Error()}
+	var tagErr *gologix.TagError
+	if errors.As(err, &tagErr) {
+		status.Kind, status.Tag = tagErr.Kind.String(), tagErr.Tag
+		if tagErr.Kind == gologix.TagErrorStatus {
+			status.CIPStatus = tagErr.Status
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		status.Code = CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		status.Code = CodeDeadlineExceeded
+	case errors.Is(err, pool.ErrUnavailable):
+		status.Code = CodeUnavailable
+	default:
+		switch gologix.ClassifyError(err) {
+		case gologix.ErrorNotFound:
+			status.Code = CodeNotFound
+		case gologix.ErrorForbidden:
+			status.Code = CodePermissionDenied
+		case gologix.ErrorUnsupported:
+			status.Code = CodeUnimplemented
+		case gologix.ErrorInvalid:
+			status.Code = CodeInvalidArgument
+		case gologix.ErrorOutOfRange:
+			status.Code = CodeOutOfRange
+		case gologix.ErrorConflict:
+			status.Code = CodeFailedPrecondition
+		}
+	}
+	return status
+}
+
+//errorOf 单个标签的错误
+func errorOf(err error) *Error {
+	status := StatusOf(err)
+	return &Error{Code: status.Code, Message: status.Message, Kind: status.Kind, CIPStatus: uint32(status.CIPStatus)}
+}
+
+//allowed 地址是否在 Allow 列表中，主机名只能精确匹配
+func (s *Server) allowed(address string) bool {
+	host := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	for _, allow := range s.Allow {
+		if _, network, err := net.ParseCIDR(allow); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+		} else if allow == host {
+			return true
+		}
+	}
+	return false
+}
+
+//acquire 获取 Target 的链接，不存在时创建，同时关闭空闲的链接
+func (s *Server) acquire(target *Target) (*entry, error) {
+	if target == nil || target.Address == "" {
+		return nil, &Status{Code: CodeInvalidArgument, Message: "缺少 PLC 地址"}
+	}
+	if target.Slot > 255 {
+		return nil, &Status{Code: CodeInvalidArgument, Message: fmt.Sprintf("槽号 %d 超出范围", target.Slot)}
+	}
+	if !s.allowed(target.Address) {
+		return nil, &Status{Code: CodePermissionDenied, Message: "不允许访问 " + target.Address}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil, &Status{Code: CodeUnavailable, Message: "服务已关闭"}
+	}
+	now := time.Now()
+	for key, e := range s.clients {
+		if e.active == 0 && now.Sub(e.lastUsed) > s.IdleTimeout {
+			//关闭链接需要网络通信，不在锁内执行
+			go e.close()
+			delete(s.clients, key)
+		}
+	}
+	e, ok := s.clients[*target]
+	if !ok {
+		if len(s.clients) >= s.MaxConnections {
+			return nil, &Status{Code: CodeResourceExhausted, Message: fmt.Sprintf("PLC 链接数量超过限制 %d", s.MaxConnections)}
+		}
+		name := target.Address
+		if target.Route != "" {
+			name += "/" + target.Route
+		}
+		e = &entry{client: &pool.Client{Endpoint: &pool.Endpoint{
+			Name:        name,
+			Address:     target.Address,
+			Slot:        uint8(target.Slot),
+			Route:       target.Route,
+			Micro800:    target.Micro800,
+			Unconnected: target.Unconnected,
+		}}}
+		e.subscriber = gologix.NewSubscriber(e.client, 0)
+		e.subscriber.Start()
+		s.clients[*target] = e
+	}
+	e.active++
+	e.lastUsed = now
+	return e, nil
+}
+
+//close 先停止订阅扫描再关闭链接，避免扫描使用已关闭的链接
+func (e *entry) close() {
+	e.subscriber.Stop()
+	e.client.Close()
+}
+
+func (s *Server) release(e *entry) {
+	s.mutex.Lock()
+	e.active--
+	e.lastUsed = time.Now()
+	s.mutex.Unlock()
+}
+
+//do 在 Target 的链接上执行 fn
+func (s *Server) do(target *Target, fn func(plc *gologix.PLC) error) error {
+	e, err := s.acquire(target)
+	if err != nil {
+		return err
+	}
+	defer s.release(e)
+	return e.client.Do(fn)
+}
+
+func (s *Server) connect(req *ConnectRequest) (interface{}, error) {
+	response := &ConnectResponse{}
+	err := s.do(req.Target, func(plc *gologix.PLC) error {
+		response.SessionID, response.ForwardOpened = plc.SessionId, plc.ForwardOpened()
+		return nil
+	})
+	return response, err
+}
+
+func (s *Server) info(req *InfoRequest) (interface{}, error) {
+	response := &InfoResponse{}
+	err := s.do(req.Target, func(plc *gologix.PLC) error {
+		if err := plc.ReadAttributeAll(); err != nil {
+			return err
+		}
+		info := plc.Info
+		*response = InfoResponse{
+			SerialNumber:            info.SerialNumber,
+			Name:                    info.Name,
+			Version:                 info.Version,
+			Status:                  uint32(info.Status),
+			Faulted:                 info.Faulted,
+			MinorRecoverableFault:   info.MinorRecoverableFault,
+			MinorUnrecoverableFault: info.MinorUnrecoverableFault,
+			MajorRecoverableFault:   info.MajorRecoverableFault,
+			MajorUnrecoverableFault: info.MajorUnrecoverableFault,
+			IoFaulted:               info.IoFaulted,
+		}
+		return nil
+	})
+	return response, err
+}
+
+//elements 读取的元素数量，0 为 1 个
+func elements(count uint32) (uint16, error) {
+	if count > 0xffff {
+		return 0, &Status{Code: CodeInvalidArgument, Message: fmt.Sprintf("元素数量 %d 超出范围", count)}
+	}
+	if count == 0 {
+		return 1, nil
+	}
+	return uint16(count), nil
+}
+
+func newValues(values []gologix.Value) []*Value {
+	list := make([]*Value, len(values))
+	for i, value := range values {
+		list[i] = NewValue(value)
+	}
+	return list
+}
+
+func (s *Server) read(req *ReadRequest) (interface{}, error) {
+	count, err := elements(req.Count)
+	if err != nil {
+		return nil, err
+	}
+	response := &ReadResponse{Tag: req.Tag}
+	err = s.do(req.Target, func(plc *gologix.PLC) error {
+		values, err := plc.ReadValues(req.Tag, count)
+		response.Values = newValues(values)
+		return err
+	})
+	return response, err
+}
+
+func (s *Server) write(req *WriteRequest) (interface{}, error) {
+	if len(req.Values) == 0 {
+		return nil, &Status{Code: CodeInvalidArgument, Message: "没有写入的数值"}
+	}
+	values := make([]interface{}, len(req.Values))
+	for i, value := range req.Values {
+		data, err := value.Data()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = data
+	}
+	err := s.do(req.Target, func(plc *gologix.PLC) error {
+		return plc.WriteTag(req.Tag, values...)
+	})
+	return &WriteResponse{}, err
+}
+
+func (s *Server) multiRead(req *MultiReadRequest) (interface{}, error) {
+	if len(req.Items) == 0 {
+		return nil, &Status{Code: CodeInvalidArgument, Message: "没有读取的标签"}
+	}
+	requests := make([]gologix.ReadRequest, len(req.Items))
+	for i, item := range req.Items {
+		count, err := elements(item.Count)
+		if err != nil {
+			return nil, err
+		}
+		requests[i] = gologix.ReadRequest{Tag: item.Tag, Elements: count}
+	}
+	e, err := s.acquire(req.Target)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release(e)
+	response := &MultiReadResponse{}
+	response.Results, err = readBatch(e.client, requests)
+	return response, err
+}
+
+//readBatch 批量读取，标签错误记录在各自的结果中，只有链接错误时返回 error
+func readBatch(plc gologix.TagReader, requests []gologix.ReadRequest) ([]*ReadResult, error) {
+	results, err := plc.MultiReadTags(requests)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ReadResult, 0, len(requests))
+	for _, item := range requests {
+		values, err := results[item.Tag].Elements(item.Elements)
+		if err != nil {
+			list = append(list, &ReadResult{Tag: item.Tag, Error: errorOf(err)})
+			continue
+		}
+		list = append(list, &ReadResult{Tag: item.Tag, Values: newValues(values)})
+	}
+	return list, nil
+}
+
+func (s *Server) listTags(req *ListTagsRequest) (interface{}, error) {
+	response := &ListTagsResponse{}
+	err := s.do(req.Target, func(plc *gologix.PLC) error {
+		symbols, err := plc.ListTags(req.Program)
+		if err != nil {
+			return err
+		}
+		for _, symbol := range symbols {
+			if symbol.System && !req.IncludeSystem {
+				continue
+			}
+			response.Tags = append(response.Tags, &TagInfo{
+				Name:        symbol.Name,
+				Type:        symbol.DType,
+				TemplateID:  uint32(symbol.TemplateID),
+				ElementSize: uint32(symbol.ElementSize),
+				Dims:        symbol.Dims,
+				System:      symbol.System,
+			})
+		}
+		return nil
+	})
+	return response, err
+}
+
+//subscribe 订阅标签，首次读取与数值或错误变化时推送事件，直到客户端取消。
+//推送慢于变化时同一标签只保留最新的事件，不阻塞同一 Target 的其它订阅
+func (s *Server) subscribe(st *stream, req *SubscribeRequest) error {
+	if len(req.Tags) == 0 {
+		return &Status{Code: CodeInvalidArgument, Message: "没有订阅的标签"}
+	}
+	rate := time.Duration(req.RateMs) * time.Millisecond
+	if rate < s.MinRate {
+		rate = s.MinRate
+	}
+	e, err := s.acquire(req.Target)
+	if err != nil {
+		return err
+	}
+	defer s.release(e)
+	var mutex sync.Mutex
+	pending := make(map[string]*TagEvent)
+	notify := make(chan struct{}, 1)
+	sub, err := e.subscriber.Add(req.Tags, rate, gologix.SubscribeOptions{}, func(events []gologix.ChangeEvent) {
+		mutex.Lock()
+		for _, event := range events {
+			tagEvent := &TagEvent{Tag: event.Tag, TimeUnixNano: event.Time.UnixNano()}
+			if event.Err != nil {
+				tagEvent.Error = errorOf(event.Err)
+			} else {
+				tagEvent.Values = newValues(event.Values)
+			}
+			pending[event.Tag] = tagEvent
+		}
+		mutex.Unlock()
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return &Status{Code: CodeInvalidArgument, Message: err.Error()}
+	}
+	defer e.subscriber.Remove(sub)
+	for {
+		select {
+		case <-st.ctx.Done():
+			return st.ctx.Err()
+		case <-s.done:
+			return &Status{Code: CodeUnavailable, Message: "服务已关闭"}
+		case <-notify:
+		}
+		mutex.Lock()
+		events := make([]*TagEvent, 0, len(pending))
+		for _, event := range pending {
+			events = append(events, event)
+		}
+		pending = make(map[string]*TagEvent)
+		mutex.Unlock()
+		sort.Slice(events, func(i, j int) bool {
+			return events[i].Tag < events[j].Tag
+		})
+		for _, event := range events {
+			if err := st.send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/internal/protobuf"
+	"github.com/wj008/gologix/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+//invoke 发送 gRPC 请求，返回应答，消息由 next 读取
+func invoke(t *testing.T, ctx context.Context, ts *httptest.Server, method string, req interface{}) *http.Response {
+	t.Helper()
+	data, err := protobuf.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+ServicePath+method, bytes.NewReader(append(frame, data...)))
+	request.Header.Set("Content-Type", "application/grpc")
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || response.ProtoMajor != 2 {
+		t.Fatalf("应答错误 %s %s", response.Proto, response.Status)
+	}
+	return response
+}
+
+//next 读取一个应答消息，没有更多消息时返回 false
+func next(t *testing.T, response *http.Response, v interface{}) bool {
+	t.Helper()
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(response.Body, header); err == io.EOF {
+		return false
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(response.Body, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := protobuf.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+//call 一元调用，返回 grpc-status 与 trailer
+func call(t *testing.T, ts *httptest.Server, method string, req interface{}, resp interface{}) (string, http.Header) {
+	t.Helper()
+	response := invoke(t, context.Background(), ts, method, req)
+	defer response.Body.Close()
+	if next(t, response, resp) {
+		if next(t, response, resp) {
+			t.Fatal("一元调用返回了多个消息")
+		}
+	}
+	return response.Trailer.Get("Grpc-Status"), response.Trailer
+}
+
+func TestServer(t *testing.T) {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.AddTag("Speed", types.REAL, []float32{12.5})
+	sim.AddTag("Small", types.SINT, []int8{1})
+	sim.AddArray("Counts", types.DINT, []uint32{3}, []int32{1, 2, 3})
+	server := New()
+	server.Allow = []string{"127.0.0.0/8"}
+	defer server.Close()
+	ts := httptest.NewUnstartedServer(server)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	target := &Target{Address: sim.Addr(), Unconnected: true}
+
+	connected := &ConnectResponse{}
+	if status, _ := call(t, ts, "Connect", &ConnectRequest{Target: target}, connected); status != "0" || connected.SessionID == 0 {
+		t.Fatalf("链接失败 %s %+v", status, connected)
+	}
+	read := &ReadResponse{}
+	if status, _ := call(t, ts, "Read", &ReadRequest{Target: target, Tag: "Counts", Count: 3}, read); status != "0" || len(read.Values) != 3 || *read.Values[2].DintValue != 3 || read.Values[0].Type != types.DINT {
+		t.Fatalf("读取数组失败 %s %+v", status, read.Values)
+	}
+
+	//设备返回的错误状态在 trailer 中
+	status, trailer := call(t, ts, "Read", &ReadRequest{Target: target, Tag: "Missing"}, &ReadResponse{})
+	if status != "5" || trailer.Get("Gologix-Cip-Status") == "" {
+		t.Fatalf("不存在的标签应返回 NotFound %s %v", status, trailer)
+	}
+	details, err := base64.RawStdEncoding.DecodeString(trailer.Get("Grpc-Status-Details-Bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpc := &rpcStatus{}
+	info := &errorInfo{}
+	if err = protobuf.Unmarshal(details, rpc); err != nil || len(rpc.Details) != 1 || protobuf.Unmarshal(rpc.Details[0].Value, info) != nil || info.Reason != "CIP_STATUS" {
+		t.Fatalf("错误详情不正确 %+v %+v", rpc, info)
+	}
+
+	speed := float32(20)
+	if status, _ = call(t, ts, "Write", &WriteRequest{Target: target, Tag: "Speed", Values: []*Value{{RealValue: &speed}}}, &WriteResponse{}); status != "0" {
+		t.Fatalf("写入失败 %s", status)
+	}
+	large := int32(300)
+	if status, _ = call(t, ts, "Write", &WriteRequest{Target: target, Tag: "Small", Values: []*Value{{DintValue: &large}}}, &WriteResponse{}); status != "11" {
+		t.Fatalf("超出范围应返回 OutOfRange %s", status)
+	}
+	multi := &MultiReadResponse{}
+	call(t, ts, "MultiRead", &MultiReadRequest{Target: target, Items: []*ReadItem{{Tag: "Speed"}, {Tag: "Missing"}}}, multi)
+	if len(multi.Results) != 2 || *multi.Results[0].Values[0].RealValue != 20 || multi.Results[1].Error == nil || multi.Results[1].Error.Code != CodeNotFound {
+		t.Fatalf("批量读取结果错误 %+v", multi.Results)
+	}
+	tags := &ListTagsResponse{}
+	call(t, ts, "ListTags", &ListTagsRequest{Target: target}, tags)
+	var names []string
+	for _, tag := range tags.Tags {
+		names = append(names, tag.Name)
+	}
+	sort.Strings(names)
+	if len(names) != 3 || names[0] != "Counts" || tags.Tags[0].Type == types.NULL {
+		t.Fatalf("标签列表错误 %v", names)
+	}
+
+	if status, _ = call(t, ts, "Read", &ReadRequest{Target: &Target{Address: "10.0.0.1"}, Tag: "Speed"}, &ReadResponse{}); status != "7" {
+		t.Fatalf("不在允许列表中的地址应返回 PermissionDenied %s", status)
+	}
+	if status, _ = call(t, ts, "Reset", &ReadRequest{}, &ReadResponse{}); status != "12" {
+		t.Fatalf("不支持的方法应返回 Unimplemented %s", status)
+	}
+
+	//订阅：首次推送当前值，之后推送变化
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	response := invoke(t, ctx, ts, "Subscribe", &SubscribeRequest{Target: target, Tags: []string{"Speed"}, RateMs: 50})
+	defer response.Body.Close()
+	event := &TagEvent{}
+	if !next(t, response, event) || event.Tag != "Speed" || *event.Values[0].RealValue != 20 {
+		t.Fatalf("首次推送错误 %+v", event)
+	}
+	speed = 30
+	call(t, ts, "Write", &WriteRequest{Target: target, Tag: "Speed", Values: []*Value{{RealValue: &speed}}}, &WriteResponse{})
+	event = &TagEvent{}
+	if !next(t, response, event) || *event.Values[0].RealValue != 30 {
+		t.Fatalf("变化推送错误 %+v", event)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	server := New()
+	if server.allowed("127.0.0.1") {
+		t.Fatal("没有允许列表时应拒绝所有地址")
+	}
+	server.Allow = []string{"192.168.1.0/24", "plc1"}
+	for address, want := range map[string]bool{
+		"192.168.1.20":       true,
+		"192.168.1.20:44818": true,
+		"192.168.2.20":       false,
+		"plc1":               true,
+		"plc2":               false,
+	} {
+		if server.allowed(address) != want {
+			t.Fatalf("%s 应该为 %v", address, want)
+		}
+	}
+}
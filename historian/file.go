@@ -0,0 +1,235 @@
+package historian
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//文件格式
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+//FileOptions 文件写入参数
+type FileOptions struct {
+	Dir          string        //目录
+	Prefix       string        //文件名前缀 默认 history
+	Format       string        //csv 或 jsonl
+	MaxSize      int64         //单个文件最大字节数，超出后新建文件 默认 10MB
+	RotateEvery  time.Duration //按时间新建文件，0 表示不按时间
+	MaxAge       time.Duration //删除修改时间早于该时长的文件，0 表示不删除
+	MaxTotalSize int64         //所有文件的最大总字节数，超出时删除最旧的文件，0 表示不限制
+}
+
+//FileSink 滚动写入 CSV/JSONL 文件
+type FileSink struct {
+	options FileOptions
+	file    *os.File
+	writer  *bufio.Writer
+	size    int64
+	opened  time.Time
+}
+
+//csvHeader CSV 表头
+var csvHeader = []string{"time", "plc", "group", "tag", "type", "value", "quality", "error"}
+
+//NewFileSink 创建文件写入目标，目录不存在时创建
+func NewFileSink(options FileOptions) (*FileSink, error) {
+	if options.Format != FormatCSV && options.Format != FormatJSONL {
+		return nil, fmt.Errorf("不支持的文件格式 %s，可选 csv/jsonl", options.Format)
+	}
+	if options.Prefix == "" {
+		options.Prefix = "history"
+	}
+	if options.MaxSize == 0 {
+		options.MaxSize = 10 << 20
+	}
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileSink{options: options}, nil
+}
+
+//Write 写入记录，文件超出大小或时间后新建文件
+func (s *FileSink) Write(rows []*Row) error {
+	for _, row := range rows {
+		if s.file == nil || s.size >= s.options.MaxSize ||
+			(s.options.RotateEvery > 0 && time.Since(s.opened) >= s.options.RotateEvery) {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		line, err := s.encode(row)
+		if err != nil {
+			return err
+		}
+		n, err := s.writer.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return s.writer.Flush()
+}
+
+//encode 编码一条记录
+func (s *FileSink) encode(row *Row) ([]byte, error) {
+	if s.options.Format == FormatJSONL {
+		data, err := json.Marshal(jsonRow(row))
+		return append(data, '\n'), err
+	}
+	builder := &strings.Builder{}
+	writer := csv.NewWriter(builder)
+	writer.Write(csvRow(row))
+	writer.Flush()
+	return []byte(builder.String()), writer.Error()
+}
+
+//rotate 关闭当前文件并新建文件，然后按保留策略删除旧文件
+func (s *FileSink) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	now := time.Now()
+	base := filepath.Join(s.options.Dir, s.options.Prefix+"-"+now.UTC().Format("20060102-150405.000"))
+	path := base + "." + s.options.Format
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = base + "-" + strconv.Itoa(i) + "." + s.options.Format
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file, s.writer, s.size, s.opened = file, bufio.NewWriter(file), 0, now
+	if s.options.Format == FormatCSV {
+		line := strings.Join(csvHeader, ",") + "\n"
+		n, _ := s.writer.WriteString(line)
+		s.size += int64(n)
+	}
+	return s.cleanup(path)
+}
+
+//cleanup 删除超出保留时间或总大小的文件，不删除当前文件
+func (s *FileSink) cleanup(current string) error {
+	if s.options.MaxAge == 0 && s.options.MaxTotalSize == 0 {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(s.options.Dir, s.options.Prefix+"-*."+s.options.Format))
+	if err != nil {
+		return err
+	}
+	//文件名含创建时间，按名称排序即按时间排序
+	sort.Strings(paths)
+	type fileInfo struct {
+		path string
+		size int64
+	}
+	var files []fileInfo
+	total := int64(0)
+	for _, path := range paths {
+		if path == current {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if s.options.MaxAge > 0 && time.Since(info.ModTime()) > s.options.MaxAge {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, fileInfo{path: path, size: info.Size()})
+		total += info.Size()
+	}
+	for len(files) > 0 && s.options.MaxTotalSize > 0 && total+s.size > s.options.MaxTotalSize {
+		os.Remove(files[0].path)
+		total -= files[0].size
+		files = files[1:]
+	}
+	return nil
+}
+
+func (s *FileSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.writer.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file, s.writer = nil, nil
+	return err
+}
+
+//Close 关闭当前文件
+func (s *FileSink) Close() error {
+	return s.closeFile()
+}
+
+//formatValue 数值转换为文本，空值为空字符串
+func formatValue(value interface{}) string {
+	switch data := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return data
+	case time.Time:
+		return data.Format(time.RFC3339Nano)
+	case float32:
+		return strconv.FormatFloat(float64(data), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(data, 'g', -1, 64)
+	default:
+		return fmt.Sprint(data)
+	}
+}
+
+func csvRow(row *Row) []string {
+	return []string{row.Time.UTC().Format(time.RFC3339Nano), row.PLC, row.Group, row.Tag, row.Type,
+		formatValue(row.Value), row.Quality.String(), row.Error}
+}
+
+//jsonRecord JSONL 记录
+type jsonRecord struct {
+	Time    time.Time   `json:"time"`
+	PLC     string      `json:"plc"`
+	Group   string      `json:"group"`
+	Tag     string      `json:"tag"`
+	Type    string      `json:"type,omitempty"`
+	Value   interface{} `json:"value"`
+	Quality string      `json:"quality"`
+	Error   string      `json:"error,omitempty"`
+}
+
+//jsonRow 转换为 JSON 记录，NaN、无穷大与时长转换为字符串
+func jsonRow(row *Row) *jsonRecord {
+	value := row.Value
+	switch data := value.(type) {
+	case float32:
+		if math.IsNaN(float64(data)) || math.IsInf(float64(data), 0) {
+			value = formatValue(data)
+		}
+	case float64:
+		if math.IsNaN(data) || math.IsInf(data, 0) {
+			value = formatValue(data)
+		}
+	case time.Duration:
+		value = data.String()
+	}
+	return &jsonRecord{Time: row.Time.UTC(), PLC: row.PLC, Group: row.Group, Tag: row.Tag, Type: row.Type,
+		Value: value, Quality: row.Quality.String(), Error: row.Error}
+}
@@ -0,0 +1,237 @@
+//Package historian 按周期或变化采样 PLC 标签组，写入滚动的 CSV/JSONL 文件或 database/sql 数据库
+//
+//PLC 不可用时仍按计划生成质量为 Bad 的记录；写入失败的记录保留在缓冲区中，下次刷新时重试。
+//
+//不在本包范围内：内嵌的 SQLite 数据库。本库只依赖标准库，SQLSink 需要调用方导入 database/sql 驱动，
+//cmd/historian 因此只支持文件与 InfluxDB 输出。
+package historian
+
+import (
+	"errors"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"sync"
+	"time"
+)
+
+//采样方式
+const (
+	ModeInterval = "interval" //每个周期记录
+	ModeChange   = "change"   //数值或质量变化时记录
+)
+
+//Group 按相同周期采样的一组标签
+type Group struct {
+	Name     string   `json:"name"`
+	PLC      string   `json:"plc"`
+	Tags     []string `json:"tags"`
+	RateMs   int      `json:"rate_ms"`  //采样周期 默认 1000
+	Mode     string   `json:"mode"`     //interval 或 change，默认 interval
+	Deadband float64  `json:"deadband"` //change 模式下数值的绝对值死区
+}
+
+//Row 一条历史记录，PLC 不可用或读取失败时 Value 为空、Quality 为 Bad
+type Row struct {
+	Time    time.Time
+	PLC     string
+	Group   string
+	Tag     string
+	Type    string
+	Value   interface{}
+	Quality gologix.Quality
+	Error   string
+}
+
+//Sink 记录的写入目标，Write 失败时记录会被保留并重试
+type Sink interface {
+	Write(rows []*Row) error
+	Close() error
+}
+
+//Historian 历史记录器
+type Historian struct {
+	subs    map[string]*gologix.Subscriber //每个 PLC 一个订阅引擎，相同周期的组共用一次读取
+	sink    Sink
+	mutex   sync.Mutex
+	buffer  []*Row
+	dropped uint64
+	stop    chan struct{}
+	wait    sync.WaitGroup
+	//FlushInterval 写入间隔 默认 1s
+	FlushInterval time.Duration
+	//MaxBuffer 缓冲区最大记录数，超出时丢弃最旧的记录 默认 100000
+	MaxBuffer int
+	//Logger 记录写入失败，默认 log.Default()
+	Logger *log.Logger
+}
+
+//New 创建历史记录器，组的 PLC 必须在 manager 中配置，groups 不会被修改
+func New(manager *pool.Manager, groups []*Group, sink Sink) (*Historian, error) {
+	h := &Historian{
+		subs:          make(map[string]*gologix.Subscriber),
+		sink:          sink,
+		FlushInterval: time.Second,
+		MaxBuffer:     100000,
+		Logger:        log.Default(),
+	}
+	for _, item := range groups {
+		g := *item
+		g.Tags = append([]string(nil), item.Tags...)
+		if g.Name == "" || len(g.Tags) == 0 {
+			return nil, errors.New("采样组缺少名称或标签")
+		}
+		client, err := manager.Client(g.PLC)
+		if err != nil {
+			return nil, err
+		}
+		options := gologix.SubscribeOptions{}
+		switch g.Mode {
+		case "", ModeInterval:
+			options.Always = true
+		case ModeChange:
+			options.Deadband.Absolute = g.Deadband
+		default:
+			return nil, errors.New("不支持的采样方式 " + g.Mode)
+		}
+		rate := time.Second
+		if g.RateMs > 0 {
+			rate = time.Duration(g.RateMs) * time.Millisecond
+		}
+		subscriber, ok := h.subs[g.PLC]
+		if !ok {
+			subscriber = gologix.NewSubscriber(client, 0)
+			h.subs[g.PLC] = subscriber
+		}
+		if _, err = subscriber.Add(g.Tags, rate, options, func(events []gologix.ChangeEvent) {
+			h.append(rows(&g, events))
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+//rows 订阅事件转换为记录，质量为 Bad 时没有数值
+func rows(g *Group, events []gologix.ChangeEvent) []*Row {
+	result := make([]*Row, len(events))
+	for i, event := range events {
+		row := &Row{Time: event.Time, PLC: g.PLC, Group: g.Name, Tag: event.Tag, Quality: event.Quality}
+		if event.Err != nil {
+			row.Error = event.Err.Error()
+		} else {
+			row.Type, row.Value = event.Values[0].DType.String(), event.Values[0].Data
+		}
+		result[i] = row
+	}
+	return result
+}
+
+//Start 开始采样与写入
+func (h *Historian) Start() {
+	h.stop = make(chan struct{})
+	for _, subscriber := range h.subs {
+		subscriber.Start()
+	}
+	h.wait.Add(1)
+	go h.flushLoop()
+}
+
+//Stop 停止采样，写入缓冲区中的记录后关闭写入目标
+func (h *Historian) Stop() error {
+	for _, subscriber := range h.subs {
+		subscriber.Stop()
+	}
+	close(h.stop)
+	h.wait.Wait()
+	err := h.Flush()
+	if closeErr := h.sink.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//Dropped 缓冲区满时丢弃的记录数
+func (h *Historian) Dropped() uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.dropped
+}
+
+//Pending 等待写入的记录数
+func (h *Historian) Pending() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.buffer)
+}
+
+//Flush 写入缓冲区中的记录，失败时保留记录
+func (h *Historian) Flush() error {
+	h.mutex.Lock()
+	rows := h.buffer
+	h.buffer = nil
+	h.mutex.Unlock()
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := h.sink.Write(rows); err != nil {
+		h.mutex.Lock()
+		h.buffer = append(rows, h.buffer...)
+		h.trimLocked()
+		h.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (h *Historian) flushLoop() {
+	defer h.wait.Done()
+	ticker := time.NewTicker(h.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			if err := h.Flush(); err != nil {
+				h.Logger.Println("写入历史记录失败:", err)
+			}
+		}
+	}
+}
+
+//append 加入缓冲区
+func (h *Historian) append(rows []*Row) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.buffer = append(h.buffer, rows...)
+	h.trimLocked()
+}
+
+//trimLocked 超出缓冲区大小时丢弃最旧的记录
+func (h *Historian) trimLocked() {
+	if over := len(h.buffer) - h.MaxBuffer; h.MaxBuffer > 0 && over > 0 {
+		h.buffer = h.buffer[over:]
+		h.dropped += uint64(over)
+	}
+}
+
+//Config 历史记录器配置文件
+type Config struct {
+	PLCs    []*pool.Endpoint `json:"plcs"`
+	Groups  []*Group         `json:"groups"`
+	Output  Output           `json:"output"`
+	FlushMs int              `json:"flush_ms"` //写入间隔 默认 1000
+	Buffer  int              `json:"buffer"`   //缓冲区最大记录数 默认 100000
+}
+
+//Output 文件写入目标配置，type 为 csv 或 jsonl；数据库写入目标在程序中导入驱动后用 NewSQLSink 创建
+type Output struct {
+	Type          string `json:"type"`
+	Dir           string `json:"dir"`
+	Prefix        string `json:"prefix"`
+	MaxSizeMB     int64  `json:"max_size_mb"`
+	RotateMinutes int    `json:"rotate_minutes"`
+	MaxAgeHours   int    `json:"max_age_hours"`
+	MaxTotalMB    int64  `json:"max_total_mb"`
+}
@@ -0,0 +1,181 @@
+package historian
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/types"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//memorySink 记录写入的行，fail 为真时写入失败
+type memorySink struct {
+	mutex sync.Mutex
+	rows  []*Row
+	fail  bool
+}
+
+func (s *memorySink) Write(rows []*Row) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.fail {
+		return errors.New("磁盘已满")
+	}
+	s.rows = append(s.rows, rows...)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func (s *memorySink) setFail(fail bool) {
+	s.mutex.Lock()
+	s.fail = fail
+	s.mutex.Unlock()
+}
+
+//count 指定组与质量的行数
+func (s *memorySink) count(group string, quality gologix.Quality) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := 0
+	for _, row := range s.rows {
+		if row.Group == group && row.Quality == quality {
+			n++
+		}
+	}
+	return n
+}
+
+func TestHistorian(t *testing.T) {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.AddTag("Speed", types.REAL, []float32{12.5})
+	sim.AddTag("Count", types.DINT, []int32{3})
+	manager, err := pool.NewManager([]*pool.Endpoint{
+		{Name: "line1", Address: sim.Addr()},
+		{Name: "offline", Address: "127.0.0.1:1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	sink := &memorySink{fail: true}
+	groups := []*Group{
+		{Name: "fast", PLC: "line1", Tags: []string{"Speed"}, RateMs: 20},
+		{Name: "counts", PLC: "line1", Tags: []string{"Count"}, RateMs: 20, Mode: ModeChange},
+		{Name: "remote", PLC: "offline", Tags: []string{"Level"}, RateMs: 20},
+	}
+	historian, err := New(manager, groups, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups[0].Mode != "" {
+		t.Fatalf("不应修改调用方的采样组 %q", groups[0].Mode)
+	}
+	historian.FlushInterval = 20 * time.Millisecond
+	historian.Logger = log.New(io.Discard, "", 0)
+	historian.Start()
+
+	//写入失败时记录保留在缓冲区
+	time.Sleep(200 * time.Millisecond)
+	if historian.Pending() == 0 || sink.count("fast", gologix.QualityGood) != 0 {
+		t.Fatal("写入失败时记录应保留在缓冲区")
+	}
+	sink.setFail(false)
+	err = manager.Do("line1", func(plc *gologix.PLC) error {
+		return plc.WriteTag("Count", 4)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err = historian.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if historian.Pending() != 0 {
+		t.Fatalf("停止后缓冲区应为空 %d", historian.Pending())
+	}
+	if sink.count("fast", gologix.QualityGood) < 5 {
+		t.Fatalf("周期采样记录不足 %d", sink.count("fast", gologix.QualityGood))
+	}
+	if n := sink.count("counts", gologix.QualityGood); n != 2 {
+		t.Fatalf("变化采样应只记录 2 次 %d", n)
+	}
+	if sink.count("remote", gologix.QualityBad) == 0 || sink.count("remote", gologix.QualityGood) != 0 {
+		t.Fatal("PLC 不可用时应记录 Bad 质量")
+	}
+	for _, row := range sink.rows {
+		if row.Group == "remote" && (row.Value != nil || row.Error == "") {
+			t.Fatalf("Bad 记录应没有数值并带错误 %+v", row)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(FileOptions{Dir: dir, Format: FormatCSV, MaxSize: 300, MaxTotalSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 50; i++ {
+		row := &Row{Time: now.Add(time.Duration(i) * time.Second), PLC: "line1", Group: "g", Tag: "Speed",
+			Type: "REAL", Value: float32(i) + 0.5, Quality: gologix.QualityGood}
+		if err = sink.Write([]*Row{row}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	sink.Close()
+	paths, _ := filepath.Glob(filepath.Join(dir, "history-*.csv"))
+	if len(paths) < 2 {
+		t.Fatalf("超出大小应新建文件 %d", len(paths))
+	}
+	total := int64(0)
+	for _, path := range paths {
+		info, _ := os.Stat(path)
+		total += info.Size()
+	}
+	if total > 1000+300 {
+		t.Fatalf("超出总大小应删除旧文件 %d", total)
+	}
+	data, _ := os.ReadFile(paths[len(paths)-1])
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != strings.Join(csvHeader, ",") || !strings.HasSuffix(lines[len(lines)-1], ",REAL,49.5,Good,") {
+		t.Fatalf("CSV 内容错误\n%s", data)
+	}
+
+	sink, err = NewFileSink(FileOptions{Dir: dir, Format: FormatJSONL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write([]*Row{{Time: now, PLC: "line1", Group: "g", Tag: "Level", Quality: gologix.QualityBad, Error: "PLC 不可用"}})
+	sink.Close()
+	paths, _ = filepath.Glob(filepath.Join(dir, "history-*.jsonl"))
+	file, _ := os.Open(paths[0])
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+	record := map[string]interface{}{}
+	if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["quality"] != "Bad" || record["value"] != nil || record["error"] != "PLC 不可用" {
+		t.Fatalf("JSONL 内容错误 %v", record)
+	}
+}
@@ -0,0 +1,116 @@
+package historian
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+)
+
+//SQLOptions 数据库写入参数，SQL 语句按 SQLite 语法编写，MaxRows 按 rowid 删除
+type SQLOptions struct {
+	Table   string        //表名 默认 history
+	MaxAge  time.Duration //删除早于该时长的记录，0 表示不删除
+	MaxRows int64         //最多保留的记录数，0 表示不限制
+}
+
+//SQLSink 写入 database/sql 数据库，本库不包含驱动，需由调用方导入(如 modernc.org/sqlite)
+type SQLSink struct {
+	db      *sql.DB
+	options SQLOptions
+	insert  string
+}
+
+//sqlTimeLayout 定长的 UTC 时间文本，可以按文本比较先后
+const sqlTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+//NewSQLSink 创建数据库写入目标，表不存在时创建，并按保留策略删除旧记录
+func NewSQLSink(db *sql.DB, options SQLOptions) (*SQLSink, error) {
+	if options.Table == "" {
+		options.Table = "history"
+	}
+	if !tableName.MatchString(options.Table) {
+		return nil, errors.New("表名不正确 " + options.Table)
+	}
+	table := options.Table
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + table + ` (
+	time TEXT NOT NULL,
+	plc TEXT NOT NULL,
+	grp TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	type TEXT,
+	value TEXT,
+	quality TEXT NOT NULL,
+	error TEXT
+)`)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS ` + table + `_time ON ` + table + ` (time)`); err != nil {
+		return nil, err
+	}
+	sink := &SQLSink{
+		db:      db,
+		options: options,
+		insert:  `INSERT INTO ` + table + ` (time, plc, grp, tag, type, value, quality, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+	}
+	if err = sink.retain(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+//Write 在一个事务中写入记录，然后按保留策略删除旧记录
+func (s *SQLSink) Write(rows []*Row) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.insert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		var value interface{}
+		if row.Value != nil {
+			value = formatValue(row.Value)
+		}
+		_, err = stmt.Exec(row.Time.UTC().Format(sqlTimeLayout), row.PLC, row.Group, row.Tag, row.Type,
+			value, row.Quality.String(), row.Error)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	//保留策略失败不影响已写入的记录，下次写入时重试
+	s.retain()
+	return nil
+}
+
+//retain 删除超出保留时间或数量的记录，时间按定长文本比较
+func (s *SQLSink) retain() error {
+	table := s.options.Table
+	if s.options.MaxAge > 0 {
+		cutoff := time.Now().Add(-s.options.MaxAge).UTC().Format(sqlTimeLayout)
+		if _, err := s.db.Exec(`DELETE FROM `+table+` WHERE time < ?`, cutoff); err != nil {
+			return err
+		}
+	}
+	if s.options.MaxRows > 0 {
+		_, err := s.db.Exec(`DELETE FROM `+table+` WHERE rowid NOT IN (SELECT rowid FROM `+table+` ORDER BY rowid DESC LIMIT ?)`, s.options.MaxRows)
+		return err
+	}
+	return nil
+}
+
+//Close 不关闭数据库，数据库由调用方管理
+func (s *SQLSink) Close() error {
+	return nil
+}
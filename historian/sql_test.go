@@ -0,0 +1,144 @@
+package historian
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//recordDriver 记录执行的 SQL 语句与参数
+type recordDriver struct {
+	mutex      sync.Mutex
+	statements []string
+	args       [][]driver.Value
+	commits    int
+}
+
+func (d *recordDriver) Open(name string) (driver.Conn, error) {
+	return &recordConn{driver: d}, nil
+}
+
+type recordConn struct {
+	driver *recordDriver
+}
+
+func (c *recordConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordStmt{driver: c.driver, query: query}, nil
+}
+
+func (c *recordConn) Close() error {
+	return nil
+}
+
+func (c *recordConn) Begin() (driver.Tx, error) {
+	return &recordTx{driver: c.driver}, nil
+}
+
+type recordTx struct {
+	driver *recordDriver
+}
+
+func (t *recordTx) Commit() error {
+	t.driver.mutex.Lock()
+	t.driver.commits++
+	t.driver.mutex.Unlock()
+	return nil
+}
+
+func (t *recordTx) Rollback() error {
+	return nil
+}
+
+type recordStmt struct {
+	driver *recordDriver
+	query  string
+}
+
+func (s *recordStmt) Close() error {
+	return nil
+}
+
+func (s *recordStmt) NumInput() int {
+	return strings.Count(s.query, "?")
+}
+
+func (s *recordStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.mutex.Lock()
+	defer s.driver.mutex.Unlock()
+	s.driver.statements = append(s.driver.statements, s.query)
+	s.driver.args = append(s.driver.args, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("不支持查询")
+}
+
+//recordDrivers 已注册的驱动数量，驱动不能重复注册，每次打开使用新的名称
+var recordDrivers uint64
+
+//openRecordDB 注册新的驱动并打开数据库，重复运行测试时记录互不影响
+func openRecordDB(t *testing.T) (*sql.DB, *recordDriver) {
+	recorder := &recordDriver{}
+	name := fmt.Sprintf("historian-record-%d", atomic.AddUint64(&recordDrivers, 1))
+	sql.Register(name, recorder)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db, recorder
+}
+
+func TestSQLSink(t *testing.T) {
+	db, recorder := openRecordDB(t)
+	if _, err := NewSQLSink(db, SQLOptions{Table: "x; DROP TABLE y"}); err == nil {
+		t.Fatal("不合法的表名应返回错误")
+	}
+	sink, err := NewSQLSink(db, SQLOptions{Table: "tags", MaxAge: time.Hour, MaxRows: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	err = sink.Write([]*Row{
+		{Time: now, PLC: "line1", Group: "g", Tag: "Speed", Type: "REAL", Value: float32(1.5), Quality: gologix.QualityGood},
+		{Time: now, PLC: "line1", Group: "g", Tag: "Level", Quality: gologix.QualityBad, Error: "PLC 不可用"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := recorder.statements
+	if !strings.Contains(statements[2], "WHERE time < ?") {
+		t.Fatalf("创建时应按保留策略删除旧记录 %v", statements)
+	}
+	if !strings.HasPrefix(statements[0], "CREATE TABLE IF NOT EXISTS tags") || recorder.commits != 1 {
+		t.Fatalf("建表语句错误 %v", statements)
+	}
+	inserts := 0
+	for i, statement := range statements {
+		if !strings.HasPrefix(statement, "INSERT INTO tags") {
+			continue
+		}
+		inserts++
+		args := recorder.args[i]
+		if inserts == 1 && (args[0] != "2024-05-01T08:00:00.000000Z" || args[5] != "1.5" || args[6] != "Good") {
+			t.Fatalf("插入参数错误 %v", args)
+		}
+		if inserts == 2 && (args[5] != nil || args[6] != "Bad" || args[7] != "PLC 不可用") {
+			t.Fatalf("Bad 记录参数错误 %v", args)
+		}
+	}
+	last := statements[len(statements)-1]
+	if inserts != 2 || !strings.Contains(statements[len(statements)-2], "WHERE time < ?") || !strings.Contains(last, "LIMIT ?") {
+		t.Fatalf("保留策略语句错误 %v", statements)
+	}
+}
@@ -0,0 +1,409 @@
+//Package httpgateway 通过 REST/JSON 接口读写 PLC 标签
+//
+//接口:
+//  GET  /plcs                      所有 PLC 及链接状态
+//  GET  /plcs/{name}/info          设备信息
+//  GET  /plcs/{name}/tags/{tag}    读取标签，?count=N 读取 N 个元素
+//  PUT  /plcs/{name}/tags/{tag}    写入标签，请求体 {"value": v} 或 {"values": [...]}
+//  POST /plcs/{name}/read          批量读取，请求体 {"tags": [{"tag": "A", "count": 1}]}
+//  POST /plcs/{name}/write         批量写入，请求体 {"writes": [{"tag": "A", "value": 1}]}
+//  GET  /plcs/{name}/stream        WebSocket 订阅标签变化，消息格式见 StreamRequest 与 StreamMessage
+package httpgateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/types"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Config 网关配置文件
+type Config struct {
+	Listen string           `json:"listen"` //监听地址 默认 :8080
+	PLCs   []*pool.Endpoint `json:"plcs"`
+}
+
+//Server REST 网关
+type Server struct {
+	manager *pool.Manager
+	//MaxBodySize 请求体最大长度 默认 1MB
+	MaxBodySize int64
+	//MinRate 订阅的最小扫描周期 默认 100ms
+	MinRate time.Duration
+	//ClientInterval 向同一客户端两次推送的最小间隔 默认 100ms
+	ClientInterval time.Duration
+	//WriteTimeout 推送超时，超时的客户端被断开 默认 5s
+	WriteTimeout time.Duration
+	mutex        sync.Mutex
+	hubs         map[string]*hub
+}
+
+//New 创建网关，PLC 链接由 manager 管理
+func New(manager *pool.Manager) *Server {
+	return &Server{
+		manager:        manager,
+		MaxBodySize:    1 << 20,
+		MinRate:        100 * time.Millisecond,
+		ClientInterval: 100 * time.Millisecond,
+		WriteTimeout:   5 * time.Second,
+		hubs:           make(map[string]*hub),
+	}
+}
+
+//ErrorBody 错误信息，设备返回错误状态时包含 CIP 状态码
+type ErrorBody struct {
+	Error     string `json:"error"`
+	Kind      string `json:"kind,omitempty"`
+	CIPStatus *uint8 `json:"cip_status,omitempty"`
+}
+
+//TagBody 标签读取结果，单个元素时为 value，多个元素时为 values
+type TagBody struct {
+	Tag    string        `json:"tag"`
+	Type   string        `json:"type,omitempty"`
+	Value  interface{}   `json:"value,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+	Error  *ErrorBody    `json:"error,omitempty"`
+}
+
+//ReadItem 批量读取项
+type ReadItem struct {
+	Tag   string `json:"tag"`
+	Count uint16 `json:"count"`
+}
+
+//WriteItem 写入项，value 与 values 二选一
+type WriteItem struct {
+	Tag    string        `json:"tag"`
+	Value  interface{}   `json:"value"`
+	Values []interface{} `json:"values"`
+}
+
+//WriteResult 写入结果
+type WriteResult struct {
+	Tag   string     `json:"tag"`
+	OK    bool       `json:"ok"`
+	Error *ErrorBody `json:"error,omitempty"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	//标签名称中可能包含转义字符，按原始路径拆分
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		parts[i] = unescaped
+	}
+	if len(parts) == 0 || parts[0] != "plcs" {
+		writeError(w, http.StatusNotFound, errors.New("接口不存在"))
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.handleList(w)
+	case len(parts) == 3 && parts[2] == "info" && r.Method == http.MethodGet:
+		s.handleInfo(w, parts[1])
+	case len(parts) == 4 && parts[2] == "tags" && r.Method == http.MethodGet:
+		s.handleRead(w, r, parts[1], parts[3])
+	case len(parts) == 4 && parts[2] == "tags" && r.Method == http.MethodPut:
+		s.handleWrite(w, r, parts[1], parts[3])
+	case len(parts) == 3 && parts[2] == "read" && r.Method == http.MethodPost:
+		s.handleBatchRead(w, r, parts[1])
+	case len(parts) == 3 && parts[2] == "write" && r.Method == http.MethodPost:
+		s.handleBatchWrite(w, r, parts[1])
+	case len(parts) == 3 && parts[2] == "stream" && r.Method == http.MethodGet:
+		s.handleStream(w, r, parts[1])
+	case len(parts) <= 4:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("不支持的请求方法 "+r.Method))
+	default:
+		writeError(w, http.StatusNotFound, errors.New("接口不存在"))
+	}
+}
+
+func (s *Server) handleList(w http.ResponseWriter) {
+	statuses := make([]pool.Status, 0)
+	for _, name := range s.manager.Names() {
+		client, _ := s.manager.Client(name)
+		statuses = append(statuses, client.Status())
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, name string) {
+	var info gologix.PLCInfo
+	err := s.manager.Do(name, func(plc *gologix.PLC) error {
+		if err := plc.ReadAttributeAll(); err != nil {
+			return err
+		}
+		info = *plc.Info
+		return nil
+	})
+	if err != nil {
+		writeError(w, StatusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *Server) handleRead(w http.ResponseWriter, r *http.Request, name string, tag string) {
+	count := uint16(1)
+	if text := r.URL.Query().Get("count"); text != "" {
+		n, err := strconv.ParseUint(text, 10, 16)
+		if err != nil || n == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("count 参数不正确"))
+			return
+		}
+		count = uint16(n)
+	}
+	var body *TagBody
+	err := s.manager.Do(name, func(plc *gologix.PLC) error {
+		values, err := plc.ReadValues(tag, count)
+		if err != nil {
+			return err
+		}
+		body = tagBody(tag, values)
+		return nil
+	})
+	if err != nil {
+		writeError(w, StatusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request, name string, tag string) {
+	item := &WriteItem{}
+	if err := s.decode(w, r, item); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	item.Tag = tag
+	err := s.manager.Do(name, func(plc *gologix.PLC) error {
+		return writeItem(plc, item)
+	})
+	if err != nil {
+		writeError(w, StatusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &WriteResult{Tag: tag, OK: true})
+}
+
+func (s *Server) handleBatchRead(w http.ResponseWriter, r *http.Request, name string) {
+	request := struct {
+		Tags []ReadItem `json:"tags"`
+	}{}
+	if err := s.decode(w, r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(request.Tags) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("tags 为空"))
+		return
+	}
+	requests := make([]gologix.ReadRequest, len(request.Tags))
+	for i, item := range request.Tags {
+		if item.Count == 0 {
+			item.Count = 1
+		}
+		requests[i] = gologix.ReadRequest{Tag: item.Tag, Elements: item.Count}
+	}
+	client, err := s.manager.Client(name)
+	if err != nil {
+		writeError(w, StatusOf(err), err)
+		return
+	}
+	bodies, err := readBatch(client, requests)
+	if err != nil {
+		writeError(w, StatusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": bodies})
+}
+
+func (s *Server) handleBatchWrite(w http.ResponseWriter, r *http.Request, name string) {
+	request := struct {
+		Writes []*WriteItem `json:"writes"`
+	}{}
+	if err := s.decode(w, r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(request.Writes) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("writes 为空"))
+		return
+	}
+	results := make([]*WriteResult, 0, len(request.Writes))
+	err := s.manager.Do(name, func(plc *gologix.PLC) error {
+		for _, item := range request.Writes {
+			result := &WriteResult{Tag: item.Tag, OK: true}
+			if err := writeItem(plc, item); err != nil {
+				if !plc.Connected() {
+					return err
+				}
+				result.OK, result.Error = false, errorBody(err)
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, StatusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+//readBatch 批量读取，标签错误记录在各自的结果中，只有链接错误时返回 error
+func readBatch(plc gologix.TagReader, requests []gologix.ReadRequest) ([]*TagBody, error) {
+	results, err := plc.MultiReadTags(requests)
+	if err != nil {
+		return nil, err
+	}
+	bodies := make([]*TagBody, 0, len(requests))
+	for _, item := range requests {
+		values, err := results[item.Tag].Elements(item.Elements)
+		if err != nil {
+			bodies = append(bodies, &TagBody{Tag: item.Tag, Error: errorBody(err)})
+			continue
+		}
+		bodies = append(bodies, tagBody(item.Tag, values))
+	}
+	return bodies, nil
+}
+
+//decode 解析请求体，数值保留为 json.Number 以免大整数丢失精度
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.MaxBodySize))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		if err == io.EOF {
+			return errors.New("请求体为空")
+		}
+		return fmt.Errorf("请求体格式不正确: %w", err)
+	}
+	return nil
+}
+
+//writeItem 写入单个标签，时间类型的字符串按 RFC3339 或时长格式转换
+func writeItem(plc *gologix.PLC, item *WriteItem) error {
+	values := item.Values
+	if values == nil {
+		if item.Value == nil {
+			return &types.EncodeError{Value: nil, Err: types.ErrTypeMismatch}
+		}
+		values = []interface{}{item.Value}
+	}
+	baseTag, _ := lib.ParseTagName(item.Tag)
+	dataType, err := plc.ReadPartialTag(baseTag)
+	if err != nil {
+		return err
+	}
+	if types.IsTimeType(dataType) || dataType == types.LINT {
+		for i, value := range values {
+			if text, ok := value.(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, text); err == nil {
+					values[i] = t
+				} else if d, err := time.ParseDuration(text); err == nil && dataType != types.LINT {
+					values[i] = d
+				}
+			}
+		}
+	}
+	return plc.WriteTag(item.Tag, values...)
+}
+
+//tagBody 读取结果转换为 JSON
+func tagBody(tag string, values []gologix.Value) *TagBody {
+	body := &TagBody{Tag: tag}
+	if len(values) > 0 {
+		body.Type = values[0].DType.String()
+	}
+	if len(values) == 1 {
+		body.Value = jsonValue(values[0].Data)
+		return body
+	}
+	body.Values = make([]interface{}, len(values))
+	for i, value := range values {
+		body.Values[i] = jsonValue(value.Data)
+	}
+	return body
+}
+
+//jsonValue 转换 JSON 不支持的数值: NaN 与无穷大为字符串，时长为字符串
+func jsonValue(value interface{}) interface{} {
+	switch data := value.(type) {
+	case float32:
+		return jsonValue(float64(data))
+	case float64:
+		if math.IsNaN(data) || math.IsInf(data, 0) {
+			return strconv.FormatFloat(data, 'g', -1, 64)
+		}
+		return data
+	case time.Duration:
+		return data.String()
+	default:
+		return data
+	}
+}
+
+//StatusOf 错误对应的 HTTP 状态码
+func StatusOf(err error) int {
+	switch {
+	case errors.Is(err, pool.ErrUnknownPLC):
+		return http.StatusNotFound
+	case errors.Is(err, pool.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	switch gologix.ClassifyError(err) {
+	case gologix.ErrorNotFound:
+		return http.StatusNotFound
+	case gologix.ErrorForbidden:
+		return http.StatusForbidden
+	case gologix.ErrorUnsupported:
+		return http.StatusNotImplemented
+	case gologix.ErrorInvalid, gologix.ErrorOutOfRange:
+		return http.StatusBadRequest
+	case gologix.ErrorConflict:
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+//errorBody 错误转换为 JSON
+func errorBody(err error) *ErrorBody {
+	body := &ErrorBody{Error: err.Error()}
+	var tagErr *gologix.TagError
+	if errors.As(err, &tagErr) {
+		body.Kind = tagErr.Kind.String()
+		if tagErr.Kind == gologix.TagErrorStatus {
+			status := tagErr.Status
+			body.CIPStatus = &status
+		}
+	}
+	return body
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorBody(err))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
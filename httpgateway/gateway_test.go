@@ -0,0 +1,116 @@
+package httpgateway
+
+import (
+	"encoding/json"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sim.Close()
+	})
+	sim.AddTag("P_REAL", types.REAL, []float32{1.5, 2.5, 3.5})
+	sim.AddTag("Counter", types.SINT, []int8{7})
+	sim.AddTag("Flags", types.DINT, []int32{0})
+	manager, err := pool.NewManager([]*pool.Endpoint{{Name: "line1", Address: sim.Addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(New(manager))
+	t.Cleanup(func() {
+		server.Close()
+		manager.Close()
+	})
+	return server
+}
+
+func request(t *testing.T, method string, url string, body string, v interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if v != nil {
+		if err = json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestGateway(t *testing.T) {
+	server := newTestServer(t)
+	base := server.URL + "/plcs/line1"
+
+	body := &TagBody{}
+	if status := request(t, "GET", base+"/tags/P_REAL%5B1%5D?count=2", "", body); status != 200 {
+		t.Fatalf("读取状态 %d", status)
+	}
+	if body.Type != "REAL" || len(body.Values) != 2 || body.Values[1] != 3.5 {
+		t.Fatalf("读取结果错误 %+v", body)
+	}
+	errBody := &ErrorBody{}
+	if status := request(t, "GET", base+"/tags/Missing", "", errBody); status != http.StatusNotFound || errBody.CIPStatus == nil || *errBody.CIPStatus != 0x05 {
+		t.Fatalf("不存在的标签应返回 404 %d %+v", status, errBody)
+	}
+	if status := request(t, "GET", server.URL+"/plcs/line9/tags/P_REAL", "", nil); status != http.StatusNotFound {
+		t.Fatalf("不存在的 PLC 应返回 404 %d", status)
+	}
+	if status := request(t, "PUT", base+"/tags/Counter", `{"value": 300}`, errBody); status != http.StatusBadRequest {
+		t.Fatalf("超出范围应返回 400 %d", status)
+	}
+	if status := request(t, "PUT", base+"/tags/Counter", `{"value": -5}`, nil); status != 200 {
+		t.Fatalf("写入状态 %d", status)
+	}
+
+	writes := struct {
+		Results []*WriteResult `json:"results"`
+	}{}
+	status := request(t, "POST", base+"/write", `{"writes": [{"tag": "Flags.2", "value": true}, {"tag": "P_REAL[0]", "values": [9, 8]}, {"tag": "Missing", "value": 1}]}`, &writes)
+	if status != 200 || len(writes.Results) != 3 || !writes.Results[0].OK || !writes.Results[1].OK || writes.Results[2].OK {
+		t.Fatalf("批量写入结果错误 %d %+v", status, writes.Results)
+	}
+
+	reads := struct {
+		Results []*TagBody `json:"results"`
+	}{}
+	status = request(t, "POST", base+"/read", `{"tags": [{"tag": "Counter"}, {"tag": "P_REAL[0]", "count": 3}, {"tag": "Flags"}, {"tag": "Missing"}]}`, &reads)
+	if status != 200 || len(reads.Results) != 4 {
+		t.Fatalf("批量读取结果错误 %d %+v", status, reads.Results)
+	}
+	if reads.Results[0].Value != float64(-5) || reads.Results[1].Values[1] != float64(8) || reads.Results[2].Value != float64(4) || reads.Results[3].Error == nil {
+		t.Fatalf("批量读取数值错误 %+v %+v %+v", reads.Results[0], reads.Results[1], reads.Results[2])
+	}
+
+	info := map[string]interface{}{}
+	if status = request(t, "GET", base+"/info", "", &info); status != 200 || info["Name"] == "" {
+		t.Fatalf("设备信息错误 %d %v", status, info)
+	}
+	statuses := []pool.Status{}
+	if status = request(t, "GET", server.URL+"/plcs", "", &statuses); status != 200 || len(statuses) != 1 || !statuses[0].Connected {
+		t.Fatalf("PLC 列表错误 %d %+v", status, statuses)
+	}
+}
+
+func TestGatewayUnavailable(t *testing.T) {
+	manager, _ := pool.NewManager([]*pool.Endpoint{{Name: "down", Address: "127.0.0.1:1"}})
+	server := httptest.NewServer(New(manager))
+	defer server.Close()
+	if status := request(t, "GET", server.URL+"/plcs/down/tags/A", "", nil); status != http.StatusServiceUnavailable {
+		t.Fatalf("无法链接时应返回 503 %d", status)
+	}
+}
@@ -0,0 +1,264 @@
+package httpgateway
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/websocket"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//StreamRequest 客户端订阅消息
+//  {"op": "subscribe", "tags": ["A", "B"], "rate_ms": 500}
+//  {"op": "unsubscribe", "tags": ["A"]}
+type StreamRequest struct {
+	Op     string   `json:"op"`
+	Tags   []string `json:"tags"`
+	RateMs int64    `json:"rate_ms"`
+}
+
+//StreamUpdate 标签变化
+type StreamUpdate struct {
+	*TagBody
+	Quality string    `json:"quality"`
+	Time    time.Time `json:"time"`
+}
+
+//StreamMessage 推送给客户端的消息，type 为 subscribed/unsubscribed/update/error
+type StreamMessage struct {
+	Type    string          `json:"type"`
+	Tags    []string        `json:"tags,omitempty"`
+	RateMs  int64           `json:"rate_ms,omitempty"`
+	Updates []*StreamUpdate `json:"updates,omitempty"`
+	Dropped int             `json:"dropped,omitempty"` //推送前被新值覆盖的变化数量
+	Error   string          `json:"error,omitempty"`
+}
+
+//hub 单个 PLC 的订阅，所有客户端共用一个 Subscriber，相同周期的标签只读取一次
+type hub struct {
+	subscriber *gologix.Subscriber
+}
+
+//hub 获取 PLC 的订阅，不存在时创建
+func (s *Server) hub(name string) (*hub, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if h, ok := s.hubs[name]; ok {
+		return h, nil
+	}
+	client, err := s.manager.Client(name)
+	if err != nil {
+		return nil, err
+	}
+	h := &hub{subscriber: gologix.NewSubscriber(client, 0)}
+	h.subscriber.Start()
+	s.hubs[name] = h
+	return h, nil
+}
+
+//Close 停止所有 PLC 的订阅扫描，PLC 链接由 pool.Manager 关闭
+func (s *Server) Close() {
+	s.mutex.Lock()
+	hubs := s.hubs
+	s.hubs = make(map[string]*hub)
+	s.mutex.Unlock()
+	for _, h := range hubs {
+		h.subscriber.Stop()
+	}
+}
+
+//subscribe 订阅标签，首次扫描推送当前结果，之后只推送变化
+func (h *hub) subscribe(client *streamClient, tag string, rate time.Duration) (*gologix.Subscription, error) {
+	return h.subscriber.Add([]string{tag}, rate, gologix.SubscribeOptions{}, func(events []gologix.ChangeEvent) {
+		for _, event := range events {
+			client.push(streamUpdate(event))
+		}
+	})
+}
+
+//streamUpdate 变化事件转换为推送内容
+func streamUpdate(event gologix.ChangeEvent) *StreamUpdate {
+	update := &StreamUpdate{Quality: event.Quality.String(), Time: event.Time}
+	if event.Err != nil {
+		update.TagBody = &TagBody{Tag: event.Tag, Error: errorBody(event.Err)}
+	} else {
+		update.TagBody = tagBody(event.Tag, event.Values)
+	}
+	return update
+}
+
+//streamClient WebSocket 客户端，变化先进入待发送队列，同一标签只保留最新值
+type streamClient struct {
+	server   *Server
+	conn     *websocket.Conn
+	mutex    sync.Mutex
+	pending  map[string]*StreamUpdate
+	dropped  int
+	notify   chan struct{}
+	interval time.Duration
+	subs     map[string]*gologix.Subscription //标签对应的订阅，只在读取协程中访问
+	done     chan struct{}
+}
+
+func newStreamClient(s *Server, conn *websocket.Conn, interval time.Duration) *streamClient {
+	return &streamClient{
+		server:   s,
+		conn:     conn,
+		pending:  make(map[string]*StreamUpdate),
+		notify:   make(chan struct{}, 1),
+		interval: interval,
+		subs:     make(map[string]*gologix.Subscription),
+		done:     make(chan struct{}),
+	}
+}
+
+//push 加入待发送队列，不阻塞，未发送的旧值被覆盖
+func (c *streamClient) push(update *StreamUpdate) {
+	c.mutex.Lock()
+	if _, ok := c.pending[update.Tag]; ok {
+		c.dropped++
+	}
+	c.pending[update.Tag] = update
+	c.mutex.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+//send 写入一条消息，超时后关闭链接
+func (c *streamClient) send(message *StreamMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.server.WriteTimeout))
+	if err = c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		c.conn.Close()
+	}
+	return err
+}
+
+//writeLoop 推送待发送的变化，两次推送至少间隔 interval
+func (c *streamClient) writeLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.notify:
+		}
+		c.mutex.Lock()
+		pending, dropped := c.pending, c.dropped
+		c.pending, c.dropped = make(map[string]*StreamUpdate), 0
+		c.mutex.Unlock()
+		updates := make([]*StreamUpdate, 0, len(pending))
+		for _, update := range pending {
+			updates = append(updates, update)
+		}
+		sort.Slice(updates, func(i, j int) bool {
+			return updates[i].Tag < updates[j].Tag
+		})
+		if err := c.send(&StreamMessage{Type: "update", Updates: updates, Dropped: dropped}); err != nil {
+			return
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.interval):
+		}
+	}
+}
+
+//handle 处理订阅消息
+func (c *streamClient) handle(h *hub, request *StreamRequest) error {
+	if len(request.Tags) == 0 {
+		return errors.New("缺少标签")
+	}
+	switch request.Op {
+	case "subscribe":
+		rate := time.Duration(request.RateMs) * time.Millisecond
+		if rate == 0 {
+			rate = time.Second
+		}
+		if rate < c.server.MinRate {
+			rate = c.server.MinRate
+		}
+		if err := c.send(&StreamMessage{Type: "subscribed", Tags: request.Tags, RateMs: rate.Milliseconds()}); err != nil {
+			return err
+		}
+		for _, tag := range request.Tags {
+			if old, ok := c.subs[tag]; ok {
+				h.subscriber.Remove(old)
+				delete(c.subs, tag)
+			}
+			sub, err := h.subscribe(c, tag, rate)
+			if err != nil {
+				return err
+			}
+			c.subs[tag] = sub
+		}
+	case "unsubscribe":
+		for _, tag := range request.Tags {
+			if sub, ok := c.subs[tag]; ok {
+				h.subscriber.Remove(sub)
+				delete(c.subs, tag)
+			}
+		}
+		return c.send(&StreamMessage{Type: "unsubscribed", Tags: request.Tags})
+	default:
+		return errors.New("不支持的操作 " + request.Op)
+	}
+	return nil
+}
+
+//handleStream 升级为 WebSocket 并处理订阅，?interval_ms=N 设置两次推送的最小间隔
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, name string) {
+	h, err := s.hub(name)
+	if err != nil {
+		writeError(w, StatusOf(err), err)
+		return
+	}
+	interval := s.ClientInterval
+	if text := r.URL.Query().Get("interval_ms"); text != "" {
+		ms, err := strconv.ParseUint(text, 10, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("interval_ms 参数不正确"))
+			return
+		}
+		if d := time.Duration(ms) * time.Millisecond; d > interval {
+			interval = d
+		}
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	client := newStreamClient(s, conn, interval)
+	go client.writeLoop()
+	defer func() {
+		for _, sub := range client.subs {
+			h.subscriber.Remove(sub)
+		}
+		close(client.done)
+		conn.Close()
+	}()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		request := &StreamRequest{}
+		if err = json.Unmarshal(data, request); err == nil {
+			err = client.handle(h, request)
+		}
+		if err != nil {
+			if client.send(&StreamMessage{Type: "error", Error: err.Error()}) != nil {
+				return
+			}
+		}
+	}
+}
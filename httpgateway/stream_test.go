@@ -0,0 +1,93 @@
+package httpgateway
+
+import (
+	"encoding/json"
+	"github.com/wj008/gologix/internal/websocket"
+	"strings"
+	"testing"
+	"time"
+)
+
+//readStream 读取消息直到得到指定类型
+func readStream(t *testing.T, conn *websocket.Conn, messageType string) *StreamMessage {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := &StreamMessage{}
+		if err = json.Unmarshal(data, message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := newTestServer(t)
+	gateway := server.Config.Handler.(*Server)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/plcs/line1/stream"
+
+	clients := make([]*websocket.Conn, 2)
+	for i := range clients {
+		conn, err := websocket.Dial(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		clients[i] = conn
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"op":"subscribe","tags":["Counter"],"rate_ms":100}`))
+		if message := readStream(t, conn, "subscribed"); message.RateMs != 100 {
+			t.Fatalf("订阅应答错误 %+v", message)
+		}
+		message := readStream(t, conn, "update")
+		if len(message.Updates) != 1 || message.Updates[0].Value != 7.0 || message.Updates[0].Quality != "Good" {
+			t.Fatalf("首次推送错误 %+v", message.Updates[0])
+		}
+	}
+	gateway.mutex.Lock()
+	hubs := len(gateway.hubs)
+	gateway.mutex.Unlock()
+	if hubs != 1 {
+		t.Fatalf("同一 PLC 的订阅应共用一个 Subscriber %d", hubs)
+	}
+
+	if status := request(t, "PUT", server.URL+"/plcs/line1/tags/Counter", `{"value": 9}`, nil); status != 200 {
+		t.Fatalf("写入状态 %d", status)
+	}
+	for _, conn := range clients {
+		message := readStream(t, conn, "update")
+		if message.Updates[0].Value != 9.0 {
+			t.Fatalf("变化推送错误 %+v", message.Updates[0])
+		}
+	}
+
+	clients[0].WriteMessage(websocket.TextMessage, []byte(`{"op":"watch","tags":["Counter"]}`))
+	if message := readStream(t, clients[0], "error"); message.Error == "" {
+		t.Fatal("不支持的操作应返回错误")
+	}
+	for _, conn := range clients {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"op":"unsubscribe","tags":["Counter"]}`))
+		readStream(t, conn, "unsubscribed")
+	}
+	gateway.Close()
+	gateway.mutex.Lock()
+	hubs = len(gateway.hubs)
+	gateway.mutex.Unlock()
+	if hubs != 0 {
+		t.Fatalf("关闭后应停止所有订阅 %d", hubs)
+	}
+}
+
+func TestStreamBackpressure(t *testing.T) {
+	client := newStreamClient(New(nil), nil, time.Second)
+	for i := 0; i < 3; i++ {
+		client.push(&StreamUpdate{TagBody: &TagBody{Tag: "A", Value: i}})
+	}
+	if len(client.pending) != 1 || client.dropped != 2 || client.pending["A"].Value != 2 {
+		t.Fatalf("慢速客户端只保留最新值 %d %d", len(client.pending), client.dropped)
+	}
+}
@@ -0,0 +1,156 @@
+package influx
+
+import (
+	"errors"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/historian"
+	"time"
+)
+
+//Mapping 单个标签的映射，空字段沿用 Converter 的设置
+type Mapping struct {
+	Measurement string            `json:"measurement"`
+	Field       string            `json:"field"`
+	Tags        map[string]string `json:"tags"` //与 Converter.Tags 合并，同名时覆盖
+}
+
+//Converter 把标签读取结果转换为数据点
+type Converter struct {
+	Measurement  string              `json:"measurement"`   //默认 plc
+	Field        string              `json:"field"`         //保存数值的字段 默认 value
+	TagKey       string              `json:"tag_key"`       //保存标签名的 tag 键 默认 tag，"-" 表示不保存
+	QualityField string              `json:"quality_field"` //保存质量的字段，为空时质量为 Bad 的结果不写入
+	Tags         map[string]string   `json:"tags"`          //所有数据点的固定 tag
+	Mappings     map[string]*Mapping `json:"mappings"`      //按标签名覆盖
+}
+
+//Point 转换一个标签的数值，质量为 Bad 且未设置 QualityField 时返回 nil
+func (c *Converter) Point(tag string, value interface{}, quality gologix.Quality, t time.Time) *Point {
+	measurement, field, tagKey := c.Measurement, c.Field, c.TagKey
+	if measurement == "" {
+		measurement = "plc"
+	}
+	if field == "" {
+		field = "value"
+	}
+	if tagKey == "" {
+		tagKey = "tag"
+	}
+	tags := make(map[string]string, len(c.Tags)+1)
+	if tagKey != "-" {
+		tags[tagKey] = tag
+	}
+	for key, value := range c.Tags {
+		tags[key] = value
+	}
+	if mapping, ok := c.Mappings[tag]; ok && mapping != nil {
+		if mapping.Measurement != "" {
+			measurement = mapping.Measurement
+		}
+		if mapping.Field != "" {
+			field = mapping.Field
+		}
+		for key, value := range mapping.Tags {
+			tags[key] = value
+		}
+	}
+	fields := make(map[string]interface{}, 2)
+	if quality == gologix.QualityGood {
+		fields[field] = value
+	} else if c.QualityField == "" {
+		return nil
+	}
+	if c.QualityField != "" {
+		fields[c.QualityField] = quality.String()
+	}
+	return &Point{Measurement: measurement, Tags: tags, Fields: fields, Time: t}
+}
+
+//Values 转换 MultiReadTag 的结果，t 应为收到应答的时间
+func (c *Converter) Values(values map[string]*gologix.TagValue, t time.Time) []*Point {
+	points := make([]*Point, 0, len(values))
+	for tag, value := range values {
+		quality := gologix.QualityGood
+		if value == nil || value.Err != nil || value.Status != 0 || value.Value == nil {
+			quality = gologix.QualityBad
+		}
+		var data interface{}
+		if value != nil {
+			data = value.Value
+		}
+		if point := c.Point(tag, data, quality, t); point != nil {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+//Event 转换订阅引擎的变化事件，时间为事件时间
+func (c *Converter) Event(event gologix.ChangeEvent) *Point {
+	return c.Point(event.Tag, event.NewValue, event.Quality, event.Time)
+}
+
+//Read 批量读取标签并转换，时间为收到应答的时间，读取失败的标签质量为 Bad，只有链接错误时返回 error
+func (c *Converter) Read(plc gologix.TagReader, tags []string) ([]*Point, error) {
+	requests := make([]gologix.ReadRequest, len(tags))
+	for i, tag := range tags {
+		requests[i] = gologix.ReadRequest{Tag: tag, Elements: 1}
+	}
+	results, err := plc.MultiReadTags(requests)
+	now := time.Now()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]*gologix.TagValue, len(tags))
+	for _, tag := range tags {
+		value := &gologix.TagValue{}
+		if result := results[tag]; result != nil {
+			value.Status, value.DType = result.Status, result.DType
+		}
+		typed, err := results[tag].Elements(1)
+		if err != nil {
+			value.Err = err
+		} else {
+			value.Value = typed[0].Data
+		}
+		values[tag] = value
+	}
+	return c.Values(values, now), nil
+}
+
+//Sink 把历史记录写入 InfluxDB，实现 historian.Sink
+//
+//记录的 PLC 名称与采样组名称分别写入 plc 与 group tag。
+type Sink struct {
+	converter *Converter
+	writer    *Writer
+}
+
+//NewSink 创建历史记录写入目标
+func NewSink(converter *Converter, writer *Writer) *Sink {
+	return &Sink{converter: converter, writer: writer}
+}
+
+//Write 转换记录并加入发送队列，发送失败由 Writer 重试与保存
+func (s *Sink) Write(rows []*historian.Row) error {
+	points := make([]*Point, 0, len(rows))
+	for _, row := range rows {
+		point := s.converter.Point(row.Tag, row.Value, row.Quality, row.Time)
+		if point == nil {
+			continue
+		}
+		point.Tags["plc"] = row.PLC
+		point.Tags["group"] = row.Group
+		points = append(points, point)
+	}
+	//无效的数据点(如 NaN)已被忽略，重新写入也不会成功，只有关闭后返回错误
+	if err := s.writer.Write(points...); errors.Is(err, ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+//Close 发送剩余数据点并关闭 Writer
+func (s *Sink) Close() error {
+	return s.writer.Close()
+}
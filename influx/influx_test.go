@@ -0,0 +1,211 @@
+package influx
+
+import (
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/historian"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/types"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLine(t *testing.T) {
+	now := time.Unix(1714550400, 5)
+	point := &Point{
+		Measurement: "line 1,a",
+		Tags:        map[string]string{"tag": "Speed=1", "site": "", "area": "A B"},
+		Fields:      map[string]interface{}{"value": float32(1.5), "count": int32(-3), "ok": true, "name": `a "b"`, "nan": math.NaN()},
+		Time:        now,
+	}
+	line, err := point.Line()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `line\ 1\,a,area=A\ B,tag=Speed\=1 count=-3i,name="a \"b\"",ok=true,value=1.5 1714550400000000005`
+	if line != expect {
+		t.Fatalf("行协议错误\n%s\n%s", line, expect)
+	}
+	point.Fields = map[string]interface{}{"value": math.Inf(1)}
+	if _, err = point.Line(); err == nil {
+		t.Fatal("没有有效字段时应返回错误")
+	}
+}
+
+func TestConverter(t *testing.T) {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.AddTag("Speed", types.REAL, []float32{12.5})
+	sim.AddTag("Count", types.DINT, []int32{3})
+	plc := gologix.NewPLC()
+	if err = plc.Connect(sim.Addr(), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer plc.Close()
+	converter := &Converter{
+		Measurement:  "line1",
+		Tags:         map[string]string{"site": "north"},
+		QualityField: "quality",
+		Mappings:     map[string]*Mapping{"Count": {Measurement: "counters", Field: "total"}},
+	}
+	before := time.Now()
+	points, err := converter.Read(plc, []string{"Speed", "Count", "Missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := map[string]string{}
+	for _, point := range points {
+		if point.Time.Before(before) {
+			t.Fatal("时间应为收到应答的时间")
+		}
+		point.Time = time.Time{}
+		line, err := point.Line()
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines[point.Tags["tag"]] = line
+	}
+	if lines["Speed"] != `line1,site=north,tag=Speed quality="Good",value=12.5` ||
+		lines["Count"] != `counters,site=north,tag=Count quality="Good",total=3i` ||
+		lines["Missing"] != `line1,site=north,tag=Missing quality="Bad"` {
+		t.Fatalf("转换结果错误 %v", lines)
+	}
+	converter.QualityField = ""
+	if converter.Point("Missing", nil, gologix.QualityBad, before) != nil {
+		t.Fatal("未设置质量字段时 Bad 结果不应写入")
+	}
+}
+
+//stub 记录收到的请求，fail 大于 0 时返回 503 并减 1
+type stub struct {
+	mutex  sync.Mutex
+	lines  []string
+	fail   int
+	reject bool
+	auth   string
+	query  string
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.auth, s.query = r.Header.Get("Authorization"), r.URL.RawQuery
+	body, _ := io.ReadAll(r.Body)
+	if s.fail > 0 {
+		s.fail--
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	if s.reject {
+		http.Error(w, "unable to parse", http.StatusBadRequest)
+		return
+	}
+	s.lines = append(s.lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *stub) received() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+func TestWriter(t *testing.T) {
+	handler := &stub{fail: 100}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	dir := t.TempDir()
+	options := Options{URL: server.URL, Org: "plant", Bucket: "plc", Token: "secret", BatchSize: 2,
+		FlushInterval: time.Hour, Retries: 1, RetryDelay: time.Millisecond, BufferDir: dir}
+	writer, err := NewWriter(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Logger = log.New(io.Discard, "", 0)
+	point := func(i int) *Point {
+		return &Point{Measurement: "m", Fields: map[string]interface{}{"value": i}, Time: time.Unix(0, int64(i))}
+	}
+
+	//服务不可用时批次保存到磁盘
+	writer.Write(point(1), point(2), point(3))
+	if err = writer.Flush(); err == nil {
+		t.Fatal("服务不可用时应返回错误")
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.lp"))
+	if len(paths) != 2 || writer.Pending() != 0 {
+		t.Fatalf("失败的批次应保存到磁盘 %d", len(paths))
+	}
+
+	//服务恢复后先补发磁盘中的批次，并保持顺序
+	handler.mutex.Lock()
+	handler.fail = 1
+	handler.mutex.Unlock()
+	writer.Write(point(4))
+	if err = writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(handler.received(), ";"); got != "m value=1i 1;m value=2i 2;m value=3i 3;m value=4i 4" {
+		t.Fatalf("补发顺序错误 %s", got)
+	}
+	if paths, _ = filepath.Glob(filepath.Join(dir, "*.lp")); len(paths) != 0 {
+		t.Fatal("补发后应删除磁盘中的批次")
+	}
+	if handler.auth != "Token secret" || handler.query != "bucket=plc&org=plant&precision=ns" {
+		t.Fatalf("请求参数错误 %s %s", handler.auth, handler.query)
+	}
+
+	//数据被拒绝时不重试也不保存
+	handler.mutex.Lock()
+	handler.reject = true
+	handler.mutex.Unlock()
+	writer.Write(point(5))
+	if err = writer.Flush(); err == nil || writer.Dropped() != 1 {
+		t.Fatalf("被拒绝的数据应丢弃 %v %d", err, writer.Dropped())
+	}
+	if paths, _ = filepath.Glob(filepath.Join(dir, "*.lp")); len(paths) != 0 {
+		t.Fatal("被拒绝的数据不应保存")
+	}
+	writer.Close()
+	if writer.Write(point(6)) != ErrClosed {
+		t.Fatal("关闭后写入应返回 ErrClosed")
+	}
+}
+
+func TestSink(t *testing.T) {
+	handler := &stub{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	writer, err := NewWriter(Options{URL: server.URL, Database: "plc", FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sink historian.Sink = NewSink(&Converter{}, writer)
+	now := time.Unix(10, 0)
+	err = sink.Write([]*historian.Row{
+		{Time: now, PLC: "line1", Group: "fast", Tag: "Speed", Value: float32(2.5), Quality: gologix.QualityGood},
+		{Time: now, PLC: "line1", Group: "fast", Tag: "Level", Quality: gologix.QualityBad},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := handler.received(); len(got) != 1 || got[0] != "plc,group=fast,plc=line1,tag=Speed value=2.5 10000000000" {
+		t.Fatalf("历史记录转换错误 %v", got)
+	}
+	if handler.query != "db=plc&precision=ns" {
+		t.Fatalf("1.x 请求参数错误 %s", handler.query)
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
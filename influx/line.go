@@ -0,0 +1,137 @@
+//Package influx 把 PLC 读取结果转换为 InfluxDB 行协议，并分批写入 HTTP 接口
+//
+//发送失败的批次按退避重试，仍失败时保存到磁盘目录，下次发送成功前先按顺序补发。
+package influx
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Point 一个数据点
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+//Line 编码为一行行协议(不含换行)，tag 与字段按名称排序，时间精度为纳秒
+//
+//空的 tag 值与 NaN、无穷大的字段会被忽略，没有有效字段时返回错误。
+func (p *Point) Line() (string, error) {
+	if p.Measurement == "" {
+		return "", errors.New("数据点缺少 measurement")
+	}
+	builder := &strings.Builder{}
+	builder.WriteString(measurementEscaper.Replace(p.Measurement))
+	for _, key := range sortedKeys(p.Tags) {
+		if key == "" || p.Tags[key] == "" {
+			continue
+		}
+		builder.WriteString(",")
+		builder.WriteString(keyEscaper.Replace(key))
+		builder.WriteString("=")
+		builder.WriteString(keyEscaper.Replace(p.Tags[key]))
+	}
+	fields := 0
+	for _, key := range sortedFields(p.Fields) {
+		value, ok := formatField(p.Fields[key])
+		if key == "" || !ok {
+			continue
+		}
+		if fields == 0 {
+			builder.WriteString(" ")
+		} else {
+			builder.WriteString(",")
+		}
+		builder.WriteString(keyEscaper.Replace(key))
+		builder.WriteString("=")
+		builder.WriteString(value)
+		fields++
+	}
+	if fields == 0 {
+		return "", errors.New("数据点 " + p.Measurement + " 没有有效字段")
+	}
+	if !p.Time.IsZero() {
+		builder.WriteString(" ")
+		builder.WriteString(strconv.FormatInt(p.Time.UnixNano(), 10))
+	}
+	return builder.String(), nil
+}
+
+//formatField 编码字段值，整数带 i 后缀，不支持的数值返回 false
+func formatField(value interface{}) (string, bool) {
+	switch data := value.(type) {
+	case bool:
+		return strconv.FormatBool(data), true
+	case int8:
+		return strconv.FormatInt(int64(data), 10) + "i", true
+	case int16:
+		return strconv.FormatInt(int64(data), 10) + "i", true
+	case int32:
+		return strconv.FormatInt(int64(data), 10) + "i", true
+	case int64:
+		return strconv.FormatInt(data, 10) + "i", true
+	case int:
+		return strconv.Itoa(data) + "i", true
+	case uint8:
+		return strconv.FormatUint(uint64(data), 10) + "i", true
+	case uint16:
+		return strconv.FormatUint(uint64(data), 10) + "i", true
+	case uint32:
+		return strconv.FormatUint(uint64(data), 10) + "i", true
+	case uint64:
+		//InfluxDB 1.x 不支持无符号整数，超出 int64 范围时写为浮点数
+		if data > math.MaxInt64 {
+			return strconv.FormatFloat(float64(data), 'g', -1, 64), true
+		}
+		return strconv.FormatUint(data, 10) + "i", true
+	case float32:
+		if math.IsNaN(float64(data)) || math.IsInf(float64(data), 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(float64(data), 'g', -1, 32), true
+	case float64:
+		if math.IsNaN(data) || math.IsInf(data, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(data, 'g', -1, 64), true
+	case string:
+		return `"` + stringEscaper.Replace(data) + `"`, true
+	case time.Duration:
+		return strconv.FormatInt(int64(data), 10) + "i", true
+	case time.Time:
+		return strconv.FormatInt(data.UnixNano(), 10) + "i", true
+	default:
+		return "", false
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFields(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,403 @@
+package influx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ErrClosed Writer 已关闭
+var ErrClosed = errors.New("influx writer 已关闭")
+
+//StatusError InfluxDB 返回的错误状态
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("InfluxDB 返回 %d: %s", e.Code, e.Message)
+}
+
+//Temporary 是否可以重试，429 与 5xx 可以重试，其他错误说明数据无效
+func (e *StatusError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+//Options 写入参数，设置 Database 时使用 1.x 的 /write 接口，否则使用 2.x 的 /api/v2/write 接口
+type Options struct {
+	URL           string        //InfluxDB 地址，如 http://127.0.0.1:8086
+	Org           string        //2.x 组织
+	Bucket        string        //2.x bucket
+	Token         string        //2.x API Token
+	Database      string        //1.x 数据库
+	Username      string        //1.x 用户名
+	Password      string        //1.x 密码
+	BatchSize     int           //每批最多行数 默认 5000
+	FlushInterval time.Duration //发送间隔 默认 1s
+	Retries       int           //每批重试次数 默认 3，负数表示不重试
+	RetryDelay    time.Duration //首次重试等待时间，之后每次加倍 默认 500ms
+	Timeout       time.Duration //请求超时 默认 10s
+	MaxPending    int           //内存中等待发送的最大行数，超出时丢弃最旧的行 默认 100000
+	BufferDir     string        //保存发送失败批次的目录，为空时丢弃失败的批次
+	MaxBufferSize int64         //磁盘缓冲最大字节数，超出时删除最旧的批次 默认 100MB
+}
+
+//Writer 分批发送数据点，创建后在后台按间隔或批次大小发送
+type Writer struct {
+	options  Options
+	endpoint string
+	client   *http.Client
+	mutex    sync.Mutex
+	pending  []string
+	dropped  uint64
+	sequence uint64
+	closed   bool
+	flushing sync.Mutex
+	notify   chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	//Logger 记录后台发送失败，默认 log.Default()
+	Logger *log.Logger
+}
+
+//NewWriter 创建 Writer 并启动后台发送，BufferDir 中上次保存的批次会在下次发送时补发
+func NewWriter(options Options) (*Writer, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(options.URL, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, errors.New("InfluxDB 地址不正确 " + options.URL)
+	}
+	query := url.Values{"precision": {"ns"}}
+	if options.Database != "" {
+		endpoint.Path += "/write"
+		query.Set("db", options.Database)
+	} else if options.Bucket != "" {
+		endpoint.Path += "/api/v2/write"
+		query.Set("org", options.Org)
+		query.Set("bucket", options.Bucket)
+	} else {
+		return nil, errors.New("需要设置 bucket 或 database")
+	}
+	endpoint.RawQuery = query.Encode()
+	if options.BatchSize <= 0 {
+		options.BatchSize = 5000
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	if options.Retries == 0 {
+		options.Retries = 3
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = 500 * time.Millisecond
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if options.MaxPending <= 0 {
+		options.MaxPending = 100000
+	}
+	if options.MaxBufferSize <= 0 {
+		options.MaxBufferSize = 100 << 20
+	}
+	if options.BufferDir != "" {
+		if err = os.MkdirAll(options.BufferDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	w := &Writer{
+		options:  options,
+		endpoint: endpoint.String(),
+		client:   &http.Client{Timeout: options.Timeout},
+		notify:   make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		Logger:   log.Default(),
+	}
+	go w.loop()
+	return w, nil
+}
+
+//Write 编码数据点并加入发送队列，无效的数据点被忽略并返回第一个错误
+func (w *Writer) Write(points ...*Point) error {
+	var firstErr error
+	lines := make([]string, 0, len(points))
+	for _, point := range points {
+		line, err := point.Line()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return ErrClosed
+	}
+	w.pending = append(w.pending, lines...)
+	if over := len(w.pending) - w.options.MaxPending; over > 0 {
+		w.pending = w.pending[over:]
+		w.dropped += uint64(over)
+	}
+	full := len(w.pending) >= w.options.BatchSize
+	w.mutex.Unlock()
+	if full {
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+	return firstErr
+}
+
+//Pending 内存中等待发送的行数
+func (w *Writer) Pending() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.pending)
+}
+
+//Dropped 丢弃的行数，包括队列已满、数据被拒绝与超出磁盘缓冲大小
+func (w *Writer) Dropped() uint64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.dropped
+}
+
+//Close 停止后台发送，发送队列中剩余的数据点，失败时保存到磁盘
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mutex.Unlock()
+	close(w.stop)
+	<-w.done
+	return w.Flush()
+}
+
+func (w *Writer) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		case <-w.notify:
+		}
+		if err := w.Flush(); err != nil {
+			w.Logger.Println("写入 InfluxDB 失败:", err)
+		}
+	}
+}
+
+//Flush 先补发磁盘中的批次，再发送队列中的数据点，失败的批次保存到磁盘
+func (w *Writer) Flush() error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+	w.mutex.Lock()
+	lines := w.pending
+	w.pending = nil
+	w.mutex.Unlock()
+	var batches [][]string
+	for len(lines) > 0 {
+		n := w.options.BatchSize
+		if n > len(lines) {
+			n = len(lines)
+		}
+		batches = append(batches, lines[:n])
+		lines = lines[n:]
+	}
+	if err := w.replay(); err != nil {
+		//磁盘中还有未发送的批次，新数据也保存到磁盘以保持顺序
+		w.spill(batches)
+		return err
+	}
+	var rejected error
+	for i, batch := range batches {
+		err := w.send(batch)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && !statusErr.Temporary() {
+			//数据被拒绝，重试也不会成功
+			w.drop(len(batch))
+			rejected = err
+			continue
+		}
+		if err != nil {
+			w.spill(batches[i:])
+			return err
+		}
+	}
+	return rejected
+}
+
+//replay 按顺序补发磁盘中的批次，数据被拒绝的批次直接删除
+func (w *Writer) replay() error {
+	if w.options.BufferDir == "" {
+		return nil
+	}
+	for _, path := range w.bufferFiles() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		err = w.send(lines)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && !statusErr.Temporary() {
+			w.drop(len(lines))
+		} else if err != nil {
+			return err
+		}
+		os.Remove(path)
+	}
+	return nil
+}
+
+//spill 保存发送失败的批次，超出磁盘缓冲大小时删除最旧的批次
+func (w *Writer) spill(batches [][]string) {
+	for i, batch := range batches {
+		if w.options.BufferDir == "" {
+			w.drop(len(batch))
+			continue
+		}
+		w.sequence++
+		name := fmt.Sprintf("influx-%019d-%06d.lp", time.Now().UnixNano(), w.sequence%1000000)
+		data := strings.Join(batch, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(w.options.BufferDir, name), []byte(data), 0644); err != nil {
+			w.Logger.Println("保存 InfluxDB 批次失败:", err)
+			for _, rest := range batches[i:] {
+				w.drop(len(rest))
+			}
+			return
+		}
+	}
+	w.trimBuffer()
+}
+
+//trimBuffer 删除超出磁盘缓冲大小的最旧批次
+func (w *Writer) trimBuffer() {
+	paths := w.bufferFiles()
+	sizes := make([]int64, len(paths))
+	total := int64(0)
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(paths) && total > w.options.MaxBufferSize; i++ {
+		if data, err := os.ReadFile(paths[i]); err == nil {
+			w.drop(bytes.Count(data, []byte("\n")))
+		}
+		os.Remove(paths[i])
+		total -= sizes[i]
+	}
+}
+
+//bufferFiles 磁盘中的批次，文件名含保存时间，按名称排序即按时间排序
+func (w *Writer) bufferFiles() []string {
+	paths, _ := filepath.Glob(filepath.Join(w.options.BufferDir, "influx-*.lp"))
+	sort.Strings(paths)
+	return paths
+}
+
+func (w *Writer) drop(n int) {
+	w.mutex.Lock()
+	w.dropped += uint64(n)
+	w.mutex.Unlock()
+}
+
+//send 发送一个批次，可重试的错误按退避重试，关闭时不再等待重试
+func (w *Writer) send(lines []string) error {
+	body := []byte(strings.Join(lines, "\n") + "\n")
+	delay := w.options.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := w.post(body)
+		var statusErr *StatusError
+		if err == nil || attempt >= w.options.Retries || (errors.As(err, &statusErr) && !statusErr.Temporary()) {
+			return err
+		}
+		select {
+		case <-w.stop:
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (w *Writer) post(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.options.Token != "" {
+		request.Header.Set("Authorization", "Token "+w.options.Token)
+	} else if w.options.Username != "" {
+		request.SetBasicAuth(w.options.Username, w.options.Password)
+	}
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode/100 != 2 {
+		return &StatusError{Code: response.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return nil
+}
+
+//Config 配置文件中的 InfluxDB 输出
+type Config struct {
+	URL         string    `json:"url"`
+	Org         string    `json:"org"`
+	Bucket      string    `json:"bucket"`
+	Token       string    `json:"token"`
+	Database    string    `json:"database"`
+	Username    string    `json:"username"`
+	Password    string    `json:"password"`
+	BatchSize   int       `json:"batch_size"`    //每批最多行数 默认 5000
+	FlushMs     int       `json:"flush_ms"`      //发送间隔 默认 1000
+	Retries     int       `json:"retries"`       //每批重试次数 默认 3
+	BufferDir   string    `json:"buffer_dir"`    //保存发送失败批次的目录
+	MaxBufferMB int64     `json:"max_buffer_mb"` //磁盘缓冲最大大小 默认 100
+	Point       Converter `json:"point"`         //measurement、tag 与字段映射
+}
+
+//Options 转换为写入参数
+func (c *Config) Options() Options {
+	return Options{
+		URL:           c.URL,
+		Org:           c.Org,
+		Bucket:        c.Bucket,
+		Token:         c.Token,
+		Database:      c.Database,
+		Username:      c.Username,
+		Password:      c.Password,
+		BatchSize:     c.BatchSize,
+		FlushInterval: time.Duration(c.FlushMs) * time.Millisecond,
+		Retries:       c.Retries,
+		BufferDir:     c.BufferDir,
+		MaxBufferSize: c.MaxBufferMB << 20,
+	}
+}
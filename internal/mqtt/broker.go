@@ -0,0 +1,221 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+//Broker 进程内 MQTT 代理，用于测试: 支持 QoS 0 转发、保留消息与遗嘱
+type Broker struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	sessions map[*session]bool
+	retained map[string]*Message
+	wait     sync.WaitGroup
+}
+
+//session 代理上的客户端链接
+type session struct {
+	conn       net.Conn
+	writeMutex sync.Mutex
+	filters    []string
+	will       *Message
+}
+
+//NewBroker 在 addr 上监听，addr 为空时使用随机端口
+func NewBroker(addr string) (*Broker, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	b := &Broker{listener: listener, sessions: make(map[*session]bool), retained: make(map[string]*Message)}
+	b.wait.Add(1)
+	go b.accept()
+	return b, nil
+}
+
+//Addr 监听地址
+func (b *Broker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+//Close 关闭代理与所有链接
+func (b *Broker) Close() {
+	b.listener.Close()
+	b.mutex.Lock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+	b.mutex.Unlock()
+	b.wait.Wait()
+}
+
+//Disconnect 断开所有客户端但不清除遗嘱，用于模拟网络中断
+func (b *Broker) Disconnect() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+func (b *Broker) accept() {
+	defer b.wait.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.wait.Add(1)
+		go b.serve(conn)
+	}
+}
+
+func (s *session) write(packet []byte) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	s.conn.Write(packet)
+}
+
+//serve 处理单个链接，非正常断开时发布遗嘱
+func (b *Broker) serve(conn net.Conn) {
+	defer b.wait.Done()
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	header, body, err := readPacket(reader)
+	if err != nil || header>>4 != connectPacket {
+		return
+	}
+	s := &session{conn: conn}
+	if s.will, err = parseConnect(body); err != nil {
+		s.write(encodePacket(connackPacket<<4, []byte{0, 1}))
+		return
+	}
+	s.write(encodePacket(connackPacket<<4, []byte{0, 0}))
+	b.mutex.Lock()
+	b.sessions[s] = true
+	b.mutex.Unlock()
+	defer func() {
+		b.mutex.Lock()
+		delete(b.sessions, s)
+		will := s.will
+		b.mutex.Unlock()
+		if will != nil {
+			b.publish(will)
+		}
+	}()
+	for {
+		header, body, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case publishPacket:
+			message, id, err := decodePublish(header, body)
+			if err != nil {
+				return
+			}
+			if (header>>1)&0x03 == 1 {
+				s.write(encodePacket(pubackPacket<<4, appendUint16(nil, id)))
+			}
+			b.publish(message)
+		case subscribePacket:
+			if len(body) < 2 {
+				return
+			}
+			reply := append([]byte(nil), body[:2]...)
+			rest := body[2:]
+			var filters []string
+			for len(rest) > 0 {
+				filter, next, err := readString(rest)
+				if err != nil || len(next) < 1 {
+					return
+				}
+				filters = append(filters, filter)
+				reply = append(reply, 0)
+				rest = next[1:]
+			}
+			b.mutex.Lock()
+			s.filters = append(s.filters, filters...)
+			var retained []*Message
+			for topic, message := range b.retained {
+				for _, filter := range filters {
+					if Match(filter, topic) {
+						retained = append(retained, message)
+						break
+					}
+				}
+			}
+			b.mutex.Unlock()
+			s.write(encodePacket(subackPacket<<4, reply))
+			for _, message := range retained {
+				s.write(encodePublish(message))
+			}
+		case pingreqPacket:
+			s.write(encodePacket(pingrespPacket<<4, nil))
+		case disconnectPacket:
+			b.mutex.Lock()
+			s.will = nil
+			b.mutex.Unlock()
+			return
+		}
+	}
+}
+
+//publish 转发给订阅的链接，保留消息载荷为空时清除
+func (b *Broker) publish(message *Message) {
+	b.mutex.Lock()
+	if message.Retain {
+		if len(message.Payload) == 0 {
+			delete(b.retained, message.Topic)
+		} else {
+			b.retained[message.Topic] = message
+		}
+	}
+	var targets []*session
+	for s := range b.sessions {
+		for _, filter := range s.filters {
+			if Match(filter, message.Topic) {
+				targets = append(targets, s)
+				break
+			}
+		}
+	}
+	b.mutex.Unlock()
+	packet := encodePublish(&Message{Topic: message.Topic, Payload: message.Payload})
+	for _, s := range targets {
+		s.write(packet)
+	}
+}
+
+//parseConnect 解析 CONNECT 报文，返回遗嘱消息
+func parseConnect(body []byte) (*Message, error) {
+	protocol, rest, err := readString(body)
+	if err != nil || protocol != "MQTT" || len(rest) < 4 || rest[0] != 4 {
+		return nil, errors.New("不支持的协议版本")
+	}
+	flags := rest[1]
+	if _, rest, err = readString(rest[4:]); err != nil {
+		return nil, err
+	}
+	if flags&0x04 == 0 {
+		return nil, nil
+	}
+	will := &Message{Retain: flags&0x20 != 0}
+	if will.Topic, rest, err = readString(rest); err != nil {
+		return nil, err
+	}
+	if len(rest) < 2 || len(rest) < 2+int(binary.BigEndian.Uint16(rest)) {
+		return nil, errors.New("遗嘱消息不完整")
+	}
+	will.Payload = append([]byte(nil), rest[2:2+int(binary.BigEndian.Uint16(rest))]...)
+	return will, nil
+}
@@ -0,0 +1,255 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+//Options 链接参数
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration //心跳周期 默认 30s
+	Timeout   time.Duration //链接与订阅的等待时间 默认 10s
+	Will      *Message      //链接异常断开时代理发布的遗嘱消息
+}
+
+//Client MQTT 客户端，收到的消息在读取协程中交给 handler
+type Client struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	options    Options
+	handler    func(*Message)
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	packetID   uint16
+	acks       map[uint16]chan []byte
+	done       chan struct{}
+	err        error
+	closeOnce  sync.Once
+}
+
+//connack 返回码
+var connackErrors = map[byte]string{
+	1: "不支持的协议版本",
+	2: "客户端标识不合格",
+	3: "服务不可用",
+	4: "用户名或密码错误",
+	5: "未授权",
+}
+
+//Dial 链接代理，handler 可为 nil
+func Dial(addr string, options Options, handler func(*Message)) (*Client, error) {
+	if options.KeepAlive == 0 {
+		options.KeepAlive = 30 * time.Second
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 10 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", addr, options.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		options: options,
+		handler: handler,
+		acks:    make(map[uint16]chan []byte),
+		done:    make(chan struct{}),
+	}
+	if err = c.connect(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	go c.keepAlive()
+	return c, nil
+}
+
+//connect 发送 CONNECT 并等待 CONNACK
+func (c *Client) connect() error {
+	flags := byte(0x02) //clean session
+	body := appendString(nil, "MQTT")
+	payload := appendString(nil, c.options.ClientID)
+	if will := c.options.Will; will != nil {
+		flags |= 0x04
+		if will.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, will.Topic)
+		payload = appendUint16(payload, uint16(len(will.Payload)))
+		payload = append(payload, will.Payload...)
+	}
+	if c.options.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, c.options.Username)
+		if c.options.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, c.options.Password)
+		}
+	}
+	body = append(body, 4, flags)
+	body = appendUint16(body, uint16(c.options.KeepAlive/time.Second))
+	c.conn.SetDeadline(time.Now().Add(c.options.Timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if _, err := c.conn.Write(encodePacket(connectPacket<<4, append(body, payload...))); err != nil {
+		return err
+	}
+	header, reply, err := readPacket(c.reader)
+	if err != nil {
+		return err
+	}
+	if header>>4 != connackPacket || len(reply) < 2 {
+		return errors.New("MQTT 链接应答不正确")
+	}
+	if reply[1] != 0 {
+		if message, ok := connackErrors[reply[1]]; ok {
+			return errors.New("MQTT 链接被拒绝: " + message)
+		}
+		return fmt.Errorf("MQTT 链接被拒绝: %d", reply[1])
+	}
+	return nil
+}
+
+//write 写入报文
+func (c *Client) write(packet []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.options.Timeout))
+	_, err := c.conn.Write(packet)
+	if err != nil {
+		c.close(err)
+	}
+	return err
+}
+
+//Publish 以 QoS 0 发布消息
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	return c.write(encodePublish(&Message{Topic: topic, Payload: payload, Retain: retain}))
+}
+
+//Subscribe 以 QoS 0 订阅主题并等待应答
+func (c *Client) Subscribe(filters ...string) error {
+	c.mutex.Lock()
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+	id := c.packetID
+	ack := make(chan []byte, 1)
+	c.acks[id] = ack
+	c.mutex.Unlock()
+	defer func() {
+		c.mutex.Lock()
+		delete(c.acks, id)
+		c.mutex.Unlock()
+	}()
+	body := appendUint16(nil, id)
+	for _, filter := range filters {
+		body = append(appendString(body, filter), 0)
+	}
+	if err := c.write(encodePacket(subscribePacket<<4|0x02, body)); err != nil {
+		return err
+	}
+	select {
+	case codes := <-ack:
+		for i, code := range codes {
+			if code == 0x80 && i < len(filters) {
+				return errors.New("MQTT 订阅被拒绝 " + filters[i])
+			}
+		}
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-time.After(c.options.Timeout):
+		return errors.New("MQTT 订阅超时")
+	}
+}
+
+//Disconnect 发送 DISCONNECT 后关闭链接，代理不发布遗嘱
+func (c *Client) Disconnect() error {
+	err := c.write(encodePacket(disconnectPacket<<4, nil))
+	c.close(errors.New("MQTT 链接已关闭"))
+	return err
+}
+
+//Done 链接断开后关闭
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+//Err 链接断开的原因
+func (c *Client) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *Client) close(err error) {
+	c.closeOnce.Do(func() {
+		c.mutex.Lock()
+		c.err = err
+		c.mutex.Unlock()
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+//readLoop 读取报文，超过 1.5 倍心跳周期没有数据时认为链接断开
+func (c *Client) readLoop() {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.options.KeepAlive * 3 / 2))
+		header, body, err := readPacket(c.reader)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		switch header >> 4 {
+		case publishPacket:
+			message, id, err := decodePublish(header, body)
+			if err != nil {
+				c.close(err)
+				return
+			}
+			if (header>>1)&0x03 == 1 {
+				c.write(encodePacket(pubackPacket<<4, appendUint16(nil, id)))
+			}
+			if c.handler != nil {
+				c.handler(message)
+			}
+		case subackPacket:
+			if len(body) < 2 {
+				continue
+			}
+			c.mutex.Lock()
+			ack, ok := c.acks[binary.BigEndian.Uint16(body)]
+			c.mutex.Unlock()
+			if ok {
+				ack <- body[2:]
+			}
+		}
+	}
+}
+
+//keepAlive 周期发送 PINGREQ
+func (c *Client) keepAlive() {
+	ticker := time.NewTicker(c.options.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if c.write(encodePacket(pingreqPacket<<4, nil)) != nil {
+				return
+			}
+		}
+	}
+}
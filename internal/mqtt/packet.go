@@ -0,0 +1,151 @@
+//Package mqtt 精简的 MQTT 3.1.1 客户端与进程内代理，只支持 QoS 0 发布与订阅
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//报文类型
+const (
+	connectPacket     = 1
+	connackPacket     = 2
+	publishPacket     = 3
+	pubackPacket      = 4
+	subscribePacket   = 8
+	subackPacket      = 9
+	pingreqPacket     = 12
+	pingrespPacket    = 13
+	disconnectPacket  = 14
+	maxRemainingBytes = 4
+)
+
+//MaxPacketSize 最大报文长度
+const MaxPacketSize = 16 << 20
+
+//Message 发布的消息
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+//readPacket 读取一个报文，返回首字节与剩余部分
+func readPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := 0
+	for i, shift := 0, 0; ; i, shift = i+1, shift+7 {
+		if i == maxRemainingBytes {
+			return 0, nil, errors.New("MQTT 报文长度不正确")
+		}
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if length > MaxPacketSize {
+		return 0, nil, fmt.Errorf("MQTT 报文过长 %d", length)
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+//encodePacket 编码报文，body 为可变头与载荷
+func encodePacket(header byte, body []byte) []byte {
+	packet := make([]byte, 0, len(body)+5)
+	packet = append(packet, header)
+	length := len(body)
+	for {
+		b := byte(length & 0x7f)
+		length >>= 7
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+//appendString 追加带 2 字节长度前缀的字符串
+func appendString(buf []byte, text string) []byte {
+	return append(appendUint16(buf, uint16(len(text))), text...)
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+//readString 读取带长度前缀的字符串，返回剩余数据
+func readString(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, errors.New("MQTT 字符串不完整")
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+length {
+		return "", nil, errors.New("MQTT 字符串不完整")
+	}
+	return string(data[2 : 2+length]), data[2+length:], nil
+}
+
+//encodePublish 编码 QoS 0 发布报文
+func encodePublish(message *Message) []byte {
+	header := byte(publishPacket << 4)
+	if message.Retain {
+		header |= 0x01
+	}
+	body := appendString(make([]byte, 0, len(message.Topic)+len(message.Payload)+2), message.Topic)
+	return encodePacket(header, append(body, message.Payload...))
+}
+
+//decodePublish 解析发布报文，QoS 大于 0 时返回报文标识
+func decodePublish(header byte, body []byte) (*Message, uint16, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	qos := (header >> 1) & 0x03
+	id := uint16(0)
+	if qos > 0 {
+		if len(rest) < 2 {
+			return nil, 0, errors.New("MQTT 发布报文不完整")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	return &Message{Topic: topic, Payload: rest, Retain: header&0x01 != 0}, id, nil
+}
+
+//Match 主题是否匹配订阅过滤器，支持 + 与 # 通配符
+func Match(filter string, topic string) bool {
+	filters := strings.Split(filter, "/")
+	topics := strings.Split(topic, "/")
+	for i, part := range filters {
+		if part == "#" {
+			return true
+		}
+		if i >= len(topics) {
+			return false
+		}
+		if part != "+" && part != topics[i] {
+			return false
+		}
+	}
+	return len(filters) == len(topics)
+}
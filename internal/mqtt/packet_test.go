@@ -0,0 +1,114 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	//剩余长度跨越 1 到 3 字节的边界
+	for _, size := range []int{0, 127, 128, 16383, 16384, 70000} {
+		body := bytes.Repeat([]byte{0x5a}, size)
+		packet := encodePacket(pingreqPacket<<4, body)
+		header, got, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+		if err != nil || header != pingreqPacket<<4 || !bytes.Equal(got, body) {
+			t.Fatalf("长度 %d 往返错误 %v", size, err)
+		}
+	}
+	message := &Message{Topic: "spBv1.0/plant/DDATA/edge/line1", Payload: []byte{1, 2, 3}, Retain: true}
+	header, body, err := readPacket(bufio.NewReader(bytes.NewReader(encodePublish(message))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, id, err := decodePublish(header, body)
+	if err != nil || id != 0 || got.Topic != message.Topic || !bytes.Equal(got.Payload, message.Payload) || !got.Retain {
+		t.Fatalf("发布报文往返错误 %+v %v", got, err)
+	}
+	//QoS 1 报文带报文标识
+	body = append(appendString(nil, "a/b"), 0x12, 0x34, 'x')
+	if got, id, err = decodePublish(publishPacket<<4|0x02, body); err != nil || id != 0x1234 || string(got.Payload) != "x" {
+		t.Fatalf("QoS 1 发布报文错误 %+v %x %v", got, id, err)
+	}
+}
+
+func TestPacketMalformed(t *testing.T) {
+	cases := map[string][]byte{
+		"剩余长度超过 4 字节": {0x30, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"剩余长度不完整":     {0x30, 0x80},
+		"报文体不完整":      {0x30, 0x05, 'a'},
+		"超过最大长度":      {0x30, 0xff, 0xff, 0xff, 0x7f},
+	}
+	for name, data := range cases {
+		if _, _, err := readPacket(bufio.NewReader(bytes.NewReader(data))); err == nil {
+			t.Errorf("%s 应返回错误", name)
+		}
+	}
+	for _, body := range [][]byte{{}, {0x00}, {0x00, 0x05, 'a'}} {
+		if _, _, err := decodePublish(publishPacket<<4, body); err == nil {
+			t.Errorf("不完整的主题 % x 应返回错误", body)
+		}
+	}
+	if _, _, err := decodePublish(publishPacket<<4|0x02, appendString(nil, "a")); err == nil {
+		t.Error("缺少报文标识应返回错误")
+	}
+}
+
+func TestParseConnect(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	client := &Client{conn: local, reader: bufio.NewReader(local), options: Options{
+		ClientID: "edge", Username: "u", Password: "p", KeepAlive: 30 * time.Second, Timeout: time.Second,
+		Will: &Message{Topic: "spBv1.0/plant/NDEATH/edge", Payload: []byte{9, 8}, Retain: true},
+	}}
+	received := make(chan []byte, 1)
+	go func() {
+		header, body, err := readPacket(bufio.NewReader(remote))
+		if err != nil || header != connectPacket<<4 {
+			received <- nil
+			return
+		}
+		received <- body
+		remote.Write(encodePacket(connackPacket<<4, []byte{0, 0}))
+	}()
+	if err := client.connect(); err != nil {
+		t.Fatal(err)
+	}
+	will, err := parseConnect(<-received)
+	if err != nil || will.Topic != client.options.Will.Topic || !bytes.Equal(will.Payload, []byte{9, 8}) || !will.Retain {
+		t.Fatalf("遗嘱消息错误 %+v %v", will, err)
+	}
+	for _, body := range [][]byte{
+		appendString(nil, "MQIsdp"),
+		append(appendString(nil, "MQTT"), 3, 0, 0, 30),
+		append(appendString(nil, "MQTT"), 4, 0x04, 0, 30, 0, 1),
+		append(appendString(appendString(append(appendString(nil, "MQTT"), 4, 0x04, 0, 30), "id"), "will"), 0, 5, 'x'),
+	} {
+		if _, err := parseConnect(body); err == nil {
+			t.Errorf("错误的 CONNECT 报文 % x 应返回错误", body)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a/b/c", true},
+		{"#", "a", true},
+		{"a/b/c", "a/b", false},
+		{"+/+", "a", false},
+	}
+	for _, c := range cases {
+		if Match(c.filter, c.topic) != c.match {
+			t.Errorf("%s 匹配 %s 应为 %v", c.filter, c.topic, c.match)
+		}
+	}
+}
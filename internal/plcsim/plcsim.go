@@ -0,0 +1,604 @@
+//Package plcsim 用于离线测试的简易 Logix 模拟器
+package plcsim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/epath"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/types"
+	"io"
+	"net"
+	"sort"
+	"sync"
+)
+
+//Tag 模拟标签
+type Tag struct {
+	DType      types.DataType
+	Handle     uint16
+	TemplateID uint16
+	Size       int
+	Dims       []uint32
+	Access     uint8
+	Constant   bool
+	Data       []byte
+}
+
+//Template 模拟结构体模板
+type Template struct {
+	Handle      uint16
+	Size        uint32
+	MemberCount uint16
+	Definition  []byte
+}
+
+//OpenRequest 收到的 ForwardOpen 请求
+type OpenRequest struct {
+	Large             bool
+	Priority          uint8
+	TimeoutTicks      uint8
+	OTConnectionID    uint32
+	TOConnectionID    uint32
+	ConnectionSerial  uint16
+	VendorID          uint16
+	OriginatorSerial  uint32
+	TimeoutMultiplier uint8
+	OTRPI             uint32
+	TORPI             uint32
+	Path              []byte
+}
+
+//ReplyLimit 单次读取应答的最大数据长度
+const ReplyLimit = 480
+
+//Sim 用于离线测试的简易 Logix 模拟器
+type Sim struct {
+	listener   net.Listener
+	mutex      sync.Mutex
+	tags       map[string]*Tag
+	templates  map[uint16]*Template
+	nextID     uint32
+	toIDs      map[uint32]uint32
+	connUsage  map[uint32]int
+	maxConnect int
+	routes     [][]byte
+	opens      []*OpenRequest
+	conns      map[net.Conn]bool
+	accepts    int
+	identity   uint8
+}
+
+//New 在本机随机端口启动模拟器
+func New() (*Sim, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	sim := &Sim{
+		listener:   listener,
+		tags:       make(map[string]*Tag),
+		templates:  make(map[uint16]*Template),
+		nextID:     0x1000,
+		toIDs:      make(map[uint32]uint32),
+		connUsage:  make(map[uint32]int),
+		maxConnect: 8,
+		conns:      make(map[net.Conn]bool),
+	}
+	go sim.serve(listener)
+	return sim, nil
+}
+
+//Close 停止模拟器，已建立的链接需通过 Drop 断开
+func (s *Sim) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.listener.Close()
+}
+
+//Restart 关闭后在原地址重新监听
+func (s *Sim) Restart() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	listener, err := net.Listen("tcp", s.listener.Addr().String())
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go s.serve(listener)
+	return nil
+}
+
+//Drop 断开所有已建立的链接
+func (s *Sim) Drop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+//FailIdentity 设置读取设备信息时返回的状态码，0 为正常应答
+func (s *Sim) FailIdentity(status uint8) {
+	s.mutex.Lock()
+	s.identity = status
+	s.mutex.Unlock()
+}
+
+//Accepts 已接受的链接数量
+func (s *Sim) Accepts() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.accepts
+}
+
+func (s *Sim) Addr() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.listener.Addr().String()
+}
+
+//AddTag 添加标签，values 为同一类型的元素切片
+func (s *Sim) AddTag(name string, dataType types.DataType, values interface{}) {
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, values)
+	s.mutex.Lock()
+	s.tags[name] = &Tag{DType: dataType, Data: buffer.Bytes()}
+	s.mutex.Unlock()
+}
+
+//AddArray 添加多维数组标签，values 按行优先顺序排列
+func (s *Sim) AddArray(name string, dataType types.DataType, dims []uint32, values interface{}) {
+	s.AddTag(name, dataType, values)
+	s.mutex.Lock()
+	s.tags[name].Dims = dims
+	s.mutex.Unlock()
+}
+
+//AddStruct 添加结构体标签
+func (s *Sim) AddStruct(name string, templateID uint16, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	template := s.templates[templateID]
+	s.tags[name] = &Tag{DType: types.STRUCT, Handle: template.Handle, TemplateID: templateID, Size: int(template.Size), Data: data}
+}
+
+//SetAccess 设置标签的外部访问与常量标志
+func (s *Sim) SetAccess(name string, access uint8, constant bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if tag, ok := s.tags[name]; ok {
+		tag.Access = access
+		tag.Constant = constant
+	}
+}
+
+//RemoveTag 删除标签
+func (s *Sim) RemoveTag(name string) {
+	s.mutex.Lock()
+	delete(s.tags, name)
+	s.mutex.Unlock()
+}
+
+//ConnectionUsage 各链接(O->T 链接ID)收到的链接消息数量
+func (s *Sim) ConnectionUsage() map[uint32]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	usage := make(map[uint32]int, len(s.connUsage))
+	for id, count := range s.connUsage {
+		usage[id] = count
+	}
+	return usage
+}
+
+//Routes 收到的 Unconnected Send 路由路径
+func (s *Sim) Routes() [][]byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]byte{}, s.routes...)
+}
+
+//OpenRequests 收到的 ForwardOpen 请求
+func (s *Sim) OpenRequests() []*OpenRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*OpenRequest{}, s.opens...)
+}
+
+//AddTemplate 添加结构体模板
+func (s *Sim) AddTemplate(id uint16, template *Template) {
+	s.mutex.Lock()
+	s.templates[id] = template
+	s.mutex.Unlock()
+}
+
+func (s *Sim) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.accepts++
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *Sim) handle(conn net.Conn) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+	for {
+		head := make([]byte, 24)
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return
+		}
+		header := enip.Header{}
+		lib.ReadByte(bytes.NewReader(head), &header)
+		body := make([]byte, header.Length)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		reply := &enip.Package{Header: header}
+		switch header.Command {
+		case enip.CommandRegisterSession:
+			reply.SessionId = 0x1234
+			reply.Data = body
+		case enip.CommandUnRegisterSession:
+			return
+		case enip.CommandSendRRData:
+			items := enip.ParserCPF(body[6:])
+			replyData := s.handleUnconnected(items[1].Data)
+			reply.Data = enip.BuildRRData(replyData, 0).Data
+		case enip.CommandSendUnitData:
+			items := enip.ParserCPF(body[6:])
+			otID := binary.LittleEndian.Uint32(items[0].Data)
+			sequence := binary.LittleEndian.Uint16(items[1].Data)
+			s.mutex.Lock()
+			toID := s.toIDs[otID]
+			s.connUsage[otID]++
+			s.mutex.Unlock()
+			replyData := s.handleMessage(items[1].Data[2:])
+			reply.Data = enip.BuildUnitData(replyData, toID, uint32(sequence)).Data
+		default:
+			continue
+		}
+		if _, err := conn.Write(reply.Buffer()); err != nil {
+			return
+		}
+	}
+}
+
+//handleUnconnected 处理非链接消息
+func (s *Sim) handleUnconnected(data []byte) []byte {
+	service := enip.CIPServType(data[0])
+	pathLen := int(data[1]) * 2
+	reqData := data[2+pathLen:]
+	path, _ := epath.Decode(data[2:2+pathLen], true)
+	if len(path) == 0 {
+		return s.handleMessage(data)
+	}
+	if _, ok := path[0].(*epath.LogicalSegment); !ok {
+		return s.handleMessage(data)
+	}
+	if class, ok := path[0].(*epath.LogicalSegment); ok && (class.Value == 0x6b || class.Value == 0x6c) {
+		return s.handleMessage(data)
+	}
+	switch service {
+	case enip.ServiceUnconnectedSendService:
+		msgLen := int(binary.LittleEndian.Uint16(reqData[2:4]))
+		pos := 4 + msgLen + msgLen%2
+		if len(reqData) >= pos+2 && len(reqData) >= pos+2+int(reqData[pos])*2 {
+			route := append([]byte{}, reqData[pos+2:pos+2+int(reqData[pos])*2]...)
+			s.mutex.Lock()
+			s.routes = append(s.routes, route)
+			s.mutex.Unlock()
+		}
+		return s.handleUnconnected(reqData[4 : 4+msgLen])
+	case enip.ServiceForwardOpen, enip.ServiceForwardOpenLarge:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.opens = append(s.opens, parseOpen(service, reqData))
+		if len(s.toIDs) >= s.maxConnect {
+			return []byte{uint8(service) | 0x80, 0, 0x01, 0x01, 0x13, 0x01}
+		}
+		s.nextID++
+		otID := s.nextID
+		toID := binary.LittleEndian.Uint32(reqData[6:10])
+		s.toIDs[otID] = toID
+		buffer := new(bytes.Buffer)
+		lib.WriteByte(buffer, []byte{uint8(service) | 0x80, 0, 0, 0})
+		lib.WriteByte(buffer, otID)
+		lib.WriteByte(buffer, toID)
+		buffer.Write(reqData[10:18])
+		lib.WriteByte(buffer, binary.LittleEndian.Uint32(reqData[22:26]))
+		lib.WriteByte(buffer, binary.LittleEndian.Uint32(reqData[22:26]))
+		lib.WriteByte(buffer, uint16(0))
+		return buffer.Bytes()
+	case enip.ServiceMultipleServicePacket:
+		return s.handleMultiple(data)
+	case enip.ServiceForwardClose:
+		return []byte{uint8(service) | 0x80, 0, 0, 0}
+	case enip.ServiceGetAttributeAll:
+		s.mutex.Lock()
+		status := s.identity
+		s.mutex.Unlock()
+		if status != 0 {
+			return []byte{uint8(service) | 0x80, 0, status, 0}
+		}
+		buffer := new(bytes.Buffer)
+		lib.WriteByte(buffer, []byte{uint8(service) | 0x80, 0, 0, 0})
+		lib.WriteByte(buffer, uint16(1))
+		lib.WriteByte(buffer, uint16(14))
+		lib.WriteByte(buffer, uint16(166))
+		lib.WriteByte(buffer, []byte{32, 11})
+		lib.WriteByte(buffer, uint16(0x3060))
+		lib.WriteByte(buffer, uint32(0xc0ffee))
+		name := "1756-L83E/B"
+		lib.WriteByte(buffer, uint8(len(name)))
+		buffer.WriteString(name)
+		return buffer.Bytes()
+	default:
+		return []byte{uint8(service) | 0x80, 0, 0x08, 0}
+	}
+}
+
+//parseOpen 解析 ForwardOpen 请求数据
+func parseOpen(service enip.CIPServType, reqData []byte) *OpenRequest {
+	request := &OpenRequest{Large: service == enip.ServiceForwardOpenLarge}
+	pos := 34
+	if request.Large {
+		pos = 38
+	}
+	if len(reqData) < pos {
+		return request
+	}
+	request.Priority = reqData[0]
+	request.TimeoutTicks = reqData[1]
+	request.OTConnectionID = binary.LittleEndian.Uint32(reqData[2:6])
+	request.TOConnectionID = binary.LittleEndian.Uint32(reqData[6:10])
+	request.ConnectionSerial = binary.LittleEndian.Uint16(reqData[10:12])
+	request.VendorID = binary.LittleEndian.Uint16(reqData[12:14])
+	request.OriginatorSerial = binary.LittleEndian.Uint32(reqData[14:18])
+	request.TimeoutMultiplier = reqData[18]
+	request.OTRPI = binary.LittleEndian.Uint32(reqData[22:26])
+	request.TORPI = binary.LittleEndian.Uint32(reqData[pos-8 : pos-4])
+	if len(reqData) >= pos+2 && len(reqData) >= pos+2+int(reqData[pos+1])*2 {
+		request.Path = append([]byte{}, reqData[pos+2:pos+2+int(reqData[pos+1])*2]...)
+	}
+	return request
+}
+
+//handleMessage 处理标签服务
+func (s *Sim) handleMessage(data []byte) []byte {
+	service := enip.CIPServType(data[0])
+	if service == enip.ServiceMultipleServicePacket {
+		return s.handleMultiple(data)
+	}
+	pathLen := int(data[1]) * 2
+	path, err := epath.Decode(data[2:2+pathLen], true)
+	reqData := data[2+pathLen:]
+	failed := []byte{uint8(service) | 0x80, 0, 0x05, 0}
+	if err != nil || len(path) == 0 {
+		return failed
+	}
+	if _, ok := path[0].(*epath.LogicalSegment); ok {
+		return s.handleObject(service, path, reqData)
+	}
+	symbol, ok := path[0].(*epath.SymbolicSegment)
+	if !ok {
+		return failed
+	}
+	s.mutex.Lock()
+	tag, ok := s.tags[symbol.Name]
+	s.mutex.Unlock()
+	if !ok {
+		return failed
+	}
+	size := int(types.GetByteCount(tag.DType))
+	if tag.Size > 0 {
+		size = tag.Size
+	}
+	start := 0
+	for i, segment := range path[1:] {
+		if member, ok := segment.(*epath.LogicalSegment); ok {
+			if i < len(tag.Dims) {
+				start *= int(tag.Dims[i])
+			}
+			start += int(member.Value)
+		}
+	}
+	start *= size
+	if service == enip.ServiceWriteTag || service == enip.ServiceWriteTagFragmented {
+		return s.writeTag(service, tag, start, reqData)
+	}
+	if service == enip.ServiceReadModifyWriteTag {
+		maskSize := int(binary.LittleEndian.Uint16(reqData))
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for i := 0; i < maskSize && start+i < len(tag.Data); i++ {
+			tag.Data[start+i] = tag.Data[start+i]&reqData[2+maskSize+i] | reqData[2+i]
+		}
+		return []byte{uint8(service) | 0x80, 0, 0, 0}
+	}
+	elements := int(binary.LittleEndian.Uint16(reqData[0:2]))
+	offset := 0
+	if service == enip.ServiceReadTagFragmented {
+		offset = int(binary.LittleEndian.Uint32(reqData[2:6]))
+	}
+	switch service {
+	case enip.ServiceReadTag, enip.ServiceReadTagFragmented:
+		end := start + elements*size
+		if end > len(tag.Data) {
+			return []byte{uint8(service) | 0x80, 0, 0x05, 0}
+		}
+		//应答超出长度时按元素截断并返回状态 6
+		status := uint8(0)
+		if limit := ReplyLimit / size * size; end-start-offset > limit {
+			end = start + offset + limit
+			status = 6
+		}
+		buffer := new(bytes.Buffer)
+		lib.WriteByte(buffer, []byte{uint8(service) | 0x80, 0, status, 0})
+		lib.WriteByte(buffer, tag.DType)
+		if tag.DType == types.STRUCT {
+			lib.WriteByte(buffer, tag.Handle)
+		}
+		buffer.Write(tag.Data[start+offset : end])
+		return buffer.Bytes()
+	default:
+		return []byte{uint8(service) | 0x80, 0, 0x08, 0}
+	}
+}
+
+//writeTag 处理写入服务
+func (s *Sim) writeTag(service enip.CIPServType, tag *Tag, start int, reqData []byte) []byte {
+	pos := 2
+	if types.DataType(binary.LittleEndian.Uint16(reqData)) == types.STRUCT {
+		if binary.LittleEndian.Uint16(reqData[2:]) != tag.Handle {
+			return []byte{uint8(service) | 0x80, 0, 0xff, 0}
+		}
+		pos += 2
+	}
+	pos += 2
+	offset := 0
+	if service == enip.ServiceWriteTagFragmented {
+		offset = int(binary.LittleEndian.Uint32(reqData[pos:]))
+		pos += 4
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if start+offset+len(reqData[pos:]) > len(tag.Data) {
+		return []byte{uint8(service) | 0x80, 0, 0x05, 0}
+	}
+	copy(tag.Data[start+offset:], reqData[pos:])
+	return []byte{uint8(service) | 0x80, 0, 0, 0}
+}
+
+//handleObject 处理符号对象与模板对象服务
+func (s *Sim) handleObject(service enip.CIPServType, path epath.Path, reqData []byte) []byte {
+	failed := []byte{uint8(service) | 0x80, 0, 0x05, 0}
+	if len(path) < 2 {
+		return failed
+	}
+	class := path[0].(*epath.LogicalSegment).Value
+	instance, ok := path[1].(*epath.LogicalSegment)
+	if !ok {
+		return failed
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, []byte{uint8(service) | 0x80, 0, 0, 0})
+	switch {
+	case class == 0x6b && service == enip.ServiceGetInstanceAttributeList:
+		names := make([]string, 0, len(s.tags))
+		for name := range s.tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			if uint32(i+1) < instance.Value {
+				continue
+			}
+			tag := s.tags[name]
+			symbolType := uint16(tag.DType)
+			size := uint16(types.GetByteCount(tag.DType))
+			if tag.DType == types.STRUCT {
+				symbolType = 0x8000 | tag.TemplateID
+				size = uint16(tag.Size)
+			}
+			dims := [3]uint32{}
+			if len(tag.Dims) > 0 {
+				symbolType |= uint16(len(tag.Dims)) << 13
+				copy(dims[:], tag.Dims)
+			} else if count := len(tag.Data) / int(size); count > 1 {
+				symbolType |= 1 << 13
+				dims[0] = uint32(count)
+			}
+			lib.WriteByte(buffer, uint32(i+1))
+			lib.WriteByte(buffer, symbolType)
+			lib.WriteByte(buffer, size)
+			lib.WriteByte(buffer, dims)
+			lib.WriteByte(buffer, uint16(len(name)))
+			buffer.WriteString(name)
+		}
+	case class == 0x6b && service == enip.ServiceGetAttributeList:
+		names := make([]string, 0, len(s.tags))
+		for name := range s.tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if instance.Value == 0 || int(instance.Value) > len(names) {
+			return failed
+		}
+		tag := s.tags[names[instance.Value-1]]
+		constant := uint8(0)
+		if tag.Constant {
+			constant = 1
+		}
+		lib.WriteByte(buffer, uint16(2))
+		lib.WriteByte(buffer, []uint16{9, 0})
+		lib.WriteByte(buffer, constant)
+		lib.WriteByte(buffer, []uint16{10, 0})
+		lib.WriteByte(buffer, tag.Access)
+	case class == 0x6c && service == enip.ServiceGetAttributeList:
+		template, ok := s.templates[uint16(instance.Value)]
+		if !ok {
+			return failed
+		}
+		lib.WriteByte(buffer, uint16(4))
+		lib.WriteByte(buffer, []uint16{4, 0})
+		lib.WriteByte(buffer, uint32((len(template.Definition)+21+3)/4))
+		lib.WriteByte(buffer, []uint16{5, 0})
+		lib.WriteByte(buffer, template.Size)
+		lib.WriteByte(buffer, []uint16{2, 0, template.MemberCount})
+		lib.WriteByte(buffer, []uint16{1, 0, template.Handle})
+	case class == 0x6c && service == enip.ServiceReadTemplate:
+		template, ok := s.templates[uint16(instance.Value)]
+		if !ok {
+			return failed
+		}
+		offset := int(binary.LittleEndian.Uint32(reqData))
+		end := offset + int(binary.LittleEndian.Uint16(reqData[4:]))
+		if end > len(template.Definition) {
+			end = len(template.Definition)
+		}
+		buffer.Write(template.Definition[offset:end])
+	default:
+		return []byte{uint8(service) | 0x80, 0, 0x08, 0}
+	}
+	return buffer.Bytes()
+}
+
+func (s *Sim) handleMultiple(data []byte) []byte {
+	reqData := data[2+int(data[1])*2:]
+	count := int(binary.LittleEndian.Uint16(reqData[0:2]))
+	replies := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		start := int(binary.LittleEndian.Uint16(reqData[2+i*2:]))
+		end := len(reqData)
+		if i+1 < count {
+			end = int(binary.LittleEndian.Uint16(reqData[4+i*2:]))
+		}
+		replies = append(replies, s.handleMessage(reqData[start:end]))
+	}
+	buffer := new(bytes.Buffer)
+	lib.WriteByte(buffer, []byte{uint8(enip.ServiceMultipleServicePacket) | 0x80, 0, 0, 0})
+	lib.WriteByte(buffer, uint16(count))
+	offset := 2 + count*2
+	for _, reply := range replies {
+		lib.WriteByte(buffer, uint16(offset))
+		offset += len(reply)
+	}
+	for _, reply := range replies {
+		buffer.Write(reply)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,369 @@
+//Package protobuf 按结构体标签编码 protobuf 消息，只支持 proto3 的基本类型、嵌套消息与 repeated 字段
+//
+//字段标签为 `protobuf:"序号"`，sint32/sint64 使用 `protobuf:"序号,zigzag"`。
+//指针字段在非 nil 时编码(用于 oneof)，其他字段为零值时不编码；未知字段在解码时跳过。
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//线路类型
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var ErrDecode = errors.New("protobuf 数据格式错误")
+
+//field 结构体字段与序号
+type field struct {
+	index  int
+	number uint64
+	zigzag bool
+}
+
+var fieldCache sync.Map
+
+//fields 解析结构体的字段标签，没有标签的字段被忽略
+func fields(t reflect.Type) ([]field, error) {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field), nil
+	}
+	var list []field
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("protobuf")
+		if !ok {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		number, err := strconv.ParseUint(options[0], 10, 29)
+		if err != nil || number == 0 {
+			return nil, fmt.Errorf("%s.%s 字段序号不正确: %q", t.Name(), t.Field(i).Name, tag)
+		}
+		list = append(list, field{index: i, number: number, zigzag: len(options) > 1 && options[1] == "zigzag"})
+	}
+	fieldCache.Store(t, list)
+	return list, nil
+}
+
+//Marshal 编码结构体或结构体指针
+func Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return []byte{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("不支持编码 %s", rv.Type())
+	}
+	return appendMessage(make([]byte, 0, 64), rv)
+}
+
+func appendMessage(data []byte, rv reflect.Value) ([]byte, error) {
+	list, err := fields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range list {
+		fv := rv.Field(f.index)
+		switch {
+		case fv.Kind() == reflect.Ptr:
+			if !fv.IsNil() {
+				data, err = appendValue(data, f, fv.Elem(), true)
+			}
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8:
+			data, err = appendRepeated(data, f, fv)
+		default:
+			data, err = appendValue(data, f, fv, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+//appendRepeated 数值类型按 packed 编码，其他类型逐个编码
+func appendRepeated(data []byte, f field, fv reflect.Value) ([]byte, error) {
+	if fv.Len() == 0 {
+		return data, nil
+	}
+	if wire, _, ok := scalar(f, fv.Index(0)); ok {
+		packed := make([]byte, 0, fv.Len()*2)
+		for i := 0; i < fv.Len(); i++ {
+			_, bits, _ := scalar(f, fv.Index(i))
+			packed = appendBits(packed, wire, bits)
+		}
+		data = appendKey(data, f.number, wireBytes)
+		data = appendUvarint(data, uint64(len(packed)))
+		return append(data, packed...), nil
+	}
+	var err error
+	for i := 0; i < fv.Len(); i++ {
+		item := fv.Index(i)
+		if item.Kind() == reflect.Ptr {
+			if item.IsNil() {
+				return nil, fmt.Errorf("repeated 字段 %d 包含 nil", f.number)
+			}
+			item = item.Elem()
+		}
+		if data, err = appendValue(data, f, item, true); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+//appendValue 编码单个值，force 为 false 时零值不编码
+func appendValue(data []byte, f field, v reflect.Value, force bool) ([]byte, error) {
+	if wire, bits, ok := scalar(f, v); ok {
+		if bits == 0 && !force {
+			return data, nil
+		}
+		return appendBits(appendKey(data, f.number, wire), wire, bits), nil
+	}
+	var body []byte
+	switch {
+	case v.Kind() == reflect.String:
+		body = []byte(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		body = v.Bytes()
+	case v.Kind() == reflect.Struct:
+		var err error
+		if body, err = appendMessage(nil, v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持编码 %s", v.Type())
+	}
+	if len(body) == 0 && !force {
+		return data, nil
+	}
+	data = appendKey(data, f.number, wireBytes)
+	data = appendUvarint(data, uint64(len(body)))
+	return append(data, body...), nil
+}
+
+//scalar 数值类型的线路类型与编码后的位
+func scalar(f field, v reflect.Value) (int, uint64, bool) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return wireVarint, 1, true
+		}
+		return wireVarint, 0, true
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		x := v.Int()
+		if f.zigzag {
+			return wireVarint, uint64(x<<1) ^ uint64(x>>63), true
+		}
+		return wireVarint, uint64(x), true
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return wireVarint, v.Uint(), true
+	case reflect.Float32:
+		return wireFixed32, uint64(math.Float32bits(float32(v.Float()))), true
+	case reflect.Float64:
+		return wireFixed64, math.Float64bits(v.Float()), true
+	default:
+		return 0, 0, false
+	}
+}
+
+func appendKey(data []byte, number uint64, wire int) []byte {
+	return appendUvarint(data, number<<3|uint64(wire))
+}
+
+func appendBits(data []byte, wire int, bits uint64) []byte {
+	switch wire {
+	case wireFixed32:
+		return append(data, byte(bits), byte(bits>>8), byte(bits>>16), byte(bits>>24))
+	case wireFixed64:
+		return appendBits(appendBits(data, wireFixed32, bits&0xffffffff), wireFixed32, bits>>32)
+	default:
+		return appendUvarint(data, bits)
+	}
+}
+
+func appendUvarint(data []byte, x uint64) []byte {
+	for x >= 0x80 {
+		data = append(data, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(data, byte(x))
+}
+
+//Unmarshal 解码到结构体指针，已有的字段值被覆盖，repeated 字段追加
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("不支持解码到 %T", v)
+	}
+	return decodeMessage(data, rv.Elem())
+}
+
+func decodeMessage(data []byte, rv reflect.Value) error {
+	list, err := fields(rv.Type())
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 {
+			return ErrDecode
+		}
+		data = data[n:]
+		number, wire := key>>3, int(key&7)
+		var value []byte
+		var bits uint64
+		switch wire {
+		case wireVarint:
+			if bits, n = binary.Uvarint(data); n <= 0 {
+				return ErrDecode
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return ErrDecode
+			}
+			bits, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return ErrDecode
+			}
+			bits, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return ErrDecode
+			}
+			value, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return ErrDecode
+		}
+		for _, f := range list {
+			if f.number == number {
+				if err = decodeField(f, rv.Field(f.index), wire, bits, value); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func decodeField(f field, fv reflect.Value, wire int, bits uint64, value []byte) error {
+	switch {
+	case fv.Kind() == reflect.Ptr:
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return decodeValue(f, fv.Elem(), wire, bits, value)
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8:
+		item, target := newItem(fv.Type().Elem())
+		itemWire, _, isScalar := scalar(f, target)
+		if !isScalar || wire != wireBytes {
+			if err := decodeValue(f, target, wire, bits, value); err != nil {
+				return err
+			}
+			fv.Set(reflect.Append(fv, item))
+			return nil
+		}
+		//packed
+		for len(value) > 0 {
+			switch itemWire {
+			case wireFixed32:
+				if len(value) < 4 {
+					return ErrDecode
+				}
+				bits, value = uint64(binary.LittleEndian.Uint32(value)), value[4:]
+			case wireFixed64:
+				if len(value) < 8 {
+					return ErrDecode
+				}
+				bits, value = binary.LittleEndian.Uint64(value), value[8:]
+			default:
+				var n int
+				if bits, n = binary.Uvarint(value); n <= 0 {
+					return ErrDecode
+				}
+				value = value[n:]
+			}
+			item, target = newItem(fv.Type().Elem())
+			if err := decodeValue(f, target, itemWire, bits, nil); err != nil {
+				return err
+			}
+			fv.Set(reflect.Append(fv, item))
+		}
+		return nil
+	default:
+		return decodeValue(f, fv, wire, bits, value)
+	}
+}
+
+//newItem 创建 repeated 字段的元素，返回元素与解码目标
+func newItem(t reflect.Type) (reflect.Value, reflect.Value) {
+	item := reflect.New(t).Elem()
+	if t.Kind() == reflect.Ptr {
+		item.Set(reflect.New(t.Elem()))
+	}
+	return item, reflect.Indirect(item)
+}
+
+func decodeValue(f field, v reflect.Value, wire int, bits uint64, value []byte) error {
+	if expected, _, ok := scalar(f, v); ok && expected != wire {
+		return ErrDecode
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(bits != 0)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		x := int64(bits)
+		if f.zigzag {
+			x = int64(bits>>1) ^ -int64(bits&1)
+		}
+		if v.OverflowInt(x) {
+			return ErrDecode
+		}
+		v.SetInt(x)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		if v.OverflowUint(bits) {
+			return ErrDecode
+		}
+		v.SetUint(bits)
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(uint32(bits))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(bits))
+	case reflect.String:
+		if wire != wireBytes {
+			return ErrDecode
+		}
+		v.SetString(string(value))
+	case reflect.Slice:
+		if wire != wireBytes || v.Type().Elem().Kind() != reflect.Uint8 {
+			return ErrDecode
+		}
+		v.SetBytes(append([]byte{}, value...))
+	case reflect.Struct:
+		if wire != wireBytes {
+			return ErrDecode
+		}
+		return decodeMessage(value, v)
+	default:
+		return fmt.Errorf("不支持解码到 %s", v.Type())
+	}
+	return nil
+}
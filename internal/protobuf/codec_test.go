@@ -0,0 +1,100 @@
+package protobuf
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+type inner struct {
+	Name  string `protobuf:"1"`
+	Value int32  `protobuf:"2"`
+}
+
+type message struct {
+	Bool    bool      `protobuf:"1"`
+	Int32   int32     `protobuf:"2"`
+	Sint64  int64     `protobuf:"3,zigzag"`
+	Uint64  uint64    `protobuf:"4"`
+	Float   float32   `protobuf:"5"`
+	Double  float64   `protobuf:"6"`
+	Text    string    `protobuf:"7"`
+	Data    []byte    `protobuf:"8"`
+	Inner   inner     `protobuf:"9"`
+	Ints    []int32   `protobuf:"10"`
+	Doubles []float64 `protobuf:"11"`
+	Names   []string  `protobuf:"12"`
+	Items   []*inner  `protobuf:"13"`
+	Choice  *int32    `protobuf:"14"`
+	Ignored int
+}
+
+func TestRoundTrip(t *testing.T) {
+	zero := int32(0)
+	original := &message{
+		Bool:    true,
+		Int32:   -5,
+		Sint64:  math.MinInt64,
+		Uint64:  math.MaxUint64,
+		Float:   1.5,
+		Double:  -2.25,
+		Text:    "标签",
+		Data:    []byte{0, 1, 2},
+		Inner:   inner{Name: "a", Value: 300},
+		Ints:    []int32{1, -1, 1 << 20},
+		Doubles: []float64{0.5, 0},
+		Names:   []string{"x", ""},
+		Items:   []*inner{{Name: "b"}, {Value: 1}},
+		Choice:  &zero,
+	}
+	data, err := Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &message{}
+	if err = Unmarshal(data, decoded); err != nil || !reflect.DeepEqual(decoded, original) {
+		t.Fatalf("往返得到 %+v %v", decoded, err)
+	}
+	//零值字段不编码，nil 指针不编码
+	if data, err = Marshal(&message{}); err != nil || len(data) != 0 {
+		t.Fatalf("零值消息编码为 %x %v", data, err)
+	}
+	//未知字段被跳过
+	data = append(appendKey(nil, 20, wireFixed32), 1, 2, 3, 4)
+	data = append(data, appendBits(appendKey(nil, 2, wireVarint), wireVarint, 7)...)
+	decoded = &message{}
+	if err = Unmarshal(data, decoded); err != nil || decoded.Int32 != 7 {
+		t.Fatalf("跳过未知字段失败 %+v %v", decoded, err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	cases := map[string][]byte{
+		"字段序号为 0":     {0x00, 0x01},
+		"varint 不完整":  {0x10, 0x80},
+		"长度超出数据":      {0x3a, 0x05, 'a'},
+		"fixed32 不完整": {0x2d, 0x00, 0x00},
+		"fixed64 不完整": {0x31, 0x00},
+		"未知线路类型":      {0x0b},
+		"线路类型不匹配":     {0x12, 0x01, 0x00},
+		"packed 不完整":  {0x5a, 0x03, 0x00, 0x00, 0x00},
+		"嵌套消息错误":      {0x4a, 0x02, 0x10, 0x80},
+	}
+	for name, data := range cases {
+		if err := Unmarshal(data, &message{}); err != ErrDecode {
+			t.Fatalf("%s 应该返回 ErrDecode，得到 %v", name, err)
+		}
+	}
+	//溢出的整数
+	overflow := appendBits(appendKey(nil, 2, wireVarint), wireVarint, 1<<40)
+	if err := Unmarshal(overflow, &struct {
+		Small int8 `protobuf:"2"`
+	}{}); err != ErrDecode {
+		t.Fatalf("溢出应该返回 ErrDecode，得到 %v", err)
+	}
+	//截断的有效消息不能 panic
+	data, _ := Marshal(&message{Text: "abc", Inner: inner{Name: "x"}, Ints: []int32{1, 2}})
+	for i := 1; i < len(data); i++ {
+		Unmarshal(data[:i], &message{})
+	}
+}
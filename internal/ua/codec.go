@@ -0,0 +1,361 @@
+//Package ua OPC UA 二进制编码、服务结构与 UA TCP 传输层，仅供 opcua 包与测试使用
+//
+//结构体按字段顺序编码: Go 基本类型对应同名的 UA 内置类型，string 为 String，[]byte 为 ByteString，
+//time.Time 为 DateTime，切片为数组(nil 编码为 -1)。实现 Marshaler/Unmarshaler 的类型自行编码。
+package ua
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"time"
+)
+
+//ErrDecode 数据不完整或格式错误
+var ErrDecode = errors.New("OPC UA 数据解析失败")
+
+//maxArrayLength 解码数组的最大长度
+const maxArrayLength = 1 << 20
+
+//Marshaler 自定义编码
+type Marshaler interface {
+	EncodeUA(e *Encoder)
+}
+
+//Unmarshaler 自定义解码
+type Unmarshaler interface {
+	DecodeUA(d *Decoder)
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	timeType        = reflect.TypeOf(time.Time{})
+)
+
+//epoch DateTime 起点 1601-01-01，单位 100ns
+var epoch = time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//Encoder 小端二进制编码
+type Encoder struct {
+	data []byte
+}
+
+//Bytes 编码结果
+func (e *Encoder) Bytes() []byte {
+	return e.data
+}
+
+func (e *Encoder) WriteUint8(v uint8) {
+	e.data = append(e.data, v)
+}
+
+func (e *Encoder) WriteUint16(v uint16) {
+	e.data = append(e.data, byte(v), byte(v>>8))
+}
+
+func (e *Encoder) WriteUint32(v uint32) {
+	e.data = append(e.data, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (e *Encoder) WriteUint64(v uint64) {
+	e.WriteUint32(uint32(v))
+	e.WriteUint32(uint32(v >> 32))
+}
+
+func (e *Encoder) WriteBool(v bool) {
+	if v {
+		e.WriteUint8(1)
+	} else {
+		e.WriteUint8(0)
+	}
+}
+
+//WriteString 空字符串编码为 null(-1)
+func (e *Encoder) WriteString(v string) {
+	if v == "" {
+		e.WriteUint32(math.MaxUint32)
+		return
+	}
+	e.WriteUint32(uint32(len(v)))
+	e.data = append(e.data, v...)
+}
+
+//WriteByteString nil 编码为 null(-1)
+func (e *Encoder) WriteByteString(v []byte) {
+	if v == nil {
+		e.WriteUint32(math.MaxUint32)
+		return
+	}
+	e.WriteUint32(uint32(len(v)))
+	e.data = append(e.data, v...)
+}
+
+//WriteTime 零值编码为 0
+func (e *Encoder) WriteTime(v time.Time) {
+	if v.IsZero() || v.Before(epoch) {
+		e.WriteUint64(0)
+		return
+	}
+	e.WriteUint64(uint64((v.Unix()-epoch.Unix())*10000000 + int64(v.Nanosecond()/100)))
+}
+
+//Encode 按结构编码任意值
+func (e *Encoder) Encode(v interface{}) {
+	e.value(reflect.ValueOf(v))
+}
+
+func (e *Encoder) value(rv reflect.Value) {
+	if !rv.IsValid() {
+		return
+	}
+	if rv.Type().Implements(marshalerType) {
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			reflect.New(rv.Type().Elem()).Interface().(Marshaler).EncodeUA(e)
+			return
+		}
+		rv.Interface().(Marshaler).EncodeUA(e)
+		return
+	}
+	if rv.Type() == timeType {
+		e.WriteTime(rv.Interface().(time.Time))
+		return
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		e.WriteBool(rv.Bool())
+	case reflect.Int8:
+		e.WriteUint8(uint8(rv.Int()))
+	case reflect.Uint8:
+		e.WriteUint8(uint8(rv.Uint()))
+	case reflect.Int16:
+		e.WriteUint16(uint16(rv.Int()))
+	case reflect.Uint16:
+		e.WriteUint16(uint16(rv.Uint()))
+	case reflect.Int32:
+		e.WriteUint32(uint32(rv.Int()))
+	case reflect.Uint32:
+		e.WriteUint32(uint32(rv.Uint()))
+	case reflect.Int64:
+		e.WriteUint64(uint64(rv.Int()))
+	case reflect.Uint64:
+		e.WriteUint64(rv.Uint())
+	case reflect.Float32:
+		e.WriteUint32(math.Float32bits(float32(rv.Float())))
+	case reflect.Float64:
+		e.WriteUint64(math.Float64bits(rv.Float()))
+	case reflect.String:
+		e.WriteString(rv.String())
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			e.WriteByteString(rv.Bytes())
+			return
+		}
+		if rv.IsNil() {
+			e.WriteUint32(math.MaxUint32)
+			return
+		}
+		e.WriteUint32(uint32(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			e.value(rv.Index(i))
+		}
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			e.value(rv.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if rv.Type().Field(i).PkgPath == "" {
+				e.value(rv.Field(i))
+			}
+		}
+	case reflect.Ptr:
+		if rv.IsNil() {
+			e.value(reflect.New(rv.Type().Elem()).Elem())
+			return
+		}
+		e.value(rv.Elem())
+	case reflect.Interface:
+		e.value(rv.Elem())
+	}
+}
+
+//Decoder 小端二进制解码，出错后后续读取均返回零值
+type Decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+//NewDecoder 创建解码器
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+//Err 第一个解码错误
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+//Remaining 剩余未解码的字节
+func (d *Decoder) Remaining() []byte {
+	return d.data[d.pos:]
+}
+
+func (d *Decoder) read(n int) []byte {
+	if d.err != nil || n < 0 || d.pos+n > len(d.data) {
+		d.err = ErrDecode
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *Decoder) ReadUint8() uint8 {
+	if b := d.read(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *Decoder) ReadUint16() uint16 {
+	if b := d.read(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *Decoder) ReadUint32() uint32 {
+	if b := d.read(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *Decoder) ReadUint64() uint64 {
+	if b := d.read(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *Decoder) ReadBool() bool {
+	return d.ReadUint8() != 0
+}
+
+//ReadByteString null 返回 nil
+func (d *Decoder) ReadByteString() []byte {
+	n := int32(d.ReadUint32())
+	if n < 0 || d.err != nil {
+		return nil
+	}
+	return append([]byte{}, d.read(int(n))...)
+}
+
+//ReadString null 返回空字符串
+func (d *Decoder) ReadString() string {
+	return string(d.ReadByteString())
+}
+
+func (d *Decoder) ReadTime() time.Time {
+	ticks := int64(d.ReadUint64())
+	if ticks <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(epoch.Unix()+ticks/10000000, ticks%10000000*100).UTC()
+}
+
+//arrayLength 读取数组长度，null 返回 -1
+func (d *Decoder) arrayLength() int {
+	n := int32(d.ReadUint32())
+	if n > maxArrayLength {
+		d.err = ErrDecode
+		return -1
+	}
+	if n < 0 || d.err != nil {
+		return -1
+	}
+	return int(n)
+}
+
+//Decode 按结构解码到指针 v
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("解码目标必须为指针")
+	}
+	d.value(rv.Elem())
+	return d.err
+}
+
+func (d *Decoder) value(rv reflect.Value) {
+	if d.err != nil {
+		return
+	}
+	if rv.CanAddr() && rv.Addr().Type().Implements(unmarshalerType) {
+		rv.Addr().Interface().(Unmarshaler).DecodeUA(d)
+		return
+	}
+	if rv.Type() == timeType {
+		rv.Set(reflect.ValueOf(d.ReadTime()))
+		return
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		rv.SetBool(d.ReadBool())
+	case reflect.Int8:
+		rv.SetInt(int64(int8(d.ReadUint8())))
+	case reflect.Uint8:
+		rv.SetUint(uint64(d.ReadUint8()))
+	case reflect.Int16:
+		rv.SetInt(int64(int16(d.ReadUint16())))
+	case reflect.Uint16:
+		rv.SetUint(uint64(d.ReadUint16()))
+	case reflect.Int32:
+		rv.SetInt(int64(int32(d.ReadUint32())))
+	case reflect.Uint32:
+		rv.SetUint(uint64(d.ReadUint32()))
+	case reflect.Int64:
+		rv.SetInt(int64(d.ReadUint64()))
+	case reflect.Uint64:
+		rv.SetUint(d.ReadUint64())
+	case reflect.Float32:
+		rv.SetFloat(float64(math.Float32frombits(d.ReadUint32())))
+	case reflect.Float64:
+		rv.SetFloat(math.Float64frombits(d.ReadUint64()))
+	case reflect.String:
+		rv.SetString(d.ReadString())
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			rv.SetBytes(d.ReadByteString())
+			return
+		}
+		n := d.arrayLength()
+		if n < 0 {
+			return
+		}
+		slice := reflect.MakeSlice(rv.Type(), n, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			d.value(slice.Index(i))
+		}
+		rv.Set(slice)
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			d.value(rv.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if rv.Type().Field(i).PkgPath == "" {
+				d.value(rv.Field(i))
+			}
+		}
+	case reflect.Ptr:
+		elem := reflect.New(rv.Type().Elem())
+		d.value(elem.Elem())
+		rv.Set(elem)
+	default:
+		d.err = errors.New("不支持解码的类型 " + rv.Type().String())
+	}
+}
@@ -0,0 +1,185 @@
+package ua
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNodeIDRoundTrip(t *testing.T) {
+	ids := []NodeID{
+		NewNumericNodeID(0, 85),      //2 字节形式
+		NewNumericNodeID(2, 1000),    //4 字节形式
+		NewNumericNodeID(300, 70000), //完整形式
+		NewStringNodeID(1, "Program:Main.Count"),
+		{Namespace: 3, Type: NodeIDOpaque, Text: "\x01\x02\x03"},
+	}
+	for _, id := range ids {
+		e := &Encoder{}
+		id.EncodeUA(e)
+		got := NodeID{}
+		d := NewDecoder(e.Bytes())
+		got.DecodeUA(d)
+		if d.Err() != nil || got != id || len(d.Remaining()) != 0 {
+			t.Fatalf("%s 往返得到 %s %v", id, got, d.Err())
+		}
+	}
+	for text, want := range map[string]NodeID{
+		"i=85":        NewNumericNodeID(0, 85),
+		"ns=2;s=Tag1": NewStringNodeID(2, "Tag1"),
+	} {
+		id, err := ParseNodeID(text)
+		if err != nil || id != want || id.String() != text {
+			t.Fatalf("解析 %s 得到 %s %v", text, id, err)
+		}
+	}
+	for _, text := range []string{"", "ns=1", "ns=x;i=1", "i=x", "g=00"} {
+		if _, err := ParseNodeID(text); err == nil {
+			t.Fatalf("%q 应该解析失败", text)
+		}
+	}
+}
+
+func TestVariantRoundTrip(t *testing.T) {
+	stamp := time.Date(2024, 5, 6, 7, 8, 9, 100, time.UTC)
+	values := []interface{}{
+		nil,
+		true,
+		int16(-2),
+		uint32(7),
+		float32(1.5),
+		3.25,
+		"text",
+		stamp,
+		[]byte{1, 2},
+		NewStringNodeID(1, "Tag"),
+		StatusCode(StatusBadTCPMessageTooLarge),
+		LocalizedText{Locale: "zh", Text: "标签"},
+		[]int32{1, -1, 3},
+		[]string{"a", "", "c"},
+		[]interface{}{int32(1), "two", nil},
+	}
+	for _, value := range values {
+		e := &Encoder{}
+		e.Encode(&Variant{Value: value})
+		got := Variant{}
+		if err := NewDecoder(e.Bytes()).Decode(&got); err != nil || !reflect.DeepEqual(got.Value, value) {
+			t.Fatalf("%#v 往返得到 %#v %v", value, got.Value, err)
+		}
+	}
+	value := DataValue{Value: int32(42), Status: StatusBadTCPMessageTypeInvalid, SourceTimestamp: stamp, ServerTimestamp: stamp}
+	e := &Encoder{}
+	e.Encode(&value)
+	got := DataValue{}
+	if err := NewDecoder(e.Bytes()).Decode(&got); err != nil || !reflect.DeepEqual(got, value) {
+		t.Fatalf("DataValue 往返得到 %#v %v", got, err)
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	request := &ReadRequest{
+		RequestHeader:      RequestHeader{RequestHandle: 9, TimeoutHint: 1000},
+		TimestampsToReturn: 2,
+		NodesToRead: []ReadValueID{
+			{NodeID: NewStringNodeID(1, "Tag1"), AttributeID: 13},
+			{NodeID: NewNumericNodeID(0, 2258), AttributeID: 13, IndexRange: "0:1"},
+		},
+	}
+	data, err := EncodeMessage(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := DecodeMessage(data)
+	if err != nil || !reflect.DeepEqual(message, request) {
+		t.Fatalf("ReadRequest 往返得到 %#v %v", message, err)
+	}
+	//每一个截断位置都必须返回错误而不是 panic
+	for i := 0; i < len(data); i++ {
+		if _, err := DecodeMessage(data[:i]); err == nil {
+			t.Fatalf("截断到 %d 字节应该解析失败", i)
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	//数组长度超过上限
+	e := &Encoder{}
+	e.WriteUint8(TypeInt32 | 0x80)
+	e.WriteUint32(maxArrayLength + 1)
+	if err := NewDecoder(e.Bytes()).Decode(&Variant{}); err != ErrDecode {
+		t.Fatalf("超长数组应该返回 ErrDecode，得到 %v", err)
+	}
+	//未知的内置类型
+	if err := NewDecoder([]byte{0x3f}).Decode(&Variant{}); err != ErrDecode {
+		t.Fatalf("未知类型应该返回 ErrDecode，得到 %v", err)
+	}
+	//未知的节点标识编码
+	if err := NewDecoder([]byte{0x0f, 0, 0}).Decode(&NodeID{}); err != ErrDecode {
+		t.Fatalf("未知节点标识编码应该返回 ErrDecode，得到 %v", err)
+	}
+	//未注册的服务保留请求头
+	e = &Encoder{}
+	NewNumericNodeID(0, 1).EncodeUA(e)
+	e.Encode(&RequestHeader{RequestHandle: 5})
+	_, err := DecodeMessage(e.Bytes())
+	unknown := &ErrUnknownService{}
+	if !errors.As(err, &unknown) || unknown.TypeID != NewNumericNodeID(0, 1) || unknown.Header.RequestHandle != 5 {
+		t.Fatalf("未注册的服务得到 %v", err)
+	}
+}
+
+func TestConnChunks(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	writer, reader := NewConn(client), NewConn(server)
+	writer.ChannelID, writer.TokenID = 1, 2
+	writer.SendBufferSize = 64
+	body := make([]byte, 200)
+	for i := range body {
+		body[i] = byte(i)
+	}
+	go writer.WriteMessage(MessageService, 7, body)
+	message, err := reader.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Type != MessageService || message.ChannelID != 1 || message.TokenID != 2 || message.RequestID != 7 || !reflect.DeepEqual(message.Body, body) {
+		t.Fatalf("分块消息组装错误 %+v", message)
+	}
+}
+
+func TestConnMalformed(t *testing.T) {
+	frame := func(msgType string, chunkType byte, size uint32) []byte {
+		header := make([]byte, 8)
+		copy(header, msgType)
+		header[3] = chunkType
+		binary.LittleEndian.PutUint32(header[4:], size)
+		return header
+	}
+	cases := []struct {
+		name  string
+		frame []byte
+		want  error
+	}{
+		{"长度过小", frame(MessageService, 'F', 4), StatusBadTCPMessageTooLarge},
+		{"长度过大", frame(MessageService, 'F', DefaultBufferSize+1), StatusBadTCPMessageTooLarge},
+		{"未知消息类型", frame("XYZ", 'F', 8), StatusBadTCPMessageTypeInvalid},
+		{"未知块类型", append(frame(MessageService, 'X', 24), make([]byte, 16)...), StatusBadTCPMessageTypeInvalid},
+	}
+	for _, c := range cases {
+		client, server := net.Pipe()
+		go func(data []byte) {
+			client.Write(data)
+			client.Close()
+		}(c.frame)
+		_, err := NewConn(server).ReadMessage()
+		server.Close()
+		if err != c.want {
+			t.Fatalf("%s 应该返回 %v，得到 %v", c.name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package ua
+
+import "fmt"
+
+//StatusCode 状态码，高两位为 0 表示成功
+type StatusCode uint32
+
+//状态码
+const (
+	StatusGood                         StatusCode = 0
+	StatusBadUnexpectedError           StatusCode = 0x80010000
+	StatusBadInternalError             StatusCode = 0x80020000
+	StatusBadDecodingError             StatusCode = 0x80070000
+	StatusBadServiceUnsupported        StatusCode = 0x800B0000
+	StatusBadNothingToDo               StatusCode = 0x800F0000
+	StatusBadTooManyOperations         StatusCode = 0x80100000
+	StatusBadUserAccessDenied          StatusCode = 0x801F0000
+	StatusBadIdentityTokenInvalid      StatusCode = 0x80200000
+	StatusBadIdentityTokenRejected     StatusCode = 0x80210000
+	StatusBadSessionIDInvalid          StatusCode = 0x80250000
+	StatusBadSessionClosed             StatusCode = 0x80260000
+	StatusBadSessionNotActivated       StatusCode = 0x80270000
+	StatusBadSubscriptionIDInvalid     StatusCode = 0x80280000
+	StatusBadTimestampsToReturnInvalid StatusCode = 0x802B0000
+	StatusBadNoCommunication           StatusCode = 0x80310000
+	StatusBadWaitingForInitialData     StatusCode = 0x80320000
+	StatusBadNodeIDUnknown             StatusCode = 0x80340000
+	StatusBadAttributeIDInvalid        StatusCode = 0x80350000
+	StatusBadIndexRangeInvalid         StatusCode = 0x80360000
+	StatusBadNotReadable               StatusCode = 0x803A0000
+	StatusBadNotWritable               StatusCode = 0x803B0000
+	StatusBadOutOfRange                StatusCode = 0x803C0000
+	StatusBadNotSupported              StatusCode = 0x803D0000
+	StatusBadMonitoringModeInvalid     StatusCode = 0x80410000
+	StatusBadMonitoredItemIDInvalid    StatusCode = 0x80420000
+	StatusBadFilterNotAllowed          StatusCode = 0x80450000
+	StatusBadContinuationPointInvalid  StatusCode = 0x804A0000
+	StatusBadNoContinuationPoints      StatusCode = 0x804B0000
+	StatusBadBrowseDirectionInvalid    StatusCode = 0x804D0000
+	StatusBadSecurityPolicyRejected    StatusCode = 0x80550000
+	StatusBadNoMatch                   StatusCode = 0x806F0000
+	StatusBadTypeMismatch              StatusCode = 0x80740000
+	StatusBadTooManyPublishRequests    StatusCode = 0x80780000
+	StatusBadNoSubscription            StatusCode = 0x80790000
+	StatusBadSequenceNumberUnknown     StatusCode = 0x807A0000
+	StatusBadMessageNotAvailable       StatusCode = 0x807B0000
+	StatusBadTCPMessageTypeInvalid     StatusCode = 0x807E0000
+	StatusBadTCPMessageTooLarge        StatusCode = 0x80800000
+	StatusBadDeviceFailure             StatusCode = 0x808B0000
+	StatusBadTimeout                   StatusCode = 0x800A0000
+	StatusBadSecureChannelIDInvalid    StatusCode = 0x80220000
+	StatusBadTCPEndpointURLInvalid     StatusCode = 0x80830000
+)
+
+func (c StatusCode) Error() string {
+	return fmt.Sprintf("OPC UA 状态 0x%08X", uint32(c))
+}
+
+//IsBad 是否为错误状态
+func (c StatusCode) IsBad() bool {
+	return c&0x80000000 != 0
+}
+
+//属性标识
+const (
+	AttrNodeID                  = 1
+	AttrNodeClass               = 2
+	AttrBrowseName              = 3
+	AttrDisplayName             = 4
+	AttrDescription             = 5
+	AttrWriteMask               = 6
+	AttrUserWriteMask           = 7
+	AttrIsAbstract              = 8
+	AttrSymmetric               = 9
+	AttrInverseName             = 10
+	AttrContainsNoLoops         = 11
+	AttrEventNotifier           = 12
+	AttrValue                   = 13
+	AttrDataType                = 14
+	AttrValueRank               = 15
+	AttrArrayDimensions         = 16
+	AttrAccessLevel             = 17
+	AttrUserAccessLevel         = 18
+	AttrMinimumSamplingInterval = 19
+	AttrHistorizing             = 20
+)
+
+//节点类别
+const (
+	NodeClassObject        = 1
+	NodeClassVariable      = 2
+	NodeClassMethod        = 4
+	NodeClassObjectType    = 8
+	NodeClassVariableType  = 16
+	NodeClassReferenceType = 32
+	NodeClassDataType      = 64
+	NodeClassView          = 128
+)
+
+//命名空间 0 的标准节点
+const (
+	IDBoolean                         = 1
+	IDSByte                           = 2
+	IDByte                            = 3
+	IDInt16                           = 4
+	IDUInt16                          = 5
+	IDInt32                           = 6
+	IDUInt32                          = 7
+	IDInt64                           = 8
+	IDUInt64                          = 9
+	IDFloat                           = 10
+	IDDouble                          = 11
+	IDString                          = 12
+	IDDateTime                        = 13
+	IDStructure                       = 22
+	IDBaseDataType                    = 24
+	IDNumber                          = 26
+	IDInteger                         = 27
+	IDUInteger                        = 28
+	IDReferences                      = 31
+	IDNonHierarchicalReferences       = 32
+	IDHierarchicalReferences          = 33
+	IDHasChild                        = 34
+	IDOrganizes                       = 35
+	IDHasTypeDefinition               = 40
+	IDAggregates                      = 44
+	IDHasSubtype                      = 45
+	IDHasProperty                     = 46
+	IDHasComponent                    = 47
+	IDBaseObjectType                  = 58
+	IDFolderType                      = 61
+	IDBaseVariableType                = 62
+	IDBaseDataVariableType            = 63
+	IDPropertyType                    = 68
+	IDRootFolder                      = 84
+	IDObjectsFolder                   = 85
+	IDTypesFolder                     = 86
+	IDViewsFolder                     = 87
+	IDObjectTypesFolder               = 88
+	IDVariableTypesFolder             = 89
+	IDDataTypesFolder                 = 90
+	IDReferenceTypesFolder            = 91
+	IDDuration                        = 290
+	IDServerState                     = 852
+	IDServerStatusDataType            = 862
+	IDServerType                      = 2004
+	IDServerStatusType                = 2138
+	IDServer                          = 2253
+	IDServerServerArray               = 2254
+	IDServerNamespaceArray            = 2255
+	IDServerServerStatus              = 2256
+	IDServerServerStatusStartTime     = 2257
+	IDServerServerStatusCurrentTime   = 2258
+	IDServerServerStatusState         = 2259
+	IDServerServerStatusBuildInfo     = 2260
+	IDServerServiceLevel              = 2267
+	IDServerServerCapabilities        = 2268
+	IDServerCapabilitiesServerProfile = 2269
+)
+
+//二进制编码标识
+const (
+	IDAnonymousIdentityToken       = 321
+	IDUserNameIdentityToken        = 324
+	IDServiceFault                 = 397
+	IDFindServersRequest           = 422
+	IDFindServersResponse          = 425
+	IDGetEndpointsRequest          = 428
+	IDGetEndpointsResponse         = 431
+	IDOpenSecureChannelRequest     = 446
+	IDOpenSecureChannelResponse    = 449
+	IDCloseSecureChannelRequest    = 452
+	IDCloseSecureChannelResponse   = 455
+	IDCreateSessionRequest         = 461
+	IDCreateSessionResponse        = 464
+	IDActivateSessionRequest       = 467
+	IDActivateSessionResponse      = 470
+	IDCloseSessionRequest          = 473
+	IDCloseSessionResponse         = 476
+	IDBrowseRequest                = 527
+	IDBrowseResponse               = 530
+	IDBrowseNextRequest            = 533
+	IDBrowseNextResponse           = 536
+	IDTranslateBrowsePathsRequest  = 554
+	IDTranslateBrowsePathsResponse = 557
+	IDRegisterNodesRequest         = 560
+	IDRegisterNodesResponse        = 563
+	IDUnregisterNodesRequest       = 566
+	IDUnregisterNodesResponse      = 569
+	IDReadRequest                  = 631
+	IDReadResponse                 = 634
+	IDWriteRequest                 = 673
+	IDWriteResponse                = 676
+	IDDataChangeFilter             = 724
+	IDCreateMonitoredItemsRequest  = 751
+	IDCreateMonitoredItemsResponse = 754
+	IDModifyMonitoredItemsRequest  = 763
+	IDModifyMonitoredItemsResponse = 766
+	IDSetMonitoringModeRequest     = 769
+	IDSetMonitoringModeResponse    = 772
+	IDDeleteMonitoredItemsRequest  = 781
+	IDDeleteMonitoredItemsResponse = 784
+	IDCreateSubscriptionRequest    = 787
+	IDCreateSubscriptionResponse   = 790
+	IDModifySubscriptionRequest    = 793
+	IDModifySubscriptionResponse   = 796
+	IDSetPublishingModeRequest     = 799
+	IDSetPublishingModeResponse    = 802
+	IDDataChangeNotification       = 811
+	IDStatusChangeNotification     = 820
+	IDPublishRequest               = 826
+	IDPublishResponse              = 829
+	IDRepublishRequest             = 832
+	IDRepublishResponse            = 835
+	IDDeleteSubscriptionsRequest   = 847
+	IDDeleteSubscriptionsResponse  = 850
+	IDServerStatusDataTypeEncoding = 864
+)
+
+//监视模式
+const (
+	MonitoringDisabled  = 0
+	MonitoringSampling  = 1
+	MonitoringReporting = 2
+)
+
+//时间戳返回方式
+const (
+	TimestampsSource  = 0
+	TimestampsServer  = 1
+	TimestampsBoth    = 2
+	TimestampsNeither = 3
+)
+
+//浏览方向
+const (
+	BrowseForward = 0
+	BrowseInverse = 1
+	BrowseBoth    = 2
+)
+
+//安全模式
+const (
+	SecurityModeNone = 1
+)
+
+//用户令牌类型
+const (
+	UserTokenAnonymous = 0
+	UserTokenUserName  = 1
+)
+
+//PolicyNone 不加密的安全策略
+const PolicyNone = "http://opcfoundation.org/UA/SecurityPolicy#None"
+
+//TransportProfile UA TCP 二进制传输
+const TransportProfile = "http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary"
@@ -0,0 +1,674 @@
+package ua
+
+import (
+	"errors"
+	"reflect"
+	"time"
+)
+
+//Request 服务请求，所有请求以 RequestHeader 开始
+type Request interface {
+	Header() *RequestHeader
+}
+
+//Response 服务应答，所有应答以 ResponseHeader 开始
+type Response interface {
+	Header() *ResponseHeader
+}
+
+//以下服务与结构体按 OPC UA 规范第 4 部分的字段顺序编码，不能调整字段顺序
+
+//RequestHeader 请求头
+type RequestHeader struct {
+	AuthenticationToken NodeID
+	Timestamp           time.Time
+	RequestHandle       uint32
+	ReturnDiagnostics   uint32
+	AuditEntryID        string
+	TimeoutHint         uint32
+	AdditionalHeader    ExtensionObject
+}
+
+//Header 嵌入请求后实现 Request
+func (h *RequestHeader) Header() *RequestHeader {
+	return h
+}
+
+//ResponseHeader 应答头
+type ResponseHeader struct {
+	Timestamp          time.Time
+	RequestHandle      uint32
+	ServiceResult      StatusCode
+	ServiceDiagnostics DiagnosticInfo
+	StringTable        []string
+	AdditionalHeader   ExtensionObject
+}
+
+//Header 嵌入应答后实现 Response
+func (h *ResponseHeader) Header() *ResponseHeader {
+	return h
+}
+
+type ServiceFault struct {
+	ResponseHeader
+}
+
+type ChannelSecurityToken struct {
+	ChannelID       uint32
+	TokenID         uint32
+	CreatedAt       time.Time
+	RevisedLifetime uint32
+}
+
+type OpenSecureChannelRequest struct {
+	RequestHeader
+	ClientProtocolVersion uint32
+	RequestType           uint32 //0 创建 1 更新
+	SecurityMode          uint32
+	ClientNonce           []byte
+	RequestedLifetime     uint32
+}
+
+type OpenSecureChannelResponse struct {
+	ResponseHeader
+	ServerProtocolVersion uint32
+	SecurityToken         ChannelSecurityToken
+	ServerNonce           []byte
+}
+
+type CloseSecureChannelRequest struct {
+	RequestHeader
+}
+
+type CloseSecureChannelResponse struct {
+	ResponseHeader
+}
+
+type ApplicationDescription struct {
+	ApplicationURI      string
+	ProductURI          string
+	ApplicationName     LocalizedText
+	ApplicationType     uint32 //0 服务端
+	GatewayServerURI    string
+	DiscoveryProfileURI string
+	DiscoveryURLs       []string
+}
+
+type UserTokenPolicy struct {
+	PolicyID          string
+	TokenType         uint32
+	IssuedTokenType   string
+	IssuerEndpointURL string
+	SecurityPolicyURI string
+}
+
+type EndpointDescription struct {
+	EndpointURL         string
+	Server              ApplicationDescription
+	ServerCertificate   []byte
+	SecurityMode        uint32
+	SecurityPolicyURI   string
+	UserIdentityTokens  []UserTokenPolicy
+	TransportProfileURI string
+	SecurityLevel       uint8
+}
+
+type GetEndpointsRequest struct {
+	RequestHeader
+	EndpointURL string
+	LocaleIDs   []string
+	ProfileURIs []string
+}
+
+type GetEndpointsResponse struct {
+	ResponseHeader
+	Endpoints []EndpointDescription
+}
+
+type FindServersRequest struct {
+	RequestHeader
+	EndpointURL string
+	LocaleIDs   []string
+	ServerURIs  []string
+}
+
+type FindServersResponse struct {
+	ResponseHeader
+	Servers []ApplicationDescription
+}
+
+type SignatureData struct {
+	Algorithm string
+	Signature []byte
+}
+
+type SignedSoftwareCertificate struct {
+	CertificateData []byte
+	Signature       []byte
+}
+
+type CreateSessionRequest struct {
+	RequestHeader
+	ClientDescription       ApplicationDescription
+	ServerURI               string
+	EndpointURL             string
+	SessionName             string
+	ClientNonce             []byte
+	ClientCertificate       []byte
+	RequestedSessionTimeout float64
+	MaxResponseMessageSize  uint32
+}
+
+type CreateSessionResponse struct {
+	ResponseHeader
+	SessionID                  NodeID
+	AuthenticationToken        NodeID
+	RevisedSessionTimeout      float64
+	ServerNonce                []byte
+	ServerCertificate          []byte
+	ServerEndpoints            []EndpointDescription
+	ServerSoftwareCertificates []SignedSoftwareCertificate
+	ServerSignature            SignatureData
+	MaxRequestMessageSize      uint32
+}
+
+type AnonymousIdentityToken struct {
+	PolicyID string
+}
+
+type UserNameIdentityToken struct {
+	PolicyID            string
+	UserName            string
+	Password            []byte
+	EncryptionAlgorithm string
+}
+
+type ActivateSessionRequest struct {
+	RequestHeader
+	ClientSignature            SignatureData
+	ClientSoftwareCertificates []SignedSoftwareCertificate
+	LocaleIDs                  []string
+	UserIdentityToken          ExtensionObject
+	UserTokenSignature         SignatureData
+}
+
+type ActivateSessionResponse struct {
+	ResponseHeader
+	ServerNonce     []byte
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type CloseSessionRequest struct {
+	RequestHeader
+	DeleteSubscriptions bool
+}
+
+type CloseSessionResponse struct {
+	ResponseHeader
+}
+
+type ViewDescription struct {
+	ViewID      NodeID
+	Timestamp   time.Time
+	ViewVersion uint32
+}
+
+type BrowseDescription struct {
+	NodeID          NodeID
+	BrowseDirection uint32
+	ReferenceTypeID NodeID
+	IncludeSubtypes bool
+	NodeClassMask   uint32
+	ResultMask      uint32
+}
+
+type ReferenceDescription struct {
+	ReferenceTypeID NodeID
+	IsForward       bool
+	NodeID          ExpandedNodeID
+	BrowseName      QualifiedName
+	DisplayName     LocalizedText
+	NodeClass       uint32
+	TypeDefinition  ExpandedNodeID
+}
+
+type BrowseResult struct {
+	StatusCode        StatusCode
+	ContinuationPoint []byte
+	References        []ReferenceDescription
+}
+
+type BrowseRequest struct {
+	RequestHeader
+	View                          ViewDescription
+	RequestedMaxReferencesPerNode uint32
+	NodesToBrowse                 []BrowseDescription
+}
+
+type BrowseResponse struct {
+	ResponseHeader
+	Results         []BrowseResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type BrowseNextRequest struct {
+	RequestHeader
+	ReleaseContinuationPoints bool
+	ContinuationPoints        [][]byte
+}
+
+type BrowseNextResponse struct {
+	ResponseHeader
+	Results         []BrowseResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type RelativePathElement struct {
+	ReferenceTypeID NodeID
+	IsInverse       bool
+	IncludeSubtypes bool
+	TargetName      QualifiedName
+}
+
+type RelativePath struct {
+	Elements []RelativePathElement
+}
+
+type BrowsePath struct {
+	StartingNode NodeID
+	RelativePath RelativePath
+}
+
+type BrowsePathTarget struct {
+	TargetID           ExpandedNodeID
+	RemainingPathIndex uint32
+}
+
+type BrowsePathResult struct {
+	StatusCode StatusCode
+	Targets    []BrowsePathTarget
+}
+
+type TranslateBrowsePathsRequest struct {
+	RequestHeader
+	BrowsePaths []BrowsePath
+}
+
+type TranslateBrowsePathsResponse struct {
+	ResponseHeader
+	Results         []BrowsePathResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type RegisterNodesRequest struct {
+	RequestHeader
+	NodesToRegister []NodeID
+}
+
+type RegisterNodesResponse struct {
+	ResponseHeader
+	RegisteredNodeIDs []NodeID
+}
+
+type UnregisterNodesRequest struct {
+	RequestHeader
+	NodesToUnregister []NodeID
+}
+
+type UnregisterNodesResponse struct {
+	ResponseHeader
+}
+
+type ReadValueID struct {
+	NodeID       NodeID
+	AttributeID  uint32
+	IndexRange   string
+	DataEncoding QualifiedName
+}
+
+type ReadRequest struct {
+	RequestHeader
+	MaxAge             float64
+	TimestampsToReturn uint32
+	NodesToRead        []ReadValueID
+}
+
+type ReadResponse struct {
+	ResponseHeader
+	Results         []DataValue
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type WriteValue struct {
+	NodeID      NodeID
+	AttributeID uint32
+	IndexRange  string
+	Value       DataValue
+}
+
+type WriteRequest struct {
+	RequestHeader
+	NodesToWrite []WriteValue
+}
+
+type WriteResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type CreateSubscriptionRequest struct {
+	RequestHeader
+	RequestedPublishingInterval float64
+	RequestedLifetimeCount      uint32
+	RequestedMaxKeepAliveCount  uint32
+	MaxNotificationsPerPublish  uint32
+	PublishingEnabled           bool
+	Priority                    uint8
+}
+
+type CreateSubscriptionResponse struct {
+	ResponseHeader
+	SubscriptionID            uint32
+	RevisedPublishingInterval float64
+	RevisedLifetimeCount      uint32
+	RevisedMaxKeepAliveCount  uint32
+}
+
+type ModifySubscriptionRequest struct {
+	RequestHeader
+	SubscriptionID              uint32
+	RequestedPublishingInterval float64
+	RequestedLifetimeCount      uint32
+	RequestedMaxKeepAliveCount  uint32
+	MaxNotificationsPerPublish  uint32
+	Priority                    uint8
+}
+
+type ModifySubscriptionResponse struct {
+	ResponseHeader
+	RevisedPublishingInterval float64
+	RevisedLifetimeCount      uint32
+	RevisedMaxKeepAliveCount  uint32
+}
+
+type SetPublishingModeRequest struct {
+	RequestHeader
+	PublishingEnabled bool
+	SubscriptionIDs   []uint32
+}
+
+type SetPublishingModeResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type DeleteSubscriptionsRequest struct {
+	RequestHeader
+	SubscriptionIDs []uint32
+}
+
+type DeleteSubscriptionsResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type MonitoringParameters struct {
+	ClientHandle     uint32
+	SamplingInterval float64
+	Filter           ExtensionObject
+	QueueSize        uint32
+	DiscardOldest    bool
+}
+
+type MonitoredItemCreateRequest struct {
+	ItemToMonitor       ReadValueID
+	MonitoringMode      uint32
+	RequestedParameters MonitoringParameters
+}
+
+type MonitoredItemCreateResult struct {
+	StatusCode              StatusCode
+	MonitoredItemID         uint32
+	RevisedSamplingInterval float64
+	RevisedQueueSize        uint32
+	FilterResult            ExtensionObject
+}
+
+type CreateMonitoredItemsRequest struct {
+	RequestHeader
+	SubscriptionID     uint32
+	TimestampsToReturn uint32
+	ItemsToCreate      []MonitoredItemCreateRequest
+}
+
+type CreateMonitoredItemsResponse struct {
+	ResponseHeader
+	Results         []MonitoredItemCreateResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type MonitoredItemModifyRequest struct {
+	MonitoredItemID     uint32
+	RequestedParameters MonitoringParameters
+}
+
+type MonitoredItemModifyResult struct {
+	StatusCode              StatusCode
+	RevisedSamplingInterval float64
+	RevisedQueueSize        uint32
+	FilterResult            ExtensionObject
+}
+
+type ModifyMonitoredItemsRequest struct {
+	RequestHeader
+	SubscriptionID     uint32
+	TimestampsToReturn uint32
+	ItemsToModify      []MonitoredItemModifyRequest
+}
+
+type ModifyMonitoredItemsResponse struct {
+	ResponseHeader
+	Results         []MonitoredItemModifyResult
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type SetMonitoringModeRequest struct {
+	RequestHeader
+	SubscriptionID   uint32
+	MonitoringMode   uint32
+	MonitoredItemIDs []uint32
+}
+
+type SetMonitoringModeResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type DeleteMonitoredItemsRequest struct {
+	RequestHeader
+	SubscriptionID   uint32
+	MonitoredItemIDs []uint32
+}
+
+type DeleteMonitoredItemsResponse struct {
+	ResponseHeader
+	Results         []StatusCode
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type MonitoredItemNotification struct {
+	ClientHandle uint32
+	Value        DataValue
+}
+
+type DataChangeNotification struct {
+	MonitoredItems  []MonitoredItemNotification
+	DiagnosticInfos []DiagnosticInfo
+}
+
+type NotificationMessage struct {
+	SequenceNumber   uint32
+	PublishTime      time.Time
+	NotificationData []ExtensionObject
+}
+
+type SubscriptionAcknowledgement struct {
+	SubscriptionID uint32
+	SequenceNumber uint32
+}
+
+type PublishRequest struct {
+	RequestHeader
+	SubscriptionAcknowledgements []SubscriptionAcknowledgement
+}
+
+type PublishResponse struct {
+	ResponseHeader
+	SubscriptionID           uint32
+	AvailableSequenceNumbers []uint32
+	MoreNotifications        bool
+	NotificationMessage      NotificationMessage
+	Results                  []StatusCode
+	DiagnosticInfos          []DiagnosticInfo
+}
+
+type RepublishRequest struct {
+	RequestHeader
+	SubscriptionID           uint32
+	RetransmitSequenceNumber uint32
+}
+
+type RepublishResponse struct {
+	ResponseHeader
+	NotificationMessage NotificationMessage
+}
+
+type BuildInfo struct {
+	ProductURI       string
+	ManufacturerName string
+	ProductName      string
+	SoftwareVersion  string
+	BuildNumber      string
+	BuildDate        time.Time
+}
+
+type ServerStatusDataType struct {
+	StartTime           time.Time
+	CurrentTime         time.Time
+	State               uint32
+	BuildInfo           BuildInfo
+	SecondsTillShutdown uint32
+	ShutdownReason      LocalizedText
+}
+
+func init() {
+	for id, v := range map[uint32]interface{}{
+		IDAnonymousIdentityToken:       AnonymousIdentityToken{},
+		IDUserNameIdentityToken:        UserNameIdentityToken{},
+		IDServiceFault:                 ServiceFault{},
+		IDFindServersRequest:           FindServersRequest{},
+		IDFindServersResponse:          FindServersResponse{},
+		IDGetEndpointsRequest:          GetEndpointsRequest{},
+		IDGetEndpointsResponse:         GetEndpointsResponse{},
+		IDOpenSecureChannelRequest:     OpenSecureChannelRequest{},
+		IDOpenSecureChannelResponse:    OpenSecureChannelResponse{},
+		IDCloseSecureChannelRequest:    CloseSecureChannelRequest{},
+		IDCloseSecureChannelResponse:   CloseSecureChannelResponse{},
+		IDCreateSessionRequest:         CreateSessionRequest{},
+		IDCreateSessionResponse:        CreateSessionResponse{},
+		IDActivateSessionRequest:       ActivateSessionRequest{},
+		IDActivateSessionResponse:      ActivateSessionResponse{},
+		IDCloseSessionRequest:          CloseSessionRequest{},
+		IDCloseSessionResponse:         CloseSessionResponse{},
+		IDBrowseRequest:                BrowseRequest{},
+		IDBrowseResponse:               BrowseResponse{},
+		IDBrowseNextRequest:            BrowseNextRequest{},
+		IDBrowseNextResponse:           BrowseNextResponse{},
+		IDTranslateBrowsePathsRequest:  TranslateBrowsePathsRequest{},
+		IDTranslateBrowsePathsResponse: TranslateBrowsePathsResponse{},
+		IDRegisterNodesRequest:         RegisterNodesRequest{},
+		IDRegisterNodesResponse:        RegisterNodesResponse{},
+		IDUnregisterNodesRequest:       UnregisterNodesRequest{},
+		IDUnregisterNodesResponse:      UnregisterNodesResponse{},
+		IDReadRequest:                  ReadRequest{},
+		IDReadResponse:                 ReadResponse{},
+		IDWriteRequest:                 WriteRequest{},
+		IDWriteResponse:                WriteResponse{},
+		IDCreateMonitoredItemsRequest:  CreateMonitoredItemsRequest{},
+		IDCreateMonitoredItemsResponse: CreateMonitoredItemsResponse{},
+		IDModifyMonitoredItemsRequest:  ModifyMonitoredItemsRequest{},
+		IDModifyMonitoredItemsResponse: ModifyMonitoredItemsResponse{},
+		IDSetMonitoringModeRequest:     SetMonitoringModeRequest{},
+		IDSetMonitoringModeResponse:    SetMonitoringModeResponse{},
+		IDDeleteMonitoredItemsRequest:  DeleteMonitoredItemsRequest{},
+		IDDeleteMonitoredItemsResponse: DeleteMonitoredItemsResponse{},
+		IDCreateSubscriptionRequest:    CreateSubscriptionRequest{},
+		IDCreateSubscriptionResponse:   CreateSubscriptionResponse{},
+		IDModifySubscriptionRequest:    ModifySubscriptionRequest{},
+		IDModifySubscriptionResponse:   ModifySubscriptionResponse{},
+		IDSetPublishingModeRequest:     SetPublishingModeRequest{},
+		IDSetPublishingModeResponse:    SetPublishingModeResponse{},
+		IDDataChangeNotification:       DataChangeNotification{},
+		IDPublishRequest:               PublishRequest{},
+		IDPublishResponse:              PublishResponse{},
+		IDRepublishRequest:             RepublishRequest{},
+		IDRepublishResponse:            RepublishResponse{},
+		IDDeleteSubscriptionsRequest:   DeleteSubscriptionsRequest{},
+		IDDeleteSubscriptionsResponse:  DeleteSubscriptionsResponse{},
+		IDServerStatusDataTypeEncoding: ServerStatusDataType{},
+	} {
+		RegisterExtension(id, v)
+	}
+}
+
+//ErrUnknownService 消息的编码标识没有注册，Header 中的 RequestHandle 仍然有效
+type ErrUnknownService struct {
+	TypeID NodeID
+	Header RequestHeader
+}
+
+func (e *ErrUnknownService) Error() string {
+	return "不支持的服务 " + e.TypeID.String()
+}
+
+//EncodeMessage 编码服务消息: 编码标识 + 结构
+func EncodeMessage(v interface{}) ([]byte, error) {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	id, ok := extensionIDs[t]
+	if !ok {
+		return nil, errors.New("没有注册的消息类型 " + t.String())
+	}
+	e := &Encoder{}
+	NewNumericNodeID(0, id).EncodeUA(e)
+	e.Encode(v)
+	return e.Bytes(), nil
+}
+
+//DecodeMessage 解码服务消息，返回结构体指针；未注册的服务返回 *ErrUnknownService
+func DecodeMessage(data []byte) (interface{}, error) {
+	d := NewDecoder(data)
+	id := NodeID{}
+	id.DecodeUA(d)
+	if d.err != nil {
+		return nil, d.err
+	}
+	t, ok := extensionTypes[id.Numeric]
+	if !ok || id.Namespace != 0 || id.Type != NodeIDNumeric {
+		unknown := &ErrUnknownService{TypeID: id}
+		d.Decode(&unknown.Header)
+		return nil, unknown
+	}
+	v := reflect.New(t)
+	if err := d.Decode(v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
@@ -0,0 +1,249 @@
+package ua
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+//消息类型
+const (
+	MessageHello       = "HEL"
+	MessageAcknowledge = "ACK"
+	MessageError       = "ERR"
+	MessageOpen        = "OPN"
+	MessageClose       = "CLO"
+	MessageService     = "MSG"
+)
+
+//传输层缓冲区默认值
+const (
+	DefaultBufferSize = 65535
+	minBufferSize     = 8192
+	maxMessageSize    = 16 << 20
+)
+
+//Hello 客户端握手
+type Hello struct {
+	ProtocolVersion   uint32
+	ReceiveBufferSize uint32
+	SendBufferSize    uint32
+	MaxMessageSize    uint32
+	MaxChunkCount     uint32
+	EndpointURL       string
+}
+
+//Acknowledge 服务端握手应答
+type Acknowledge struct {
+	ProtocolVersion   uint32
+	ReceiveBufferSize uint32
+	SendBufferSize    uint32
+	MaxMessageSize    uint32
+	MaxChunkCount     uint32
+}
+
+//ErrorMessage 传输层错误，发送后关闭链接
+type ErrorMessage struct {
+	Error  StatusCode
+	Reason string
+}
+
+//Message 组装完成的消息
+type Message struct {
+	Type      string
+	ChannelID uint32
+	TokenID   uint32 //MSG 与 CLO
+	Policy    string //OPN 的安全策略
+	RequestID uint32
+	Body      []byte
+}
+
+//Conn UA TCP 链接，仅支持 None 安全策略；读取只能在一个协程中进行，写入可以并发
+type Conn struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	mutex    sync.Mutex
+	sequence uint32
+	//ChannelID 安全通道标识，写入 OPN/MSG/CLO 时使用
+	ChannelID uint32
+	//TokenID 安全令牌标识
+	TokenID uint32
+	//SendBufferSize 发送的最大块长度
+	SendBufferSize uint32
+	//ReceiveBufferSize 接收的最大块长度
+	ReceiveBufferSize uint32
+	//WriteTimeout 写入超时
+	WriteTimeout time.Duration
+}
+
+//NewConn 包装 TCP 链接
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn:              conn,
+		reader:            bufio.NewReader(conn),
+		SendBufferSize:    DefaultBufferSize,
+		ReceiveBufferSize: DefaultBufferSize,
+		WriteTimeout:      10 * time.Second,
+	}
+}
+
+//NetConn 底层 TCP 链接
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+//ReadMessage 读取一个完整消息，中止的消息被丢弃
+func (c *Conn) ReadMessage() (*Message, error) {
+	var message *Message
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, header); err != nil {
+			return nil, err
+		}
+		msgType, chunkType := string(header[:3]), header[3]
+		size := binary.LittleEndian.Uint32(header[4:])
+		if size < 8 || size > c.ReceiveBufferSize {
+			return nil, StatusBadTCPMessageTooLarge
+		}
+		data := make([]byte, size-8)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		switch msgType {
+		case MessageHello, MessageAcknowledge, MessageError:
+			return &Message{Type: msgType, Body: data}, nil
+		case MessageOpen, MessageService, MessageClose:
+		default:
+			return nil, StatusBadTCPMessageTypeInvalid
+		}
+		d := NewDecoder(data)
+		chunk := &Message{Type: msgType, ChannelID: d.ReadUint32()}
+		if msgType == MessageOpen {
+			chunk.Policy = d.ReadString()
+			d.ReadByteString()
+			d.ReadByteString()
+			if chunk.Policy != PolicyNone && d.Err() == nil {
+				return nil, StatusBadSecurityPolicyRejected
+			}
+		} else {
+			chunk.TokenID = d.ReadUint32()
+		}
+		d.ReadUint32()
+		chunk.RequestID = d.ReadUint32()
+		if d.Err() != nil {
+			return nil, d.Err()
+		}
+		switch chunkType {
+		case 'A':
+			message = nil
+			continue
+		case 'C', 'F':
+		default:
+			return nil, StatusBadTCPMessageTypeInvalid
+		}
+		if message == nil {
+			message = chunk
+		} else if message.Type != chunk.Type || message.RequestID != chunk.RequestID {
+			return nil, errors.New("消息块不连续")
+		}
+		message.Body = append(message.Body, d.Remaining()...)
+		if len(message.Body) > maxMessageSize {
+			return nil, StatusBadTCPMessageTooLarge
+		}
+		if chunkType == 'F' {
+			return message, nil
+		}
+	}
+}
+
+//WriteRaw 写入 HEL/ACK/ERR 消息
+func (c *Conn) WriteRaw(msgType string, v interface{}) error {
+	e := &Encoder{}
+	e.Encode(v)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.write(c.frame(msgType, 'F', e.Bytes()))
+}
+
+//WriteMessage 写入 OPN/MSG/CLO 消息，按 SendBufferSize 分块
+func (c *Conn) WriteMessage(msgType string, requestID uint32, body []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	security := &Encoder{}
+	security.WriteUint32(c.ChannelID)
+	if msgType == MessageOpen {
+		security.WriteString(PolicyNone)
+		security.WriteByteString(nil)
+		security.WriteByteString(nil)
+	} else {
+		security.WriteUint32(c.TokenID)
+	}
+	//块长度 = 消息头 8 字节 + 安全头 + 序号头 8 字节 + 数据
+	limit := int(c.SendBufferSize) - 16 - len(security.Bytes())
+	if limit <= 0 {
+		return fmt.Errorf("发送缓冲区 %d 过小", c.SendBufferSize)
+	}
+	for {
+		n := len(body)
+		chunkType := byte('F')
+		if n > limit {
+			n, chunkType = limit, 'C'
+		}
+		c.sequence++
+		chunk := &Encoder{data: append([]byte{}, security.Bytes()...)}
+		chunk.WriteUint32(c.sequence)
+		chunk.WriteUint32(requestID)
+		chunk.data = append(chunk.data, body[:n]...)
+		if err := c.write(c.frame(msgType, chunkType, chunk.Bytes())); err != nil {
+			return err
+		}
+		body = body[n:]
+		if chunkType == 'F' {
+			return nil
+		}
+	}
+}
+
+//frame 加上消息头
+func (c *Conn) frame(msgType string, chunkType byte, data []byte) []byte {
+	frame := make([]byte, 8, 8+len(data))
+	copy(frame, msgType)
+	frame[3] = chunkType
+	binary.LittleEndian.PutUint32(frame[4:], uint32(8+len(data)))
+	return append(frame, data...)
+}
+
+func (c *Conn) write(frame []byte) error {
+	if c.WriteTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+//Negotiate 服务端根据客户端握手确定缓冲区大小，返回应答
+func (c *Conn) Negotiate(hello *Hello) (*Acknowledge, error) {
+	if hello.ReceiveBufferSize < minBufferSize || hello.SendBufferSize < minBufferSize {
+		return nil, fmt.Errorf("客户端缓冲区过小 %d/%d", hello.ReceiveBufferSize, hello.SendBufferSize)
+	}
+	if hello.ReceiveBufferSize < c.SendBufferSize {
+		c.SendBufferSize = hello.ReceiveBufferSize
+	}
+	if hello.SendBufferSize < c.ReceiveBufferSize {
+		c.ReceiveBufferSize = hello.SendBufferSize
+	}
+	return &Acknowledge{
+		ReceiveBufferSize: c.ReceiveBufferSize,
+		SendBufferSize:    c.SendBufferSize,
+		MaxMessageSize:    maxMessageSize,
+	}, nil
+}
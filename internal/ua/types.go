@@ -0,0 +1,564 @@
+package ua
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//NodeID 标识类型
+const (
+	NodeIDNumeric = 0
+	NodeIDString  = 1
+	NodeIDGUID    = 2
+	NodeIDOpaque  = 3
+)
+
+//NodeID 节点标识，可以作为 map 的键
+type NodeID struct {
+	Namespace uint16
+	Type      uint8
+	Numeric   uint32
+	Text      string //字符串标识，GUID 与 Opaque 为原始字节
+}
+
+//NewNumericNodeID 数字节点标识
+func NewNumericNodeID(namespace uint16, id uint32) NodeID {
+	return NodeID{Namespace: namespace, Type: NodeIDNumeric, Numeric: id}
+}
+
+//NewStringNodeID 字符串节点标识
+func NewStringNodeID(namespace uint16, id string) NodeID {
+	return NodeID{Namespace: namespace, Type: NodeIDString, Text: id}
+}
+
+//IsNull 是否为空节点(ns=0;i=0)
+func (n NodeID) IsNull() bool {
+	return n == NodeID{}
+}
+
+func (n NodeID) String() string {
+	prefix := ""
+	if n.Namespace != 0 {
+		prefix = "ns=" + strconv.Itoa(int(n.Namespace)) + ";"
+	}
+	switch n.Type {
+	case NodeIDString:
+		return prefix + "s=" + n.Text
+	case NodeIDGUID:
+		return prefix + fmt.Sprintf("g=%x", n.Text)
+	case NodeIDOpaque:
+		return prefix + fmt.Sprintf("b=%x", n.Text)
+	default:
+		return prefix + "i=" + strconv.FormatUint(uint64(n.Numeric), 10)
+	}
+}
+
+//ParseNodeID 解析 ns=1;s=Tag 或 i=85 形式的节点标识，仅支持数字与字符串标识
+func ParseNodeID(text string) (NodeID, error) {
+	id := NodeID{}
+	if strings.HasPrefix(text, "ns=") {
+		pos := strings.Index(text, ";")
+		if pos < 0 {
+			return id, errors.New("节点标识格式错误 " + text)
+		}
+		namespace, err := strconv.ParseUint(text[3:pos], 10, 16)
+		if err != nil {
+			return id, errors.New("节点标识格式错误 " + text)
+		}
+		id.Namespace = uint16(namespace)
+		text = text[pos+1:]
+	}
+	switch {
+	case strings.HasPrefix(text, "i="):
+		numeric, err := strconv.ParseUint(text[2:], 10, 32)
+		if err != nil {
+			return id, errors.New("节点标识格式错误 " + text)
+		}
+		id.Numeric = uint32(numeric)
+	case strings.HasPrefix(text, "s="):
+		id.Type, id.Text = NodeIDString, text[2:]
+	default:
+		return id, errors.New("节点标识格式错误 " + text)
+	}
+	return id, nil
+}
+
+func (n NodeID) EncodeUA(e *Encoder) {
+	n.encode(e, 0)
+}
+
+//encode mask 为 ExpandedNodeId 的附加标志
+func (n NodeID) encode(e *Encoder, mask uint8) {
+	switch n.Type {
+	case NodeIDString:
+		e.WriteUint8(0x03 | mask)
+		e.WriteUint16(n.Namespace)
+		e.WriteString(n.Text)
+	case NodeIDGUID:
+		e.WriteUint8(0x04 | mask)
+		e.WriteUint16(n.Namespace)
+		e.data = append(e.data, n.Text...)
+	case NodeIDOpaque:
+		e.WriteUint8(0x05 | mask)
+		e.WriteUint16(n.Namespace)
+		e.WriteByteString([]byte(n.Text))
+	default:
+		switch {
+		case n.Namespace == 0 && n.Numeric <= 0xff:
+			e.WriteUint8(0x00 | mask)
+			e.WriteUint8(uint8(n.Numeric))
+		case n.Namespace <= 0xff && n.Numeric <= 0xffff:
+			e.WriteUint8(0x01 | mask)
+			e.WriteUint8(uint8(n.Namespace))
+			e.WriteUint16(uint16(n.Numeric))
+		default:
+			e.WriteUint8(0x02 | mask)
+			e.WriteUint16(n.Namespace)
+			e.WriteUint32(n.Numeric)
+		}
+	}
+}
+
+func (n *NodeID) DecodeUA(d *Decoder) {
+	n.decode(d)
+}
+
+//decode 返回编码字节中的附加标志
+func (n *NodeID) decode(d *Decoder) uint8 {
+	flags := d.ReadUint8()
+	*n = NodeID{}
+	switch flags & 0x0f {
+	case 0x00:
+		n.Numeric = uint32(d.ReadUint8())
+	case 0x01:
+		n.Namespace = uint16(d.ReadUint8())
+		n.Numeric = uint32(d.ReadUint16())
+	case 0x02:
+		n.Namespace = d.ReadUint16()
+		n.Numeric = d.ReadUint32()
+	case 0x03:
+		n.Namespace = d.ReadUint16()
+		n.Type, n.Text = NodeIDString, d.ReadString()
+	case 0x04:
+		n.Namespace = d.ReadUint16()
+		n.Type, n.Text = NodeIDGUID, string(d.read(16))
+	case 0x05:
+		n.Namespace = d.ReadUint16()
+		n.Type, n.Text = NodeIDOpaque, string(d.ReadByteString())
+	default:
+		d.err = ErrDecode
+	}
+	return flags & 0xc0
+}
+
+//ExpandedNodeID 带命名空间 URI 与服务器索引的节点标识
+type ExpandedNodeID struct {
+	NodeID
+	NamespaceURI string
+	ServerIndex  uint32
+}
+
+func (n ExpandedNodeID) EncodeUA(e *Encoder) {
+	mask := uint8(0)
+	if n.NamespaceURI != "" {
+		mask |= 0x80
+	}
+	if n.ServerIndex != 0 {
+		mask |= 0x40
+	}
+	n.NodeID.encode(e, mask)
+	if n.NamespaceURI != "" {
+		e.WriteString(n.NamespaceURI)
+	}
+	if n.ServerIndex != 0 {
+		e.WriteUint32(n.ServerIndex)
+	}
+}
+
+func (n *ExpandedNodeID) DecodeUA(d *Decoder) {
+	mask := n.NodeID.decode(d)
+	n.NamespaceURI, n.ServerIndex = "", 0
+	if mask&0x80 != 0 {
+		n.NamespaceURI = d.ReadString()
+	}
+	if mask&0x40 != 0 {
+		n.ServerIndex = d.ReadUint32()
+	}
+}
+
+//QualifiedName 带命名空间的名称
+type QualifiedName struct {
+	Namespace uint16
+	Name      string
+}
+
+//LocalizedText 本地化文本
+type LocalizedText struct {
+	Locale string
+	Text   string
+}
+
+func (t LocalizedText) EncodeUA(e *Encoder) {
+	mask := uint8(0)
+	if t.Locale != "" {
+		mask |= 0x01
+	}
+	if t.Text != "" {
+		mask |= 0x02
+	}
+	e.WriteUint8(mask)
+	if t.Locale != "" {
+		e.WriteString(t.Locale)
+	}
+	if t.Text != "" {
+		e.WriteString(t.Text)
+	}
+}
+
+func (t *LocalizedText) DecodeUA(d *Decoder) {
+	mask := d.ReadUint8()
+	*t = LocalizedText{}
+	if mask&0x01 != 0 {
+		t.Locale = d.ReadString()
+	}
+	if mask&0x02 != 0 {
+		t.Text = d.ReadString()
+	}
+}
+
+//GUID 16 字节 GUID
+type GUID [16]byte
+
+//DiagnosticInfo 诊断信息，服务端不返回诊断信息，只用于解码
+type DiagnosticInfo struct {
+	SymbolicID          int32
+	NamespaceURI        int32
+	LocalizedText       int32
+	Locale              int32
+	AdditionalInfo      string
+	InnerStatusCode     StatusCode
+	InnerDiagnosticInfo *DiagnosticInfo
+}
+
+func (i DiagnosticInfo) EncodeUA(e *Encoder) {
+	e.WriteUint8(0)
+}
+
+func (i *DiagnosticInfo) DecodeUA(d *Decoder) {
+	mask := d.ReadUint8()
+	*i = DiagnosticInfo{}
+	if mask&0x01 != 0 {
+		i.SymbolicID = int32(d.ReadUint32())
+	}
+	if mask&0x02 != 0 {
+		i.NamespaceURI = int32(d.ReadUint32())
+	}
+	if mask&0x04 != 0 {
+		i.LocalizedText = int32(d.ReadUint32())
+	}
+	if mask&0x08 != 0 {
+		i.Locale = int32(d.ReadUint32())
+	}
+	if mask&0x10 != 0 {
+		i.AdditionalInfo = d.ReadString()
+	}
+	if mask&0x20 != 0 {
+		i.InnerStatusCode = StatusCode(d.ReadUint32())
+	}
+	if mask&0x40 != 0 {
+		i.InnerDiagnosticInfo = &DiagnosticInfo{}
+		i.InnerDiagnosticInfo.DecodeUA(d)
+	}
+}
+
+//extensionTypes 扩展对象二进制编码标识对应的结构
+var (
+	extensionTypes = make(map[uint32]reflect.Type)
+	extensionIDs   = make(map[reflect.Type]uint32)
+)
+
+//RegisterExtension 注册扩展对象结构，id 为 ns=0 的二进制编码标识
+func RegisterExtension(id uint32, v interface{}) {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	extensionTypes[id] = t
+	extensionIDs[t] = id
+}
+
+//ExtensionObject 扩展对象，已注册的结构解码为结构体指针，其他为原始字节
+type ExtensionObject struct {
+	TypeID NodeID
+	Body   interface{}
+}
+
+//NewExtensionObject 使用注册的编码标识包装结构
+func NewExtensionObject(body interface{}) *ExtensionObject {
+	t := reflect.TypeOf(body)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return &ExtensionObject{TypeID: NewNumericNodeID(0, extensionIDs[t]), Body: body}
+}
+
+func (o ExtensionObject) EncodeUA(e *Encoder) {
+	o.TypeID.EncodeUA(e)
+	switch body := o.Body.(type) {
+	case nil:
+		e.WriteUint8(0)
+	case []byte:
+		e.WriteUint8(1)
+		e.WriteByteString(body)
+	default:
+		inner := &Encoder{}
+		inner.Encode(body)
+		e.WriteUint8(1)
+		e.WriteByteString(inner.Bytes())
+	}
+}
+
+func (o *ExtensionObject) DecodeUA(d *Decoder) {
+	*o = ExtensionObject{}
+	o.TypeID.DecodeUA(d)
+	switch d.ReadUint8() {
+	case 0:
+	case 1, 2:
+		data := d.ReadByteString()
+		t, ok := extensionTypes[o.TypeID.Numeric]
+		if !ok || o.TypeID.Namespace != 0 || o.TypeID.Type != NodeIDNumeric {
+			o.Body = data
+			return
+		}
+		body := reflect.New(t)
+		if err := NewDecoder(data).Decode(body.Interface()); err != nil {
+			d.err = err
+			return
+		}
+		o.Body = body.Interface()
+	default:
+		d.err = ErrDecode
+	}
+}
+
+//内置类型标识
+const (
+	TypeBoolean         = 1
+	TypeSByte           = 2
+	TypeByte            = 3
+	TypeInt16           = 4
+	TypeUInt16          = 5
+	TypeInt32           = 6
+	TypeUInt32          = 7
+	TypeInt64           = 8
+	TypeUInt64          = 9
+	TypeFloat           = 10
+	TypeDouble          = 11
+	TypeString          = 12
+	TypeDateTime        = 13
+	TypeGUID            = 14
+	TypeByteString      = 15
+	TypeXMLElement      = 16
+	TypeNodeID          = 17
+	TypeExpandedNodeID  = 18
+	TypeStatusCode      = 19
+	TypeQualifiedName   = 20
+	TypeLocalizedText   = 21
+	TypeExtensionObject = 22
+	TypeDataValue       = 23
+	TypeVariant         = 24
+	TypeDiagnosticInfo  = 25
+)
+
+//variantTypes 内置类型对应的 Go 类型
+var variantTypes = map[uint8]reflect.Type{
+	TypeBoolean:         reflect.TypeOf(false),
+	TypeSByte:           reflect.TypeOf(int8(0)),
+	TypeByte:            reflect.TypeOf(uint8(0)),
+	TypeInt16:           reflect.TypeOf(int16(0)),
+	TypeUInt16:          reflect.TypeOf(uint16(0)),
+	TypeInt32:           reflect.TypeOf(int32(0)),
+	TypeUInt32:          reflect.TypeOf(uint32(0)),
+	TypeInt64:           reflect.TypeOf(int64(0)),
+	TypeUInt64:          reflect.TypeOf(uint64(0)),
+	TypeFloat:           reflect.TypeOf(float32(0)),
+	TypeDouble:          reflect.TypeOf(float64(0)),
+	TypeString:          reflect.TypeOf(""),
+	TypeDateTime:        timeType,
+	TypeGUID:            reflect.TypeOf(GUID{}),
+	TypeByteString:      reflect.TypeOf([]byte(nil)),
+	TypeNodeID:          reflect.TypeOf(NodeID{}),
+	TypeExpandedNodeID:  reflect.TypeOf(ExpandedNodeID{}),
+	TypeStatusCode:      reflect.TypeOf(StatusCode(0)),
+	TypeQualifiedName:   reflect.TypeOf(QualifiedName{}),
+	TypeLocalizedText:   reflect.TypeOf(LocalizedText{}),
+	TypeExtensionObject: reflect.TypeOf(&ExtensionObject{}),
+	TypeDataValue:       reflect.TypeOf(&DataValue{}),
+	TypeVariant:         reflect.TypeOf((*interface{})(nil)).Elem(),
+	TypeDiagnosticInfo:  reflect.TypeOf(&DiagnosticInfo{}),
+}
+
+//variantIDs Go 类型对应的内置类型
+var variantIDs = func() map[reflect.Type]uint8 {
+	ids := make(map[reflect.Type]uint8)
+	for id, t := range variantTypes {
+		ids[t] = id
+	}
+	return ids
+}()
+
+//Variant 任意内置类型的数值或一维数组，Value 为 nil 表示空值，[]interface{} 为 Variant 数组
+type Variant struct {
+	Value interface{}
+}
+
+//VariantType 数值对应的内置类型与是否为数组，不支持的类型返回 0
+func VariantType(value interface{}) (uint8, bool) {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return 0, false
+	}
+	if id, ok := variantIDs[t]; ok {
+		return id, false
+	}
+	if t.Kind() == reflect.Slice {
+		if id, ok := variantIDs[t.Elem()]; ok {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (v Variant) EncodeUA(e *Encoder) {
+	id, isArray := VariantType(v.Value)
+	if id == 0 {
+		e.WriteUint8(0)
+		return
+	}
+	if !isArray {
+		e.WriteUint8(id)
+		e.Encode(v.Value)
+		return
+	}
+	e.WriteUint8(id | 0x80)
+	rv := reflect.ValueOf(v.Value)
+	e.WriteUint32(uint32(rv.Len()))
+	for i := 0; i < rv.Len(); i++ {
+		if id == TypeVariant {
+			Variant{Value: rv.Index(i).Interface()}.EncodeUA(e)
+		} else {
+			e.value(rv.Index(i))
+		}
+	}
+}
+
+func (v *Variant) DecodeUA(d *Decoder) {
+	mask := d.ReadUint8()
+	v.Value = nil
+	id := mask & 0x3f
+	if id == 0 || d.err != nil {
+		return
+	}
+	if id == TypeXMLElement {
+		id = TypeByteString
+	}
+	t, ok := variantTypes[id]
+	if !ok {
+		d.err = ErrDecode
+		return
+	}
+	if mask&0x80 == 0 {
+		value := reflect.New(t)
+		d.value(value.Elem())
+		v.Value = value.Elem().Interface()
+		return
+	}
+	n := d.arrayLength()
+	if n < 0 {
+		n = 0
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(t), n, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		if id == TypeVariant {
+			item := &Variant{}
+			item.DecodeUA(d)
+			if item.Value != nil {
+				slice.Index(i).Set(reflect.ValueOf(item.Value))
+			}
+		} else {
+			d.value(slice.Index(i))
+		}
+	}
+	if mask&0x40 != 0 {
+		//多维数组按一维返回
+		var dims []int32
+		d.value(reflect.ValueOf(&dims).Elem())
+	}
+	v.Value = slice.Interface()
+}
+
+//DataValue 带状态与时间戳的数值
+type DataValue struct {
+	Value           interface{} //nil 表示没有数值
+	Status          StatusCode
+	SourceTimestamp time.Time
+	ServerTimestamp time.Time
+}
+
+func (v DataValue) EncodeUA(e *Encoder) {
+	mask := uint8(0)
+	if v.Value != nil {
+		mask |= 0x01
+	}
+	if v.Status != 0 {
+		mask |= 0x02
+	}
+	if !v.SourceTimestamp.IsZero() {
+		mask |= 0x04
+	}
+	if !v.ServerTimestamp.IsZero() {
+		mask |= 0x08
+	}
+	e.WriteUint8(mask)
+	if v.Value != nil {
+		Variant{Value: v.Value}.EncodeUA(e)
+	}
+	if v.Status != 0 {
+		e.WriteUint32(uint32(v.Status))
+	}
+	if !v.SourceTimestamp.IsZero() {
+		e.WriteTime(v.SourceTimestamp)
+	}
+	if !v.ServerTimestamp.IsZero() {
+		e.WriteTime(v.ServerTimestamp)
+	}
+}
+
+func (v *DataValue) DecodeUA(d *Decoder) {
+	mask := d.ReadUint8()
+	*v = DataValue{}
+	if mask&0x01 != 0 {
+		variant := &Variant{}
+		variant.DecodeUA(d)
+		v.Value = variant.Value
+	}
+	if mask&0x02 != 0 {
+		v.Status = StatusCode(d.ReadUint32())
+	}
+	if mask&0x04 != 0 {
+		v.SourceTimestamp = d.ReadTime()
+	}
+	if mask&0x10 != 0 {
+		d.ReadUint16()
+	}
+	if mask&0x08 != 0 {
+		v.ServerTimestamp = d.ReadTime()
+	}
+	if mask&0x20 != 0 {
+		d.ReadUint16()
+	}
+}
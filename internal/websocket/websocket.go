@@ -0,0 +1,320 @@
+//Package websocket 精简的 RFC 6455 WebSocket 实现，支持文本/二进制消息、分片、ping/pong 与关闭握手
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//消息类型
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	closeMessage  = 8
+	pingMessage   = 9
+	pongMessage   = 10
+)
+
+//关闭状态码
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooLarge      = 1009
+)
+
+//DefaultMaxMessageSize 默认最大消息长度
+const DefaultMaxMessageSize = 64 << 10
+
+var acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+//ErrClosed 对方已关闭链接
+var ErrClosed = errors.New("websocket 链接已关闭")
+
+//Conn WebSocket 链接，读取只能在一个协程中进行，写入可并发
+type Conn struct {
+	conn           net.Conn
+	reader         *bufio.Reader
+	client         bool //客户端发送的数据需要掩码
+	writeMutex     sync.Mutex
+	closeOnce      sync.Once
+	MaxMessageSize int
+}
+
+func newConn(conn net.Conn, reader *bufio.Reader, client bool) *Conn {
+	return &Conn{conn: conn, reader: reader, client: client, MaxMessageSize: DefaultMaxMessageSize}
+}
+
+//acceptKey 计算 Sec-WebSocket-Accept
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+//headerContains 头部是否包含指定标记(逗号分隔，忽略大小写)
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//Upgrade 将 HTTP 请求升级为 WebSocket 链接，失败时已写入错误应答
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "需要 WebSocket 握手", http.StatusBadRequest)
+		return nil, errors.New("不是 WebSocket 握手请求")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "不支持的 WebSocket 版本", http.StatusUpgradeRequired)
+		return nil, errors.New("不支持的 WebSocket 版本")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "不支持 WebSocket", http.StatusInternalServerError)
+		return nil, errors.New("ResponseWriter 不支持 Hijack")
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err = conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newConn(conn, buffer.Reader, false), nil
+}
+
+//Dial 以客户端方式链接 ws:// 地址
+func Dial(rawURL string) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, errors.New("只支持 ws:// 地址")
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request := "GET " + u.RequestURI() + " HTTP/1.1\r\nHost: " + u.Host + "\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err = conn.Write([]byte(request)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket 握手失败: %s", response.Status)
+	}
+	return newConn(conn, reader, true), nil
+}
+
+//ReadMessage 读取一条完整消息，自动应答 ping 与关闭帧
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	message := make([]byte, 0)
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case pingMessage:
+			if err = c.writeFrame(pongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case pongMessage:
+			continue
+		case closeMessage:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.WriteClose(code, "")
+			c.conn.Close()
+			return 0, nil, ErrClosed
+		case 0:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "没有起始帧的分片")
+			}
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "分片未结束")
+			}
+			messageType = opcode
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "未知的操作码")
+		}
+		if len(message)+len(payload) > c.MaxMessageSize {
+			return 0, nil, c.fail(CloseTooLarge, "消息过长")
+		}
+		message = append(message, payload...)
+		if fin {
+			return messageType, message, nil
+		}
+	}
+}
+
+//readFrame 读取单个帧并去除掩码
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(buf))
+	case 127:
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(buf)
+	}
+	if masked == c.client {
+		return false, 0, nil, c.fail(CloseProtocolError, "掩码标志不正确")
+	}
+	if length > uint64(c.MaxMessageSize) {
+		return false, 0, nil, c.fail(CloseTooLarge, "消息过长")
+	}
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+//fail 发送关闭帧并返回错误
+func (c *Conn) fail(code int, reason string) error {
+	c.WriteClose(code, reason)
+	c.conn.Close()
+	return errors.New(reason)
+}
+
+//writeFrame 写入单个完整帧，客户端数据加掩码
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|byte(opcode))
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(payload)))
+		frame = append(append(frame, maskBit|127), size...)
+	}
+	if c.client {
+		mask := make([]byte, 4)
+		rand.Read(mask)
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+//WriteMessage 写入一条消息
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errors.New("消息类型不正确")
+	}
+	return c.writeFrame(messageType, data)
+}
+
+//Ping 发送 ping
+func (c *Conn) Ping() error {
+	return c.writeFrame(pingMessage, nil)
+}
+
+//WriteClose 发送关闭帧，只发送一次
+func (c *Conn) WriteClose(code int, reason string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		err = c.writeFrame(closeMessage, payload)
+	})
+	return err
+}
+
+//SetWriteDeadline 设置写入超时，慢速客户端写入超时后应关闭链接
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+//SetReadDeadline 设置读取超时
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+//Close 直接关闭底层链接
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
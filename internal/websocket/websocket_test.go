@@ -0,0 +1,195 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//pipe 以内存链接创建一对客户端与服务端
+func pipe(t *testing.T) (*Conn, *Conn) {
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return newConn(a, bufio.NewReader(a), true), newConn(b, bufio.NewReader(b), false)
+}
+
+//frame 构造单个帧，masked 时使用固定掩码
+func frame(fin bool, opcode int, masked bool, payload []byte) []byte {
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	out := []byte{first}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		out = append(out, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		out = append(out, maskBit|126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		out = append(out, maskBit|127, 0, 0, 0, 0, byte(len(payload)>>24), byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload)))
+	}
+	if !masked {
+		return append(out, payload...)
+	}
+	mask := []byte{1, 2, 3, 4}
+	out = append(out, mask...)
+	for i, b := range payload {
+		out = append(out, b^mask[i%4])
+	}
+	return out
+}
+
+//rawServer 服务端 Conn，对端写入原始数据并丢弃服务端的应答
+func rawServer(t *testing.T, data ...[]byte) *Conn {
+	local, remote := net.Pipe()
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+	go io.Copy(io.Discard, remote)
+	go func() {
+		for _, item := range data {
+			if _, err := remote.Write(item); err != nil {
+				return
+			}
+		}
+	}()
+	return newConn(local, bufio.NewReader(local), false)
+}
+
+func TestRoundTrip(t *testing.T) {
+	client, server := pipe(t)
+	server.MaxMessageSize = 1 << 20
+	messages := [][]byte{[]byte("hello"), bytes.Repeat([]byte{0xab}, 300), bytes.Repeat([]byte("x"), 70000), {}}
+	go func() {
+		for i, message := range messages {
+			messageType := TextMessage
+			if i%2 == 1 {
+				messageType = BinaryMessage
+			}
+			if err := client.WriteMessage(messageType, message); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i, want := range messages {
+		messageType, data, err := server.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantType := TextMessage + i%2; messageType != wantType || !bytes.Equal(data, want) {
+			t.Fatalf("消息 %d 错误 类型 %d 长度 %d", i, messageType, len(data))
+		}
+	}
+	//服务端发送给客户端的数据不加掩码
+	go server.WriteMessage(TextMessage, []byte("reply"))
+	if _, data, err := client.ReadMessage(); err != nil || string(data) != "reply" {
+		t.Fatalf("客户端读取错误 %q %v", data, err)
+	}
+}
+
+func TestFragmentsAndPing(t *testing.T) {
+	server := rawServer(t,
+		frame(false, TextMessage, true, []byte("he")),
+		frame(true, pingMessage, true, []byte("p")),
+		frame(false, 0, true, []byte("ll")),
+		frame(true, 0, true, []byte("o")),
+	)
+	messageType, data, err := server.ReadMessage()
+	if err != nil || messageType != TextMessage || string(data) != "hello" {
+		t.Fatalf("分片消息错误 %d %q %v", messageType, data, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	server := rawServer(t, frame(true, closeMessage, true, []byte{0x03, 0xe8}))
+	if _, _, err := server.ReadMessage(); err != ErrClosed {
+		t.Fatalf("关闭帧应返回 ErrClosed %v", err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	cases := map[string][][]byte{
+		"掩码标志不正确":  {frame(true, TextMessage, false, []byte("a"))},
+		"没有起始帧的分片": {frame(true, 0, true, []byte("a"))},
+		"分片未结束":    {frame(false, TextMessage, true, []byte("a")), frame(true, TextMessage, true, []byte("b"))},
+		"未知的操作码":   {frame(true, 3, true, []byte("a"))},
+		"消息过长":     {frame(true, BinaryMessage, true, make([]byte, DefaultMaxMessageSize+1))[:14]},
+	}
+	for want, data := range cases {
+		server := rawServer(t, data...)
+		if _, _, err := server.ReadMessage(); err == nil || err.Error() != want {
+			t.Errorf("应返回 %q 实际 %v", want, err)
+		}
+	}
+	//分片合计超过最大长度
+	server := rawServer(t, frame(false, TextMessage, true, []byte("abc")), frame(true, 0, true, []byte("def")))
+	server.MaxMessageSize = 4
+	if _, _, err := server.ReadMessage(); err == nil || err.Error() != "消息过长" {
+		t.Errorf("分片合计过长应返回错误 %v", err)
+	}
+	//帧数据不完整
+	local, remote := net.Pipe()
+	defer local.Close()
+	go func() {
+		remote.Write(frame(true, TextMessage, true, []byte("hello"))[:8])
+		remote.Close()
+	}()
+	server = newConn(local, bufio.NewReader(local), false)
+	if _, _, err := server.ReadMessage(); err != io.ErrUnexpectedEOF {
+		t.Errorf("不完整的帧应返回 io.ErrUnexpectedEOF %v", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	//RFC 6455 1.3 示例
+	if key := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept 错误 %s", key)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		messageType, data, err := conn.ReadMessage()
+		if err == nil {
+			conn.WriteMessage(messageType, append([]byte("echo "), data...))
+		}
+	}))
+	defer server.Close()
+	conn, err := Dial("ws" + strings.TrimPrefix(server.URL, "http") + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteMessage(TextMessage, []byte("hi"))
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "echo hi" {
+		t.Fatalf("回显错误 %q %v", data, err)
+	}
+	//普通 HTTP 请求不能升级
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("非握手请求状态 %d", response.StatusCode)
+	}
+	if _, err := Dial("http://" + strings.TrimPrefix(server.URL, "http://")); err == nil {
+		t.Fatal("非 ws:// 地址应返回错误")
+	}
+}
@@ -0,0 +1,162 @@
+package modbus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/types"
+	"math"
+	"strings"
+)
+
+//数据表
+const (
+	TableCoil     = "coil"     //线圈 可读写，功能码 01/05/15
+	TableDiscrete = "discrete" //离散输入 只读，功能码 02
+	TableHolding  = "holding"  //保持寄存器 可读写，功能码 03/06/16
+	TableInput    = "input"    //输入寄存器 只读，功能码 04
+)
+
+//多寄存器数值的字序，寄存器内始终为高字节在前
+const (
+	WordOrderHigh = "high" //高位字在前(ABCD)
+	WordOrderLow  = "low"  //低位字在前(CDAB)
+)
+
+//Mapping 一个 Modbus 地址到 Logix 标签的映射
+type Mapping struct {
+	Table     string `json:"table"`      //coil、discrete、holding 或 input
+	Address   uint16 `json:"address"`    //起始地址，从 0 开始
+	PLC       string `json:"plc"`        //PLC 名称
+	Tag       string `json:"tag"`        //标签名称
+	Type      string `json:"type"`       //寄存器布局类型，线圈与离散输入只能为 BOOL，寄存器默认 INT
+	WordOrder string `json:"word_order"` //high 或 low，默认 high
+	ReadOnly  bool   `json:"read_only"`  //禁止写入线圈或保持寄存器
+}
+
+//registerTypes 寄存器支持的数据类型与占用的寄存器数量
+var registerTypes = map[string]struct {
+	dtype types.DataType
+	words uint16
+}{
+	"SINT":  {types.SINT, 1},
+	"USINT": {types.USINT, 1},
+	"INT":   {types.INT, 1},
+	"UINT":  {types.UINT, 1},
+	"DINT":  {types.DINT, 2},
+	"UDINT": {types.UDINT, 2},
+	"REAL":  {types.REAL, 2},
+	"LINT":  {types.LINT, 4},
+	"ULINT": {types.ULINT, 4},
+	"LREAL": {types.LREAL, 4},
+}
+
+//layout 数值在寄存器中的布局
+type layout struct {
+	dtype     types.DataType
+	words     uint16 //占用的寄存器数量，线圈与离散输入为 1
+	lowFirst  bool
+	bitsTable bool
+}
+
+//newLayout 校验映射并得到寄存器布局
+func newLayout(m *Mapping) (*layout, error) {
+	if m.Tag == "" || m.PLC == "" {
+		return nil, errors.New("映射缺少 PLC 或标签")
+	}
+	name := strings.ToUpper(m.Type)
+	switch m.Table {
+	case TableCoil, TableDiscrete:
+		if name != "" && name != "BOOL" {
+			return nil, fmt.Errorf("%s %d: 线圈与离散输入只能映射 BOOL", m.Table, m.Address)
+		}
+		return &layout{dtype: types.BOOL, words: 1, bitsTable: true}, nil
+	case TableHolding, TableInput:
+	default:
+		return nil, errors.New("不支持的数据表 " + m.Table + "，可选 coil/discrete/holding/input")
+	}
+	if name == "" {
+		name = "INT"
+	}
+	registerType, ok := registerTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("%s %d: 寄存器不支持类型 %s", m.Table, m.Address, m.Type)
+	}
+	if int(m.Address)+int(registerType.words) > 0x10000 {
+		return nil, fmt.Errorf("%s %d: 地址超出范围", m.Table, m.Address)
+	}
+	l := &layout{dtype: registerType.dtype, words: registerType.words}
+	switch m.WordOrder {
+	case "", WordOrderHigh:
+	case WordOrderLow:
+		l.lowFirst = true
+	default:
+		return nil, errors.New("不支持的字序 " + m.WordOrder + "，可选 high/low")
+	}
+	return l, nil
+}
+
+//encode 按布局把数值编码为寄存器，超出类型范围时返回错误
+func (l *layout) encode(value interface{}) ([]uint16, error) {
+	buffer := new(bytes.Buffer)
+	if err := types.Encode(buffer, l.dtype, value); err != nil {
+		return nil, err
+	}
+	data := buffer.Bytes()
+	var bits uint64
+	switch len(data) {
+	case 1:
+		//单字节类型占一个寄存器，SINT 按符号扩展
+		if l.dtype == types.SINT {
+			bits = uint64(uint16(int16(int8(data[0]))))
+		} else {
+			bits = uint64(data[0])
+		}
+	case 2:
+		bits = uint64(binary.LittleEndian.Uint16(data))
+	case 4:
+		bits = uint64(binary.LittleEndian.Uint32(data))
+	default:
+		bits = binary.LittleEndian.Uint64(data)
+	}
+	words := make([]uint16, l.words)
+	for i := range words {
+		shift := 16 * (int(l.words) - 1 - i)
+		if l.lowFirst {
+			shift = 16 * i
+		}
+		words[i] = uint16(bits >> shift)
+	}
+	return words, nil
+}
+
+//decode 把寄存器解码为布局类型的数值，单字节类型保留 16 位数值由写入时检查范围
+func (l *layout) decode(words []uint16) interface{} {
+	var bits uint64
+	for i, word := range words {
+		shift := 16 * (int(l.words) - 1 - i)
+		if l.lowFirst {
+			shift = 16 * i
+		}
+		bits |= uint64(word) << shift
+	}
+	switch l.dtype {
+	case types.SINT, types.INT:
+		return int16(bits)
+	case types.USINT, types.UINT:
+		return uint16(bits)
+	case types.DINT:
+		return int32(bits)
+	case types.UDINT:
+		return uint32(bits)
+	case types.REAL:
+		return math.Float32frombits(uint32(bits))
+	case types.LINT:
+		return int64(bits)
+	case types.LREAL:
+		return math.Float64frombits(bits)
+	default:
+		return bits
+	}
+}
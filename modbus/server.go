@@ -0,0 +1,498 @@
+//Package modbus 提供 Modbus TCP 服务端，把线圈、离散输入、保持寄存器与输入寄存器映射到 Logix 标签
+//
+//读取时同一 PLC 的过期映射合并为一次批量读取，结果缓存 CacheTime；写入后清除对应缓存。
+//服务端不区分单元标识，所有单元共用同一组映射。
+package modbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/types"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+//功能码
+const (
+	FuncReadCoils          = 0x01
+	FuncReadDiscreteInputs = 0x02
+	FuncReadHolding        = 0x03
+	FuncReadInput          = 0x04
+	FuncWriteCoil          = 0x05
+	FuncWriteRegister      = 0x06
+	FuncWriteCoils         = 0x0f
+	FuncWriteRegisters     = 0x10
+)
+
+//异常码
+const (
+	ExceptionIllegalFunction    = 0x01
+	ExceptionIllegalAddress     = 0x02
+	ExceptionIllegalValue       = 0x03
+	ExceptionDeviceFailure      = 0x04
+	ExceptionGatewayUnavailable = 0x0a //没有配置该 PLC
+	ExceptionGatewayNoResponse  = 0x0b //PLC 不可用
+)
+
+//Config Modbus 服务配置文件
+type Config struct {
+	Listen   string           `json:"listen"`   //监听地址 默认 :502
+	CacheMs  int              `json:"cache_ms"` //读取缓存时间 默认 500
+	PLCs     []*pool.Endpoint `json:"plcs"`
+	Mappings []*Mapping       `json:"mappings"`
+}
+
+//mapping 映射运行状态与读取缓存
+type mapping struct {
+	*Mapping
+	*layout
+	cache   []uint16 //寄存器缓存，线圈为 0 或 1
+	err     error
+	updated time.Time
+}
+
+//exception 异常应答
+type exception byte
+
+func (e exception) Error() string {
+	return fmt.Sprintf("Modbus 异常 0x%02x", byte(e))
+}
+
+//Server Modbus TCP 服务端
+type Server struct {
+	manager  *pool.Manager
+	tables   map[string]map[uint16]*mapping //数据表地址对应的映射，多寄存器映射占用多个地址
+	mutex    sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+	wait     sync.WaitGroup
+	//CacheTime 读取结果的缓存时间，小于等于 0 时每次读取都访问 PLC 默认 500ms
+	CacheTime time.Duration
+	//IdleTimeout 链接空闲超时 默认 5 分钟
+	IdleTimeout time.Duration
+	//Logger 记录链接错误，默认 log.Default()
+	Logger *log.Logger
+}
+
+//New 创建服务端，映射的 PLC 必须在 manager 中配置，同一数据表中的地址不能重叠
+func New(manager *pool.Manager, mappings []*Mapping) (*Server, error) {
+	s := &Server{
+		manager:     manager,
+		tables:      make(map[string]map[uint16]*mapping),
+		conns:       make(map[net.Conn]bool),
+		CacheTime:   500 * time.Millisecond,
+		IdleTimeout: 5 * time.Minute,
+		Logger:      log.Default(),
+	}
+	for _, m := range mappings {
+		l, err := newLayout(m)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = manager.Client(m.PLC); err != nil {
+			return nil, err
+		}
+		table, ok := s.tables[m.Table]
+		if !ok {
+			table = make(map[uint16]*mapping)
+			s.tables[m.Table] = table
+		}
+		state := &mapping{Mapping: m, layout: l}
+		for i := uint16(0); i < l.words; i++ {
+			if other, ok := table[m.Address+i]; ok {
+				return nil, fmt.Errorf("%s %d: %s 与 %s 地址重叠", m.Table, m.Address+i, m.Tag, other.Tag)
+			}
+			table[m.Address+i] = state
+		}
+	}
+	return s, nil
+}
+
+//ListenAndServe 在 addr 上监听并处理请求，直到 Close
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+//Serve 接受链接并处理请求，直到 Close
+func (s *Server) Serve(listener net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		listener.Close()
+		return net.ErrClosed
+	}
+	s.listener = listener
+	s.mutex.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closed := s.closed
+			s.mutex.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mutex.Lock()
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		s.wait.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+//Close 停止监听并关闭所有链接
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wait.Wait()
+	return err
+}
+
+//serveConn 按顺序处理一个链接上的请求
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wait.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	header := make([]byte, 7)
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return
+		}
+		//MBAP 头: 事务标识、协议标识、长度、单元标识
+		length := binary.BigEndian.Uint16(header[4:6])
+		if binary.BigEndian.Uint16(header[2:4]) != 0 || length < 2 || length > 254 {
+			s.Logger.Println("Modbus 请求头错误", conn.RemoteAddr())
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(reader, pdu); err != nil {
+			return
+		}
+		reply := s.handle(pdu)
+		response := make([]byte, 7, 7+len(reply))
+		copy(response, header[:4])
+		binary.BigEndian.PutUint16(response[4:6], uint16(len(reply)+1))
+		response[6] = header[6]
+		response = append(response, reply...)
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+//handle 处理一个请求 PDU，返回应答 PDU
+func (s *Server) handle(pdu []byte) []byte {
+	function := pdu[0]
+	reply, err := s.dispatch(function, pdu[1:])
+	if err != nil {
+		code := exception(ExceptionDeviceFailure)
+		errors.As(err, &code)
+		return []byte{function | 0x80, byte(code)}
+	}
+	return append([]byte{function}, reply...)
+}
+
+func (s *Server) dispatch(function byte, data []byte) ([]byte, error) {
+	switch function {
+	case FuncReadCoils, FuncReadDiscreteInputs, FuncReadHolding, FuncReadInput:
+		if len(data) != 4 {
+			return nil, exception(ExceptionIllegalValue)
+		}
+		start, count := binary.BigEndian.Uint16(data[0:2]), binary.BigEndian.Uint16(data[2:4])
+		table := map[byte]string{FuncReadCoils: TableCoil, FuncReadDiscreteInputs: TableDiscrete,
+			FuncReadHolding: TableHolding, FuncReadInput: TableInput}[function]
+		limit := uint16(125)
+		if function == FuncReadCoils || function == FuncReadDiscreteInputs {
+			limit = 2000
+		}
+		if count == 0 || count > limit {
+			return nil, exception(ExceptionIllegalValue)
+		}
+		words, err := s.read(table, start, count)
+		if err != nil {
+			return nil, err
+		}
+		if limit == 2000 {
+			return packBits(words), nil
+		}
+		reply := make([]byte, 1+2*len(words))
+		reply[0] = byte(2 * len(words))
+		for i, word := range words {
+			binary.BigEndian.PutUint16(reply[1+2*i:], word)
+		}
+		return reply, nil
+	case FuncWriteCoil:
+		if len(data) != 4 {
+			return nil, exception(ExceptionIllegalValue)
+		}
+		value := binary.BigEndian.Uint16(data[2:4])
+		if value != 0xff00 && value != 0 {
+			return nil, exception(ExceptionIllegalValue)
+		}
+		bit := uint16(0)
+		if value == 0xff00 {
+			bit = 1
+		}
+		return data, s.write(TableCoil, binary.BigEndian.Uint16(data[0:2]), []uint16{bit})
+	case FuncWriteRegister:
+		if len(data) != 4 {
+			return nil, exception(ExceptionIllegalValue)
+		}
+		return data, s.write(TableHolding, binary.BigEndian.Uint16(data[0:2]), []uint16{binary.BigEndian.Uint16(data[2:4])})
+	case FuncWriteCoils, FuncWriteRegisters:
+		if len(data) < 5 {
+			return nil, exception(ExceptionIllegalValue)
+		}
+		start, count := binary.BigEndian.Uint16(data[0:2]), int(binary.BigEndian.Uint16(data[2:4]))
+		values := data[5:]
+		var words []uint16
+		if function == FuncWriteCoils {
+			if count == 0 || count > 1968 || int(data[4]) != (count+7)/8 || len(values) != int(data[4]) {
+				return nil, exception(ExceptionIllegalValue)
+			}
+			words = make([]uint16, count)
+			for i := range words {
+				words[i] = uint16(values[i/8]>>(i%8)) & 1
+			}
+			return data[:4], s.write(TableCoil, start, words)
+		}
+		if count == 0 || count > 123 || int(data[4]) != 2*count || len(values) != 2*count {
+			return nil, exception(ExceptionIllegalValue)
+		}
+		words = make([]uint16, count)
+		for i := range words {
+			words[i] = binary.BigEndian.Uint16(values[2*i:])
+		}
+		return data[:4], s.write(TableHolding, start, words)
+	default:
+		return nil, exception(ExceptionIllegalFunction)
+	}
+}
+
+//packBits 线圈状态按位打包，第一个线圈在第一个字节的最低位
+func packBits(bits []uint16) []byte {
+	reply := make([]byte, 1+(len(bits)+7)/8)
+	reply[0] = byte(len(reply) - 1)
+	for i, bit := range bits {
+		if bit != 0 {
+			reply[1+i/8] |= 1 << (i % 8)
+		}
+	}
+	return reply
+}
+
+//lookup 查找地址范围内的映射，有地址没有映射时返回地址异常
+func (s *Server) lookup(table string, start uint16, count int) ([]*mapping, error) {
+	if int(start)+count > 0x10000 {
+		return nil, exception(ExceptionIllegalAddress)
+	}
+	var mappings []*mapping
+	for i := 0; i < count; i++ {
+		m, ok := s.tables[table][start+uint16(i)]
+		if !ok {
+			return nil, exception(ExceptionIllegalAddress)
+		}
+		if len(mappings) == 0 || mappings[len(mappings)-1] != m {
+			mappings = append(mappings, m)
+		}
+	}
+	return mappings, nil
+}
+
+//read 读取地址范围内的寄存器或线圈，过期的映射按 PLC 批量刷新
+func (s *Server) read(table string, start uint16, count uint16) ([]uint16, error) {
+	mappings, err := s.lookup(table, start, int(count))
+	if err != nil {
+		return nil, err
+	}
+	s.refresh(mappings)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	words := make([]uint16, 0, count)
+	for i := uint16(0); i < count; i++ {
+		m := s.tables[table][start+i]
+		if m.err != nil {
+			return nil, m.err
+		}
+		words = append(words, m.cache[start+i-m.Address])
+	}
+	return words, nil
+}
+
+//refresh 按 PLC 分组批量读取过期的映射
+func (s *Server) refresh(mappings []*mapping) {
+	now := time.Now()
+	groups := make(map[string][]*mapping)
+	s.mutex.Lock()
+	for _, m := range mappings {
+		if m.updated.IsZero() || now.Sub(m.updated) >= s.CacheTime {
+			groups[m.PLC] = append(groups[m.PLC], m)
+		}
+	}
+	s.mutex.Unlock()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.readPLC(name, groups[name])
+	}
+}
+
+//readPLC 批量读取一个 PLC 的映射并更新缓存
+func (s *Server) readPLC(name string, mappings []*mapping) {
+	var requests []gologix.ReadRequest
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		if !seen[m.Tag] {
+			seen[m.Tag] = true
+			requests = append(requests, gologix.ReadRequest{Tag: m.Tag, Elements: 1})
+		}
+	}
+	values := make(map[string]gologix.Value)
+	tagErrs := make(map[string]error)
+	client, err := s.manager.Client(name)
+	if err == nil {
+		var results map[string]*gologix.TagResult
+		if results, err = client.MultiReadTags(requests); err == nil {
+			for _, request := range requests {
+				if typed, tagErr := results[request.Tag].Elements(1); tagErr != nil {
+					tagErrs[request.Tag] = tagErr
+				} else {
+					values[request.Tag] = typed[0]
+				}
+			}
+		}
+	}
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, m := range mappings {
+		m.updated, m.cache, m.err = now, nil, nil
+		if err != nil {
+			m.err = readException(err)
+			continue
+		}
+		var tagErr error
+		if tagErr = tagErrs[m.Tag]; tagErr == nil && m.bitsTable {
+			var bit bool
+			if bit, tagErr = values[m.Tag].Bool(); tagErr == nil {
+				m.cache = []uint16{0}
+				if bit {
+					m.cache[0] = 1
+				}
+			}
+		} else if tagErr == nil {
+			m.cache, tagErr = m.encode(values[m.Tag].Data)
+		}
+		if tagErr != nil {
+			s.Logger.Printf("读取 %s %s 失败: %v", name, m.Tag, tagErr)
+			m.err = readException(tagErr)
+		}
+	}
+}
+
+//write 写入地址范围内的寄存器或线圈，每个映射必须完整写入
+func (s *Server) write(table string, start uint16, words []uint16) error {
+	mappings, err := s.lookup(table, start, len(words))
+	if err != nil {
+		return err
+	}
+	first, last := mappings[0], mappings[len(mappings)-1]
+	if first.Address != start || int(last.Address)+int(last.words) != int(start)+len(words) {
+		return exception(ExceptionIllegalAddress)
+	}
+	groups := make(map[string][]*mapping)
+	var names []string
+	for _, m := range mappings {
+		if m.ReadOnly {
+			return exception(ExceptionIllegalAddress)
+		}
+		if _, ok := groups[m.PLC]; !ok {
+			names = append(names, m.PLC)
+		}
+		groups[m.PLC] = append(groups[m.PLC], m)
+	}
+	for _, name := range names {
+		err = s.manager.Do(name, func(plc *gologix.PLC) error {
+			for _, m := range groups[name] {
+				offset := m.Address - start
+				var value interface{}
+				if m.bitsTable {
+					value = words[offset] != 0
+				} else {
+					value = m.decode(words[offset : offset+m.words])
+				}
+				if err := plc.WriteTag(m.Tag, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		s.mutex.Lock()
+		for _, m := range groups[name] {
+			m.updated = time.Time{}
+		}
+		s.mutex.Unlock()
+		if err != nil {
+			s.Logger.Printf("写入 %s 失败: %v", name, err)
+			return writeException(err)
+		}
+	}
+	return nil
+}
+
+//readException 读取错误对应的异常码
+func readException(err error) error {
+	var code exception
+	switch {
+	case errors.As(err, &code):
+		return code
+	case errors.Is(err, pool.ErrUnknownPLC):
+		return exception(ExceptionGatewayUnavailable)
+	case errors.Is(err, pool.ErrUnavailable):
+		return exception(ExceptionGatewayNoResponse)
+	default:
+		return exception(ExceptionDeviceFailure)
+	}
+}
+
+//writeException 写入错误对应的异常码，数值超出标签类型范围时为非法数值
+func writeException(err error) error {
+	var encodeErr *types.EncodeError
+	if errors.As(err, &encodeErr) {
+		return exception(ExceptionIllegalValue)
+	}
+	return readException(err)
+}
@@ -0,0 +1,216 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/types"
+	"io"
+	"log"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLayout(t *testing.T) {
+	high, _ := newLayout(&Mapping{Table: TableHolding, PLC: "p", Tag: "t", Type: "DINT"})
+	low, _ := newLayout(&Mapping{Table: TableHolding, PLC: "p", Tag: "t", Type: "dint", WordOrder: WordOrderLow})
+	if words, _ := high.encode(int32(0x01020304)); !reflect.DeepEqual(words, []uint16{0x0102, 0x0304}) {
+		t.Fatalf("高位字在前编码错误 %04x", words)
+	}
+	if words, _ := low.encode(int32(0x01020304)); !reflect.DeepEqual(words, []uint16{0x0304, 0x0102}) {
+		t.Fatalf("低位字在前编码错误 %04x", words)
+	}
+	if value := low.decode([]uint16{0x0304, 0x0102}); value != int32(0x01020304) {
+		t.Fatalf("低位字在前解码错误 %v", value)
+	}
+	lreal, _ := newLayout(&Mapping{Table: TableInput, PLC: "p", Tag: "t", Type: "LREAL", WordOrder: WordOrderLow})
+	words, _ := lreal.encode(1.5)
+	bits := math.Float64bits(1.5)
+	if words[0] != uint16(bits) || words[3] != uint16(bits>>48) || lreal.decode(words) != 1.5 {
+		t.Fatalf("LREAL 编码错误 %04x", words)
+	}
+	sint, _ := newLayout(&Mapping{Table: TableHolding, PLC: "p", Tag: "t", Type: "SINT"})
+	if words, _ = sint.encode(int8(-2)); words[0] != 0xfffe {
+		t.Fatalf("SINT 应按符号扩展 %04x", words)
+	}
+	if _, err := high.encode(1.5); err == nil {
+		t.Fatal("小数编码为 DINT 应返回错误")
+	}
+	if _, err := newLayout(&Mapping{Table: TableCoil, PLC: "p", Tag: "t", Type: "REAL"}); err == nil {
+		t.Fatal("线圈只能映射 BOOL")
+	}
+}
+
+//client 测试用 Modbus TCP 客户端
+type client struct {
+	conn net.Conn
+	id   uint16
+}
+
+//call 发送请求，返回应答 PDU(含功能码)
+func (c *client) call(t *testing.T, pdu ...byte) []byte {
+	t.Helper()
+	c.id++
+	frame := make([]byte, 7, 7+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:2], c.id)
+	binary.BigEndian.PutUint16(frame[4:6], uint16(len(pdu)+1))
+	frame[6] = 1
+	frame = append(frame, pdu...)
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint16(header[0:2]) != c.id || header[6] != 1 {
+		t.Fatalf("应答头错误 %x", header)
+	}
+	reply := make([]byte, binary.BigEndian.Uint16(header[4:6])-1)
+	if _, err := io.ReadFull(c.conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+//registers 读取寄存器，异常时返回异常码
+func (c *client) registers(t *testing.T, function byte, start uint16, count uint16) ([]uint16, byte) {
+	t.Helper()
+	reply := c.call(t, function, byte(start>>8), byte(start), byte(count>>8), byte(count))
+	if reply[0]&0x80 != 0 {
+		return nil, reply[1]
+	}
+	words := make([]uint16, count)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(reply[2+2*i:])
+	}
+	return words, 0
+}
+
+func TestServer(t *testing.T) {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.AddTag("Speed", types.REAL, []float32{12.5})
+	sim.AddTag("Count", types.DINT, []int32{100000})
+	sim.AddTag("Level", types.INT, []int16{-5})
+	sim.AddTag("Small", types.SINT, []int8{1})
+	sim.AddTag("Running", types.BOOL, []bool{true})
+	sim.AddTag("Setpoint", types.REAL, []float32{0})
+	manager, err := pool.NewManager([]*pool.Endpoint{
+		{Name: "line1", Address: sim.Addr()},
+		{Name: "offline", Address: "127.0.0.1:1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	server, err := New(manager, []*Mapping{
+		{Table: TableHolding, Address: 0, PLC: "line1", Tag: "Speed", Type: "REAL"},
+		{Table: TableHolding, Address: 2, PLC: "line1", Tag: "Count", Type: "DINT", WordOrder: WordOrderLow},
+		{Table: TableHolding, Address: 4, PLC: "line1", Tag: "Level"},
+		{Table: TableHolding, Address: 5, PLC: "line1", Tag: "Small", Type: "SINT"},
+		{Table: TableHolding, Address: 10, PLC: "line1", Tag: "Setpoint", Type: "REAL"},
+		{Table: TableInput, Address: 0, PLC: "line1", Tag: "Speed", Type: "REAL"},
+		{Table: TableInput, Address: 2, PLC: "offline", Tag: "Level"},
+		{Table: TableCoil, Address: 0, PLC: "line1", Tag: "Running"},
+		{Table: TableDiscrete, Address: 0, PLC: "line1", Tag: "Running"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.CacheTime = time.Hour
+	server.Logger = log.New(io.Discard, "", 0)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer server.Close()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &client{conn: conn}
+
+	bits := math.Float32bits(12.5)
+	words, code := c.registers(t, FuncReadHolding, 0, 5)
+	if code != 0 || !reflect.DeepEqual(words, []uint16{uint16(bits >> 16), uint16(bits), 100000 & 0xffff, 100000 >> 16, 0xfffb}) {
+		t.Fatalf("读取保持寄存器错误 %04x %d", words, code)
+	}
+	if words, _ = c.registers(t, FuncReadInput, 1, 1); words[0] != uint16(bits) {
+		t.Fatalf("应可以读取多寄存器数值的一部分 %04x", words)
+	}
+	if _, code = c.registers(t, FuncReadHolding, 4, 4); code != ExceptionIllegalAddress {
+		t.Fatalf("未映射的地址应返回 0x02 %d", code)
+	}
+	if _, code = c.registers(t, FuncReadInput, 2, 1); code != ExceptionGatewayNoResponse {
+		t.Fatalf("PLC 不可用应返回 0x0b %d", code)
+	}
+	if reply := c.call(t, FuncReadCoils, 0, 0, 0, 1); !reflect.DeepEqual(reply, []byte{FuncReadCoils, 1, 1}) {
+		t.Fatalf("读取线圈错误 %x", reply)
+	}
+	if reply := c.call(t, 0x2b, 0x0e); !reflect.DeepEqual(reply, []byte{0xab, ExceptionIllegalFunction}) {
+		t.Fatalf("不支持的功能码应返回 0x01 %x", reply)
+	}
+
+	//缓存时间内的读取不访问 PLC，写入后清除缓存
+	err = manager.Do("line1", func(plc *gologix.PLC) error {
+		return plc.WriteTag("Level", -6)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words, _ = c.registers(t, FuncReadHolding, 4, 1); words[0] != 0xfffb {
+		t.Fatalf("缓存时间内应返回缓存 %04x", words)
+	}
+	if reply := c.call(t, FuncWriteRegister, 0, 4, 0, 7); reply[0] != FuncWriteRegister {
+		t.Fatalf("写入单个寄存器失败 %x", reply)
+	}
+	if words, _ = c.registers(t, FuncReadHolding, 4, 1); words[0] != 7 {
+		t.Fatalf("写入后应重新读取 %04x", words)
+	}
+
+	//多寄存器数值需要完整写入
+	bits = math.Float32bits(3.25)
+	reply := c.call(t, FuncWriteRegisters, 0, 10, 0, 2, 4, byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits))
+	if reply[0] != FuncWriteRegisters {
+		t.Fatalf("写入多个寄存器失败 %x", reply)
+	}
+	if reply = c.call(t, FuncWriteRegister, 0, 11, 0, 1); reply[1] != ExceptionIllegalAddress {
+		t.Fatalf("部分写入应返回 0x02 %x", reply)
+	}
+	if reply = c.call(t, FuncWriteRegister, 0, 5, 1, 0x2c); reply[1] != ExceptionIllegalValue {
+		t.Fatalf("超出标签范围应返回 0x03 %x", reply)
+	}
+	if reply = c.call(t, FuncWriteCoil, 0, 0, 0, 0); reply[0] != FuncWriteCoil {
+		t.Fatalf("写入线圈失败 %x", reply)
+	}
+	if reply = c.call(t, FuncWriteRegister, 0, 0, 0, 0); reply[1] != ExceptionIllegalAddress {
+		t.Fatalf("部分写入应返回 0x02 %x", reply)
+	}
+	err = manager.Do("line1", func(plc *gologix.PLC) error {
+		setpoint, err := plc.ReadValue("Setpoint")
+		if err != nil {
+			return err
+		}
+		running, err := plc.ReadValue("Running")
+		if err != nil {
+			return err
+		}
+		if setpoint.Data != float32(3.25) || running.Data != false {
+			t.Errorf("写入的数值错误 %v %v", setpoint.Data, running.Data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,457 @@
+//Package mqttbridge 周期读取 PLC 标签，以 Sparkplug B 消息发布到 MQTT 代理，并把 DCMD 指令写入 PLC
+//
+//每个设备对应一个 PLC，设备可读时发布 DBIRTH，之后只在数值变化时发布 DDATA，PLC 不可用时发布 DDEATH。
+//NCMD 的 "Node Control/Rebirth" 与 DCMD 的 "Device Control/Rebirth" 触发重新发布 BIRTH。
+package mqttbridge
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/mqtt"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/sparkplug"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+//控制指标
+const (
+	nodeRebirth   = "Node Control/Rebirth"
+	deviceRebirth = "Device Control/Rebirth"
+	bdSeqMetric   = "bdSeq"
+)
+
+//Config 网桥配置文件
+type Config struct {
+	Broker   string           `json:"broker"` //MQTT 代理地址 host:port
+	ClientID string           `json:"client_id"`
+	Username string           `json:"username"`
+	Password string           `json:"password"`
+	Group    string           `json:"group"` //Sparkplug 组 ID
+	Node     string           `json:"node"`  //边缘节点 ID
+	PLCs     []*pool.Endpoint `json:"plcs"`
+	Devices  []*Device        `json:"devices"`
+}
+
+//Device Sparkplug 设备，对应一个 PLC 的一组标签
+type Device struct {
+	Name   string   `json:"name"`    //设备 ID
+	PLC    string   `json:"plc"`     //PLC 名称，为空时与设备 ID 相同
+	Tags   []string `json:"tags"`    //标签，只能写入这里列出的标签
+	RateMs int      `json:"rate_ms"` //扫描周期 默认 1000
+}
+
+//device 设备运行状态
+type device struct {
+	*Device
+	subscriber *gologix.Subscriber
+	born       bool
+	down       bool                         //PLC 不可用
+	time       time.Time                    //最近一次读取的时间
+	readings   map[string]*reading          //最近一次读取的结果，首次读取前为 nil
+	last       map[string]*sparkplug.Metric //上次发布的指标
+	allow      map[string]bool
+}
+
+//Bridge Sparkplug B 网桥
+type Bridge struct {
+	config   *Config
+	manager  *pool.Manager
+	devices  map[string]*device
+	subs     map[string]*gologix.Subscriber //每个 PLC 一个订阅引擎，设备共用
+	mutex    sync.Mutex                     //保护 client、seq 与设备状态
+	client   *mqtt.Client
+	seq      uint64
+	bdSeq    uint64
+	commands chan *mqtt.Message
+	stop     chan struct{}
+	wait     sync.WaitGroup
+	//Logger 记录写入失败与重连，默认 log.Default()
+	Logger *log.Logger
+	//KeepAlive MQTT 心跳周期 默认 30s
+	KeepAlive time.Duration
+}
+
+//New 创建网桥，设备的 PLC 必须在 manager 中配置
+func New(config *Config, manager *pool.Manager) (*Bridge, error) {
+	if config.Broker == "" || config.Group == "" || config.Node == "" {
+		return nil, errors.New("缺少 broker、group 或 node 配置")
+	}
+	b := &Bridge{
+		config:   config,
+		manager:  manager,
+		devices:  make(map[string]*device),
+		subs:     make(map[string]*gologix.Subscriber),
+		commands: make(chan *mqtt.Message, 64),
+		Logger:   log.Default(),
+	}
+	for _, d := range config.Devices {
+		if d.Name == "" || len(d.Tags) == 0 {
+			return nil, errors.New("设备缺少名称或标签")
+		}
+		if _, ok := b.devices[d.Name]; ok {
+			return nil, errors.New("设备名称重复 " + d.Name)
+		}
+		if d.PLC == "" {
+			d.PLC = d.Name
+		}
+		client, err := manager.Client(d.PLC)
+		if err != nil {
+			return nil, err
+		}
+		subscriber, ok := b.subs[d.PLC]
+		if !ok {
+			subscriber = gologix.NewSubscriber(client, 0)
+			b.subs[d.PLC] = subscriber
+		}
+		state := &device{Device: d, subscriber: subscriber, allow: make(map[string]bool)}
+		for _, tag := range d.Tags {
+			state.allow[tag] = true
+		}
+		rate := time.Second
+		if d.RateMs > 0 {
+			rate = time.Duration(d.RateMs) * time.Millisecond
+		}
+		if _, err = subscriber.Add(d.Tags, rate, gologix.SubscribeOptions{}, func(events []gologix.ChangeEvent) {
+			b.update(state, events)
+		}); err != nil {
+			return nil, err
+		}
+		b.devices[d.Name] = state
+	}
+	return b, nil
+}
+
+//Start 链接代理并发布 NBIRTH，之后在后台扫描设备，链接断开后自动重连
+func (b *Bridge) Start() error {
+	if err := b.connect(); err != nil {
+		return err
+	}
+	b.stop = make(chan struct{})
+	b.wait.Add(2)
+	go b.run()
+	go b.handleCommands()
+	for _, subscriber := range b.subs {
+		subscriber.Start()
+	}
+	return nil
+}
+
+//Stop 停止扫描，发布 DDEATH 与 NDEATH 后断开
+func (b *Bridge) Stop() {
+	for _, subscriber := range b.subs {
+		subscriber.Stop()
+	}
+	close(b.stop)
+	b.wait.Wait()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.client == nil {
+		return
+	}
+	for _, d := range b.devices {
+		if d.born {
+			b.publish(sparkplug.DDEATH, d.Name, nil)
+			d.born = false
+		}
+	}
+	payload, _ := b.deathPayload().Marshal()
+	b.client.Publish(sparkplug.Topic(b.config.Group, sparkplug.NDEATH, b.config.Node, ""), payload, false)
+	b.client.Disconnect()
+	b.client = nil
+}
+
+//deathPayload NDEATH 载荷，与 NBIRTH 的 bdSeq 相同
+func (b *Bridge) deathPayload() *sparkplug.Payload {
+	return &sparkplug.Payload{
+		Timestamp: time.Now(),
+		Metrics:   []*sparkplug.Metric{{Name: bdSeqMetric, DataType: sparkplug.UInt64, Value: b.bdSeq}},
+	}
+}
+
+//connect 链接代理，遗嘱为 NDEATH，订阅指令后发布 NBIRTH
+func (b *Bridge) connect() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	will, err := b.deathPayload().Marshal()
+	if err != nil {
+		return err
+	}
+	clientID := b.config.ClientID
+	if clientID == "" {
+		clientID = b.config.Group + "-" + b.config.Node
+	}
+	client, err := mqtt.Dial(b.config.Broker, mqtt.Options{
+		ClientID:  clientID,
+		Username:  b.config.Username,
+		Password:  b.config.Password,
+		KeepAlive: b.KeepAlive,
+		Will:      &mqtt.Message{Topic: sparkplug.Topic(b.config.Group, sparkplug.NDEATH, b.config.Node, ""), Payload: will},
+	}, b.receive)
+	if err != nil {
+		return err
+	}
+	err = client.Subscribe(sparkplug.Topic(b.config.Group, sparkplug.NCMD, b.config.Node, ""),
+		sparkplug.Topic(b.config.Group, sparkplug.DCMD, b.config.Node, "+"))
+	if err != nil {
+		client.Disconnect()
+		return err
+	}
+	b.client = client
+	return b.birthLocked()
+}
+
+//birthLocked 发布 NBIRTH(序号从 0 开始)，已读取过的设备按最近的结果重新发布 DBIRTH
+func (b *Bridge) birthLocked() error {
+	b.seq = 0
+	err := b.publish(sparkplug.NBIRTH, "", []*sparkplug.Metric{
+		{Name: bdSeqMetric, DataType: sparkplug.UInt64, Value: b.bdSeq},
+		{Name: nodeRebirth, DataType: sparkplug.Boolean, Value: false},
+	})
+	for _, d := range b.devices {
+		d.born = false
+		b.flushLocked(d)
+	}
+	return err
+}
+
+//publish 发布消息并递增序号，需持有锁
+func (b *Bridge) publish(messageType string, deviceName string, metrics []*sparkplug.Metric) error {
+	if b.client == nil {
+		return pool.ErrUnavailable
+	}
+	payload, err := (&sparkplug.Payload{Timestamp: time.Now(), Metrics: metrics, Seq: b.seq, HasSeq: true}).Marshal()
+	if err != nil {
+		return err
+	}
+	b.seq = (b.seq + 1) % 256
+	return b.client.Publish(sparkplug.Topic(b.config.Group, messageType, b.config.Node, deviceName), payload, false)
+}
+
+//run 链接断开后按间隔重连，每次重连 bdSeq 加 1
+func (b *Bridge) run() {
+	defer b.wait.Done()
+	backoff := time.Second
+	for {
+		b.mutex.Lock()
+		client := b.client
+		b.mutex.Unlock()
+		if client != nil {
+			select {
+			case <-b.stop:
+				return
+			case <-client.Done():
+			}
+			b.Logger.Println("MQTT 链接断开:", client.Err())
+			b.mutex.Lock()
+			b.client = nil
+			b.bdSeq = (b.bdSeq + 1) % 256
+			b.mutex.Unlock()
+			continue
+		}
+		select {
+		case <-b.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if err := b.connect(); err != nil {
+			b.Logger.Println("MQTT 重连失败:", err)
+			if backoff *= 2; backoff > 30*time.Second {
+				backoff = 30 * time.Second
+			}
+			continue
+		}
+		backoff = time.Second
+	}
+}
+
+//reading 单个标签的读取结果
+type reading struct {
+	tag   string
+	value gologix.Value
+	err   error
+}
+
+//metric 读取结果转换为指标，字符串结构体按 String 处理
+func metric(item *reading, now time.Time) (*sparkplug.Metric, error) {
+	if item.err != nil {
+		return nil, item.err
+	}
+	dataType := sparkplug.FromDataType(item.value.DType)
+	if _, ok := item.value.Data.(string); ok {
+		dataType = sparkplug.String
+	}
+	if dataType == sparkplug.Unknown {
+		return nil, fmt.Errorf("不支持的数据类型 %s", item.value.DType)
+	}
+	return &sparkplug.Metric{Name: item.tag, Timestamp: now, DataType: dataType, Value: item.value.Data}, nil
+}
+
+//update 记录订阅的变化并发布
+func (b *Bridge) update(d *device, events []gologix.ChangeEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if d.readings == nil {
+		d.readings = make(map[string]*reading, len(d.Tags))
+	}
+	for _, event := range events {
+		item := &reading{tag: event.Tag, err: event.Err}
+		if event.Err == nil {
+			item.value = event.Values[0]
+		}
+		d.readings[event.Tag] = item
+		d.time = event.Time
+		d.down = errors.Is(event.Err, pool.ErrUnavailable)
+	}
+	b.flushLocked(d)
+}
+
+//flushLocked 发布设备最近的读取结果: 未发布 BIRTH 时发布 DBIRTH，否则发布变化的指标，PLC 不可用时发布 DDEATH，需持有锁
+func (b *Bridge) flushLocked(d *device) {
+	if b.client == nil || d.readings == nil {
+		return
+	}
+	if d.down {
+		if d.born {
+			b.publish(sparkplug.DDEATH, d.Name, nil)
+			d.born = false
+		}
+		return
+	}
+	now := d.time
+	metrics := make(map[string]*sparkplug.Metric, len(d.readings))
+	for _, item := range d.readings {
+		m, err := metric(item, now)
+		if err != nil {
+			//BIRTH 之后读取失败的标签发布为空值
+			if last, ok := d.last[item.tag]; ok && d.born {
+				metrics[item.tag] = &sparkplug.Metric{Name: item.tag, Timestamp: now, DataType: last.DataType, IsNull: true}
+			}
+			continue
+		}
+		metrics[item.tag] = m
+		//BIRTH 时没有的标签需要重新发布 BIRTH
+		if last, ok := d.last[item.tag]; d.born && (!ok || last.DataType != m.DataType) {
+			d.born = false
+		}
+	}
+	if !d.born {
+		birth := make([]*sparkplug.Metric, 0, len(metrics)+1)
+		birth = append(birth, &sparkplug.Metric{Name: deviceRebirth, DataType: sparkplug.Boolean, Value: false})
+		d.last = make(map[string]*sparkplug.Metric, len(metrics))
+		for _, tag := range d.Tags {
+			if m, ok := metrics[tag]; ok && !m.IsNull {
+				birth = append(birth, m)
+				d.last[tag] = m
+			}
+		}
+		if b.publish(sparkplug.DBIRTH, d.Name, birth) == nil {
+			d.born = true
+		}
+		return
+	}
+	var changes []*sparkplug.Metric
+	for _, tag := range d.Tags {
+		m, ok := metrics[tag]
+		if !ok {
+			continue
+		}
+		if last := d.last[tag]; last.IsNull == m.IsNull && reflect.DeepEqual(last.Value, m.Value) {
+			continue
+		}
+		d.last[tag] = m
+		changes = append(changes, m)
+	}
+	if len(changes) > 0 {
+		b.publish(sparkplug.DDATA, d.Name, changes)
+	}
+}
+
+//receive 收到指令，放入队列由 handleCommands 处理，不阻塞 MQTT 读取
+func (b *Bridge) receive(message *mqtt.Message) {
+	select {
+	case b.commands <- message:
+	default:
+		b.Logger.Println("指令队列已满，丢弃", message.Topic)
+	}
+}
+
+func (b *Bridge) handleCommands() {
+	defer b.wait.Done()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case message := <-b.commands:
+			if err := b.command(message); err != nil {
+				b.Logger.Println(message.Topic, err)
+			}
+		}
+	}
+}
+
+//command 处理 NCMD 与 DCMD，DCMD 的指标写入设备 PLC 的同名标签
+func (b *Bridge) command(message *mqtt.Message) error {
+	parts := strings.Split(message.Topic, "/")
+	if len(parts) < 4 || parts[0] != sparkplug.Namespace || parts[1] != b.config.Group || parts[3] != b.config.Node {
+		return errors.New("主题不正确")
+	}
+	payload, err := sparkplug.Unmarshal(message.Payload)
+	if err != nil {
+		return err
+	}
+	switch {
+	case parts[2] == sparkplug.NCMD && len(parts) == 4:
+		for _, m := range payload.Metrics {
+			if m.Name == nodeRebirth && m.Value == true {
+				b.mutex.Lock()
+				err = b.birthLocked()
+				b.mutex.Unlock()
+				return err
+			}
+		}
+		return nil
+	case parts[2] == sparkplug.DCMD && len(parts) == 5:
+		d, ok := b.devices[parts[4]]
+		if !ok {
+			return errors.New("没有配置该设备 " + parts[4])
+		}
+		var failed []string
+		for _, m := range payload.Metrics {
+			if m.Name == deviceRebirth {
+				if m.Value == true {
+					b.mutex.Lock()
+					d.born = false
+					b.flushLocked(d)
+					b.mutex.Unlock()
+				}
+				continue
+			}
+			if !d.allow[m.Name] {
+				failed = append(failed, m.Name+": 不是设备的标签")
+				continue
+			}
+			if m.IsNull || m.Value == nil {
+				failed = append(failed, m.Name+": 空值")
+				continue
+			}
+			err := b.manager.Do(d.PLC, func(plc *gologix.PLC) error {
+				return plc.WriteTag(m.Name, m.Value)
+			})
+			if err != nil {
+				failed = append(failed, m.Name+": "+err.Error())
+			}
+		}
+		d.subscriber.Refresh()
+		if len(failed) > 0 {
+			return errors.New("写入失败 " + strings.Join(failed, "; "))
+		}
+		return nil
+	default:
+		return errors.New("不支持的指令")
+	}
+}
@@ -0,0 +1,138 @@
+package mqttbridge
+
+import (
+	"github.com/wj008/gologix/internal/mqtt"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/sparkplug"
+	"github.com/wj008/gologix/types"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+type received struct {
+	topic   string
+	payload *sparkplug.Payload
+}
+
+//expect 读取消息直到得到指定主题
+func expect(t *testing.T, messages chan *received, topic string) *sparkplug.Payload {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-messages:
+			if message.topic == topic {
+				return message.payload
+			}
+		case <-timeout:
+			t.Fatalf("没有收到 %s", topic)
+		}
+	}
+}
+
+func metricValue(payload *sparkplug.Payload, name string) *sparkplug.Metric {
+	for _, metric := range payload.Metrics {
+		if metric.Name == name {
+			return metric
+		}
+	}
+	return nil
+}
+
+func TestBridge(t *testing.T) {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.AddTag("Speed", types.REAL, []float32{12.5})
+	sim.AddTag("Running", types.BOOL, []bool{true})
+	sim.AddTag("Count", types.DINT, []int32{3})
+	broker, err := mqtt.NewBroker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	messages := make(chan *received, 64)
+	observer, err := mqtt.Dial(broker.Addr(), mqtt.Options{ClientID: "observer"}, func(message *mqtt.Message) {
+		payload, err := sparkplug.Unmarshal(message.Payload)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		messages <- &received{topic: message.Topic, payload: payload}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer observer.Disconnect()
+	if err = observer.Subscribe("spBv1.0/#"); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := pool.NewManager([]*pool.Endpoint{{Name: "line1", Address: sim.Addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	bridge, err := New(&Config{
+		Broker:  broker.Addr(),
+		Group:   "plant",
+		Node:    "edge1",
+		Devices: []*Device{{Name: "line1", Tags: []string{"Speed", "Running", "Count"}, RateMs: 100}},
+	}, manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge.Logger = log.New(io.Discard, "", 0)
+	if err = bridge.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	birth := expect(t, messages, "spBv1.0/plant/NBIRTH/edge1")
+	if birth.Seq != 0 || metricValue(birth, "bdSeq") == nil {
+		t.Fatalf("NBIRTH 错误 %+v", birth)
+	}
+	dbirth := expect(t, messages, "spBv1.0/plant/DBIRTH/edge1/line1")
+	if dbirth.Seq != 1 {
+		t.Fatalf("DBIRTH 序号错误 %d", dbirth.Seq)
+	}
+	for name, expected := range map[string]interface{}{"Speed": float32(12.5), "Running": true, "Count": int32(3)} {
+		metric := metricValue(dbirth, name)
+		if metric == nil || metric.Value != expected {
+			t.Fatalf("DBIRTH 指标 %s 错误 %+v", name, metric)
+		}
+	}
+	if metricValue(dbirth, "Count").DataType != sparkplug.Int32 || metricValue(dbirth, "Speed").DataType != sparkplug.Float {
+		t.Fatal("指标数据类型错误")
+	}
+
+	command, _ := (&sparkplug.Payload{Timestamp: time.Now(), Metrics: []*sparkplug.Metric{
+		{Name: "Count", DataType: sparkplug.Int32, Value: int32(-42)},
+	}}).Marshal()
+	if err = observer.Publish("spBv1.0/plant/DCMD/edge1/line1", command, false); err != nil {
+		t.Fatal(err)
+	}
+	data := expect(t, messages, "spBv1.0/plant/DDATA/edge1/line1")
+	if data.Seq != 2 || len(data.Metrics) != 1 || data.Metrics[0].Value != int32(-42) {
+		t.Fatalf("DDATA 错误 %+v", data.Metrics[0])
+	}
+
+	rebirth, _ := (&sparkplug.Payload{Timestamp: time.Now(), Metrics: []*sparkplug.Metric{
+		{Name: "Node Control/Rebirth", DataType: sparkplug.Boolean, Value: true},
+	}}).Marshal()
+	observer.Publish("spBv1.0/plant/NCMD/edge1", rebirth, false)
+	if birth = expect(t, messages, "spBv1.0/plant/NBIRTH/edge1"); birth.Seq != 0 {
+		t.Fatalf("重新发布 NBIRTH 序号应为 0 %d", birth.Seq)
+	}
+	expect(t, messages, "spBv1.0/plant/DBIRTH/edge1/line1")
+
+	bridge.Stop()
+	expect(t, messages, "spBv1.0/plant/DDEATH/edge1/line1")
+	if death := expect(t, messages, "spBv1.0/plant/NDEATH/edge1"); death.HasSeq || metricValue(death, "bdSeq") == nil {
+		t.Fatalf("NDEATH 错误 %+v", death)
+	}
+}
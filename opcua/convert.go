@@ -0,0 +1,160 @@
+package opcua
+
+import (
+	"errors"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/ua"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/types"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//dataTypeOf Logix 基本类型对应的 OPC UA 数据类型，不支持的类型返回 0
+func dataTypeOf(dtype types.DataType) uint32 {
+	switch dtype {
+	case types.BOOL, types.BIT_STRING:
+		return ua.IDBoolean
+	case types.SINT:
+		return ua.IDSByte
+	case types.USINT:
+		return ua.IDByte
+	case types.INT:
+		return ua.IDInt16
+	case types.UINT:
+		return ua.IDUInt16
+	case types.DINT:
+		return ua.IDInt32
+	case types.UDINT:
+		return ua.IDUInt32
+	case types.LINT:
+		return ua.IDInt64
+	case types.ULINT:
+		return ua.IDUInt64
+	case types.REAL:
+		return ua.IDFloat
+	case types.LREAL:
+		return ua.IDDouble
+	case types.STRING, types.SHORT_STRING, types.STRING2, types.STRINGN, types.STRINGI:
+		return ua.IDString
+	case types.DATE, types.DATE_AND_TIME:
+		return ua.IDDateTime
+	case types.STIME, types.TIME_OF_DAY, types.FTIME, types.LTIME, types.ITIME, types.TIME:
+		return ua.IDDuration
+	default:
+		return 0
+	}
+}
+
+//toVariant 读取的数值转换为 Variant 数值，时长转换为毫秒(Duration)，不支持的数值返回 nil
+func toVariant(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bool, int8, uint8, int16, uint16, int32, uint32, int64, uint64, float32, float64, string:
+		return v
+	case time.Time:
+		return v.UTC()
+	case time.Duration:
+		return float64(v) / float64(time.Millisecond)
+	default:
+		return nil
+	}
+}
+
+//toVariantArray 数组元素转换为同一类型的切片
+func toVariantArray(values []gologix.Value) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	first := toVariant(values[0].Data)
+	if first == nil {
+		return nil
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(first)), len(values), len(values))
+	for i, value := range values {
+		item := toVariant(value.Data)
+		if item == nil || reflect.TypeOf(item) != reflect.TypeOf(first) {
+			return nil
+		}
+		slice.Index(i).Set(reflect.ValueOf(item))
+	}
+	return slice.Interface()
+}
+
+//fromVariant 写入的 Variant 数值转换为 WriteTag 的参数，数组展开为多个元素
+func fromVariant(n *node, value interface{}) ([]interface{}, error) {
+	if value == nil {
+		return nil, ua.StatusBadTypeMismatch
+	}
+	var values []interface{}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		if n.elements == 0 || rv.Len() != int(n.elements) {
+			return nil, ua.StatusBadTypeMismatch
+		}
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, rv.Index(i).Interface())
+		}
+	} else {
+		if n.elements > 0 {
+			return nil, ua.StatusBadTypeMismatch
+		}
+		values = []interface{}{value}
+	}
+	if n.dataType != ua.IDDuration {
+		return values, nil
+	}
+	//Duration 为毫秒
+	for i, item := range values {
+		ms, ok := item.(float64)
+		if !ok {
+			return nil, ua.StatusBadTypeMismatch
+		}
+		if math.IsNaN(ms) || math.Abs(ms) > float64(math.MaxInt64/int64(time.Millisecond)) {
+			return nil, ua.StatusBadOutOfRange
+		}
+		values[i] = time.Duration(ms * float64(time.Millisecond))
+	}
+	return values, nil
+}
+
+//statusOf 读写错误对应的状态码
+func statusOf(err error) ua.StatusCode {
+	var status ua.StatusCode
+	var tagErr *gologix.TagError
+	switch {
+	case errors.As(err, &status):
+		return status
+	case errors.Is(err, pool.ErrUnavailable):
+		return ua.StatusBadNoCommunication
+	case errors.Is(err, pool.ErrUnknownPLC):
+		return ua.StatusBadNodeIDUnknown
+	case errors.Is(err, types.ErrOutOfRange), errors.Is(err, types.ErrPrecisionLoss):
+		return ua.StatusBadOutOfRange
+	case errors.Is(err, types.ErrTypeMismatch):
+		return ua.StatusBadTypeMismatch
+	case errors.Is(err, gologix.ErrNotWritable):
+		return ua.StatusBadNotWritable
+	case errors.As(err, &tagErr) && tagErr.Kind == gologix.TagErrorStatus && (tagErr.Status == 0x04 || tagErr.Status == 0x05):
+		//路径错误或路径不存在
+		return ua.StatusBadNodeIDUnknown
+	default:
+		var encodeErr *types.EncodeError
+		if errors.As(err, &encodeErr) {
+			return ua.StatusBadTypeMismatch
+		}
+		return ua.StatusBadDeviceFailure
+	}
+}
+
+//elementIndex 按行优先顺序计算第 i 个元素的下标，如 [1,2]
+func elementIndex(dims []uint32, i int) string {
+	index := make([]string, len(dims))
+	for d := len(dims) - 1; d >= 0; d-- {
+		index[d] = strconv.Itoa(i % int(dims[d]))
+		i /= int(dims[d])
+	}
+	return "[" + strings.Join(index, ",") + "]"
+}
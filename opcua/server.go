@@ -0,0 +1,1012 @@
+//Package opcua 提供 OPC UA 服务端，地址空间由控制器的标签列表与结构体模板生成
+//
+//每个 PLC 为 Objects 下的一个目录，节点标识为 ns=1;s=PLC名称/标签路径，如 ns=1;s=line1/Motor.Speed。
+//程序标签位于 Program:名称 目录下；结构体为对象，成员为子节点；STRING 与自定义字符串为 String 变量。
+//读写通过 pool.Manager 访问 PLC，MonitoredItem 按 PLC 与采样间隔合并为扫描组批量读取。
+//
+//仅支持 None 安全策略与 UA TCP 二进制协议，用户名密码以明文传输，只适合在可信网络中使用。
+package opcua
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/ua"
+	"github.com/wj008/gologix/pool"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+//命名空间与应用标识
+const (
+	NamespaceURI   = "urn:github.com:wj008:gologix:tags"
+	ApplicationURI = "urn:github.com:wj008:gologix:opcua"
+	ProductURI     = "https://github.com/wj008/gologix"
+)
+
+//服务端限制
+const (
+	maxPublishRequests   = 10 //每个会话排队的 Publish 请求数量
+	maxRetransmit        = 10 //每个订阅保留的可重发消息数量
+	maxContinuations     = 16 //每个会话保留的浏览续传点数量
+	minSamplingInterval  = 100 * time.Millisecond
+	minPublishInterval   = 100 * time.Millisecond
+	defaultSessionTimout = time.Minute
+	maxSessionTimeout    = time.Hour
+)
+
+//Config OPC UA 服务配置文件
+type Config struct {
+	Listen            string            `json:"listen"`              //监听地址 默认 :4840
+	EndpointURL       string            `json:"endpoint_url"`        //客户端访问地址 默认 opc.tcp://主机名:端口
+	ReadOnly          bool              `json:"read_only"`           //禁止写入标签
+	Users             map[string]string `json:"users"`               //用户名与密码，为空时允许匿名访问
+	MaxStructElements int               `json:"max_struct_elements"` //结构体数组展开的最大元素数量 默认 100
+	PLCs              []*pool.Endpoint  `json:"plcs"`
+}
+
+//Server OPC UA 服务端
+type Server struct {
+	manager  *pool.Manager
+	space    *space
+	started  time.Time
+	mutex    sync.Mutex
+	listener net.Listener
+	conns    map[*ua.Conn]bool
+	closed   bool
+	done     chan struct{}
+	start    sync.Once
+	wait     sync.WaitGroup
+	nextID   uint32
+	sessions map[ua.NodeID]*session         //认证令牌对应的会话
+	watchers map[string]*gologix.Subscriber //每个 PLC 一个订阅引擎，监视项按采样间隔合并读取
+	//EndpointURL 返回给客户端的访问地址，为空时使用监听地址
+	EndpointURL string
+	//ReadOnly 禁止写入标签
+	ReadOnly bool
+	//Users 用户名与密码，为空时允许匿名访问
+	Users map[string]string
+	//MaxStructElements 结构体数组展开的最大元素数量 默认 100
+	MaxStructElements int
+	//RetryInterval PLC 不可用时重新读取标签列表的间隔 默认 10 秒
+	RetryInterval time.Duration
+	//Logger 记录链接与加载错误，默认 log.Default()
+	Logger *log.Logger
+}
+
+//New 创建服务端，manager 中的每个 PLC 在开始服务后读取标签列表
+func New(manager *pool.Manager) *Server {
+	s := &Server{
+		manager:           manager,
+		space:             newSpace(),
+		started:           time.Now(),
+		conns:             make(map[*ua.Conn]bool),
+		done:              make(chan struct{}),
+		sessions:          make(map[ua.NodeID]*session),
+		watchers:          make(map[string]*gologix.Subscriber),
+		MaxStructElements: 100,
+		RetryInterval:     10 * time.Second,
+		Logger:            log.Default(),
+	}
+	s.space.addStandardNodes(s)
+	return s
+}
+
+//ListenAndServe 在 addr 上监听并处理请求，直到 Close
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+//Serve 加载标签并接受链接，直到 Close
+func (s *Server) Serve(listener net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		listener.Close()
+		return net.ErrClosed
+	}
+	s.listener = listener
+	if s.EndpointURL == "" {
+		s.EndpointURL = endpointURL(listener.Addr())
+	}
+	s.mutex.Unlock()
+	s.start.Do(func() {
+		for _, name := range s.manager.Names() {
+			s.space.add(ua.NewNumericNodeID(0, ua.IDObjectsFolder), ua.IDOrganizes, folderNode(ua.NewStringNodeID(1, name), name))
+			s.wait.Add(1)
+			go s.load(name)
+		}
+		s.wait.Add(1)
+		go s.expire()
+	})
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closed := s.closed
+			s.mutex.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		c := ua.NewConn(conn)
+		s.mutex.Lock()
+		s.conns[c] = true
+		s.mutex.Unlock()
+		s.wait.Add(1)
+		go s.serveConn(c)
+	}
+}
+
+//endpointURL 由监听地址生成访问地址，未指定主机时使用本机名称
+func endpointURL(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "opc.tcp://" + addr.String()
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		if name, err := os.Hostname(); err == nil {
+			host = name
+		}
+	}
+	return "opc.tcp://" + net.JoinHostPort(host, port)
+}
+
+//Close 停止监听，关闭所有链接、会话与订阅引擎
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	for _, sess := range s.sessions {
+		s.closeSession(sess)
+	}
+	watchers := s.watchers
+	s.watchers = make(map[string]*gologix.Subscriber)
+	s.mutex.Unlock()
+	//订阅回调需要 s.mutex，解锁后再等待扫描协程退出
+	for _, watcher := range watchers {
+		watcher.Stop()
+	}
+	s.wait.Wait()
+	return err
+}
+
+//load 读取一个 PLC 的标签列表，PLC 不可用时定期重试
+func (s *Server) load(name string) {
+	defer s.wait.Done()
+	for {
+		local := newSpace()
+		err := s.manager.Do(name, func(plc *gologix.PLC) error {
+			l := &loader{plc: plc, name: name, space: local, maxElements: s.MaxStructElements, readOnly: s.ReadOnly}
+			return l.load()
+		})
+		if err == nil {
+			s.space.merge(local)
+			return
+		}
+		s.Logger.Printf("读取 %s 标签列表失败: %v", name, err)
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.RetryInterval):
+		}
+	}
+}
+
+func (s *Server) status() *ua.ServerStatusDataType {
+	return &ua.ServerStatusDataType{
+		StartTime:   s.started,
+		CurrentTime: time.Now(),
+		BuildInfo: ua.BuildInfo{
+			ProductURI:       ProductURI,
+			ManufacturerName: "gologix",
+			ProductName:      "gologix OPC UA",
+			BuildDate:        s.started,
+		},
+	}
+}
+
+//newID 服务端内唯一的标识(通道、会话、订阅与监视项)
+func (s *Server) newID() uint32 {
+	s.nextID++
+	return s.nextID
+}
+
+//serveConn 握手后按顺序处理一个链接上的消息，Publish 请求排队后由订阅应答
+func (s *Server) serveConn(conn *ua.Conn) {
+	defer s.wait.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		for _, sess := range s.sessions {
+			sess.dropConn(conn)
+		}
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+	conn.NetConn().SetReadDeadline(time.Now().Add(10 * time.Second))
+	msg, err := conn.ReadMessage()
+	if err != nil || msg.Type != ua.MessageHello {
+		s.fail(conn, err, ua.StatusBadTCPMessageTypeInvalid)
+		return
+	}
+	hello := &ua.Hello{}
+	if err = ua.NewDecoder(msg.Body).Decode(hello); err != nil {
+		s.fail(conn, err, ua.StatusBadDecodingError)
+		return
+	}
+	ack, err := conn.Negotiate(hello)
+	if err != nil {
+		s.fail(conn, err, ua.StatusBadTCPMessageTooLarge)
+		return
+	}
+	if err = conn.WriteRaw(ua.MessageAcknowledge, ack); err != nil {
+		return
+	}
+	for {
+		//安全通道的生存期内客户端会续订，空闲超过生存期视为断开
+		conn.NetConn().SetReadDeadline(time.Now().Add(time.Hour + time.Minute))
+		msg, err = conn.ReadMessage()
+		if err != nil {
+			s.fail(conn, err, 0)
+			return
+		}
+		switch msg.Type {
+		case ua.MessageOpen:
+			if err = s.openChannel(conn, msg); err != nil {
+				s.fail(conn, err, ua.StatusBadDecodingError)
+				return
+			}
+		case ua.MessageClose:
+			return
+		case ua.MessageService:
+			if conn.ChannelID == 0 || msg.ChannelID != conn.ChannelID {
+				s.fail(conn, nil, ua.StatusBadSecureChannelIDInvalid)
+				return
+			}
+			s.handle(conn, msg)
+		default:
+			s.fail(conn, nil, ua.StatusBadTCPMessageTypeInvalid)
+			return
+		}
+	}
+}
+
+//fail 发送 ERR 消息，err 为状态码时使用该状态码，网络错误不发送
+func (s *Server) fail(conn *ua.Conn, err error, status ua.StatusCode) {
+	var code ua.StatusCode
+	if errors.As(err, &code) {
+		status = code
+	}
+	if status == 0 {
+		return
+	}
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	conn.WriteRaw(ua.MessageError, &ua.ErrorMessage{Error: status, Reason: reason})
+}
+
+//openChannel 创建或续订安全通道
+func (s *Server) openChannel(conn *ua.Conn, msg *ua.Message) error {
+	v, err := ua.DecodeMessage(msg.Body)
+	if err != nil {
+		return err
+	}
+	req, ok := v.(*ua.OpenSecureChannelRequest)
+	if !ok {
+		return ua.StatusBadDecodingError
+	}
+	if req.SecurityMode != ua.SecurityModeNone {
+		return ua.StatusBadSecurityPolicyRejected
+	}
+	s.mutex.Lock()
+	if req.RequestType == 0 || conn.ChannelID == 0 {
+		conn.ChannelID = s.newID()
+	}
+	conn.TokenID++
+	s.mutex.Unlock()
+	lifetime := req.RequestedLifetime
+	if lifetime == 0 || lifetime > uint32(time.Hour/time.Millisecond) {
+		lifetime = uint32(time.Hour / time.Millisecond)
+	}
+	return s.send(conn, msg.RequestID, ua.MessageOpen, &ua.OpenSecureChannelResponse{
+		ResponseHeader: responseHeader(req, ua.StatusGood),
+		SecurityToken: ua.ChannelSecurityToken{
+			ChannelID:       conn.ChannelID,
+			TokenID:         conn.TokenID,
+			CreatedAt:       time.Now(),
+			RevisedLifetime: lifetime,
+		},
+		ServerNonce: []byte{},
+	})
+}
+
+func (s *Server) send(conn *ua.Conn, requestID uint32, msgType string, response interface{}) error {
+	body, err := ua.EncodeMessage(response)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(msgType, requestID, body)
+}
+
+func responseHeader(req ua.Request, status ua.StatusCode) ua.ResponseHeader {
+	return ua.ResponseHeader{Timestamp: time.Now(), RequestHandle: req.Header().RequestHandle, ServiceResult: status}
+}
+
+func fault(req ua.Request, status ua.StatusCode) *ua.ServiceFault {
+	return &ua.ServiceFault{ResponseHeader: responseHeader(req, status)}
+}
+
+//handle 处理一个服务请求，Publish 的应答在有通知或保活时发送
+func (s *Server) handle(conn *ua.Conn, msg *ua.Message) {
+	v, err := ua.DecodeMessage(msg.Body)
+	req, ok := v.(ua.Request)
+	if err != nil || !ok {
+		header := &ua.RequestHeader{}
+		status := ua.StatusBadDecodingError
+		var unknown *ua.ErrUnknownService
+		if errors.As(err, &unknown) {
+			header, status = &unknown.Header, ua.StatusBadServiceUnsupported
+		}
+		s.send(conn, msg.RequestID, ua.MessageService, fault(header, status))
+		return
+	}
+	response := s.dispatch(conn, msg.RequestID, req)
+	if response != nil {
+		if err = s.send(conn, msg.RequestID, ua.MessageService, response); err != nil {
+			s.Logger.Println("发送 OPC UA 应答失败", err)
+		}
+	}
+}
+
+func (s *Server) dispatch(conn *ua.Conn, requestID uint32, req ua.Request) interface{} {
+	switch r := req.(type) {
+	case *ua.GetEndpointsRequest:
+		return &ua.GetEndpointsResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Endpoints: s.endpoints()}
+	case *ua.FindServersRequest:
+		return &ua.FindServersResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Servers: []ua.ApplicationDescription{s.application()}}
+	case *ua.CloseSecureChannelRequest:
+		conn.Close()
+		return nil
+	case *ua.CreateSessionRequest:
+		return s.createSession(conn, r)
+	case *ua.ActivateSessionRequest:
+		return s.activateSession(conn, r)
+	}
+	sess, status := s.session(req)
+	if status != ua.StatusGood {
+		return fault(req, status)
+	}
+	switch r := req.(type) {
+	case *ua.CloseSessionRequest:
+		s.mutex.Lock()
+		s.closeSession(sess)
+		s.mutex.Unlock()
+		return &ua.CloseSessionResponse{ResponseHeader: responseHeader(r, ua.StatusGood)}
+	case *ua.BrowseRequest:
+		return s.browse(sess, r)
+	case *ua.BrowseNextRequest:
+		return s.browseNext(sess, r)
+	case *ua.TranslateBrowsePathsRequest:
+		return s.translate(r)
+	case *ua.RegisterNodesRequest:
+		return &ua.RegisterNodesResponse{ResponseHeader: responseHeader(r, ua.StatusGood), RegisteredNodeIDs: r.NodesToRegister}
+	case *ua.UnregisterNodesRequest:
+		return &ua.UnregisterNodesResponse{ResponseHeader: responseHeader(r, ua.StatusGood)}
+	case *ua.ReadRequest:
+		return s.read(r)
+	case *ua.WriteRequest:
+		return s.write(r)
+	case *ua.CreateSubscriptionRequest:
+		return s.createSubscription(sess, r)
+	case *ua.ModifySubscriptionRequest:
+		return s.modifySubscription(sess, r)
+	case *ua.SetPublishingModeRequest:
+		return s.setPublishingMode(sess, r)
+	case *ua.DeleteSubscriptionsRequest:
+		return s.deleteSubscriptions(sess, r)
+	case *ua.CreateMonitoredItemsRequest:
+		return s.createMonitoredItems(sess, r)
+	case *ua.ModifyMonitoredItemsRequest:
+		return s.modifyMonitoredItems(sess, r)
+	case *ua.SetMonitoringModeRequest:
+		return s.setMonitoringMode(sess, r)
+	case *ua.DeleteMonitoredItemsRequest:
+		return s.deleteMonitoredItems(sess, r)
+	case *ua.PublishRequest:
+		return s.publish(sess, conn, requestID, r)
+	case *ua.RepublishRequest:
+		return s.republish(sess, r)
+	default:
+		return fault(req, ua.StatusBadServiceUnsupported)
+	}
+}
+
+func (s *Server) application() ua.ApplicationDescription {
+	return ua.ApplicationDescription{
+		ApplicationURI:  ApplicationURI,
+		ProductURI:      ProductURI,
+		ApplicationName: ua.LocalizedText{Text: "gologix OPC UA"},
+		DiscoveryURLs:   []string{s.EndpointURL},
+	}
+}
+
+func (s *Server) endpoints() []ua.EndpointDescription {
+	var policies []ua.UserTokenPolicy
+	if len(s.Users) == 0 {
+		policies = append(policies, ua.UserTokenPolicy{PolicyID: "anonymous", TokenType: ua.UserTokenAnonymous})
+	}
+	policies = append(policies, ua.UserTokenPolicy{PolicyID: "username", TokenType: ua.UserTokenUserName, SecurityPolicyURI: ua.PolicyNone})
+	return []ua.EndpointDescription{{
+		EndpointURL:         s.EndpointURL,
+		Server:              s.application(),
+		SecurityMode:        ua.SecurityModeNone,
+		SecurityPolicyURI:   ua.PolicyNone,
+		UserIdentityTokens:  policies,
+		TransportProfileURI: ua.TransportProfile,
+	}}
+}
+
+//session 会话
+type session struct {
+	id            ua.NodeID
+	token         ua.NodeID
+	timeout       time.Duration
+	lastSeen      time.Time
+	activated     bool
+	continuations map[string]*continuation
+	subscriptions map[uint32]*subscription
+	publishes     []*publishRequest
+}
+
+//continuation 浏览续传点
+type continuation struct {
+	refs []ua.ReferenceDescription
+	max  int
+}
+
+//dropConn 丢弃链接上排队的 Publish 请求
+func (sess *session) dropConn(conn *ua.Conn) {
+	publishes := sess.publishes[:0]
+	for _, p := range sess.publishes {
+		if p.conn != conn {
+			publishes = append(publishes, p)
+		}
+	}
+	sess.publishes = publishes
+}
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.Read(data)
+	return data
+}
+
+func (s *Server) createSession(conn *ua.Conn, r *ua.CreateSessionRequest) interface{} {
+	timeout := time.Duration(r.RequestedSessionTimeout * float64(time.Millisecond))
+	if timeout <= 0 {
+		timeout = defaultSessionTimout
+	}
+	if timeout < 10*time.Second {
+		timeout = 10 * time.Second
+	}
+	if timeout > maxSessionTimeout {
+		timeout = maxSessionTimeout
+	}
+	s.mutex.Lock()
+	sess := &session{
+		id:            ua.NewNumericNodeID(1, s.newID()),
+		token:         ua.NodeID{Namespace: 0, Type: ua.NodeIDOpaque, Text: string(randomBytes(32))},
+		timeout:       timeout,
+		lastSeen:      time.Now(),
+		continuations: make(map[string]*continuation),
+		subscriptions: make(map[uint32]*subscription),
+	}
+	s.sessions[sess.token] = sess
+	s.mutex.Unlock()
+	return &ua.CreateSessionResponse{
+		ResponseHeader:        responseHeader(r, ua.StatusGood),
+		SessionID:             sess.id,
+		AuthenticationToken:   sess.token,
+		RevisedSessionTimeout: float64(timeout / time.Millisecond),
+		ServerNonce:           randomBytes(32),
+		ServerEndpoints:       s.endpoints(),
+	}
+}
+
+func (s *Server) activateSession(conn *ua.Conn, r *ua.ActivateSessionRequest) interface{} {
+	s.mutex.Lock()
+	sess, ok := s.sessions[r.AuthenticationToken]
+	s.mutex.Unlock()
+	if !ok {
+		return fault(r, ua.StatusBadSessionIDInvalid)
+	}
+	switch token := r.UserIdentityToken.Body.(type) {
+	case nil, *ua.AnonymousIdentityToken:
+		if len(s.Users) > 0 {
+			return fault(r, ua.StatusBadIdentityTokenRejected)
+		}
+	case *ua.UserNameIdentityToken:
+		if token.EncryptionAlgorithm != "" {
+			return fault(r, ua.StatusBadIdentityTokenInvalid)
+		}
+		password, ok := s.Users[token.UserName]
+		if len(s.Users) > 0 && (!ok || password != string(token.Password)) {
+			return fault(r, ua.StatusBadUserAccessDenied)
+		}
+	default:
+		return fault(r, ua.StatusBadIdentityTokenInvalid)
+	}
+	s.mutex.Lock()
+	sess.activated = true
+	sess.lastSeen = time.Now()
+	s.mutex.Unlock()
+	return &ua.ActivateSessionResponse{ResponseHeader: responseHeader(r, ua.StatusGood), ServerNonce: randomBytes(32), Results: []ua.StatusCode{}}
+}
+
+//session 查找已激活的会话并刷新超时
+func (s *Server) session(req ua.Request) (*session, ua.StatusCode) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sess, ok := s.sessions[req.Header().AuthenticationToken]
+	if !ok {
+		return nil, ua.StatusBadSessionIDInvalid
+	}
+	if !sess.activated {
+		return nil, ua.StatusBadSessionNotActivated
+	}
+	sess.lastSeen = time.Now()
+	return sess, ua.StatusGood
+}
+
+//closeSession 删除会话及其订阅，调用时持有 s.mutex
+func (s *Server) closeSession(sess *session) {
+	for _, sub := range sess.subscriptions {
+		s.deleteSubscription(sub)
+	}
+	delete(s.sessions, sess.token)
+}
+
+//expire 删除超时的会话，应答超时的 Publish 请求
+func (s *Server) expire() {
+	defer s.wait.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		var out []outgoing
+		s.mutex.Lock()
+		for _, sess := range s.sessions {
+			if now.Sub(sess.lastSeen) > sess.timeout {
+				s.closeSession(sess)
+				continue
+			}
+			publishes := sess.publishes[:0]
+			for _, p := range sess.publishes {
+				if !p.deadline.IsZero() && now.After(p.deadline) {
+					out = append(out, outgoing{conn: p.conn, requestID: p.requestID, response: fault(&p.header, ua.StatusBadTimeout)})
+					continue
+				}
+				publishes = append(publishes, p)
+			}
+			sess.publishes = publishes
+		}
+		s.mutex.Unlock()
+		s.deliver(out)
+	}
+}
+
+//browse 浏览节点的引用
+func (s *Server) browse(sess *session, r *ua.BrowseRequest) interface{} {
+	if len(r.NodesToBrowse) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	results := make([]ua.BrowseResult, len(r.NodesToBrowse))
+	for i, desc := range r.NodesToBrowse {
+		refs, status := s.references(desc)
+		if status != ua.StatusGood {
+			results[i].StatusCode = status
+			continue
+		}
+		results[i] = s.page(sess, refs, int(r.RequestedMaxReferencesPerNode))
+	}
+	return &ua.BrowseResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+func (s *Server) browseNext(sess *session, r *ua.BrowseNextRequest) interface{} {
+	if len(r.ContinuationPoints) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	results := make([]ua.BrowseResult, len(r.ContinuationPoints))
+	for i, point := range r.ContinuationPoints {
+		s.mutex.Lock()
+		next, ok := sess.continuations[string(point)]
+		delete(sess.continuations, string(point))
+		s.mutex.Unlock()
+		switch {
+		case !ok:
+			results[i].StatusCode = ua.StatusBadContinuationPointInvalid
+		case r.ReleaseContinuationPoints:
+			results[i].References = []ua.ReferenceDescription{}
+		default:
+			results[i] = s.page(sess, next.refs, next.max)
+		}
+	}
+	return &ua.BrowseNextResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+//page 返回最多 max 个引用，其余保存为续传点
+func (s *Server) page(sess *session, refs []ua.ReferenceDescription, max int) ua.BrowseResult {
+	if max <= 0 || len(refs) <= max {
+		return ua.BrowseResult{References: refs}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(sess.continuations) >= maxContinuations {
+		return ua.BrowseResult{StatusCode: ua.StatusBadNoContinuationPoints}
+	}
+	point := randomBytes(8)
+	sess.continuations[string(point)] = &continuation{refs: refs[max:], max: max}
+	return ua.BrowseResult{ContinuationPoint: point, References: refs[:max]}
+}
+
+//references 按浏览条件筛选节点的引用
+func (s *Server) references(desc ua.BrowseDescription) ([]ua.ReferenceDescription, ua.StatusCode) {
+	n := s.space.get(desc.NodeID)
+	if n == nil {
+		return nil, ua.StatusBadNodeIDUnknown
+	}
+	if desc.BrowseDirection > ua.BrowseBoth {
+		return nil, ua.StatusBadBrowseDirectionInvalid
+	}
+	refs := make([]ua.ReferenceDescription, 0, len(n.refs))
+	for _, ref := range n.refs {
+		if ref.forward && desc.BrowseDirection == ua.BrowseInverse || !ref.forward && desc.BrowseDirection == ua.BrowseForward {
+			continue
+		}
+		if !isReference(ref.refType, desc.ReferenceTypeID, desc.IncludeSubtypes) {
+			continue
+		}
+		target := s.space.get(ref.target)
+		if target == nil || desc.NodeClassMask != 0 && desc.NodeClassMask&target.class == 0 {
+			continue
+		}
+		//ResultMask: 0x01 引用类型 0x02 方向 0x04 节点类别 0x08 浏览名 0x10 显示名 0x20 类型定义
+		item := ua.ReferenceDescription{NodeID: ua.ExpandedNodeID{NodeID: target.id}}
+		if desc.ResultMask&0x01 != 0 {
+			item.ReferenceTypeID = ua.NewNumericNodeID(0, ref.refType)
+		}
+		if desc.ResultMask&0x02 != 0 {
+			item.IsForward = ref.forward
+		}
+		if desc.ResultMask&0x04 != 0 {
+			item.NodeClass = target.class
+		}
+		if desc.ResultMask&0x08 != 0 {
+			item.BrowseName = target.browseName
+		}
+		if desc.ResultMask&0x10 != 0 {
+			item.DisplayName = ua.LocalizedText{Text: target.displayName}
+		}
+		if desc.ResultMask&0x20 != 0 {
+			item.TypeDefinition = ua.ExpandedNodeID{NodeID: target.typeDef}
+		}
+		refs = append(refs, item)
+	}
+	return refs, ua.StatusGood
+}
+
+//translate 按浏览名路径查找节点
+func (s *Server) translate(r *ua.TranslateBrowsePathsRequest) interface{} {
+	if len(r.BrowsePaths) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	results := make([]ua.BrowsePathResult, len(r.BrowsePaths))
+	for i, path := range r.BrowsePaths {
+		if s.space.get(path.StartingNode) == nil {
+			results[i].StatusCode = ua.StatusBadNodeIDUnknown
+			continue
+		}
+		if len(path.RelativePath.Elements) == 0 {
+			results[i].StatusCode = ua.StatusBadNothingToDo
+			continue
+		}
+		current := []ua.NodeID{path.StartingNode}
+		for _, element := range path.RelativePath.Elements {
+			var next []ua.NodeID
+			for _, id := range current {
+				n := s.space.get(id)
+				if n == nil {
+					continue
+				}
+				for _, ref := range n.refs {
+					if ref.forward == element.IsInverse || !isReference(ref.refType, element.ReferenceTypeID, element.IncludeSubtypes) {
+						continue
+					}
+					if target := s.space.get(ref.target); target != nil && target.browseName == element.TargetName {
+						next = append(next, target.id)
+					}
+				}
+			}
+			current = next
+		}
+		if len(current) == 0 {
+			results[i].StatusCode = ua.StatusBadNoMatch
+			continue
+		}
+		for _, id := range current {
+			results[i].Targets = append(results[i].Targets, ua.BrowsePathTarget{TargetID: ua.ExpandedNodeID{NodeID: id}, RemainingPathIndex: 0xffffffff})
+		}
+	}
+	return &ua.TranslateBrowsePathsResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+//attribute 读取节点的属性，PLC 标签的数值由 readTags 读取
+func (s *Server) attribute(n *node, id uint32) ua.DataValue {
+	var value interface{}
+	isType := n.class == ua.NodeClassObjectType || n.class == ua.NodeClassVariableType ||
+		n.class == ua.NodeClassDataType || n.class == ua.NodeClassReferenceType
+	isVariable := n.class == ua.NodeClassVariable
+	switch {
+	case id == ua.AttrNodeID:
+		value = n.id
+	case id == ua.AttrNodeClass:
+		value = int32(n.class)
+	case id == ua.AttrBrowseName:
+		value = n.browseName
+	case id == ua.AttrDisplayName:
+		value = ua.LocalizedText{Text: n.displayName}
+	case id == ua.AttrDescription:
+		value = ua.LocalizedText{Text: n.description}
+	case id == ua.AttrWriteMask, id == ua.AttrUserWriteMask:
+		value = uint32(0)
+	case id == ua.AttrIsAbstract && isType:
+		value = n.isAbstract
+	case id == ua.AttrSymmetric && n.class == ua.NodeClassReferenceType:
+		value = n.symmetric
+	case id == ua.AttrInverseName && n.class == ua.NodeClassReferenceType:
+		value = ua.LocalizedText{Text: n.inverseName}
+	case id == ua.AttrEventNotifier && n.class == ua.NodeClassObject:
+		value = uint8(0)
+	case id == ua.AttrValue && isVariable && n.value != nil:
+		value = n.value()
+	case id == ua.AttrDataType && isVariable:
+		value = ua.NewNumericNodeID(0, n.dataType)
+	case id == ua.AttrValueRank && isVariable:
+		value = int32(-1)
+		if n.elements > 0 {
+			value = int32(1)
+		}
+	case id == ua.AttrArrayDimensions && isVariable:
+		if n.elements > 0 {
+			value = []uint32{uint32(n.elements)}
+		} else {
+			value = []uint32{}
+		}
+	case (id == ua.AttrAccessLevel || id == ua.AttrUserAccessLevel) && isVariable:
+		//0x01 可读 0x02 可写
+		level := uint8(0x01)
+		if n.writable && !s.ReadOnly {
+			level |= 0x02
+		}
+		value = level
+	case id == ua.AttrMinimumSamplingInterval && isVariable:
+		value = float64(minSamplingInterval / time.Millisecond)
+	case id == ua.AttrHistorizing && isVariable:
+		value = false
+	default:
+		return ua.DataValue{Status: ua.StatusBadAttributeIDInvalid}
+	}
+	now := time.Now()
+	return ua.DataValue{Value: value, ServerTimestamp: now, SourceTimestamp: now}
+}
+
+//elementsOf 节点读取的元素数量
+func elementsOf(n *node) uint16 {
+	if n.elements == 0 {
+		return 1
+	}
+	return n.elements
+}
+
+//tagValue 标签的读取结果转换为数据值
+func tagValue(n *node, values []gologix.Value, err error, now time.Time) ua.DataValue {
+	value := ua.DataValue{SourceTimestamp: now, ServerTimestamp: now}
+	switch {
+	case err != nil:
+		value.Status = statusOf(err)
+	case n.elements > 0:
+		value.Value = toVariantArray(values)
+	default:
+		value.Value = toVariant(values[0].Data)
+	}
+	if value.Value == nil && value.Status == ua.StatusGood {
+		value.Status = ua.StatusBadTypeMismatch
+	}
+	return value
+}
+
+//readTags 批量读取一个 PLC 的标签变量，标签错误记录在各自的结果中
+func (s *Server) readTags(name string, nodes []*node) []ua.DataValue {
+	var requests []gologix.ReadRequest
+	seen := make(map[string]bool)
+	for _, n := range nodes {
+		if !seen[n.tag] {
+			seen[n.tag] = true
+			requests = append(requests, gologix.ReadRequest{Tag: n.tag, Elements: elementsOf(n)})
+		}
+	}
+	var results map[string]*gologix.TagResult
+	client, err := s.manager.Client(name)
+	if err == nil {
+		results, err = client.MultiReadTags(requests)
+	}
+	now := time.Now()
+	values := make([]ua.DataValue, len(nodes))
+	for i, n := range nodes {
+		if err != nil {
+			values[i] = tagValue(n, nil, err, now)
+			continue
+		}
+		items, tagErr := results[n.tag].Elements(elementsOf(n))
+		values[i] = tagValue(n, items, tagErr, now)
+	}
+	return values
+}
+
+//stamp 按 TimestampsToReturn 保留时间戳
+func stamp(value ua.DataValue, timestamps uint32) ua.DataValue {
+	switch timestamps {
+	case ua.TimestampsSource:
+		value.ServerTimestamp = time.Time{}
+	case ua.TimestampsServer:
+		value.SourceTimestamp = time.Time{}
+	case ua.TimestampsNeither:
+		value.SourceTimestamp, value.ServerTimestamp = time.Time{}, time.Time{}
+	}
+	return value
+}
+
+//readNodes 读取节点属性，标签数值按 PLC 合并读取
+func (s *Server) readNodes(items []ua.ReadValueID) []ua.DataValue {
+	results := make([]ua.DataValue, len(items))
+	groups := make(map[string][]int)
+	for i, item := range items {
+		n := s.space.get(item.NodeID)
+		switch {
+		case n == nil:
+			results[i].Status = ua.StatusBadNodeIDUnknown
+		case item.IndexRange != "":
+			results[i].Status = ua.StatusBadIndexRangeInvalid
+		case item.AttributeID == ua.AttrValue && n.plc != "":
+			groups[n.plc] = append(groups[n.plc], i)
+		default:
+			results[i] = s.attribute(n, item.AttributeID)
+		}
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		nodes := make([]*node, len(groups[name]))
+		for j, i := range groups[name] {
+			nodes[j] = s.space.get(items[i].NodeID)
+		}
+		for j, value := range s.readTags(name, nodes) {
+			results[groups[name][j]] = value
+		}
+	}
+	return results
+}
+
+func (s *Server) read(r *ua.ReadRequest) interface{} {
+	if len(r.NodesToRead) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	if r.TimestampsToReturn > ua.TimestampsNeither {
+		return fault(r, ua.StatusBadTimestampsToReturnInvalid)
+	}
+	results := s.readNodes(r.NodesToRead)
+	for i := range results {
+		results[i] = stamp(results[i], r.TimestampsToReturn)
+	}
+	return &ua.ReadResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+//write 写入标签变量，同一 PLC 的写入在一次 Do 中按顺序执行
+func (s *Server) write(r *ua.WriteRequest) interface{} {
+	if len(r.NodesToWrite) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	results := make([]ua.StatusCode, len(r.NodesToWrite))
+	values := make([][]interface{}, len(r.NodesToWrite))
+	nodes := make([]*node, len(r.NodesToWrite))
+	groups := make(map[string][]int)
+	var names []string
+	for i, item := range r.NodesToWrite {
+		n := s.space.get(item.NodeID)
+		switch {
+		case n == nil:
+			results[i] = ua.StatusBadNodeIDUnknown
+			continue
+		case item.AttributeID < ua.AttrNodeID || item.AttributeID > ua.AttrHistorizing:
+			results[i] = ua.StatusBadAttributeIDInvalid
+			continue
+		case item.AttributeID != ua.AttrValue || n.plc == "" || !n.writable || s.ReadOnly:
+			results[i] = ua.StatusBadNotWritable
+			continue
+		case item.IndexRange != "":
+			results[i] = ua.StatusBadIndexRangeInvalid
+			continue
+		}
+		var err error
+		if values[i], err = fromVariant(n, item.Value.Value); err != nil {
+			results[i] = statusOf(err)
+			continue
+		}
+		nodes[i] = n
+		if _, ok := groups[n.plc]; !ok {
+			names = append(names, n.plc)
+		}
+		groups[n.plc] = append(groups[n.plc], i)
+	}
+	for _, name := range names {
+		err := s.manager.Do(name, func(plc *gologix.PLC) error {
+			for _, i := range groups[name] {
+				if err := plc.WriteTag(nodes[i].tag, values[i]...); err != nil {
+					if !plc.Connected() {
+						return err
+					}
+					s.Logger.Printf("写入 %s %s 失败: %v", name, nodes[i].tag, err)
+					results[i] = statusOf(err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			for _, i := range groups[name] {
+				if results[i] == ua.StatusGood {
+					results[i] = statusOf(err)
+				}
+			}
+		}
+	}
+	return &ua.WriteResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+//parseTimeout 请求的超时提示，0 表示不超时
+func parseTimeout(header *ua.RequestHeader) time.Time {
+	if header.TimeoutHint == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(header.TimeoutHint) * time.Millisecond)
+}
@@ -0,0 +1,286 @@
+package opcua
+
+import (
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/internal/ua"
+	"github.com/wj008/gologix/pool"
+	"github.com/wj008/gologix/types"
+	"io"
+	"log"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//client 测试用 OPC UA 客户端
+type client struct {
+	t         *testing.T
+	conn      *ua.Conn
+	requestID uint32
+	token     ua.NodeID
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{t: t, conn: ua.NewConn(conn)}
+	hello := &ua.Hello{ReceiveBufferSize: ua.DefaultBufferSize, SendBufferSize: ua.DefaultBufferSize, EndpointURL: "opc.tcp://" + addr}
+	if err = c.conn.WriteRaw(ua.MessageHello, hello); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := c.conn.ReadMessage(); err != nil || msg.Type != ua.MessageAcknowledge {
+		t.Fatalf("握手失败 %v %v", msg, err)
+	}
+	body, _ := ua.EncodeMessage(&ua.OpenSecureChannelRequest{SecurityMode: ua.SecurityModeNone, RequestedLifetime: 60000})
+	if err = c.conn.WriteMessage(ua.MessageOpen, 1, body); err != nil {
+		t.Fatal(err)
+	}
+	open, ok := c.receive().(*ua.OpenSecureChannelResponse)
+	if !ok {
+		t.Fatal("打开安全通道失败")
+	}
+	c.conn.ChannelID, c.conn.TokenID = open.SecurityToken.ChannelID, open.SecurityToken.TokenID
+	return c
+}
+
+func (c *client) receive() interface{} {
+	c.t.Helper()
+	c.conn.NetConn().SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	v, err := ua.DecodeMessage(msg.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return v
+}
+
+//call 发送请求并读取应答，服务错误时返回 ServiceFault
+func (c *client) call(req ua.Request) interface{} {
+	c.t.Helper()
+	c.requestID++
+	header := req.Header()
+	header.AuthenticationToken, header.RequestHandle, header.Timestamp = c.token, c.requestID, time.Now()
+	body, err := ua.EncodeMessage(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err = c.conn.WriteMessage(ua.MessageService, c.requestID, body); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.receive()
+}
+
+func (c *client) login(identity interface{}) ua.StatusCode {
+	c.t.Helper()
+	created, ok := c.call(&ua.CreateSessionRequest{SessionName: "test", RequestedSessionTimeout: 60000}).(*ua.CreateSessionResponse)
+	if !ok {
+		c.t.Fatal("创建会话失败")
+	}
+	c.token = created.AuthenticationToken
+	switch v := c.call(&ua.ActivateSessionRequest{UserIdentityToken: *ua.NewExtensionObject(identity)}).(type) {
+	case *ua.ActivateSessionResponse:
+		return ua.StatusGood
+	case *ua.ServiceFault:
+		return v.ServiceResult
+	default:
+		c.t.Fatalf("激活会话应答错误 %T", v)
+		return 0
+	}
+}
+
+func (c *client) read(ids ...ua.NodeID) []ua.DataValue {
+	c.t.Helper()
+	req := &ua.ReadRequest{TimestampsToReturn: ua.TimestampsBoth}
+	for _, id := range ids {
+		req.NodesToRead = append(req.NodesToRead, ua.ReadValueID{NodeID: id, AttributeID: ua.AttrValue})
+	}
+	response, ok := c.call(req).(*ua.ReadResponse)
+	if !ok || len(response.Results) != len(ids) {
+		c.t.Fatalf("读取失败 %v", response)
+	}
+	return response.Results
+}
+
+func (c *client) write(id ua.NodeID, value interface{}) ua.StatusCode {
+	c.t.Helper()
+	response, ok := c.call(&ua.WriteRequest{NodesToWrite: []ua.WriteValue{{NodeID: id, AttributeID: ua.AttrValue, Value: ua.DataValue{Value: value}}}}).(*ua.WriteResponse)
+	if !ok {
+		c.t.Fatal("写入失败")
+	}
+	return response.Results[0]
+}
+
+//notification 发送 Publish 请求，返回数据变化通知
+func (c *client) notification(acks ...ua.SubscriptionAcknowledgement) (*ua.PublishResponse, *ua.DataChangeNotification) {
+	c.t.Helper()
+	for {
+		response, ok := c.call(&ua.PublishRequest{SubscriptionAcknowledgements: acks}).(*ua.PublishResponse)
+		if !ok {
+			c.t.Fatal("Publish 失败")
+		}
+		acks = nil
+		data := response.NotificationMessage.NotificationData
+		if len(data) == 0 {
+			continue //保活
+		}
+		notification, ok := data[0].Body.(*ua.DataChangeNotification)
+		if !ok {
+			c.t.Fatalf("通知类型错误 %T", data[0].Body)
+		}
+		return response, notification
+	}
+}
+
+func TestServer(t *testing.T) {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.AddTag("Speed", types.REAL, []float32{12.5})
+	sim.AddTag("Running", types.BOOL, []bool{true})
+	sim.AddTag("Small", types.SINT, []int8{1})
+	sim.AddArray("Counts", types.DINT, []uint32{3}, []int32{1, 2, 3})
+	manager, err := pool.NewManager([]*pool.Endpoint{
+		{Name: "line1", Address: sim.Addr()},
+		{Name: "offline", Address: "127.0.0.1:1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	server := New(manager)
+	server.Logger = log.New(io.Discard, "", 0)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer server.Close()
+	c := dial(t, listener.Addr().String())
+	defer c.conn.Close()
+	if fault, ok := c.call(&ua.BrowseRequest{}).(*ua.ServiceFault); !ok || fault.ServiceResult != ua.StatusBadSessionIDInvalid {
+		t.Fatal("未创建会话时应拒绝请求")
+	}
+	if status := c.login(&ua.AnonymousIdentityToken{PolicyID: "anonymous"}); status != ua.StatusGood {
+		t.Fatalf("匿名登录失败 %v", status)
+	}
+
+	//等待标签列表加载完成
+	browse := &ua.BrowseRequest{NodesToBrowse: []ua.BrowseDescription{{
+		NodeID:          ua.NewStringNodeID(1, "line1"),
+		ReferenceTypeID: ua.NewNumericNodeID(0, ua.IDHierarchicalReferences),
+		IncludeSubtypes: true,
+		ResultMask:      0x3f,
+	}}}
+	var names []string
+	for deadline := time.Now().Add(5 * time.Second); len(names) < 4 && time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		response := c.call(browse).(*ua.BrowseResponse)
+		names = names[:0]
+		for _, ref := range response.Results[0].References {
+			if ref.IsForward {
+				names = append(names, ref.BrowseName.Name)
+			}
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"Counts", "Running", "Small", "Speed"}) {
+		t.Fatalf("浏览标签错误 %v", names)
+	}
+
+	speed, running, counts, small := ua.NewStringNodeID(1, "line1/Speed"), ua.NewStringNodeID(1, "line1/Running"), ua.NewStringNodeID(1, "line1/Counts"), ua.NewStringNodeID(1, "line1/Small")
+	values := c.read(speed, running, counts, ua.NewStringNodeID(1, "line1/Missing"))
+	if values[0].Value != float32(12.5) || values[1].Value != true || !reflect.DeepEqual(values[2].Value, []int32{1, 2, 3}) {
+		t.Fatalf("读取数值错误 %v", values)
+	}
+	if values[3].Status != ua.StatusBadNodeIDUnknown {
+		t.Fatalf("不存在的节点应返回 BadNodeIdUnknown %v", values[3].Status)
+	}
+	if status := c.write(speed, float32(20)); status != ua.StatusGood {
+		t.Fatalf("写入失败 %v", status)
+	}
+	if status := c.write(speed, "abc"); status != ua.StatusBadTypeMismatch {
+		t.Fatalf("类型不符应返回 BadTypeMismatch %v", status)
+	}
+	if status := c.write(small, int32(300)); status != ua.StatusBadOutOfRange {
+		t.Fatalf("超出范围应返回 BadOutOfRange %v", status)
+	}
+	if status := c.write(counts, []int32{4, 5}); status != ua.StatusBadTypeMismatch {
+		t.Fatalf("数组长度不符应返回 BadTypeMismatch %v", status)
+	}
+	if status := c.write(counts, []int32{4, 5, 6}); status != ua.StatusGood {
+		t.Fatalf("写入数组失败 %v", status)
+	}
+	if values = c.read(speed, counts); values[0].Value != float32(20) || !reflect.DeepEqual(values[1].Value, []int32{4, 5, 6}) {
+		t.Fatalf("写入后读取错误 %v", values)
+	}
+
+	//订阅：首次报告当前值，之后只报告变化
+	created := c.call(&ua.CreateSubscriptionRequest{RequestedPublishingInterval: 100, PublishingEnabled: true}).(*ua.CreateSubscriptionResponse)
+	items := c.call(&ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     created.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{ItemToMonitor: ua.ReadValueID{NodeID: speed, AttributeID: ua.AttrValue}, MonitoringMode: ua.MonitoringReporting, RequestedParameters: ua.MonitoringParameters{ClientHandle: 7, SamplingInterval: 100}},
+			{ItemToMonitor: ua.ReadValueID{NodeID: ua.NewStringNodeID(1, "line1/Missing"), AttributeID: ua.AttrValue}, MonitoringMode: ua.MonitoringReporting},
+		},
+	}).(*ua.CreateMonitoredItemsResponse)
+	if items.Results[0].StatusCode != ua.StatusGood || items.Results[1].StatusCode != ua.StatusBadNodeIDUnknown {
+		t.Fatalf("创建监视项错误 %v", items.Results)
+	}
+	response, notification := c.notification()
+	if len(notification.MonitoredItems) != 1 || notification.MonitoredItems[0].ClientHandle != 7 || notification.MonitoredItems[0].Value.Value != float32(20) {
+		t.Fatalf("首次通知错误 %+v", notification.MonitoredItems)
+	}
+	err = manager.Do("line1", func(plc *gologix.PLC) error {
+		return plc.WriteTag("Speed", float32(30))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack := ua.SubscriptionAcknowledgement{SubscriptionID: created.SubscriptionID, SequenceNumber: response.NotificationMessage.SequenceNumber}
+	response, notification = c.notification(ack)
+	if notification.MonitoredItems[0].Value.Value != float32(30) || response.Results[0] != ua.StatusGood {
+		t.Fatalf("变化通知错误 %+v %v", notification.MonitoredItems, response.Results)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	manager, err := pool.NewManager([]*pool.Endpoint{{Name: "offline", Address: "127.0.0.1:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	server := New(manager)
+	server.Users = map[string]string{"operator": "secret"}
+	server.Logger = log.New(io.Discard, "", 0)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer server.Close()
+	c := dial(t, listener.Addr().String())
+	defer c.conn.Close()
+	if status := c.login(&ua.AnonymousIdentityToken{PolicyID: "anonymous"}); status != ua.StatusBadIdentityTokenRejected {
+		t.Fatalf("配置用户后应拒绝匿名登录 %v", status)
+	}
+	if status := c.login(&ua.UserNameIdentityToken{PolicyID: "username", UserName: "operator", Password: []byte("wrong")}); status != ua.StatusBadUserAccessDenied {
+		t.Fatalf("密码错误应拒绝登录 %v", status)
+	}
+	if status := c.login(&ua.UserNameIdentityToken{PolicyID: "username", UserName: "operator", Password: []byte("secret")}); status != ua.StatusGood {
+		t.Fatalf("用户名密码登录失败 %v", status)
+	}
+	//ServerStatus 由服务端提供，不访问 PLC
+	values := c.read(ua.NewNumericNodeID(0, ua.IDServerServerStatusState))
+	if values[0].Status != ua.StatusGood || values[0].Value != int32(0) {
+		t.Fatalf("读取服务状态错误 %+v", values[0])
+	}
+}
@@ -0,0 +1,406 @@
+package opcua
+
+import (
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/ua"
+	"github.com/wj008/gologix/types"
+	"math"
+	"strings"
+	"sync"
+)
+
+//maxDepth 结构体嵌套展开的最大层数
+const maxDepth = 8
+
+//reference 节点引用
+type reference struct {
+	refType uint32 //命名空间 0 的引用类型
+	forward bool
+	target  ua.NodeID
+}
+
+//node 地址空间节点
+type node struct {
+	id          ua.NodeID
+	class       uint32
+	browseName  ua.QualifiedName
+	displayName string
+	description string
+	typeDef     ua.NodeID //对象与变量的类型定义
+	refs        []reference
+	//类型节点
+	isAbstract  bool
+	symmetric   bool
+	inverseName string
+	//变量节点
+	dataType uint32
+	elements uint16             //数组元素数量，0 为标量
+	value    func() interface{} //服务端变量的数值
+	plc      string             //PLC 名称，为空时不是标签
+	tag      string
+	writable bool
+}
+
+//space 地址空间
+type space struct {
+	mutex sync.RWMutex
+	nodes map[ua.NodeID]*node
+}
+
+func newSpace() *space {
+	return &space{nodes: make(map[ua.NodeID]*node)}
+}
+
+//get 查找节点，返回的节点只读，修改时替换为副本
+func (s *space) get(id ua.NodeID) *node {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.nodes[id]
+}
+
+//add 添加节点及父节点到节点的引用，parent 为空时只添加节点
+func (s *space) add(parent ua.NodeID, refType uint32, n *node) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nodes[n.id] = n
+	if !n.typeDef.IsNull() {
+		n.refs = append(n.refs, reference{refType: ua.IDHasTypeDefinition, forward: true, target: n.typeDef})
+	}
+	if p, ok := s.nodes[parent]; ok && !parent.IsNull() {
+		//已有节点可能正在被浏览，复制后替换
+		copied := *p
+		copied.refs = append(append(make([]reference, 0, len(p.refs)+1), p.refs...), reference{refType: refType, forward: true, target: n.id})
+		s.nodes[parent] = &copied
+		n.refs = append(n.refs, reference{refType: refType, forward: false, target: parent})
+	}
+}
+
+//merge 合并另一个地址空间，已存在的节点只追加引用
+func (s *space) merge(other *space) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, n := range other.nodes {
+		if exist, ok := s.nodes[id]; ok {
+			refs := make([]reference, 0, len(exist.refs)+len(n.refs))
+			refs = append(refs, exist.refs...)
+			for _, ref := range n.refs {
+				if ref.refType != ua.IDHasTypeDefinition {
+					refs = append(refs, ref)
+				}
+			}
+			copied := *exist
+			copied.refs = refs
+			s.nodes[id] = &copied
+			continue
+		}
+		s.nodes[id] = n
+	}
+}
+
+func folderNode(id ua.NodeID, name string) *node {
+	return &node{
+		id:          id,
+		class:       ua.NodeClassObject,
+		browseName:  ua.QualifiedName{Namespace: id.Namespace, Name: name},
+		displayName: name,
+		typeDef:     ua.NewNumericNodeID(0, ua.IDFolderType),
+	}
+}
+
+func objectNode(id ua.NodeID, name string, typeDef uint32) *node {
+	n := folderNode(id, name)
+	n.typeDef = ua.NewNumericNodeID(0, typeDef)
+	return n
+}
+
+func variableNode(id ua.NodeID, name string, dataType uint32, typeDef uint32) *node {
+	return &node{
+		id:          id,
+		class:       ua.NodeClassVariable,
+		browseName:  ua.QualifiedName{Namespace: id.Namespace, Name: name},
+		displayName: name,
+		typeDef:     ua.NewNumericNodeID(0, typeDef),
+		dataType:    dataType,
+	}
+}
+
+func typeNode(id uint32, class uint32, name string, isAbstract bool) *node {
+	return &node{
+		id:          ua.NewNumericNodeID(0, id),
+		class:       class,
+		browseName:  ua.QualifiedName{Name: name},
+		displayName: name,
+		isAbstract:  isAbstract,
+	}
+}
+
+//referenceParents 引用类型的父类型
+var referenceParents = map[uint32]uint32{
+	ua.IDHierarchicalReferences:    ua.IDReferences,
+	ua.IDNonHierarchicalReferences: ua.IDReferences,
+	ua.IDHasChild:                  ua.IDHierarchicalReferences,
+	ua.IDOrganizes:                 ua.IDHierarchicalReferences,
+	ua.IDAggregates:                ua.IDHasChild,
+	ua.IDHasSubtype:                ua.IDHasChild,
+	ua.IDHasComponent:              ua.IDAggregates,
+	ua.IDHasProperty:               ua.IDAggregates,
+	ua.IDHasTypeDefinition:         ua.IDNonHierarchicalReferences,
+}
+
+//isReference 引用类型是否匹配过滤条件，filter 为空时匹配所有引用
+func isReference(refType uint32, filter ua.NodeID, subtypes bool) bool {
+	if filter.IsNull() {
+		return true
+	}
+	if filter.Namespace != 0 || filter.Type != ua.NodeIDNumeric {
+		return false
+	}
+	for id := refType; id != 0; id = referenceParents[id] {
+		if id == filter.Numeric {
+			return true
+		}
+		if !subtypes {
+			return false
+		}
+	}
+	return false
+}
+
+//addStandardNodes 添加命名空间 0 的基本节点: 根目录、类型与 Server 对象
+func (s *space) addStandardNodes(server *Server) {
+	ns0 := func(id uint32) ua.NodeID {
+		return ua.NewNumericNodeID(0, id)
+	}
+	root := folderNode(ns0(ua.IDRootFolder), "Root")
+	s.add(ua.NodeID{}, 0, root)
+	for _, folder := range []struct {
+		parent, id uint32
+		name       string
+	}{
+		{ua.IDRootFolder, ua.IDObjectsFolder, "Objects"},
+		{ua.IDRootFolder, ua.IDTypesFolder, "Types"},
+		{ua.IDRootFolder, ua.IDViewsFolder, "Views"},
+		{ua.IDTypesFolder, ua.IDObjectTypesFolder, "ObjectTypes"},
+		{ua.IDTypesFolder, ua.IDVariableTypesFolder, "VariableTypes"},
+		{ua.IDTypesFolder, ua.IDDataTypesFolder, "DataTypes"},
+		{ua.IDTypesFolder, ua.IDReferenceTypesFolder, "ReferenceTypes"},
+	} {
+		s.add(ns0(folder.parent), ua.IDOrganizes, folderNode(ns0(folder.id), folder.name))
+	}
+
+	//类型节点: 父节点为 0 时由类型目录组织
+	for _, t := range []struct {
+		parent, id, class uint32
+		name              string
+		isAbstract        bool
+		folder            uint32
+	}{
+		{0, ua.IDBaseObjectType, ua.NodeClassObjectType, "BaseObjectType", false, ua.IDObjectTypesFolder},
+		{ua.IDBaseObjectType, ua.IDFolderType, ua.NodeClassObjectType, "FolderType", false, 0},
+		{ua.IDBaseObjectType, ua.IDServerType, ua.NodeClassObjectType, "ServerType", false, 0},
+		{0, ua.IDBaseVariableType, ua.NodeClassVariableType, "BaseVariableType", true, ua.IDVariableTypesFolder},
+		{ua.IDBaseVariableType, ua.IDBaseDataVariableType, ua.NodeClassVariableType, "BaseDataVariableType", false, 0},
+		{ua.IDBaseVariableType, ua.IDPropertyType, ua.NodeClassVariableType, "PropertyType", false, 0},
+		{ua.IDBaseDataVariableType, ua.IDServerStatusType, ua.NodeClassVariableType, "ServerStatusType", false, 0},
+		{0, ua.IDBaseDataType, ua.NodeClassDataType, "BaseDataType", true, ua.IDDataTypesFolder},
+		{ua.IDBaseDataType, ua.IDBoolean, ua.NodeClassDataType, "Boolean", false, 0},
+		{ua.IDBaseDataType, ua.IDNumber, ua.NodeClassDataType, "Number", true, 0},
+		{ua.IDNumber, ua.IDInteger, ua.NodeClassDataType, "Integer", true, 0},
+		{ua.IDNumber, ua.IDUInteger, ua.NodeClassDataType, "UInteger", true, 0},
+		{ua.IDInteger, ua.IDSByte, ua.NodeClassDataType, "SByte", false, 0},
+		{ua.IDInteger, ua.IDInt16, ua.NodeClassDataType, "Int16", false, 0},
+		{ua.IDInteger, ua.IDInt32, ua.NodeClassDataType, "Int32", false, 0},
+		{ua.IDInteger, ua.IDInt64, ua.NodeClassDataType, "Int64", false, 0},
+		{ua.IDUInteger, ua.IDByte, ua.NodeClassDataType, "Byte", false, 0},
+		{ua.IDUInteger, ua.IDUInt16, ua.NodeClassDataType, "UInt16", false, 0},
+		{ua.IDUInteger, ua.IDUInt32, ua.NodeClassDataType, "UInt32", false, 0},
+		{ua.IDUInteger, ua.IDUInt64, ua.NodeClassDataType, "UInt64", false, 0},
+		{ua.IDNumber, ua.IDFloat, ua.NodeClassDataType, "Float", false, 0},
+		{ua.IDNumber, ua.IDDouble, ua.NodeClassDataType, "Double", false, 0},
+		{ua.IDDouble, ua.IDDuration, ua.NodeClassDataType, "Duration", false, 0},
+		{ua.IDBaseDataType, ua.IDString, ua.NodeClassDataType, "String", false, 0},
+		{ua.IDBaseDataType, ua.IDDateTime, ua.NodeClassDataType, "DateTime", false, 0},
+		{ua.IDBaseDataType, ua.IDStructure, ua.NodeClassDataType, "Structure", true, 0},
+		{ua.IDStructure, ua.IDServerStatusDataType, ua.NodeClassDataType, "ServerStatusDataType", false, 0},
+		{0, ua.IDReferences, ua.NodeClassReferenceType, "References", true, ua.IDReferenceTypesFolder},
+	} {
+		if t.parent == 0 {
+			s.add(ns0(t.folder), ua.IDOrganizes, typeNode(t.id, t.class, t.name, t.isAbstract))
+		} else {
+			s.add(ns0(t.parent), ua.IDHasSubtype, typeNode(t.id, t.class, t.name, t.isAbstract))
+		}
+	}
+	for _, r := range []struct {
+		id          uint32
+		name        string
+		inverseName string
+		isAbstract  bool
+	}{
+		{ua.IDHierarchicalReferences, "HierarchicalReferences", "", true},
+		{ua.IDNonHierarchicalReferences, "NonHierarchicalReferences", "", true},
+		{ua.IDHasChild, "HasChild", "", true},
+		{ua.IDOrganizes, "Organizes", "OrganizedBy", false},
+		{ua.IDHasTypeDefinition, "HasTypeDefinition", "TypeDefinitionOf", false},
+		{ua.IDAggregates, "Aggregates", "", true},
+		{ua.IDHasSubtype, "HasSubtype", "SubtypeOf", false},
+		{ua.IDHasComponent, "HasComponent", "ComponentOf", false},
+		{ua.IDHasProperty, "HasProperty", "PropertyOf", false},
+	} {
+		n := typeNode(r.id, ua.NodeClassReferenceType, r.name, r.isAbstract)
+		n.inverseName = r.inverseName
+		s.add(ns0(referenceParents[r.id]), ua.IDHasSubtype, n)
+	}
+	s.nodes[ns0(ua.IDReferences)].symmetric = true
+
+	//Server 对象
+	s.add(ns0(ua.IDObjectsFolder), ua.IDOrganizes, objectNode(ns0(ua.IDServer), "Server", ua.IDServerType))
+	serverArray := variableNode(ns0(ua.IDServerServerArray), "ServerArray", ua.IDString, ua.IDPropertyType)
+	serverArray.elements = 1
+	serverArray.value = func() interface{} { return []string{ApplicationURI} }
+	s.add(ns0(ua.IDServer), ua.IDHasProperty, serverArray)
+	namespaces := variableNode(ns0(ua.IDServerNamespaceArray), "NamespaceArray", ua.IDString, ua.IDPropertyType)
+	namespaces.elements = 2
+	namespaces.value = func() interface{} { return []string{"http://opcfoundation.org/UA/", NamespaceURI} }
+	s.add(ns0(ua.IDServer), ua.IDHasProperty, namespaces)
+	status := variableNode(ns0(ua.IDServerServerStatus), "ServerStatus", ua.IDServerStatusDataType, ua.IDServerStatusType)
+	status.value = func() interface{} { return ua.NewExtensionObject(server.status()) }
+	s.add(ns0(ua.IDServer), ua.IDHasComponent, status)
+	startTime := variableNode(ns0(ua.IDServerServerStatusStartTime), "StartTime", ua.IDDateTime, ua.IDBaseDataVariableType)
+	startTime.value = func() interface{} { return server.status().StartTime }
+	s.add(status.id, ua.IDHasComponent, startTime)
+	currentTime := variableNode(ns0(ua.IDServerServerStatusCurrentTime), "CurrentTime", ua.IDDateTime, ua.IDBaseDataVariableType)
+	currentTime.value = func() interface{} { return server.status().CurrentTime }
+	s.add(status.id, ua.IDHasComponent, currentTime)
+	//ServerState 枚举，0 为 Running
+	state := variableNode(ns0(ua.IDServerServerStatusState), "State", ua.IDServerState, ua.IDBaseDataVariableType)
+	state.value = func() interface{} { return int32(server.status().State) }
+	s.add(status.id, ua.IDHasComponent, state)
+}
+
+//loader 读取 PLC 的标签列表与结构体模板，生成一个 PLC 的地址空间
+type loader struct {
+	plc         *gologix.PLC
+	name        string
+	space       *space
+	maxElements int  //结构体数组展开的最大元素数量
+	readOnly    bool //不允许写入
+}
+
+//tagID 标签节点标识: PLC 名称/标签路径
+func tagID(plc string, tag string) ua.NodeID {
+	return ua.NewStringNodeID(1, plc+"/"+tag)
+}
+
+//load 添加控制器标签与程序标签，程序作为目录
+func (l *loader) load() error {
+	root := ua.NewStringNodeID(1, l.name)
+	l.space.add(ua.NodeID{}, 0, folderNode(root, l.name))
+	symbols, err := l.plc.ListTags("")
+	if err != nil {
+		return err
+	}
+	for _, symbol := range symbols {
+		if !strings.HasPrefix(symbol.Name, "Program:") {
+			if err = l.addSymbol(root, symbol, symbol.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		program := tagID(l.name, symbol.Name)
+		l.space.add(root, ua.IDOrganizes, folderNode(program, symbol.Name))
+		items, err := l.plc.ListTags(symbol.Name)
+		if err != nil {
+			if !l.plc.Connected() {
+				return err
+			}
+			continue
+		}
+		for _, item := range items {
+			if err = l.addSymbol(program, item, strings.TrimPrefix(item.Name, symbol.Name+".")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//addSymbol 添加一个标签，跳过系统标签、隐藏标签与模块等非数据符号
+func (l *loader) addSymbol(parent ua.NodeID, symbol *gologix.SymbolInfo, name string) error {
+	if symbol.System || strings.HasPrefix(name, "__") || strings.Contains(name, ":") {
+		return nil
+	}
+	return l.addValue(parent, ua.IDOrganizes, symbol.Name, name, symbol.DType, symbol.TemplateID, symbol.Dims, 0)
+}
+
+//addValue 添加标签或结构体成员: 基本类型与字符串为变量，结构体为对象，结构体数组按元素展开
+func (l *loader) addValue(parent ua.NodeID, refType uint32, tag string, name string, dtype types.DataType, templateID uint16, dims []uint32, depth int) error {
+	count := 1
+	for _, dim := range dims {
+		count *= int(dim)
+	}
+	id := tagID(l.name, tag)
+	dataType := dataTypeOf(dtype)
+	var template *gologix.Template
+	if dtype == types.STRUCT {
+		var err error
+		if template, err = l.plc.ReadTemplate(templateID); err != nil {
+			if !l.plc.Connected() {
+				return err
+			}
+			return nil
+		}
+		if template.IsString() {
+			dataType = ua.IDString
+		}
+	}
+	if dataType != 0 {
+		if count > math.MaxUint16 {
+			return nil
+		}
+		n := variableNode(id, name, dataType, ua.IDBaseDataVariableType)
+		n.plc, n.tag = l.name, tag
+		n.writable = !l.readOnly && dtype != types.BIT_STRING
+		if len(dims) > 0 {
+			n.elements = uint16(count)
+		}
+		if template != nil {
+			n.description = template.Name
+		} else {
+			n.description = dtype.String()
+		}
+		l.space.add(parent, refType, n)
+		return nil
+	}
+	if template == nil || depth >= maxDepth {
+		return nil
+	}
+	object := objectNode(id, name, ua.IDBaseObjectType)
+	object.description = template.Name
+	l.space.add(parent, refType, object)
+	if len(dims) > 0 {
+		for i := 0; i < count && i < l.maxElements; i++ {
+			index := elementIndex(dims, i)
+			if err := l.addValue(id, ua.IDHasComponent, tag+index, index, dtype, templateID, nil, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, member := range template.Members {
+		if member.Hidden {
+			continue
+		}
+		var memberDims []uint32
+		if member.ArraySize > 0 {
+			memberDims = []uint32{uint32(member.ArraySize)}
+		}
+		if member.DType == types.BIT_STRING {
+			memberDims = []uint32{uint32(member.ArraySize) * 32}
+		}
+		err := l.addValue(id, ua.IDHasComponent, tag+"."+member.Name, member.Name, member.DType, member.TemplateID, memberDims, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,599 @@
+package opcua
+
+import (
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/ua"
+	"reflect"
+	"sort"
+	"time"
+)
+
+//monitoredItem 监视项，队列长度为 1，只保留最新的变化
+type monitoredItem struct {
+	id         uint32
+	sub        *subscription
+	handle     uint32
+	node       *node
+	attribute  uint32
+	mode       uint32
+	interval   time.Duration
+	timestamps uint32
+	watch      *gologix.Subscription //PLC 标签数值的订阅；为空时在订阅周期内采样
+	latest     *ua.DataValue         //订阅最近的结果，停用期间也更新
+	last       *ua.DataValue
+	pending    *ua.DataValue
+}
+
+//subscription 订阅
+type subscription struct {
+	id               uint32
+	session          *session
+	interval         time.Duration
+	lifetime         uint32
+	keepAlive        uint32
+	maxNotifications uint32
+	enabled          bool
+	items            map[uint32]*monitoredItem
+	sequence         uint32
+	idle             uint32 //未发送消息的周期数
+	starved          uint32 //没有 Publish 请求的周期数
+	late             bool
+	sent             []ua.NotificationMessage //等待确认的消息
+	stop             chan struct{}
+}
+
+//publishRequest 排队的 Publish 请求
+type publishRequest struct {
+	conn      *ua.Conn
+	requestID uint32
+	header    ua.RequestHeader
+	results   []ua.StatusCode
+	deadline  time.Time
+}
+
+//outgoing 持有 s.mutex 时生成、解锁后发送的应答
+type outgoing struct {
+	conn      *ua.Conn
+	requestID uint32
+	response  interface{}
+}
+
+func (s *Server) deliver(out []outgoing) {
+	for _, o := range out {
+		if err := s.send(o.conn, o.requestID, ua.MessageService, o.response); err != nil {
+			s.Logger.Println("发送 OPC UA 应答失败", err)
+		}
+	}
+}
+
+//isTag 是否监视 PLC 标签的数值，标签数值由订阅引擎采样
+func (item *monitoredItem) isTag() bool {
+	return item.node.plc != "" && item.attribute == ua.AttrValue
+}
+
+//update 记录采样值，数值或状态变化时放入队列
+func (item *monitoredItem) update(value ua.DataValue) {
+	if item.last != nil && item.last.Status == value.Status && reflect.DeepEqual(item.last.Value, value.Value) {
+		return
+	}
+	item.last = &value
+	if item.mode == ua.MonitoringReporting {
+		item.pending = &value
+	}
+}
+
+//revise 修正订阅参数，保活次数至少为 1，生存期至少为保活次数的 3 倍
+func (sub *subscription) revise(interval float64, lifetime, keepAlive, maxNotifications uint32) {
+	sub.interval = time.Duration(interval * float64(time.Millisecond))
+	if sub.interval < minPublishInterval {
+		sub.interval = minPublishInterval
+	}
+	if keepAlive == 0 {
+		keepAlive = 10
+	}
+	if lifetime < 3*keepAlive {
+		lifetime = 3 * keepAlive
+	}
+	sub.keepAlive, sub.lifetime, sub.maxNotifications = keepAlive, lifetime, maxNotifications
+}
+
+func (s *Server) createSubscription(sess *session, r *ua.CreateSubscriptionRequest) interface{} {
+	s.mutex.Lock()
+	sub := &subscription{
+		id:      s.newID(),
+		session: sess,
+		enabled: r.PublishingEnabled,
+		items:   make(map[uint32]*monitoredItem),
+		stop:    make(chan struct{}),
+	}
+	sub.revise(r.RequestedPublishingInterval, r.RequestedLifetimeCount, r.RequestedMaxKeepAliveCount, r.MaxNotificationsPerPublish)
+	sess.subscriptions[sub.id] = sub
+	s.wait.Add(1)
+	go s.runSubscription(sub)
+	s.mutex.Unlock()
+	return &ua.CreateSubscriptionResponse{
+		ResponseHeader:            responseHeader(r, ua.StatusGood),
+		SubscriptionID:            sub.id,
+		RevisedPublishingInterval: float64(sub.interval / time.Millisecond),
+		RevisedLifetimeCount:      sub.lifetime,
+		RevisedMaxKeepAliveCount:  sub.keepAlive,
+	}
+}
+
+func (s *Server) modifySubscription(sess *session, r *ua.ModifySubscriptionRequest) interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub, ok := sess.subscriptions[r.SubscriptionID]
+	if !ok {
+		return fault(r, ua.StatusBadSubscriptionIDInvalid)
+	}
+	sub.revise(r.RequestedPublishingInterval, r.RequestedLifetimeCount, r.RequestedMaxKeepAliveCount, r.MaxNotificationsPerPublish)
+	return &ua.ModifySubscriptionResponse{
+		ResponseHeader:            responseHeader(r, ua.StatusGood),
+		RevisedPublishingInterval: float64(sub.interval / time.Millisecond),
+		RevisedLifetimeCount:      sub.lifetime,
+		RevisedMaxKeepAliveCount:  sub.keepAlive,
+	}
+}
+
+func (s *Server) setPublishingMode(sess *session, r *ua.SetPublishingModeRequest) interface{} {
+	if len(r.SubscriptionIDs) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	results := make([]ua.StatusCode, len(r.SubscriptionIDs))
+	for i, id := range r.SubscriptionIDs {
+		if sub, ok := sess.subscriptions[id]; ok {
+			sub.enabled = r.PublishingEnabled
+		} else {
+			results[i] = ua.StatusBadSubscriptionIDInvalid
+		}
+	}
+	return &ua.SetPublishingModeResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+func (s *Server) deleteSubscriptions(sess *session, r *ua.DeleteSubscriptionsRequest) interface{} {
+	if len(r.SubscriptionIDs) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	s.mutex.Lock()
+	results := make([]ua.StatusCode, len(r.SubscriptionIDs))
+	for i, id := range r.SubscriptionIDs {
+		if sub, ok := sess.subscriptions[id]; ok {
+			s.deleteSubscription(sub)
+		} else {
+			results[i] = ua.StatusBadSubscriptionIDInvalid
+		}
+	}
+	out := s.noSubscription(sess)
+	s.mutex.Unlock()
+	s.deliver(out)
+	return &ua.DeleteSubscriptionsResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+//deleteSubscription 停止订阅并删除监视项，调用时持有 s.mutex
+func (s *Server) deleteSubscription(sub *subscription) {
+	for _, item := range sub.items {
+		s.leave(item)
+	}
+	close(sub.stop)
+	delete(sub.session.subscriptions, sub.id)
+}
+
+//noSubscription 会话没有订阅时应答排队的 Publish 请求
+func (s *Server) noSubscription(sess *session) []outgoing {
+	if len(sess.subscriptions) > 0 {
+		return nil
+	}
+	var out []outgoing
+	for _, p := range sess.publishes {
+		out = append(out, outgoing{conn: p.conn, requestID: p.requestID, response: fault(&p.header, ua.StatusBadNoSubscription)})
+	}
+	sess.publishes = nil
+	return out
+}
+
+//join 订阅 PLC 标签的监视项，相同 PLC 与采样间隔的监视项由订阅引擎合并为一次批量读取，调用时持有 s.mutex
+func (s *Server) join(item *monitoredItem) {
+	watcher, ok := s.watchers[item.node.plc]
+	if !ok {
+		client, err := s.manager.Client(item.node.plc)
+		if err != nil {
+			return
+		}
+		watcher = gologix.NewSubscriber(client, 0)
+		watcher.Start()
+		s.watchers[item.node.plc] = watcher
+	}
+	var watch *gologix.Subscription
+	options := gologix.SubscribeOptions{Elements: elementsOf(item.node)}
+	watch, err := watcher.Add([]string{item.node.tag}, item.interval, options, func(events []gologix.ChangeEvent) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		//回调期间监视项可能已被删除或改为其它采样间隔
+		if item.watch != watch {
+			return
+		}
+		for _, event := range events {
+			value := tagValue(item.node, event.Values, event.Err, event.Time)
+			item.latest = &value
+			if item.mode != ua.MonitoringDisabled {
+				item.update(value)
+			}
+		}
+	})
+	if err != nil {
+		s.Logger.Println("订阅标签失败", item.node.tag, err)
+		return
+	}
+	item.watch = watch
+}
+
+//leave 取消监视项的订阅，调用时持有 s.mutex
+func (s *Server) leave(item *monitoredItem) {
+	if item.watch == nil {
+		return
+	}
+	if watcher, ok := s.watchers[item.node.plc]; ok {
+		watcher.Remove(item.watch)
+	}
+	item.watch, item.latest = nil, nil
+}
+
+//runSubscription 按发布间隔采样本地节点并发送通知
+func (s *Server) runSubscription(sub *subscription) {
+	defer s.wait.Done()
+	s.mutex.Lock()
+	interval := sub.interval
+	s.mutex.Unlock()
+	for {
+		select {
+		case <-sub.stop:
+			return
+		case <-s.done:
+			return
+		case <-time.After(interval):
+		}
+		s.mutex.Lock()
+		for _, item := range sub.items {
+			if !item.isTag() && item.mode != ua.MonitoringDisabled {
+				item.update(s.attribute(item.node, item.attribute))
+			}
+		}
+		out := s.tick(sub)
+		interval = sub.interval
+		s.mutex.Unlock()
+		s.deliver(out)
+	}
+}
+
+//tick 发布周期：有通知或达到保活次数时应答一个 Publish 请求，
+//没有请求时标记为延迟，超过生存期删除订阅。调用时持有 s.mutex
+func (s *Server) tick(sub *subscription) []outgoing {
+	if _, ok := sub.session.subscriptions[sub.id]; !ok {
+		return nil
+	}
+	if !sub.late && !sub.notifying() && sub.idle+1 < sub.keepAlive {
+		sub.idle++
+		return nil
+	}
+	if out := s.flush(sub); out != nil {
+		return []outgoing{*out}
+	}
+	sub.late = true
+	sub.starved++
+	if sub.starved >= sub.lifetime {
+		sess := sub.session
+		s.deleteSubscription(sub)
+		return s.noSubscription(sess)
+	}
+	return nil
+}
+
+//notifying 是否有待发送的通知
+func (sub *subscription) notifying() bool {
+	if !sub.enabled {
+		return false
+	}
+	for _, item := range sub.items {
+		if item.pending != nil {
+			return true
+		}
+	}
+	return false
+}
+
+//flush 使用最早的 Publish 请求发送通知或保活消息，没有请求时返回 nil。调用时持有 s.mutex
+func (s *Server) flush(sub *subscription) *outgoing {
+	sess := sub.session
+	if len(sess.publishes) == 0 {
+		return nil
+	}
+	p := sess.publishes[0]
+	sess.publishes = sess.publishes[1:]
+	sub.late, sub.idle, sub.starved = false, 0, 0
+	now := time.Now()
+	message := ua.NotificationMessage{SequenceNumber: sub.sequence + 1, PublishTime: now}
+	more := false
+	if sub.enabled {
+		ids := make([]uint32, 0, len(sub.items))
+		for id, item := range sub.items {
+			if item.pending != nil {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		if sub.maxNotifications > 0 && len(ids) > int(sub.maxNotifications) {
+			ids, more = ids[:sub.maxNotifications], true
+		}
+		if len(ids) > 0 {
+			notification := &ua.DataChangeNotification{}
+			for _, id := range ids {
+				item := sub.items[id]
+				notification.MonitoredItems = append(notification.MonitoredItems, ua.MonitoredItemNotification{
+					ClientHandle: item.handle,
+					Value:        stamp(*item.pending, item.timestamps),
+				})
+				item.pending = nil
+			}
+			sub.sequence++
+			message.NotificationData = []ua.ExtensionObject{*ua.NewExtensionObject(notification)}
+			sub.sent = append(sub.sent, message)
+			if len(sub.sent) > maxRetransmit {
+				sub.sent = sub.sent[len(sub.sent)-maxRetransmit:]
+			}
+		}
+	}
+	available := make([]uint32, len(sub.sent))
+	for i, sent := range sub.sent {
+		available[i] = sent.SequenceNumber
+	}
+	return &outgoing{conn: p.conn, requestID: p.requestID, response: &ua.PublishResponse{
+		ResponseHeader:           ua.ResponseHeader{Timestamp: now, RequestHandle: p.header.RequestHandle},
+		SubscriptionID:           sub.id,
+		AvailableSequenceNumbers: available,
+		MoreNotifications:        more,
+		NotificationMessage:      message,
+		Results:                  p.results,
+	}}
+}
+
+//publish 确认已收到的消息并排队，延迟的订阅立即应答
+func (s *Server) publish(sess *session, conn *ua.Conn, requestID uint32, r *ua.PublishRequest) interface{} {
+	s.mutex.Lock()
+	if len(sess.subscriptions) == 0 {
+		s.mutex.Unlock()
+		return fault(r, ua.StatusBadNoSubscription)
+	}
+	if len(sess.publishes) >= maxPublishRequests {
+		s.mutex.Unlock()
+		return fault(r, ua.StatusBadTooManyPublishRequests)
+	}
+	results := make([]ua.StatusCode, len(r.SubscriptionAcknowledgements))
+	for i, ack := range r.SubscriptionAcknowledgements {
+		sub, ok := sess.subscriptions[ack.SubscriptionID]
+		if !ok {
+			results[i] = ua.StatusBadSubscriptionIDInvalid
+			continue
+		}
+		results[i] = ua.StatusBadSequenceNumberUnknown
+		for j, sent := range sub.sent {
+			if sent.SequenceNumber == ack.SequenceNumber {
+				sub.sent = append(sub.sent[:j:j], sub.sent[j+1:]...)
+				results[i] = ua.StatusGood
+				break
+			}
+		}
+	}
+	sess.publishes = append(sess.publishes, &publishRequest{
+		conn:      conn,
+		requestID: requestID,
+		header:    r.RequestHeader,
+		results:   results,
+		deadline:  parseTimeout(&r.RequestHeader),
+	})
+	ids := make([]uint32, 0, len(sess.subscriptions))
+	for id, sub := range sess.subscriptions {
+		if sub.late {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var out []outgoing
+	for _, id := range ids {
+		if o := s.flush(sess.subscriptions[id]); o != nil {
+			out = append(out, *o)
+		}
+	}
+	s.mutex.Unlock()
+	s.deliver(out)
+	return nil
+}
+
+func (s *Server) republish(sess *session, r *ua.RepublishRequest) interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub, ok := sess.subscriptions[r.SubscriptionID]
+	if !ok {
+		return fault(r, ua.StatusBadSubscriptionIDInvalid)
+	}
+	for _, sent := range sub.sent {
+		if sent.SequenceNumber == r.RetransmitSequenceNumber {
+			return &ua.RepublishResponse{ResponseHeader: responseHeader(r, ua.StatusGood), NotificationMessage: sent}
+		}
+	}
+	return fault(r, ua.StatusBadMessageNotAvailable)
+}
+
+//samplingInterval 修正采样间隔，负数使用发布间隔
+func samplingInterval(sub *subscription, requested float64) time.Duration {
+	interval := time.Duration(requested * float64(time.Millisecond))
+	if requested < 0 {
+		interval = sub.interval
+	}
+	if interval < minSamplingInterval {
+		interval = minSamplingInterval
+	}
+	return interval
+}
+
+func (s *Server) createMonitoredItems(sess *session, r *ua.CreateMonitoredItemsRequest) interface{} {
+	if len(r.ItemsToCreate) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	if r.TimestampsToReturn > ua.TimestampsNeither {
+		return fault(r, ua.StatusBadTimestampsToReturnInvalid)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub, ok := sess.subscriptions[r.SubscriptionID]
+	if !ok {
+		return fault(r, ua.StatusBadSubscriptionIDInvalid)
+	}
+	results := make([]ua.MonitoredItemCreateResult, len(r.ItemsToCreate))
+	for i, create := range r.ItemsToCreate {
+		n := s.space.get(create.ItemToMonitor.NodeID)
+		isTag := n != nil && n.plc != "" && create.ItemToMonitor.AttributeID == ua.AttrValue
+		switch {
+		case n == nil:
+			results[i].StatusCode = ua.StatusBadNodeIDUnknown
+			continue
+		case !isTag && s.attribute(n, create.ItemToMonitor.AttributeID).Status == ua.StatusBadAttributeIDInvalid:
+			results[i].StatusCode = ua.StatusBadAttributeIDInvalid
+			continue
+		case create.ItemToMonitor.IndexRange != "":
+			results[i].StatusCode = ua.StatusBadIndexRangeInvalid
+			continue
+		case create.MonitoringMode > ua.MonitoringReporting:
+			results[i].StatusCode = ua.StatusBadMonitoringModeInvalid
+			continue
+		case create.RequestedParameters.Filter.Body != nil:
+			//只支持默认的数值与状态变化触发
+			results[i].StatusCode = ua.StatusBadFilterNotAllowed
+			continue
+		}
+		item := &monitoredItem{
+			id:         s.newID(),
+			sub:        sub,
+			handle:     create.RequestedParameters.ClientHandle,
+			node:       n,
+			attribute:  create.ItemToMonitor.AttributeID,
+			mode:       create.MonitoringMode,
+			interval:   samplingInterval(sub, create.RequestedParameters.SamplingInterval),
+			timestamps: r.TimestampsToReturn,
+		}
+		sub.items[item.id] = item
+		if isTag {
+			s.join(item)
+		}
+		results[i] = ua.MonitoredItemCreateResult{
+			MonitoredItemID:         item.id,
+			RevisedSamplingInterval: float64(item.interval / time.Millisecond),
+			RevisedQueueSize:        1,
+		}
+	}
+	return &ua.CreateMonitoredItemsResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+func (s *Server) modifyMonitoredItems(sess *session, r *ua.ModifyMonitoredItemsRequest) interface{} {
+	if len(r.ItemsToModify) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	if r.TimestampsToReturn > ua.TimestampsNeither {
+		return fault(r, ua.StatusBadTimestampsToReturnInvalid)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub, ok := sess.subscriptions[r.SubscriptionID]
+	if !ok {
+		return fault(r, ua.StatusBadSubscriptionIDInvalid)
+	}
+	results := make([]ua.MonitoredItemModifyResult, len(r.ItemsToModify))
+	for i, modify := range r.ItemsToModify {
+		item, ok := sub.items[modify.MonitoredItemID]
+		switch {
+		case !ok:
+			results[i].StatusCode = ua.StatusBadMonitoredItemIDInvalid
+			continue
+		case modify.RequestedParameters.Filter.Body != nil:
+			results[i].StatusCode = ua.StatusBadFilterNotAllowed
+			continue
+		}
+		item.handle = modify.RequestedParameters.ClientHandle
+		item.timestamps = r.TimestampsToReturn
+		interval := samplingInterval(sub, modify.RequestedParameters.SamplingInterval)
+		if interval != item.interval {
+			item.interval = interval
+			if item.isTag() {
+				s.leave(item)
+				s.join(item)
+			}
+		}
+		results[i] = ua.MonitoredItemModifyResult{RevisedSamplingInterval: float64(item.interval / time.Millisecond), RevisedQueueSize: 1}
+	}
+	return &ua.ModifyMonitoredItemsResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+func (s *Server) setMonitoringMode(sess *session, r *ua.SetMonitoringModeRequest) interface{} {
+	if len(r.MonitoredItemIDs) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	if r.MonitoringMode > ua.MonitoringReporting {
+		return fault(r, ua.StatusBadMonitoringModeInvalid)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub, ok := sess.subscriptions[r.SubscriptionID]
+	if !ok {
+		return fault(r, ua.StatusBadSubscriptionIDInvalid)
+	}
+	results := make([]ua.StatusCode, len(r.MonitoredItemIDs))
+	for i, id := range r.MonitoredItemIDs {
+		item, ok := sub.items[id]
+		if !ok {
+			results[i] = ua.StatusBadMonitoredItemIDInvalid
+			continue
+		}
+		item.mode = r.MonitoringMode
+		switch item.mode {
+		case ua.MonitoringDisabled:
+			//重新启用时报告当前值
+			item.last, item.pending = nil, nil
+		case ua.MonitoringSampling:
+			item.pending = nil
+		case ua.MonitoringReporting:
+			if item.pending == nil {
+				item.pending = item.last
+			}
+		}
+		//停用期间订阅只在变化时通知，重新启用时使用最近的结果
+		if item.mode != ua.MonitoringDisabled && item.last == nil && item.latest != nil {
+			item.update(*item.latest)
+		}
+	}
+	return &ua.SetMonitoringModeResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
+
+func (s *Server) deleteMonitoredItems(sess *session, r *ua.DeleteMonitoredItemsRequest) interface{} {
+	if len(r.MonitoredItemIDs) == 0 {
+		return fault(r, ua.StatusBadNothingToDo)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sub, ok := sess.subscriptions[r.SubscriptionID]
+	if !ok {
+		return fault(r, ua.StatusBadSubscriptionIDInvalid)
+	}
+	results := make([]ua.StatusCode, len(r.MonitoredItemIDs))
+	for i, id := range r.MonitoredItemIDs {
+		item, ok := sub.items[id]
+		if !ok {
+			results[i] = ua.StatusBadMonitoredItemIDInvalid
+			continue
+		}
+		s.leave(item)
+		delete(sub.items, id)
+	}
+	return &ua.DeleteMonitoredItemsResponse{ResponseHeader: responseHeader(r, ua.StatusGood), Results: results}
+}
@@ -0,0 +1,225 @@
+package gologix
+
+import (
+	"errors"
+	"github.com/wj008/gologix/lib"
+	"sort"
+	"sync"
+)
+
+const (
+	unconnectedMessageSize = 504 //非链接消息最大长度
+	multiRequestHeaderSize = 8   //批量请求头: 服务、路径与数量
+	multiReplyHeaderSize   = 6   //批量应答头: 应答头与数量
+	multiItemHeaderSize    = 8   //单项应答: 偏移量、应答头与数据类型
+)
+
+//ReadPlan 批量读取计划，每个数据包内的标签通过一次请求读取
+type ReadPlan struct {
+	Packets      [][]ReadRequest
+	RequestSizes []int                //每个数据包的预计请求长度
+	ReplySizes   []int                //每个数据包的预计应答长度
+	Errors       map[string]*TagError //无法读取类型的标签，执行计划时作为该标签的结果返回
+	solo         []bool
+}
+
+//planItem 单个标签的计划信息
+type planItem struct {
+	request     ReadRequest
+	requestSize int
+	replySize   int
+	solo        bool
+	failed      bool
+}
+
+//messageSize 单个请求或应答允许的最大长度
+func (p *PLC) messageSize() int {
+	if p.ForwardOpened() && p.ConnectionSize > 0 {
+		//链接数据包含2字节序号
+		return int(p.ConnectionSize) - 2
+	}
+	return unconnectedMessageSize
+}
+
+//PlanMultiRead 按请求与应答长度装箱，生成数据包数量最少的读取计划
+func (p *PLC) PlanMultiRead(tagList []string) (*ReadPlan, error) {
+	requests := make([]ReadRequest, 0, len(tagList))
+	for _, tagName := range tagList {
+		requests = append(requests, ReadRequest{Tag: tagName, Elements: 1})
+	}
+	return p.PlanReadRequests(requests)
+}
+
+//PlanReadRequests 生成多元素批量读取计划，同一标签重复请求时取最大元素数量，标签不存在等错误记录在 Errors 中
+func (p *PLC) PlanReadRequests(requests []ReadRequest) (*ReadPlan, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("发送的数据为空")
+	}
+	limit := p.messageSize()
+	items := make([]*planItem, 0, len(requests))
+	seen := make(map[string]*planItem)
+	for _, request := range requests {
+		if request.Elements == 0 {
+			request.Elements = 1
+		}
+		if item, ok := seen[request.Tag]; ok {
+			if request.Elements > item.request.Elements {
+				item.request.Elements = request.Elements
+			}
+			continue
+		}
+		item := &planItem{request: request}
+		seen[request.Tag] = item
+		items = append(items, item)
+	}
+	plan := &ReadPlan{}
+	for _, item := range items {
+		baseTag, _ := lib.ParseTagName(item.request.Tag)
+		dataType, err := p.ReadPartialTag(baseTag)
+		if err != nil {
+			tagErr := p.tagFailure(item.request.Tag, err)
+			if tagErr == nil {
+				return nil, err
+			}
+			if plan.Errors == nil {
+				plan.Errors = make(map[string]*TagError)
+			}
+			plan.Errors[item.request.Tag] = tagErr
+			item.failed = true
+			continue
+		}
+		p.mutex.Lock()
+		size := p.knownSizes[baseTag]
+		p.mutex.Unlock()
+		readRequest, words := buildReadRequest(item.request.Tag, dataType, item.request.Elements)
+		item.requestSize = len(readRequest) + 2
+		item.replySize = multiItemHeaderSize + size*int(words)
+		//长度未知或单独超出长度的标签单独读取，由分段读取补齐
+		item.solo = size == 0 ||
+			item.requestSize+multiRequestHeaderSize > limit ||
+			item.replySize+multiReplyHeaderSize > limit
+	}
+	//按应答长度从大到小首次适应装箱
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].replySize != items[j].replySize {
+			return items[i].replySize > items[j].replySize
+		}
+		return items[i].requestSize > items[j].requestSize
+	})
+	for _, item := range items {
+		if item.failed {
+			continue
+		}
+		placed := false
+		for i := range plan.Packets {
+			if item.solo || plan.solo[i] {
+				continue
+			}
+			if plan.RequestSizes[i]+item.requestSize <= limit && plan.ReplySizes[i]+item.replySize <= limit {
+				plan.Packets[i] = append(plan.Packets[i], item.request)
+				plan.RequestSizes[i] += item.requestSize
+				plan.ReplySizes[i] += item.replySize
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+		plan.Packets = append(plan.Packets, []ReadRequest{item.request})
+		plan.RequestSizes = append(plan.RequestSizes, multiRequestHeaderSize+item.requestSize)
+		plan.ReplySizes = append(plan.ReplySizes, multiReplyHeaderSize+item.replySize)
+		plan.solo = append(plan.solo, item.solo)
+	}
+	return plan, nil
+}
+
+//readParallelism 并发读取的数据包数量
+func (p *PLC) readParallelism() int {
+	if p.MaxParallelReads > 0 {
+		return p.MaxParallelReads
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	count := 0
+	for _, conn := range p.connections {
+		if !conn.write {
+			count++
+		}
+	}
+	if count == 0 {
+		return 1
+	}
+	return count
+}
+
+//ExecutePlan 并发执行读取计划并合并结果，每个标签取第一个元素
+func (p *PLC) ExecutePlan(plan *ReadPlan) (map[string]*TagValue, error) {
+	results, err := p.executeRequests(plan)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]*TagValue)
+	for name, result := range results {
+		tagValue := &TagValue{Status: result.Status, DType: result.DType, Err: result.Err}
+		if len(result.Values) > 0 {
+			tagValue.Value = result.Values[0]
+		}
+		values[name] = tagValue
+	}
+	return values, nil
+}
+
+//executeRequests 并发执行读取计划，计划中的标签错误合并到结果中
+func (p *PLC) executeRequests(plan *ReadPlan) (map[string]*TagResult, error) {
+	if plan == nil || len(plan.Packets) == 0 && len(plan.Errors) == 0 {
+		return nil, errors.New("发送的数据为空")
+	}
+	values := make(map[string]*TagResult)
+	for name, tagErr := range plan.Errors {
+		values[name] = &TagResult{Status: tagErr.Status, Err: tagErr}
+	}
+	var mutex sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, p.readParallelism())
+	for _, packet := range plan.Packets {
+		wg.Add(1)
+		limiter <- struct{}{}
+		go func(packet []ReadRequest) {
+			defer func() {
+				<-limiter
+				wg.Done()
+			}()
+			result, err := p.multiReadPacket(packet)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for name, value := range result {
+				values[name] = value
+			}
+		}(packet)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return values, nil
+}
+
+//tagFailure 单个标签的错误，链接已断开时返回 nil，由调用方作为整批的错误返回
+func (p *PLC) tagFailure(tag string, err error) *TagError {
+	var tagErr *TagError
+	if errors.As(err, &tagErr) {
+		return tagErr
+	}
+	if !p.Connected() {
+		return nil
+	}
+	return &TagError{Tag: tag, Kind: TagErrorDecode, Err: err}
+}
@@ -0,0 +1,85 @@
+package gologix
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/types"
+	"testing"
+)
+
+func TestPlanMultiRead(t *testing.T) {
+	sim := newSimPLC(t)
+	tags := make([]string, 0, 40)
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("T%02d", i)
+		sim.AddTag(name, types.DINT, []int32{int32(i)})
+		tags = append(tags, name)
+	}
+	plc := connectSim(t, sim, ConnectionOptions{Count: 2})
+	plc.ConnectionSize = 100
+	plan, err := plc.PlanMultiRead(append(tags, "T00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := plc.messageSize()
+	count := 0
+	for i, packet := range plan.Packets {
+		count += len(packet)
+		if plan.RequestSizes[i] > limit || plan.ReplySizes[i] > limit {
+			t.Fatalf("数据包超出长度 %d %d", plan.RequestSizes[i], plan.ReplySizes[i])
+		}
+	}
+	if count != 40 || len(plan.Packets) != 6 {
+		t.Fatalf("计划错误 标签 %d 数据包 %d", count, len(plan.Packets))
+	}
+	values, err := plc.ExecutePlan(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range tags {
+		value, ok := values[name]
+		if !ok || value.Value != int32(i) {
+			t.Fatalf("读取错误 %s %+v", name, value)
+		}
+	}
+}
+
+func TestMultiReadTags(t *testing.T) {
+	sim := newSimPLC(t)
+	trend := make([]int32, 100)
+	for i := range trend {
+		trend[i] = int32(i * 10)
+	}
+	sim.AddTag("Trend", types.DINT, trend)
+	sim.AddTag("Flags", types.DINT, []int32{0x28})
+	sim.AddTag("Bits", types.BIT_STRING, []uint32{0, 0x0000000c})
+	plc := connectSim(t, sim, ConnectionOptions{})
+	results, err := plc.MultiReadTags([]ReadRequest{
+		{Tag: "Trend[0]", Elements: 100},
+		{Tag: "Flags.3", Elements: 3},
+		{Tag: "Bits[33]", Elements: 4},
+		{Tag: "Missing", Elements: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//不存在的标签不影响其他标签
+	var tagErr *TagError
+	if !errors.As(results["Missing"].Err, &tagErr) || tagErr.Kind != TagErrorStatus {
+		t.Fatalf("不存在的标签应返回标签错误 %+v", results["Missing"])
+	}
+	values := results["Trend[0]"].Values
+	if len(values) != 100 || values[99] != int32(990) {
+		t.Fatalf("数组读取错误 %d %v", len(values), values)
+	}
+	want := map[string][]interface{}{
+		"Flags.3":  {true, false, true},
+		"Bits[33]": {false, true, true, false},
+	}
+	for tag, bits := range want {
+		got := results[tag].Values
+		if fmt.Sprint(got) != fmt.Sprint(bits) {
+			t.Fatalf("%s 位读取错误 %v != %v", tag, got, bits)
+		}
+	}
+}
@@ -7,13 +7,15 @@ import (
 	"fmt"
 	"github.com/wj008/gologix/enip"
 	"github.com/wj008/gologix/epath"
+	"github.com/wj008/gologix/epath/segment"
 	"github.com/wj008/gologix/lib"
 	"github.com/wj008/gologix/types"
 	"log"
-	"math/rand"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,12 +23,20 @@ type TagResult struct {
 	Status uint8
 	DType  types.DataType
 	Values []interface{}
+	Err    error //批量读取时单个标签的错误，类型为 *TagError
 }
 
 type TagValue struct {
 	Status uint8
 	DType  types.DataType
 	Value  interface{}
+	Err    error //批量读取时单个标签的错误，类型为 *TagError
+}
+
+//ReadRequest 批量读取请求，Elements 为读取的元素数量
+type ReadRequest struct {
+	Tag      string
+	Elements uint16
 }
 
 type PLCInfo struct {
@@ -44,31 +54,72 @@ type PLCInfo struct {
 
 type PLC struct {
 	net.Conn
-	IsConnected            bool
-	IsRegistered           bool
-	IsForwardOpened        bool
-	Micro800               bool
-	SessionId              uint32
-	SequenceCounter        uint32
-	OnClose                func()
-	sequencePool           map[uint32]func(*enip.Package)
-	contextPool            map[uint64]func(*enip.Package)
-	knownTags              map[string]types.DataType
-	connectionID           uint32
-	ConnectionSize         uint16
-	targetPath             []byte
-	connectionPath         []byte
-	serialId               uint16
-	vendorId               uint16
-	originatorSerialNumber uint32
-	Info                   *PLCInfo
-	Logger                 *log.Logger
+	//Deprecated: 改用 Connected 方法，字段仅为兼容保留，并发读取不安全
+	IsConnected bool
+	//Deprecated: 改用 Registered 方法，字段仅为兼容保留，并发读取不安全
+	IsRegistered bool
+	//Deprecated: 改用 ForwardOpened 方法，字段仅为兼容保留，并发读取不安全
+	IsForwardOpened bool
+	//Deprecated: 每个链接单独计数，字段仅记录最近发送的链接包序号
+	SequenceCounter   uint32
+	connected         bool //以下三个状态由 mutex 保护，通过 Connected 等方法读取
+	registered        bool
+	forwardOpened     bool
+	Micro800          bool
+	SessionId         uint32
+	OnClose           func()
+	OnRequest         func(service string, elapsed time.Duration, err error) //每个请求完成后调用，用于统计耗时与超时
+	sequencePool      map[uint64]func(*enip.Package)
+	contextPool       map[uint64]func(*enip.Package)
+	knownTags         map[string]types.DataType
+	knownSizes        map[string]int
+	templates         map[uint16]*Template
+	stringTypes       map[uint16]*types.StringType
+	symbols           map[string]*SymbolInfo
+	listedScopes      map[string]bool
+	tagInfos          map[string]*TagInfo
+	ConnectionSize    uint16
+	route             epath.Path
+	targetPath        []byte
+	connectionPath    []byte
+	ConnectionOptions ConnectionOptions
+	MaxParallelReads  int  //批量读取时并发的数据包数量 默认为读取链接数量
+	CheckAccess       bool //写入前检查标签的外部访问与常量标志
+	options           ConnectionOptions
+	connections       []*cipConnection
+	nextConnection    uint32
+	contextSeed       uint64
+	mutex             sync.Mutex
+	Info              *PLCInfo
+	Logger            *log.Logger
+	LogJSON           bool
 }
 
 func NewPLC() *PLC {
 	return &PLC{}
 }
 
+//Connected 套接字是否已链接
+func (p *PLC) Connected() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.connected
+}
+
+//Registered 会话是否已注册
+func (p *PLC) Registered() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.registered
+}
+
+//ForwardOpened 是否已打开 ForwardOpen 链接
+func (p *PLC) ForwardOpened() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.forwardOpened
+}
+
 func (p *PLC) Println(v ...interface{}) {
 	if p.Logger != nil {
 		p.Logger.Println(v...)
@@ -77,13 +128,23 @@ func (p *PLC) Println(v ...interface{}) {
 
 func (p *PLC) PrintPackage(tag string, pack *enip.Package) {
 	if p.Logger != nil {
+		p.Logger.Println(tag)
+		tree, err := enip.Dissect(pack.Buffer())
+		if err == nil {
+			if p.LogJSON {
+				out, _ := tree.JSON()
+				p.Logger.Println(string(out))
+			} else {
+				p.Logger.Print(tree.Text())
+			}
+			return
+		}
 		a := fmt.Sprintf("%x", pack.Data)
 		temp := make([]string, 0)
 		for i := 0; i < len(a)/2; i++ {
 			temp = append(temp, a[i*2:i*2+2])
 		}
 		out := strings.Join(temp, " ")
-		p.Logger.Println(tag)
 		p.Logger.Println("Command", pack.Command, "Length", pack.Length, "SessionId", p.SessionId, "ContextId", pack.ContextId, "Status", pack.Status, "Options", pack.Options, "SequenceId", pack.SequenceId, "connectionID", pack.ConnectionID)
 		p.Logger.Println("Data", out)
 	}
@@ -132,7 +193,7 @@ func (p *PLC) readBytes(length int) ([]byte, error) {
 
 //readPackage 读取数据包
 func (p *PLC) readPackage() (*enip.Package, error) {
-	if !p.IsConnected {
+	if !p.Connected() {
 		return nil, errors.New("链接已经关闭，不可读取数据")
 	}
 	header, err := p.readBytes(24)
@@ -154,18 +215,47 @@ func (p *PLC) readPackage() (*enip.Package, error) {
 }
 
 func (p *PLC) newContextId() uint64 {
-	rand.Seed(time.Now().UnixNano())
-	contextId := rand.Uint64()
-	return contextId
+	return atomic.AddUint64(&p.contextSeed, 1)
+}
+
+//newRequestPack 创建请求包，已打开链接时按流量类别选择链接发送，返回是否为链接通道
+func (p *PLC) newRequestPack(request []byte, traffic trafficClass) (*enip.Package, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	conn := p.pickConnection(traffic)
+	if conn == nil {
+		return enip.BuildUnconnectedSend(p.targetPath, request), false
+	}
+	p.SequenceCounter = conn.nextSequence()
+	return enip.BuildUnitData(request, conn.report.OTConnectionID, p.SequenceCounter), true
+}
+
+//pickConnection 轮询选择链接，需持有 mutex
+func (p *PLC) pickConnection(traffic trafficClass) *cipConnection {
+	if !p.forwardOpened || len(p.connections) == 0 {
+		return nil
+	}
+	candidates := make([]*cipConnection, 0, len(p.connections))
+	for _, conn := range p.connections {
+		if conn.write == (traffic == trafficWrite) {
+			candidates = append(candidates, conn)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.connections
+	}
+	p.nextConnection++
+	return candidates[int(p.nextConnection)%len(candidates)]
 }
 
-func (p *PLC) newSequenceId() uint32 {
-	p.SequenceCounter += 1
-	p.SequenceCounter = p.SequenceCounter % 0x10000
-	if p.SequenceCounter == 0 {
-		p.SequenceCounter = 1
+//replyConnectionID 根据发送链接ID取得应答链接ID，需持有 mutex
+func (p *PLC) replyConnectionID(connectionID uint32) uint32 {
+	for _, conn := range p.connections {
+		if conn.report.OTConnectionID == connectionID {
+			return conn.report.TOConnectionID
+		}
 	}
-	return p.SequenceCounter
+	return connectionID
 }
 
 //recvData 接收到新的数据包
@@ -191,10 +281,12 @@ func (p *PLC) recvData(reply *enip.Package) {
 		}
 		//获取到队列地址
 		if reply.SequenceId != 0 {
-			sequenceId := reply.SequenceId
-			if callback, ok := p.sequencePool[sequenceId]; ok && callback != nil {
+			seqKey := sequenceKey(reply.ConnectionID, reply.SequenceId)
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			if callback, ok := p.sequencePool[seqKey]; ok && callback != nil {
 				callback(reply)
-				delete(p.sequencePool, sequenceId)
+				delete(p.sequencePool, seqKey)
 				return
 			}
 		}
@@ -203,6 +295,8 @@ func (p *PLC) recvData(reply *enip.Package) {
 
 	//其余的
 	contextId := reply.ContextId
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 	callback, ok := p.contextPool[contextId]
 	if ok && callback != nil {
 		callback(reply)
@@ -230,50 +324,107 @@ func (p *PLC) accept() {
 	}()
 }
 
-//Connect 发起链接
+//Connect 发起链接 slot 为本地机架槽号
 func (p *PLC) Connect(addr string, slot uint8) (err error) {
+	route := epath.Path{&epath.PortSegment{Port: 1, Link: []byte{slot}}}
+	return p.ConnectPath(addr, route)
+}
+
+//ConnectRoute 按 RSLinx 风格的路由字符串发起链接，例如 "1,0,2,192.168.1.20,1,3"
+func (p *PLC) ConnectRoute(addr string, route string) error {
+	path, err := epath.ParseRoute(route)
+	if err != nil {
+		return err
+	}
+	return p.ConnectPath(addr, path)
+}
+
+//ConnectPath 按路由路径发起链接，路径为空时直接访问目标设备
+func (p *PLC) ConnectPath(addr string, route epath.Path) (err error) {
+	options, err := p.ConnectionOptions.withDefaults(p.Micro800)
+	if err != nil {
+		return
+	}
 	rawConn, err := net.Dial("tcp", addr)
 	if err != nil {
 		return
 	}
 	p.Conn = rawConn
+	p.mutex.Lock()
+	p.connected = true
 	p.IsConnected = true
+	p.mutex.Unlock()
 	p.contextPool = make(map[uint64]func(*enip.Package))
-	p.sequencePool = make(map[uint32]func(*enip.Package))
+	p.sequencePool = make(map[uint64]func(*enip.Package))
+	p.contextSeed = uint64(lib.RandInt64(0x7fffffff)) << 32
 	p.knownTags = make(map[string]types.DataType)
+	p.knownSizes = make(map[string]int)
+	p.templates = make(map[uint16]*Template)
+	p.stringTypes = map[uint16]*types.StringType{types.LogixString.Handle: types.LogixString}
+	p.symbols = make(map[string]*SymbolInfo)
+	p.listedScopes = make(map[string]bool)
+	p.tagInfos = make(map[string]*TagInfo)
 
+	routerPath := segment.Paths(
+		epath.LogicalBuild(epath.LogicalTypeClassID, 0x02, true),
+		epath.LogicalBuild(epath.LogicalTypeInstanceID, 0x01, true),
+	)
+	p.route = route
+	p.targetPath = route.Bytes(true)
 	if p.Micro800 {
-		p.connectionPath = []byte{0x20, 0x02, 0x24, 0x01}
-		p.vendorId = 0x01
+		p.connectionPath = routerPath
 	} else {
-		p.connectionPath = []byte{0x01, slot, 0x20, 0x02, 0x24, 0x01}
-		p.vendorId = 0x1337
+		p.connectionPath = segment.Paths(p.targetPath, routerPath)
 	}
-	p.targetPath = epath.PortBuild([]byte{slot}, 1, true)
-	p.originatorSerialNumber = 42
-	p.SequenceCounter = 0
+	p.options = options
+	p.connections = nil
 	p.Info = &PLCInfo{}
 	p.accept()
 	return
 }
 
-//Close 关闭链接
+//RoutePath 当前链接的路由路径
+func (p *PLC) RoutePath() epath.Path {
+	return p.route
+}
+
+//Close 关闭链接，重复调用时直接返回
 func (p *PLC) Close() error {
+	p.mutex.Lock()
+	if !p.connected {
+		p.mutex.Unlock()
+		return nil
+	}
+	p.connections = nil
+	p.forwardOpened = false
 	p.IsForwardOpened = false
+	p.registered = false
 	p.IsRegistered = false
+	p.connected = false
 	p.IsConnected = false
+	p.mutex.Unlock()
 	if p.OnClose != nil {
 		p.OnClose()
 	}
 	return p.Conn.Close()
 }
 
-//writePack 写入数据包
-func (p *PLC) writePack(pack *enip.Package) (reply *enip.Package, err error) {
-	if !p.IsConnected {
+//writePack 写入数据包，service 为请求名称，用于 OnRequest 统计
+func (p *PLC) writePack(pack *enip.Package, service string) (reply *enip.Package, err error) {
+	if p.OnRequest != nil {
+		start := time.Now()
+		defer func() {
+			p.OnRequest(service, time.Since(start), err)
+		}()
+	}
+	p.mutex.Lock()
+	connected, registered := p.connected, p.registered
+	pack.SessionId = p.SessionId
+	p.mutex.Unlock()
+	if !connected {
 		return nil, errors.New("--链接已经关闭--")
 	}
-	if pack.Command == enip.CommandSendUnitData && !p.IsRegistered {
+	if pack.Command == enip.CommandSendUnitData && !registered {
 		return nil, errors.New("还没有注册链接")
 	}
 	timeout := enip.NewTimeOut(10 * time.Second)
@@ -281,28 +432,31 @@ func (p *PLC) writePack(pack *enip.Package) (reply *enip.Package, err error) {
 		timeout.Write(reply)
 	}
 	contextId := p.newContextId()
-	sequenceId := uint32(0)
+	seqKey := uint64(0)
 	pack.ContextId = contextId
-	pack.SessionId = p.SessionId
 	//数据包写入
+	p.mutex.Lock()
 	if pack.Command == enip.CommandSendUnitData {
-		sequenceId = pack.SequenceId
-		p.sequencePool[sequenceId] = callback
+		seqKey = sequenceKey(p.replyConnectionID(pack.ConnectionID), pack.SequenceId)
+		p.sequencePool[seqKey] = callback
 	} else {
 		p.contextPool[contextId] = callback
 	}
+	p.mutex.Unlock()
 	//如果发生错误
 	errorCall := func() {
 		//写入错误
+		p.mutex.Lock()
 		if pack.Command == enip.CommandSendUnitData {
-			if _, ok := p.sequencePool[sequenceId]; ok {
-				delete(p.sequencePool, sequenceId)
+			if _, ok := p.sequencePool[seqKey]; ok {
+				delete(p.sequencePool, seqKey)
 			}
 		} else {
 			if _, ok := p.contextPool[contextId]; ok {
 				delete(p.contextPool, contextId)
 			}
 		}
+		p.mutex.Unlock()
 		timeout.Close()
 		p.Close()
 	}
@@ -321,20 +475,48 @@ func (p *PLC) writePack(pack *enip.Package) (reply *enip.Package, err error) {
 	return
 }
 
+//serviceName 标签读写请求的 CIP 服务名称，用于 OnRequest 统计
+func serviceName(service uint8) string {
+	switch enip.CIPServType(service) {
+	case enip.ServiceGetAttributeAll:
+		return "get_attributes_all"
+	case enip.ServiceGetAttributeList:
+		return "get_attribute_list"
+	case enip.ServiceMultipleServicePacket:
+		return "multiple_service_packet"
+	case enip.ServiceReadTag:
+		return "read_tag"
+	case enip.ServiceWriteTag:
+		return "write_tag"
+	case enip.ServiceReadTagFragmented:
+		return "read_tag_fragmented"
+	case enip.ServiceWriteTagFragmented:
+		return "write_tag_fragmented"
+	case enip.ServiceReadModifyWriteTag:
+		return "read_modify_write_tag"
+	case enip.ServiceGetInstanceAttributeList:
+		return "get_instance_attribute_list"
+	default:
+		return fmt.Sprintf("0x%02x", service)
+	}
+}
+
 //RegisterSession 注册链接
 func (p *PLC) RegisterSession() error {
-	if p.IsRegistered {
+	if p.Registered() {
 		return errors.New("链接已经注册，不可重复注册")
 	}
 	p.Println("RegisterSession")
 	pack := enip.BuildRegisterSession()
-	reply, err := p.writePack(pack)
+	reply, err := p.writePack(pack, "register_session")
 	if err != nil {
 		return err
 	}
+	p.mutex.Lock()
 	p.SessionId = reply.SessionId
-	p.SequenceCounter = 0
+	p.registered = true
 	p.IsRegistered = true
+	p.mutex.Unlock()
 	err3 := p.ReadAttributeAll()
 	if err3 != nil {
 		p.Close()
@@ -346,7 +528,7 @@ func (p *PLC) RegisterSession() error {
 
 //UnregisterSession 退出链接
 func (p *PLC) UnregisterSession() error {
-	if !p.IsRegistered {
+	if !p.Registered() {
 		return errors.New("链接尚未注册")
 	}
 	p.Println("UnregisterSession")
@@ -357,16 +539,50 @@ func (p *PLC) UnregisterSession() error {
 		p.Close()
 		return err
 	}
+	p.mutex.Lock()
 	p.SessionId = 0
+	p.registered = false
 	p.IsRegistered = false
+	p.mutex.Unlock()
 	ch := enip.NewTimeOut(1 * time.Second)
 	ch.Read()
 	return nil
 }
 
-//ForwardOpen 打开小数据读取通道
+//ForwardOpen 打开小数据读取通道，按 ConnectionOptions.Count 打开多个链接
 func (p *PLC) ForwardOpen() error {
 	p.Println("ForwardOpen")
+	connections := make([]*cipConnection, 0, p.options.Count)
+	for i := 0; i < p.options.Count; i++ {
+		conn, err := p.forwardOpen(i)
+		if err != nil {
+			if len(connections) == 0 {
+				p.Close()
+				return err
+			}
+			//控制器链接数量有限，保留已打开的链接
+			p.Println("ForwardOpen 附加链接打开失败", i, err)
+			break
+		}
+		connections = append(connections, conn)
+	}
+	writeCount := p.options.WriteCount
+	if writeCount >= len(connections) {
+		writeCount = 0
+	}
+	for i := len(connections) - writeCount; i < len(connections); i++ {
+		connections[i].write = true
+	}
+	p.mutex.Lock()
+	p.connections = connections
+	p.forwardOpened = true
+	p.IsForwardOpened = true
+	p.mutex.Unlock()
+	return nil
+}
+
+//forwardOpen 打开单个链接
+func (p *PLC) forwardOpen(index int) (*cipConnection, error) {
 	//如果没有设置链接大小，尝试打开大链接
 	connectionSize := p.ConnectionSize
 	testLarge := false
@@ -374,17 +590,23 @@ func (p *PLC) ForwardOpen() error {
 		testLarge = true
 		connectionSize = 4002
 	}
+	conn := &cipConnection{}
+	toConnectionID := p.options.TOConnectionID + uint32(index)
 sendData:
-	frameData := p.buildForwardOpen(connectionSize)
+	conn.serialId = uint16(lib.RandInt64(65000))
+	frameData := p.buildForwardOpen(connectionSize, conn.serialId, toConnectionID)
 	pack := enip.BuildRRData(frameData, 5)
-	reply, err := p.writePack(pack)
+	reply, err := p.writePack(pack, "forward_open")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(reply.DataItems) < 2 {
-		return errors.New("数据状态不符")
+		return nil, errors.New("数据状态不符")
 	}
 	dataItem := reply.DataItems[1]
+	if len(dataItem.Data) < 4 {
+		return nil, errors.New("数据状态不符")
+	}
 	status := dataItem.Data[2]
 	if status != 0 {
 		if testLarge {
@@ -392,42 +614,89 @@ sendData:
 			connectionSize = 508
 			goto sendData
 		}
-		p.Close()
-		return errors.New("数据状态不符")
+		extended := uint16(0)
+		if dataItem.Data[3] > 0 && len(dataItem.Data) >= 6 {
+			extended = binary.LittleEndian.Uint16(dataItem.Data[4:6])
+		}
+		return nil, fmt.Errorf("ForwardOpen 失败: %s (扩展状态 0x%04x)", GetErrorCode(status), extended)
+	}
+	replyData := dataItem.Data[4+int(dataItem.Data[3])*2:]
+	if len(replyData) < 24 {
+		return nil, errors.New("数据状态不符")
 	}
 	if p.ConnectionSize == 0 {
 		p.ConnectionSize = connectionSize
 	}
-	conId := binary.LittleEndian.Uint32(reply.Data[20:24])
-	p.IsForwardOpened = true
-	p.connectionID = conId
-	return nil
+	report := &ConnectionReport{}
+	report.Large = connectionSize > 511
+	report.ConnectionSize = connectionSize
+	report.OTConnectionID = binary.LittleEndian.Uint32(replyData[0:4])
+	report.TOConnectionID = binary.LittleEndian.Uint32(replyData[4:8])
+	report.ConnectionSerial = binary.LittleEndian.Uint16(replyData[8:10])
+	report.VendorID = binary.LittleEndian.Uint16(replyData[10:12])
+	report.OriginatorSerial = binary.LittleEndian.Uint32(replyData[12:16])
+	report.OTAPI = binary.LittleEndian.Uint32(replyData[16:20])
+	report.TOAPI = binary.LittleEndian.Uint32(replyData[20:24])
+	conn.report = report
+	p.Println("ForwardOpen", index, *report)
+	return conn, nil
+}
+
+//ConnectionReport 获取第一个链接的 ForwardOpen 协商结果，未打开时返回 nil
+func (p *PLC) ConnectionReport() *ConnectionReport {
+	reports := p.ConnectionReports()
+	if len(reports) == 0 {
+		return nil
+	}
+	return reports[0]
+}
+
+//ConnectionReports 获取所有链接的 ForwardOpen 协商结果
+func (p *PLC) ConnectionReports() []*ConnectionReport {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	reports := make([]*ConnectionReport, 0, len(p.connections))
+	for _, conn := range p.connections {
+		reports = append(reports, conn.report)
+	}
+	return reports
 }
 
 //ForwardClose 关闭数据读取通道
 func (p *PLC) ForwardClose() error {
 	p.Println("ForwardClose")
-	frameData := p.buildForwardClose()
-	pack := enip.BuildRRData(frameData, 5)
-	reply, err := p.writePack(pack)
-	if err != nil {
-		return err
-	}
-	if len(reply.DataItems) < 2 {
-		return errors.New("数据状态不符")
+	p.mutex.Lock()
+	connections := p.connections
+	p.mutex.Unlock()
+	var lastErr error
+	for _, conn := range connections {
+		frameData := p.buildForwardClose(conn.serialId)
+		pack := enip.BuildRRData(frameData, 5)
+		reply, err := p.writePack(pack, "forward_close")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(reply.DataItems) < 2 {
+			lastErr = errors.New("数据状态不符")
+		}
 	}
-	dataItem := reply.DataItems[1]
-	if dataItem.TypeID == enip.CPFTypeUnconnectedMessage {
-		p.IsForwardOpened = false
+	p.mutex.Lock()
+	p.connections = nil
+	p.forwardOpened = false
+	p.IsForwardOpened = false
+	p.mutex.Unlock()
+	if lastErr != nil {
+		return lastErr
 	}
 	ch := enip.NewTimeOut(1 * time.Second)
 	ch.Read()
 	return nil
 }
 
-func (p *PLC) buildForwardOpen(connectionSize uint16) []byte {
+func (p *PLC) buildForwardOpen(connectionSize uint16, serialId uint16, toConnectionID uint32) []byte {
 	buffer := new(bytes.Buffer)
-	p.serialId = uint16(lib.RandInt64(65000))
+	opts := p.options
 	var CIPService uint8
 	var parametersUint16 uint16
 	var parametersUint32 uint32
@@ -440,29 +709,29 @@ func (p *PLC) buildForwardOpen(connectionSize uint16) []byte {
 		CIPService = uint8(0x5b)
 		parametersUint32 = uint32(0x42000000) + uint32(connectionSize)
 	}
-	lib.WriteByte(buffer, CIPService)               //B
-	lib.WriteByte(buffer, uint8(0x02))              //B CIPPathSize
-	lib.WriteByte(buffer, uint8(0x20))              //B CIPClassType
-	lib.WriteByte(buffer, uint8(0x06))              //B CIPClass
-	lib.WriteByte(buffer, uint8(0x24))              //B CIPInstanceType
-	lib.WriteByte(buffer, uint8(0x01))              //B CIPInstance
-	lib.WriteByte(buffer, uint8(0x0a))              //B CIPPriority
-	lib.WriteByte(buffer, uint8(0x0e))              //B CIPTimeoutTicks
-	lib.WriteByte(buffer, uint32(0x20000002))       //I CIPOTConnectionID
-	lib.WriteByte(buffer, uint32(0x20000001))       //I CIPTOConnectionID
-	lib.WriteByte(buffer, p.serialId)               //H
-	lib.WriteByte(buffer, p.vendorId)               //H
-	lib.WriteByte(buffer, p.originatorSerialNumber) //I
-	lib.WriteByte(buffer, uint32(0x03))             //I CIPMultiplier
-	lib.WriteByte(buffer, uint32(0x00201234))       //I CIPOTRPI
+	lib.WriteByte(buffer, CIPService)                     //B
+	lib.WriteByte(buffer, uint8(0x02))                    //B CIPPathSize
+	lib.WriteByte(buffer, uint8(0x20))                    //B CIPClassType
+	lib.WriteByte(buffer, uint8(0x06))                    //B CIPClass
+	lib.WriteByte(buffer, uint8(0x24))                    //B CIPInstanceType
+	lib.WriteByte(buffer, uint8(0x01))                    //B CIPInstance
+	lib.WriteByte(buffer, opts.Priority)                  //B CIPPriority
+	lib.WriteByte(buffer, opts.TimeoutTicks)              //B CIPTimeoutTicks
+	lib.WriteByte(buffer, opts.OTConnectionID)            //I CIPOTConnectionID
+	lib.WriteByte(buffer, toConnectionID)                 //I CIPTOConnectionID
+	lib.WriteByte(buffer, serialId)                       //H
+	lib.WriteByte(buffer, opts.VendorID)                  //H
+	lib.WriteByte(buffer, opts.OriginatorSerial)          //I
+	lib.WriteByte(buffer, uint32(opts.TimeoutMultiplier)) //I CIPMultiplier
+	lib.WriteByte(buffer, opts.OTRPI)                     //I CIPOTRPI
 	//小数据读取
 	if CIPService == 0x54 {
 		lib.WriteByte(buffer, parametersUint16)
-		lib.WriteByte(buffer, uint32(0x00204001))
+		lib.WriteByte(buffer, opts.TORPI)
 		lib.WriteByte(buffer, parametersUint16)
 	} else {
 		lib.WriteByte(buffer, parametersUint32)
-		lib.WriteByte(buffer, uint32(0x00204001))
+		lib.WriteByte(buffer, opts.TORPI)
 		lib.WriteByte(buffer, parametersUint32)
 	}
 
@@ -472,86 +741,72 @@ func (p *PLC) buildForwardOpen(connectionSize uint16) []byte {
 	return buffer.Bytes()
 }
 
-func (p *PLC) buildForwardClose() []byte {
+func (p *PLC) buildForwardClose(serialId uint16) []byte {
 	buffer := new(bytes.Buffer)
+	opts := p.options
 	var CIPService uint8 = 0x4e
-	lib.WriteByte(buffer, CIPService)               //B
-	lib.WriteByte(buffer, uint8(0x02))              //B CIPPathSize
-	lib.WriteByte(buffer, uint8(0x20))              //B CIPClassType
-	lib.WriteByte(buffer, uint8(0x06))              //B CIPClass
-	lib.WriteByte(buffer, uint8(0x24))              //B CIPInstanceType
-	lib.WriteByte(buffer, uint8(0x01))              //B CIPInstance
-	lib.WriteByte(buffer, uint8(0x0a))              //B CIPPriority
-	lib.WriteByte(buffer, uint8(0x0e))              //B CIPTimeoutTicks
-	lib.WriteByte(buffer, p.serialId)               //H
-	lib.WriteByte(buffer, p.vendorId)               //H
-	lib.WriteByte(buffer, p.originatorSerialNumber) //I
+	lib.WriteByte(buffer, CIPService)            //B
+	lib.WriteByte(buffer, uint8(0x02))           //B CIPPathSize
+	lib.WriteByte(buffer, uint8(0x20))           //B CIPClassType
+	lib.WriteByte(buffer, uint8(0x06))           //B CIPClass
+	lib.WriteByte(buffer, uint8(0x24))           //B CIPInstanceType
+	lib.WriteByte(buffer, uint8(0x01))           //B CIPInstance
+	lib.WriteByte(buffer, opts.Priority)         //B CIPPriority
+	lib.WriteByte(buffer, opts.TimeoutTicks)     //B CIPTimeoutTicks
+	lib.WriteByte(buffer, serialId)              //H
+	lib.WriteByte(buffer, opts.VendorID)         //H
+	lib.WriteByte(buffer, opts.OriginatorSerial) //I
 	lib.WriteByte(buffer, uint8(len(p.connectionPath)/2))
+	lib.WriteByte(buffer, uint8(0)) //B Reserved
 	buffer.Write(p.connectionPath)
 	return buffer.Bytes()
 }
 
 //ReadPartialTag 读取节点数据类型
 func (p *PLC) ReadPartialTag(tagName string) (types.DataType, error) {
-	if tagType, ok := p.knownTags[tagName]; ok {
+	p.mutex.Lock()
+	tagType, ok := p.knownTags[tagName]
+	p.mutex.Unlock()
+	if ok {
 		return tagType, nil
 	}
 	p.Println("ReadPartialTag", tagName)
 	tagData := enip.BuildTagIOI(tagName, 0)
 	readRequest := enip.AddPartialReadIOI(tagData, 1, 0)
-	var pack *enip.Package
-	IsForwardOpened := p.IsForwardOpened
-	if IsForwardOpened {
-		pack = enip.BuildUnitData(readRequest, p.connectionID, p.newSequenceId())
-	} else {
-		pack = enip.BuildUnconnectedSend(p.targetPath, readRequest)
-	}
-	reply, err := p.writePack(pack)
+	pack, IsForwardOpened := p.newRequestPack(readRequest, trafficRead)
+	reply, err := p.writePack(pack, serviceName(readRequest[0]))
 	if err != nil {
 		return 0, err
 	}
 	dataItem := reply.DataItems[1]
 	res := enip.ParserResponse(dataItem.Data, IsForwardOpened)
 	if res.Status != 0 && res.Status != 6 {
-		return 0, errors.New("状态不正确")
+		return 0, statusError(tagName, res.Status)
 	}
+	p.mutex.Lock()
 	p.knownTags[tagName] = res.DType
+	//记录单个元素的应答数据长度，部分传输时长度未知
+	if res.Status == 0 {
+		p.knownSizes[tagName] = len(res.Data)
+	} else {
+		p.knownSizes[tagName] = 0
+	}
+	p.mutex.Unlock()
 	//创建上下文关联
 	return res.DType, nil
 }
 
 //ReadTag 读取节点数据
 func (p *PLC) ReadTag(tagName string, elements uint16) (*TagResult, error) {
-	baseTag, indexs := lib.ParseTagName(tagName)
+	baseTag, _ := lib.ParseTagName(tagName)
 	dataType, err := p.ReadPartialTag(baseTag)
 	if err != nil {
 		return nil, err
 	}
 	p.Println("ReadTag", tagName)
-	var pack *enip.Package
-	var readRequest []byte
-	IsForwardOpened := p.IsForwardOpened
-	if dataType == types.BIT_STRING {
-		//211
-		tagData := enip.BuildTagIOI(tagName, dataType)
-		words := lib.GetWordCount(uint16(indexs[0]), elements, 32)
-		readRequest = enip.AddReadIOI(tagData, words)
-	} else if lib.IsBitWord(tagName) {
-		bitCount := types.GetByteCount(dataType) * 8
-		tagData := enip.BuildTagIOI(tagName, dataType)
-		words := lib.GetWordCount(uint16(indexs[0]), elements, bitCount)
-		readRequest = enip.AddReadIOI(tagData, words)
-	} else {
-		//读取数据
-		tagData := enip.BuildTagIOI(tagName, dataType)
-		readRequest = enip.AddReadIOI(tagData, elements)
-	}
-	if IsForwardOpened {
-		pack = enip.BuildUnitData(readRequest, p.connectionID, p.newSequenceId())
-	} else {
-		pack = enip.BuildUnconnectedSend(p.targetPath, readRequest)
-	}
-	reply, err := p.writePack(pack)
+	readRequest, _ := buildReadRequest(tagName, dataType, elements)
+	pack, IsForwardOpened := p.newRequestPack(readRequest, trafficRead)
+	reply, err := p.writePack(pack, serviceName(readRequest[0]))
 	if err != nil {
 		return nil, err
 	}
@@ -560,7 +815,7 @@ func (p *PLC) ReadTag(tagName string, elements uint16) (*TagResult, error) {
 	res := enip.ParserResponse(dataItem.Data, IsForwardOpened)
 	if res.Status != 0 && res.Status != 6 {
 		p.Println("res.Status", res.Status)
-		return nil, errors.New("状态不正确")
+		return nil, statusError(tagName, res.Status)
 	}
 	values, err := p.ParseReply(res, tagName, elements)
 	if err != nil {
@@ -573,24 +828,65 @@ func (p *PLC) ReadTag(tagName string, elements uint16) (*TagResult, error) {
 	return result, nil
 }
 
+//buildReadRequest 生成读取请求，返回请求数据与实际读取的字数量，位数组与位访问按字读取
+func buildReadRequest(tagName string, dataType types.DataType, elements uint16) ([]byte, uint16) {
+	_, indexs := lib.ParseTagName(tagName)
+	tagData := enip.BuildTagIOI(tagName, dataType)
+	words := elements
+	if dataType == types.BIT_STRING {
+		//211
+		words = lib.GetWordCount(uint16(indexs[0]), elements, 32)
+	} else if lib.IsBitWord(tagName) {
+		bitCount := types.GetByteCount(dataType) * 8
+		words = lib.GetWordCount(uint16(indexs[0]), elements, bitCount)
+	}
+	return enip.AddReadIOI(tagData, words), words
+}
+
+//MultiReadTag 批量读取节点数据，按计划分包并发读取
 func (p *PLC) MultiReadTag(tagList []string) (map[string]*TagValue, error) {
 	p.Println("MultiReadTag", tagList)
-	listLen := len(tagList)
+	if len(tagList) == 0 {
+		return nil, errors.New("发送的数据为空")
+	}
+	plan, err := p.PlanMultiRead(tagList)
+	if err != nil {
+		return nil, err
+	}
+	return p.ExecutePlan(plan)
+}
+
+//MultiReadTags 批量读取多个元素，每个标签返回一组数据，单个标签的错误在 TagResult.Err 中，只有链接错误时返回 error
+func (p *PLC) MultiReadTags(requests []ReadRequest) (map[string]*TagResult, error) {
+	p.Println("MultiReadTags", requests)
+	if len(requests) == 0 {
+		return nil, errors.New("发送的数据为空")
+	}
+	plan, err := p.PlanReadRequests(requests)
+	if err != nil {
+		return nil, err
+	}
+	return p.executeRequests(plan)
+}
+
+//multiReadPacket 单个批量读取数据包
+func (p *PLC) multiReadPacket(requests []ReadRequest) (map[string]*TagResult, error) {
+	listLen := len(requests)
 	if listLen == 0 {
 		return nil, errors.New("发送的数据为空")
 	}
 	if listLen == 1 {
-		tagName := tagList[0]
-		result, err2 := p.ReadTag(tagName, 1)
+		request := requests[0]
+		result, err2 := p.ReadTag(request.Tag, request.Elements)
 		if err2 != nil {
-			return nil, err2
+			tagErr := p.tagFailure(request.Tag, err2)
+			if tagErr == nil {
+				return nil, err2
+			}
+			result = &TagResult{Status: tagErr.Status, Err: tagErr}
 		}
-		values := make(map[string]*TagValue)
-		tagValue := &TagValue{}
-		tagValue.Value = result.Values[0]
-		tagValue.Status = result.Status
-		tagValue.DType = result.DType
-		values[tagName] = tagValue
+		values := make(map[string]*TagResult)
+		values[request.Tag] = result
 		return values, nil
 	}
 
@@ -599,16 +895,15 @@ func (p *PLC) MultiReadTag(tagList []string) (map[string]*TagValue, error) {
 	tagCount := 0
 	hLen := len(header)
 	dataLen := hLen + 2
-	for _, tagName := range tagList {
-		baseTag, _ := lib.ParseTagName(tagName)
+	for _, request := range requests {
+		baseTag, _ := lib.ParseTagName(request.Tag)
 		dataType, err := p.ReadPartialTag(baseTag)
 		if err != nil {
 			return nil, err
 		}
-		tagData := enip.BuildTagIOI(tagName, dataType)
-		readRequest := enip.AddReadIOI(tagData, 1)
+		readRequest, _ := buildReadRequest(request.Tag, dataType, request.Elements)
 		dataLen += len(readRequest) + 2
-		if dataLen > int(p.ConnectionSize) {
+		if dataLen > p.messageSize() {
 			break
 		}
 		serviceSegments = append(serviceSegments, readRequest)
@@ -633,31 +928,34 @@ func (p *PLC) MultiReadTag(tagList []string) (map[string]*TagValue, error) {
 	}
 	buffer.Write(offsets.Bytes())
 	buffer.Write(data.Bytes())
-	var pack *enip.Package
-	IsForwardOpened := p.IsForwardOpened
-	if IsForwardOpened {
-		pack = enip.BuildUnitData(buffer.Bytes(), p.connectionID, p.newSequenceId())
-	} else {
-		pack = enip.BuildUnconnectedSend(p.targetPath, buffer.Bytes())
-	}
-	reply, err := p.writePack(pack)
+	pack, IsForwardOpened := p.newRequestPack(buffer.Bytes(), trafficRead)
+	reply, err := p.writePack(pack, serviceName(uint8(enip.ServiceMultipleServicePacket)))
 	if err != nil {
 		return nil, err
 	}
 	dataItem := reply.DataItems[1]
 	res := enip.ParserResponse(dataItem.Data, IsForwardOpened)
-	values, err := p.multiParser(res, tagList)
+	values, err := p.multiParser(res, requests)
 	return values, err
 }
 
 //ReadAttributeAll 获取设备信息
 func (p *PLC) ReadAttributeAll() error {
 	pack := enip.BuildReadAttributeAll(p.targetPath)
-	reply, err := p.writePack(pack)
+	reply, err := p.writePack(pack, serviceName(uint8(enip.ServiceGetAttributeAll)))
 	if err != nil {
 		return err
 	}
+	if len(reply.DataItems) < 2 {
+		return errors.New("返回内容为空，读取失败")
+	}
 	dataItem := reply.DataItems[1]
+	if len(dataItem.Data) >= 4 && dataItem.Data[2] != 0 {
+		return fmt.Errorf("读取设备信息失败: %s (0x%02x)", GetErrorCode(dataItem.Data[2]), dataItem.Data[2])
+	}
+	if len(dataItem.Data) < 19 || len(dataItem.Data) < 19+int(dataItem.Data[18]) {
+		return errors.New("设备信息不完整")
+	}
 	p.Info.SerialNumber = binary.LittleEndian.Uint32(dataItem.Data[14:18])
 	nLen := dataItem.Data[18]
 	p.Info.Name = string(dataItem.Data[19 : 19+int(nLen)])
@@ -682,101 +980,69 @@ func (p *PLC) ReadAttributeAll() error {
 }
 
 //MultiParser 解析批量数据
-func (p *PLC) multiParser(res *enip.Response, tagList []string) (map[string]*TagValue, error) {
-	values := make(map[string]*TagValue)
+func (p *PLC) multiParser(res *enip.Response, requests []ReadRequest) (map[string]*TagResult, error) {
+	values := make(map[string]*TagResult)
 	dataLen := len(res.Data)
 	if dataLen == 0 {
 		return nil, errors.New("返回内容为空，读取失败")
 	}
-	tagList2 := make([]string, 0)
+	requests2 := make([]ReadRequest, 0)
 	tagCount := (binary.LittleEndian.Uint16(res.Data[0:2]) - 2) / 2
-	for i, tag := range tagList {
-		tagValue := &TagValue{}
+	for i, request := range requests {
+		tag := request.Tag
+		tagValue := &TagResult{}
 		loc := i * 2
 		if loc+2 > dataLen || i >= int(tagCount) {
-			tagList2 = append(tagList2, tag)
+			requests2 = append(requests2, request)
 			continue
 		}
-		offset := binary.LittleEndian.Uint16(res.Data[loc : loc+2])
-		if int(offset+4) > dataLen {
-			tagValue.Value = nil
+		offset := int(binary.LittleEndian.Uint16(res.Data[loc : loc+2]))
+		//偏移量从数量字段开始计算，Data 从偏移量表开始，下一项应答头占2字节
+		end := dataLen
+		if i+1 < int(tagCount) && loc+4 <= dataLen {
+			end = int(binary.LittleEndian.Uint16(res.Data[loc+2:loc+4])) - 2
+		}
+		if offset+2 > dataLen || end > dataLen || end < offset+2 {
+			tagValue.Err = &TagError{Tag: tag, Kind: TagErrorShortReply}
 			values[tag] = tagValue
 			continue
 		}
 		replyStatus := res.Data[offset]
 		replyExtended := res.Data[offset+1]
-		if !(replyStatus == 0 && replyExtended == 0) {
+		if replyStatus != 0 && replyStatus != 6 || replyStatus == 0 && replyExtended != 0 {
 			tagValue.Status = replyStatus
+			tagValue.Err = &TagError{Tag: tag, Kind: TagErrorStatus, Status: replyStatus}
 			if replyStatus == 0 && replyExtended != 0 {
-				tagValue.Status = 100
+				tagValue.Err = &TagError{Tag: tag, Kind: TagErrorExtendedStatus, Status: replyStatus}
 			}
-			tagValue.Value = nil
 			values[tag] = tagValue
 			continue
 		}
-		dataType := types.DataType(binary.LittleEndian.Uint16(res.Data[offset+2 : offset+4]))
-		if lib.IsBitWord(tag) {
-			reader := bytes.NewReader(res.Data[offset+4:])
-			if reader.Len() == 0 {
-				return nil, errors.New("返回内容为空，读取失败")
-			}
-			result, _, err2 := types.GetTypeValue(reader, dataType)
-			if err2 != nil {
-				tagValue.Value = nil
-				tagValue.Status = 101
-				values[tag] = tagValue
-				continue
-			}
-			tagValue.Value, err2 = types.GetBitOfWord(tag, result)
-			if err2 != nil {
-				tagValue.Value = nil
-				tagValue.Status = 102
-				values[tag] = tagValue
-				continue
-			}
-			tagValue.Status = 0
-			tagValue.DType = dataType
+		if end <= offset+4 {
+			tagValue.Err = &TagError{Tag: tag, Kind: TagErrorShortReply}
 			values[tag] = tagValue
-
-		} else if dataType == types.BIT_STRING {
-			reader := bytes.NewReader(res.Data[offset+4:])
-			if reader.Len() == 0 {
-				return nil, errors.New("返回内容为空，读取失败")
-			}
-			result, _, err2 := types.GetTypeValue(reader, dataType)
-			if err2 != nil {
-				tagValue.Value = nil
-				tagValue.Status = 101
-				values[tag] = tagValue
-				continue
-			}
-			tagValue.Value, err2 = types.GetBitOfWord(tag, result)
-			if err2 != nil {
-				tagValue.Value = nil
-				tagValue.Status = 102
-				values[tag] = tagValue
-				continue
-			}
-			tagValue.Status = 0
-			tagValue.DType = dataType
-			values[tag] = tagValue
-		} else {
-			reader := bytes.NewReader(res.Data[offset+4:])
-			var err2 error
-			tagValue.Value, _, err2 = types.GetTypeValue(reader, dataType)
-			if err2 != nil {
-				tagValue.Value = nil
-				tagValue.Status = 101
-				values[tag] = tagValue
-				continue
-			}
-			tagValue.Status = 0
-			tagValue.DType = dataType
+			continue
+		}
+		dataType := types.DataType(binary.LittleEndian.Uint16(res.Data[offset+2 : offset+4]))
+		//逐项解析，位数组与位访问展开为布尔值，部分应答时补读剩余元素
+		itemRes := &enip.Response{Status: replyStatus, DType: dataType, Data: res.Data[offset+4 : end]}
+		result, err2 := p.ParseReply(itemRes, tag, request.Elements)
+		if err2 != nil {
+			tagValue.Err = &TagError{Tag: tag, Kind: TagErrorDecode, Err: err2}
 			values[tag] = tagValue
+			continue
 		}
+		tagValue.Status = 0
+		tagValue.DType = dataType
+		tagValue.Values = result
+		values[tag] = tagValue
 	}
-	if len(tagList2) > 0 {
-		values2, err4 := p.MultiReadTag(tagList2)
+	if len(requests2) > 0 {
+		plan, err4 := p.PlanReadRequests(requests2)
+		if err4 != nil {
+			return nil, err4
+		}
+		values2, err4 := p.executeRequests(plan)
 		if err4 != nil {
 			return nil, err4
 		}
@@ -821,6 +1087,9 @@ func (p *PLC) ParseReply(res *enip.Response, tagName string, elements uint16) ([
 //getReplyValues 获取所有数值
 func (p *PLC) getReplyValues(res *enip.Response, tagName string, elements uint16) ([]interface{}, error) {
 	dataType := res.DType
+	if dataType == types.STRUCT {
+		return p.getStructValues(res, tagName, elements)
+	}
 	reader := bytes.NewReader(res.Data)
 	if reader.Len() == 0 {
 		return nil, errors.New("返回内容为空，读取失败")
@@ -851,8 +1120,7 @@ func (p *PLC) getReplyValues(res *enip.Response, tagName string, elements uint16
 					}
 					values = append(values, result.Values...)
 				} else {
-					start2 := indexs[0] + i
-					tagName2 := baseTag + "[" + strconv.Itoa(start2) + "]"
+					tagName2 := p.offsetTagName(tagName, i)
 					result, err3 := p.ReadTag(tagName2, uint16(elements2))
 					if err3 != nil {
 						return values, err3
@@ -0,0 +1,37 @@
+package gologix
+
+import (
+	"github.com/wj008/gologix/internal/plcsim"
+	"testing"
+)
+
+//newSimPLC 启动模拟器，测试结束时关闭
+func newSimPLC(t *testing.T) *plcsim.Sim {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sim.Close()
+	})
+	return sim
+}
+
+//connectSim 链接模拟器并打开链接
+func connectSim(t *testing.T, sim *plcsim.Sim, opts ConnectionOptions) *PLC {
+	plc := NewPLC()
+	plc.ConnectionOptions = opts
+	if err := plc.Connect(sim.Addr(), 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		plc.Close()
+	})
+	if err := plc.RegisterSession(); err != nil {
+		t.Fatal(err)
+	}
+	if err := plc.ForwardOpen(); err != nil {
+		t.Fatal(err)
+	}
+	return plc
+}
@@ -0,0 +1,269 @@
+//Package pool 按名称集中管理多个 PLC 链接，断线后自动重连，同一 PLC 的请求串行执行
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/epath"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownPLC  = errors.New("没有配置该 PLC")
+	ErrUnavailable = errors.New("PLC 不可用")
+)
+
+//Endpoint PLC 链接配置
+type Endpoint struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`     //地址[:端口]，默认端口 44818
+	Slot        uint8  `json:"slot"`        //本地机架槽号
+	Route       string `json:"route"`       //RSLinx 风格路由，设置后忽略 slot
+	Micro800    bool   `json:"micro800"`    //Micro800 模式
+	Unconnected bool   `json:"unconnected"` //使用非链接消息
+	Connections int    `json:"connections"` //ForwardOpen 链接数量 默认 1
+	CheckAccess bool   `json:"check_access"`
+}
+
+//Dial 按配置链接 PLC 并注册会话，未设置 Unconnected 时打开链接
+func Dial(endpoint *Endpoint) (*gologix.PLC, error) {
+	if endpoint.Address == "" {
+		return nil, errors.New("PLC 地址为空")
+	}
+	addr := endpoint.Address
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "44818")
+	}
+	plc := gologix.NewPLC()
+	plc.Micro800 = endpoint.Micro800
+	plc.CheckAccess = endpoint.CheckAccess
+	plc.ConnectionOptions.Count = endpoint.Connections
+	var err error
+	switch {
+	case endpoint.Route != "":
+		err = plc.ConnectRoute(addr, endpoint.Route)
+	case endpoint.Micro800:
+		err = plc.ConnectPath(addr, epath.Path{})
+	default:
+		err = plc.Connect(addr, endpoint.Slot)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = plc.RegisterSession(); err != nil {
+		plc.Close()
+		return nil, err
+	}
+	if !endpoint.Unconnected {
+		if err = plc.ForwardOpen(); err != nil {
+			plc.UnregisterSession()
+			plc.Close()
+			return nil, err
+		}
+	}
+	return plc, nil
+}
+
+//Hangup 关闭链接与会话
+func Hangup(plc *gologix.PLC) {
+	if plc.ForwardOpened() {
+		plc.ForwardClose()
+	}
+	plc.UnregisterSession()
+	plc.Close()
+}
+
+//Client 单个 PLC 的链接，请求串行执行
+type Client struct {
+	Endpoint *Endpoint
+	//OnConnect 链接成功后、执行请求前调用，可用于设置 PLC 的回调
+	OnConnect func(plc *gologix.PLC)
+	mutex     sync.Mutex
+	plc       *gologix.PLC
+	lastErr   error
+	retryAt   time.Time
+	backoff   time.Duration
+	closed    bool
+	connects  uint64 //链接成功的次数
+}
+
+//Status 链接状态
+type Status struct {
+	Name       string     `json:"name"`
+	Address    string     `json:"address"`
+	Connected  bool       `json:"connected"`
+	LastError  string     `json:"last_error,omitempty"`
+	RetryAt    *time.Time `json:"retry_at,omitempty"` //链接失败后的下次重连时间
+	Reconnects uint64     `json:"reconnects"`         //首次链接之后重新链接成功的次数
+}
+
+//重连间隔，连续失败时加倍
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+//Do 在链接上执行 fn，未链接时先链接，链接失败后在重连间隔内直接返回 ErrUnavailable
+func (c *Client) Do(fn func(plc *gologix.PLC) error) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return fmt.Errorf("%s: %w", c.Endpoint.Name, ErrUnavailable)
+	}
+	if c.plc == nil || !c.plc.Connected() {
+		if c.plc != nil {
+			c.plc.Close()
+			c.plc = nil
+		}
+		if time.Now().Before(c.retryAt) {
+			return fmt.Errorf("%s: %w: %v", c.Endpoint.Name, ErrUnavailable, c.lastErr)
+		}
+		plc, err := Dial(c.Endpoint)
+		if err != nil {
+			c.fail(err)
+			return fmt.Errorf("%s: %w: %v", c.Endpoint.Name, ErrUnavailable, err)
+		}
+		c.plc, c.lastErr, c.backoff = plc, nil, 0
+		c.connects++
+		if c.OnConnect != nil {
+			c.OnConnect(plc)
+		}
+	}
+	err := fn(c.plc)
+	if err != nil && isConnectionError(c.plc, err) {
+		Hangup(c.plc)
+		c.plc = nil
+		c.fail(err)
+		return fmt.Errorf("%s: %w: %v", c.Endpoint.Name, ErrUnavailable, err)
+	}
+	return err
+}
+
+//MultiReadTags 在链接上批量读取，Client 因此可作为 gologix.Subscriber 的数据源
+func (c *Client) MultiReadTags(requests []gologix.ReadRequest) (results map[string]*gologix.TagResult, err error) {
+	err = c.Do(func(plc *gologix.PLC) error {
+		results, err = plc.MultiReadTags(requests)
+		return err
+	})
+	return results, err
+}
+
+//fail 记录错误并计算下次重连时间
+func (c *Client) fail(err error) {
+	c.lastErr = err
+	if c.backoff == 0 {
+		c.backoff = minBackoff
+	} else if c.backoff *= 2; c.backoff > maxBackoff {
+		c.backoff = maxBackoff
+	}
+	c.retryAt = time.Now().Add(c.backoff)
+}
+
+//isConnectionError 链接断开或网络错误，标签错误与编码错误不影响链接
+func isConnectionError(plc *gologix.PLC, err error) bool {
+	if !plc.Connected() {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
+//Status 当前链接状态
+func (c *Client) Status() Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status := Status{Name: c.Endpoint.Name, Address: c.Endpoint.Address}
+	if c.connects > 1 {
+		status.Reconnects = c.connects - 1
+	}
+	status.Connected = c.plc != nil && c.plc.Connected()
+	if c.lastErr != nil {
+		status.LastError = c.lastErr.Error()
+		retryAt := c.retryAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+//Close 关闭链接，之后的请求返回 ErrUnavailable
+func (c *Client) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	if c.plc != nil {
+		Hangup(c.plc)
+		c.plc = nil
+	}
+}
+
+//Manager 按名称管理多个 PLC 链接
+type Manager struct {
+	clients map[string]*Client
+	names   []string
+}
+
+//NewManager 创建链接管理器，链接在首次请求时建立
+func NewManager(endpoints []*Endpoint) (*Manager, error) {
+	m := &Manager{clients: make(map[string]*Client)}
+	for _, endpoint := range endpoints {
+		if endpoint.Name == "" {
+			return nil, errors.New("PLC 名称为空")
+		}
+		if _, ok := m.clients[endpoint.Name]; ok {
+			return nil, errors.New("PLC 名称重复 " + endpoint.Name)
+		}
+		m.clients[endpoint.Name] = &Client{Endpoint: endpoint}
+		m.names = append(m.names, endpoint.Name)
+	}
+	sort.Strings(m.names)
+	return m, nil
+}
+
+//Names 所有 PLC 名称
+func (m *Manager) Names() []string {
+	return append([]string(nil), m.names...)
+}
+
+//Client 按名称获取链接
+func (m *Manager) Client(name string) (*Client, error) {
+	client, ok := m.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrUnknownPLC)
+	}
+	return client, nil
+}
+
+//Do 在指定 PLC 上执行 fn
+func (m *Manager) Do(name string, fn func(plc *gologix.PLC) error) error {
+	client, err := m.Client(name)
+	if err != nil {
+		return err
+	}
+	return client.Do(fn)
+}
+
+//Close 关闭所有链接
+func (m *Manager) Close() {
+	for _, client := range m.clients {
+		client.Close()
+	}
+}
+
+//LoadConfig 读取 JSON 配置文件到 v
+func LoadConfig(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return nil
+}
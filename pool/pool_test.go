@@ -0,0 +1,69 @@
+package pool
+
+import (
+	"errors"
+	"github.com/wj008/gologix"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/types"
+	"testing"
+	"time"
+)
+
+func readCount(c *Client) (value int64, err error) {
+	err = c.Do(func(plc *gologix.PLC) error {
+		result, err := plc.ReadValue("Count")
+		if err != nil {
+			return err
+		}
+		value, err = result.Int()
+		return err
+	})
+	return value, err
+}
+
+func TestClientReconnect(t *testing.T) {
+	sim, err := plcsim.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	sim.AddTag("Count", types.DINT, []int32{5})
+	client := &Client{Endpoint: &Endpoint{Name: "line1", Address: sim.Addr()}}
+	defer client.Close()
+	if value, err := readCount(client); err != nil || value != 5 {
+		t.Fatalf("首次读取错误 %v %v", value, err)
+	}
+	//断开链接并停止监听
+	sim.Close()
+	sim.Drop()
+	deadline := time.Now().Add(2 * time.Second)
+	for client.Status().Connected {
+		if time.Now().After(deadline) {
+			t.Fatal("链接断开后状态未更新")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := readCount(client); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("链接断开后应返回 ErrUnavailable %v", err)
+	}
+	status := client.Status()
+	if status.RetryAt == nil || status.LastError == "" {
+		t.Fatalf("链接失败后应记录重连时间 %+v", status)
+	}
+	//重连间隔内不再尝试链接
+	if err := sim.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	accepts := sim.Accepts()
+	if _, err := readCount(client); !errors.Is(err, ErrUnavailable) || sim.Accepts() != accepts {
+		t.Fatalf("重连间隔内应直接返回 ErrUnavailable %v %d", err, sim.Accepts()-accepts)
+	}
+	time.Sleep(time.Until(*status.RetryAt) + 10*time.Millisecond)
+	sim.AddTag("Count", types.DINT, []int32{6})
+	if value, err := readCount(client); err != nil || value != 6 {
+		t.Fatalf("重连后读取错误 %v %v", value, err)
+	}
+	if status = client.Status(); !status.Connected || status.Reconnects != 1 || status.LastError != "" {
+		t.Fatalf("重连后状态错误 %+v", status)
+	}
+}
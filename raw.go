@@ -0,0 +1,176 @@
+package gologix
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/types"
+	"reflect"
+)
+
+//RawTag 标签原始数据
+type RawTag struct {
+	DType    types.DataType
+	Handle   uint16 //结构体句柄，仅结构体有效
+	Elements uint16
+	Data     []byte
+}
+
+//sendRequest 发送单个 CIP 请求并解析应答头，raw 为真时不读取数据类型
+func (p *PLC) sendRequest(request []byte, traffic trafficClass, raw bool) (*enip.Response, error) {
+	pack, IsForwardOpened := p.newRequestPack(request, traffic)
+	reply, err := p.writePack(pack, serviceName(request[0]))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.DataItems) < 2 {
+		return nil, errors.New("返回内容为空，读取失败")
+	}
+	dataItem := reply.DataItems[1]
+	if raw {
+		return enip.ParserRawResponse(dataItem.Data, IsForwardOpened), nil
+	}
+	return enip.ParserResponse(dataItem.Data, IsForwardOpened), nil
+}
+
+//statusError 应答状态错误
+func statusError(tagName string, status uint8) error {
+	return &TagError{Tag: tagName, Kind: TagErrorStatus, Status: status}
+}
+
+//ReadRaw 分段读取标签原始数据，结构体数据不含句柄
+func (p *PLC) ReadRaw(tagName string, elements uint16) (*RawTag, error) {
+	baseTag, _ := lib.ParseTagName(tagName)
+	dataType, err := p.ReadPartialTag(baseTag)
+	if err != nil {
+		return nil, err
+	}
+	p.Println("ReadRaw", tagName)
+	if elements == 0 {
+		elements = 1
+	}
+	tagData := enip.BuildTagIOI(tagName, dataType)
+	raw := &RawTag{Elements: elements}
+	for {
+		readRequest := enip.AddPartialReadIOI(tagData, elements, uint32(len(raw.Data)))
+		res, err := p.sendRequest(readRequest, trafficRead, false)
+		if err != nil {
+			return nil, err
+		}
+		if res.Status != 0 && res.Status != 6 {
+			return nil, statusError(tagName, res.Status)
+		}
+		raw.DType = res.DType
+		data := res.Data
+		if res.DType == types.STRUCT {
+			if len(data) < 2 {
+				return nil, errors.New("读取结构体信息失败")
+			}
+			raw.Handle = uint16(data[0]) | uint16(data[1])<<8
+			data = data[2:]
+		}
+		raw.Data = append(raw.Data, data...)
+		if res.Status == 0 {
+			return raw, nil
+		}
+		if len(data) == 0 {
+			return nil, errors.New("返回内容为空，读取失败")
+		}
+	}
+}
+
+//WriteRaw 写入标签原始数据，超出链接长度时分段写入
+func (p *PLC) WriteRaw(tagName string, raw *RawTag) error {
+	if raw == nil || len(raw.Data) == 0 {
+		return errors.New("写入的数据为空")
+	}
+	if err := p.checkWritable(tagName); err != nil {
+		return err
+	}
+	p.Println("WriteRaw", tagName)
+	elements := raw.Elements
+	if elements == 0 {
+		elements = 1
+	}
+	tagData := enip.BuildTagIOI(tagName, raw.DType)
+	typeInfo := enip.BuildTypeInfo(raw.DType, raw.Handle)
+	request := enip.AddWriteIOI(tagData, typeInfo, elements, raw.Data)
+	if len(request) <= p.messageSize() {
+		res, err := p.sendRequest(request, trafficWrite, true)
+		if err != nil {
+			return err
+		}
+		if res.Status != 0 {
+			return statusError(tagName, res.Status)
+		}
+		return nil
+	}
+	//分段长度按4字节对齐
+	chunk := (p.messageSize() - len(enip.AddPartialWriteIOI(tagData, typeInfo, elements, 0, nil))) / 4 * 4
+	if chunk <= 0 {
+		return errors.New("标签名称过长，无法分段写入")
+	}
+	for offset := 0; offset < len(raw.Data); offset += chunk {
+		end := offset + chunk
+		if end > len(raw.Data) {
+			end = len(raw.Data)
+		}
+		request = enip.AddPartialWriteIOI(tagData, typeInfo, elements, uint32(offset), raw.Data[offset:end])
+		res, err := p.sendRequest(request, trafficWrite, true)
+		if err != nil {
+			return err
+		}
+		if res.Status != 0 {
+			return statusError(tagName, res.Status)
+		}
+	}
+	return nil
+}
+
+//elementsOf 根据目标类型计算元素数量，数组按长度读取
+func elementsOf(v interface{}) (uint16, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return 0, errors.New("数据为空")
+	}
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() != reflect.Bool {
+		if rv.Len() == 0 || rv.Len() > 0xffff {
+			return 0, fmt.Errorf("数组长度 %d 不正确", rv.Len())
+		}
+		return uint16(rv.Len()), nil
+	}
+	return 1, nil
+}
+
+//ReadInto 读取标签并按 plc 字段标签解析到 v，v 为结构体或定长数组指针
+func (p *PLC) ReadInto(tagName string, v interface{}) error {
+	elements, err := elementsOf(v)
+	if err != nil {
+		return err
+	}
+	raw, err := p.ReadRaw(tagName, elements)
+	if err != nil {
+		return err
+	}
+	return types.Unmarshal(raw.Data, v)
+}
+
+//WriteFrom 按 plc 字段标签编码 v 并写入标签，先读取原始数据以保留未映射的成员
+func (p *PLC) WriteFrom(tagName string, v interface{}) error {
+	elements, err := elementsOf(v)
+	if err != nil {
+		return err
+	}
+	raw, err := p.ReadRaw(tagName, elements)
+	if err != nil {
+		return err
+	}
+	if err = types.MarshalTo(raw.Data, v); err != nil {
+		return err
+	}
+	return p.WriteRaw(tagName, raw)
+}
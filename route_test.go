@@ -0,0 +1,79 @@
+package gologix
+
+import (
+	"bytes"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/types"
+	"testing"
+)
+
+//routerPath 链接管理器路径 Class 0x02 Instance 0x01
+var routerPath = []byte{0x20, 0x02, 0x24, 0x01}
+
+//checkRoute 先以非链接方式读取再打开链接，检查模拟器收到的路由与链接路径
+func checkRoute(t *testing.T, sim *plcsim.Sim, plc *PLC, route []byte) {
+	if err := plc.RegisterSession(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plc.ReadTag("P_DINT", 1); err != nil {
+		t.Fatal(err)
+	}
+	routes := sim.Routes()
+	if len(route) == 0 {
+		if len(routes) != 0 {
+			t.Fatalf("空路由不应使用 Unconnected Send % x", routes)
+		}
+	} else if len(routes) == 0 || !bytes.Equal(routes[len(routes)-1], route) {
+		t.Fatalf("Unconnected Send 路由错误 % x != % x", routes, route)
+	}
+	if err := plc.ForwardOpen(); err != nil {
+		t.Fatal(err)
+	}
+	opens := sim.OpenRequests()
+	if len(opens) == 0 {
+		t.Fatal("模拟器未收到 ForwardOpen")
+	}
+	want := append(append([]byte{}, route...), routerPath...)
+	if got := opens[len(opens)-1].Path; !bytes.Equal(got, want) {
+		t.Fatalf("ForwardOpen 链接路径错误 % x != % x", got, want)
+	}
+	if _, err := plc.ReadTag("P_DINT", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRouteBackplane(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTag("P_DINT", types.DINT, []int32{7})
+	plc := NewPLC()
+	if err := plc.Connect(sim.Addr(), 2); err != nil {
+		t.Fatal(err)
+	}
+	defer plc.Close()
+	checkRoute(t, sim, plc, []byte{0x01, 0x02})
+}
+
+func TestRouteMultiHop(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTag("P_DINT", types.DINT, []int32{7})
+	plc := NewPLC()
+	if err := plc.ConnectRoute(sim.Addr(), "1,0,2,192.168.1.20,1,3"); err != nil {
+		t.Fatal(err)
+	}
+	defer plc.Close()
+	route := []byte{0x01, 0x00, 0x12, 0x0c}
+	route = append(route, "192.168.1.20"...)
+	route = append(route, 0x01, 0x03)
+	checkRoute(t, sim, plc, route)
+}
+
+func TestRouteDirect(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTag("P_DINT", types.DINT, []int32{7})
+	plc := NewPLC()
+	if err := plc.ConnectPath(sim.Addr(), nil); err != nil {
+		t.Fatal(err)
+	}
+	defer plc.Close()
+	checkRoute(t, sim, plc, nil)
+}
@@ -0,0 +1,448 @@
+//Package sparkplug Sparkplug B 载荷(protobuf)编码与解析，只处理标量指标
+package sparkplug
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/types"
+	"math"
+	"time"
+)
+
+//Namespace 主题前缀
+const Namespace = "spBv1.0"
+
+//消息类型
+const (
+	NBIRTH = "NBIRTH"
+	NDEATH = "NDEATH"
+	NDATA  = "NDATA"
+	NCMD   = "NCMD"
+	DBIRTH = "DBIRTH"
+	DDEATH = "DDEATH"
+	DDATA  = "DDATA"
+	DCMD   = "DCMD"
+)
+
+//Topic 主题 spBv1.0/{group}/{type}/{node}[/{device}]
+func Topic(group string, messageType string, node string, device string) string {
+	topic := Namespace + "/" + group + "/" + messageType + "/" + node
+	if device != "" {
+		topic += "/" + device
+	}
+	return topic
+}
+
+//DataType Sparkplug 指标数据类型
+type DataType uint32
+
+const (
+	Unknown  DataType = 0
+	Int8     DataType = 1
+	Int16    DataType = 2
+	Int32    DataType = 3
+	Int64    DataType = 4
+	UInt8    DataType = 5
+	UInt16   DataType = 6
+	UInt32   DataType = 7
+	UInt64   DataType = 8
+	Float    DataType = 9
+	Double   DataType = 10
+	Boolean  DataType = 11
+	String   DataType = 12
+	DateTime DataType = 13
+	Text     DataType = 14
+)
+
+func (t DataType) String() string {
+	switch t {
+	case Int8:
+		return "Int8"
+	case Int16:
+		return "Int16"
+	case Int32:
+		return "Int32"
+	case Int64:
+		return "Int64"
+	case UInt8:
+		return "UInt8"
+	case UInt16:
+		return "UInt16"
+	case UInt32:
+		return "UInt32"
+	case UInt64:
+		return "UInt64"
+	case Float:
+		return "Float"
+	case Double:
+		return "Double"
+	case Boolean:
+		return "Boolean"
+	case String:
+		return "String"
+	case DateTime:
+		return "DateTime"
+	case Text:
+		return "Text"
+	default:
+		return "Unknown"
+	}
+}
+
+//FromDataType Logix 数据类型对应的指标类型，不支持的类型返回 Unknown
+func FromDataType(dataType types.DataType) DataType {
+	switch dataType {
+	case types.BOOL:
+		return Boolean
+	case types.SINT:
+		return Int8
+	case types.INT:
+		return Int16
+	case types.DINT:
+		return Int32
+	case types.LINT:
+		return Int64
+	case types.USINT:
+		return UInt8
+	case types.UINT, types.WORD:
+		return UInt16
+	case types.UDINT, types.DWORD, types.BIT_STRING:
+		return UInt32
+	case types.ULINT, types.LWORD:
+		return UInt64
+	case types.REAL:
+		return Float
+	case types.LREAL:
+		return Double
+	case types.STRING, types.STRING2, types.STRINGN, types.SHORT_STRING, types.STRINGI, types.STRINGAB:
+		return String
+	case types.DATE, types.DATE_AND_TIME:
+		return DateTime
+	default:
+		return Unknown
+	}
+}
+
+//Metric 指标，Value 的类型与 DataType 对应: 整数为对应位宽的 Go 整数，DateTime 为 time.Time
+type Metric struct {
+	Name      string
+	Alias     uint64 //0 表示不使用别名
+	Timestamp time.Time
+	DataType  DataType
+	IsNull    bool
+	Value     interface{}
+}
+
+//Payload 载荷
+type Payload struct {
+	Timestamp time.Time
+	Metrics   []*Metric
+	Seq       uint64
+	HasSeq    bool //NDEATH 不带序号
+}
+
+//protobuf 字段类型
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+type encoder []byte
+
+func (e *encoder) varint(v uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	*e = append(*e, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+func (e *encoder) key(field int, wire int) {
+	e.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (e *encoder) uint(field int, v uint64) {
+	e.key(field, wireVarint)
+	e.varint(v)
+}
+
+func (e *encoder) bytes(field int, data []byte) {
+	e.key(field, wireBytes)
+	e.varint(uint64(len(data)))
+	*e = append(*e, data...)
+}
+
+func milliseconds(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(time.Millisecond))
+}
+
+//Marshal 编码载荷
+func (p *Payload) Marshal() ([]byte, error) {
+	e := encoder{}
+	if !p.Timestamp.IsZero() {
+		e.uint(1, milliseconds(p.Timestamp))
+	}
+	for _, metric := range p.Metrics {
+		data, err := metric.marshal()
+		if err != nil {
+			return nil, err
+		}
+		e.bytes(2, data)
+	}
+	if p.HasSeq {
+		e.uint(3, p.Seq)
+	}
+	return e, nil
+}
+
+func (m *Metric) marshal() ([]byte, error) {
+	e := encoder{}
+	if m.Name != "" {
+		e.bytes(1, []byte(m.Name))
+	}
+	if m.Alias != 0 {
+		e.uint(2, m.Alias)
+	}
+	if !m.Timestamp.IsZero() {
+		e.uint(3, milliseconds(m.Timestamp))
+	}
+	e.uint(4, uint64(m.DataType))
+	if m.IsNull || m.Value == nil {
+		e.uint(7, 1)
+		return e, nil
+	}
+	value, err := convert(m.DataType, m.Value)
+	if err != nil {
+		return nil, fmt.Errorf("指标 %s: %w", m.Name, err)
+	}
+	switch m.DataType {
+	case Int8, Int16, Int32:
+		e.uint(10, uint64(uint32(int32(value.(int64)))))
+	case UInt8, UInt16, UInt32:
+		e.uint(10, value.(uint64))
+	case Int64:
+		e.uint(11, uint64(value.(int64)))
+	case UInt64:
+		e.uint(11, value.(uint64))
+	case DateTime:
+		e.uint(11, milliseconds(value.(time.Time)))
+	case Float:
+		e.key(12, wireFixed32)
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(value.(float64))))
+		e = append(e, buf...)
+	case Double:
+		e.key(13, wireFixed64)
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, math.Float64bits(value.(float64)))
+		e = append(e, buf...)
+	case Boolean:
+		if value.(bool) {
+			e.uint(14, 1)
+		} else {
+			e.uint(14, 0)
+		}
+	case String, Text:
+		e.bytes(15, []byte(value.(string)))
+	}
+	return e, nil
+}
+
+//convert 数值转换为编码使用的统一类型: 有符号整数 int64，无符号整数 uint64，浮点 float64
+func convert(dataType DataType, value interface{}) (interface{}, error) {
+	switch dataType {
+	case Int8, Int16, Int32, Int64:
+		switch v := value.(type) {
+		case int8:
+			return int64(v), nil
+		case int16:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		}
+	case UInt8, UInt16, UInt32, UInt64:
+		switch v := value.(type) {
+		case uint8:
+			return uint64(v), nil
+		case uint16:
+			return uint64(v), nil
+		case uint32:
+			return uint64(v), nil
+		case uint64:
+			return v, nil
+		}
+	case Float, Double:
+		switch v := value.(type) {
+		case float32:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case Boolean:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case String, Text:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case DateTime:
+		if v, ok := value.(time.Time); ok {
+			return v, nil
+		}
+	default:
+		return nil, fmt.Errorf("不支持的数据类型 %d", dataType)
+	}
+	return nil, fmt.Errorf("数值 %v(%T) 与数据类型 %s 不符", value, value, dataType)
+}
+
+type decoder []byte
+
+func (d *decoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(*d)
+	if n <= 0 {
+		return 0, errors.New("protobuf 数据不完整")
+	}
+	*d = (*d)[n:]
+	return v, nil
+}
+
+func (d *decoder) fixed(size int) ([]byte, error) {
+	if len(*d) < size {
+		return nil, errors.New("protobuf 数据不完整")
+	}
+	data := (*d)[:size]
+	*d = (*d)[size:]
+	return data, nil
+}
+
+//field 读取一个字段，返回字段号、类型、数值(varint)与数据(其他类型)
+func (d *decoder) field() (int, int, uint64, []byte, error) {
+	key, err := d.varint()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	field, wire := int(key>>3), int(key&0x07)
+	switch wire {
+	case wireVarint:
+		v, err := d.varint()
+		return field, wire, v, nil, err
+	case wireFixed64:
+		data, err := d.fixed(8)
+		return field, wire, 0, data, err
+	case wireFixed32:
+		data, err := d.fixed(4)
+		return field, wire, 0, data, err
+	case wireBytes:
+		length, err := d.varint()
+		if err != nil {
+			return 0, 0, 0, nil, err
+		}
+		if length > uint64(len(*d)) {
+			return 0, 0, 0, nil, errors.New("protobuf 数据不完整")
+		}
+		data, err := d.fixed(int(length))
+		return field, wire, 0, data, err
+	default:
+		return 0, 0, 0, nil, fmt.Errorf("不支持的 protobuf 字段类型 %d", wire)
+	}
+}
+
+//Unmarshal 解析载荷，忽略不支持的字段
+func Unmarshal(data []byte) (*Payload, error) {
+	p := &Payload{}
+	d := decoder(data)
+	for len(d) > 0 {
+		field, _, v, bytes, err := d.field()
+		if err != nil {
+			return nil, err
+		}
+		switch field {
+		case 1:
+			p.Timestamp = time.Unix(0, int64(v)*int64(time.Millisecond))
+		case 2:
+			metric, err := unmarshalMetric(bytes)
+			if err != nil {
+				return nil, err
+			}
+			p.Metrics = append(p.Metrics, metric)
+		case 3:
+			p.Seq, p.HasSeq = v, true
+		}
+	}
+	return p, nil
+}
+
+func unmarshalMetric(data []byte) (*Metric, error) {
+	m := &Metric{}
+	d := decoder(data)
+	var raw interface{}
+	for len(d) > 0 {
+		field, _, v, bytes, err := d.field()
+		if err != nil {
+			return nil, err
+		}
+		switch field {
+		case 1:
+			m.Name = string(bytes)
+		case 2:
+			m.Alias = v
+		case 3:
+			m.Timestamp = time.Unix(0, int64(v)*int64(time.Millisecond))
+		case 4:
+			m.DataType = DataType(v)
+		case 7:
+			m.IsNull = v != 0
+		case 10:
+			raw = uint32(v)
+		case 11:
+			raw = v
+		case 12:
+			if len(bytes) == 4 {
+				raw = math.Float32frombits(binary.LittleEndian.Uint32(bytes))
+			}
+		case 13:
+			if len(bytes) == 8 {
+				raw = math.Float64frombits(binary.LittleEndian.Uint64(bytes))
+			}
+		case 14:
+			raw = v != 0
+		case 15:
+			raw = string(bytes)
+		}
+	}
+	if m.IsNull || raw == nil {
+		return m, nil
+	}
+	m.Value = typedValue(m.DataType, raw)
+	return m, nil
+}
+
+//typedValue 按数据类型还原数值，类型未知时保留原始值
+func typedValue(dataType DataType, raw interface{}) interface{} {
+	switch v := raw.(type) {
+	case uint32:
+		switch dataType {
+		case Int8:
+			return int8(v)
+		case Int16:
+			return int16(v)
+		case Int32:
+			return int32(v)
+		case UInt8:
+			return uint8(v)
+		case UInt16:
+			return uint16(v)
+		}
+	case uint64:
+		switch dataType {
+		case Int64:
+			return int64(v)
+		case DateTime:
+			return time.Unix(0, int64(v)*int64(time.Millisecond)).UTC()
+		}
+	}
+	return raw
+}
@@ -0,0 +1,51 @@
+package sparkplug
+
+import (
+	"github.com/wj008/gologix/types"
+	"testing"
+	"time"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	payload := &Payload{Timestamp: now, Seq: 7, HasSeq: true, Metrics: []*Metric{
+		{Name: "SINT", DataType: FromDataType(types.SINT), Value: int8(-5)},
+		{Name: "DINT", DataType: Int32, Value: int32(-100000)},
+		{Name: "LINT", DataType: Int64, Value: int64(-1)},
+		{Name: "UINT", DataType: UInt16, Value: uint16(65535)},
+		{Name: "ULINT", DataType: UInt64, Value: uint64(1 << 63)},
+		{Name: "REAL", DataType: Float, Value: float32(1.5)},
+		{Name: "LREAL", DataType: Double, Value: 2.25},
+		{Name: "BOOL", DataType: Boolean, Value: true},
+		{Name: "STRING", DataType: String, Value: "hello"},
+		{Name: "DATE", DataType: DateTime, Value: now},
+		{Name: "Bad", DataType: Int32, IsNull: true},
+	}}
+	data, err := payload.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Timestamp.Equal(now) || decoded.Seq != 7 || !decoded.HasSeq || len(decoded.Metrics) != len(payload.Metrics) {
+		t.Fatalf("载荷解析错误 %+v", decoded)
+	}
+	for i, metric := range decoded.Metrics {
+		expected := payload.Metrics[i]
+		if metric.Name != expected.Name || metric.DataType != expected.DataType || metric.IsNull != expected.IsNull {
+			t.Fatalf("指标 %s 解析错误 %+v", expected.Name, metric)
+		}
+		if value, ok := expected.Value.(time.Time); ok {
+			if !metric.Value.(time.Time).Equal(value) {
+				t.Fatalf("指标 %s 数值错误 %v", expected.Name, metric.Value)
+			}
+		} else if metric.Value != expected.Value {
+			t.Fatalf("指标 %s 数值错误 %v(%T)", expected.Name, metric.Value, metric.Value)
+		}
+	}
+	if _, err = (&Payload{Metrics: []*Metric{{Name: "A", DataType: Int32, Value: "x"}}}).Marshal(); err == nil {
+		t.Fatal("类型不符应返回错误")
+	}
+}
@@ -0,0 +1,232 @@
+package gologix
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/types"
+	"strings"
+)
+
+//structCodec 结构体元素解析
+type structCodec struct {
+	size   int
+	decode func(data []byte) (interface{}, error)
+}
+
+//RegisterStringType 注册自定义字符串类型，无法读取模板时可手动注册
+func (p *PLC) RegisterStringType(stringType *types.StringType) {
+	p.mutex.Lock()
+	p.stringTypes[stringType.Handle] = stringType
+	p.mutex.Unlock()
+}
+
+//stringTypeOf 根据模板判断是否为字符串类型: 仅包含 LEN(DINT) 与 DATA(SINT数组)
+func stringTypeOf(template *Template) *types.StringType {
+	var length, data *TemplateMember
+	for _, member := range template.Members {
+		if member.Hidden {
+			continue
+		}
+		switch {
+		case member.Name == "LEN" && member.DType == types.DINT && member.ArraySize == 0:
+			length = member
+		case member.Name == "DATA" && member.DType == types.SINT && member.ArraySize > 0:
+			data = member
+		default:
+			return nil
+		}
+	}
+	if length == nil || data == nil {
+		return nil
+	}
+	return &types.StringType{
+		Name:       template.Name,
+		Handle:     template.Handle,
+		Size:       int(template.Size),
+		LenOffset:  int(length.Offset),
+		DataOffset: int(data.Offset),
+		Capacity:   int(data.ArraySize),
+	}
+}
+
+//splitScope 拆分程序作用域与标签路径
+func splitScope(tagName string) (string, string) {
+	if strings.HasPrefix(strings.ToLower(tagName), "program:") {
+		if pos := strings.Index(tagName, "."); pos > 0 {
+			return tagName[:pos], tagName[pos+1:]
+		}
+	}
+	return "", tagName
+}
+
+//LookupSymbol 查找标签符号，首次查找时列出所在作用域的全部标签并缓存
+func (p *PLC) LookupSymbol(tagName string) (*SymbolInfo, error) {
+	scope, path := splitScope(tagName)
+	name := strings.SplitN(path, ".", 2)[0]
+	if pos := strings.Index(name, "["); pos >= 0 {
+		name = name[:pos]
+	}
+	if scope != "" {
+		name = scope + "." + name
+	}
+	key := strings.ToLower(name)
+	p.mutex.Lock()
+	symbol, ok := p.symbols[key]
+	listed := p.listedScopes[strings.ToLower(scope)]
+	p.mutex.Unlock()
+	if ok {
+		return symbol, nil
+	}
+	if !listed {
+		symbols, err := p.ListTags(scope)
+		if err != nil {
+			return nil, err
+		}
+		p.mutex.Lock()
+		for _, item := range symbols {
+			p.symbols[strings.ToLower(item.Name)] = item
+		}
+		p.listedScopes[strings.ToLower(scope)] = true
+		symbol, ok = p.symbols[key]
+		p.mutex.Unlock()
+		if ok {
+			return symbol, nil
+		}
+	}
+	return nil, errors.New("没有找到标签 " + name)
+}
+
+//resolveTemplate 沿成员路径查找标签对应的结构体模板
+func (p *PLC) resolveTemplate(tagName string) (*Template, error) {
+	symbol, err := p.LookupSymbol(tagName)
+	if err != nil {
+		return nil, err
+	}
+	if !symbol.IsStruct() {
+		return nil, errors.New(symbol.Name + " 不是结构体")
+	}
+	template, err := p.ReadTemplate(symbol.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	_, path := splitScope(tagName)
+	parts := strings.Split(path, ".")
+	for _, part := range parts[1:] {
+		if pos := strings.Index(part, "["); pos >= 0 {
+			part = part[:pos]
+		}
+		var found *TemplateMember
+		for _, member := range template.Members {
+			if strings.EqualFold(member.Name, part) {
+				found = member
+				break
+			}
+		}
+		if found == nil || found.DType != types.STRUCT {
+			return nil, errors.New(part + " 不是结构体成员")
+		}
+		if template, err = p.ReadTemplate(found.TemplateID); err != nil {
+			return nil, err
+		}
+	}
+	return template, nil
+}
+
+//stringType 根据结构体句柄查找字符串类型，未注册时通过模板识别
+func (p *PLC) stringType(tagName string, handle uint16) *types.StringType {
+	codec := p.structCodec(tagName, handle)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if codec == nil {
+		return nil
+	}
+	return p.stringTypes[handle]
+}
+
+//structCodec 结构体元素解析器，字符串解析为 string，其他结构体为原始字节，未知结构体返回 nil
+func (p *PLC) structCodec(tagName string, handle uint16) *structCodec {
+	p.mutex.Lock()
+	stringType, ok := p.stringTypes[handle]
+	var template *Template
+	for _, item := range p.templates {
+		if item.Handle == handle {
+			template = item
+			break
+		}
+	}
+	p.mutex.Unlock()
+	if !ok && template == nil {
+		if resolved, err := p.resolveTemplate(tagName); err == nil && resolved.Handle == handle {
+			template = resolved
+		}
+	}
+	if !ok && template != nil {
+		if stringType = stringTypeOf(template); stringType != nil {
+			p.RegisterStringType(stringType)
+			ok = true
+		}
+	}
+	if ok {
+		return &structCodec{size: stringType.Size, decode: func(data []byte) (interface{}, error) {
+			return stringType.Decode(data)
+		}}
+	}
+	if template != nil && template.Size > 0 {
+		return &structCodec{size: int(template.Size), decode: func(data []byte) (interface{}, error) {
+			return append([]byte(nil), data...), nil
+		}}
+	}
+	return nil
+}
+
+//getStructValues 解析结构体应答，句柄只出现一次，之后为连续的元素数据
+func (p *PLC) getStructValues(res *enip.Response, tagName string, elements uint16) ([]interface{}, error) {
+	if len(res.Data) < 2 {
+		return nil, errors.New("读取结构体信息失败")
+	}
+	handle := binary.LittleEndian.Uint16(res.Data)
+	data := res.Data[2:]
+	codec := p.structCodec(tagName, handle)
+	if codec == nil {
+		//未知结构体，返回全部原始数据
+		return []interface{}{append([]byte(nil), data...)}, nil
+	}
+	values := make([]interface{}, 0, elements)
+	for len(values) < int(elements) && len(data) >= codec.size {
+		value, err := codec.decode(data[:codec.size])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		data = data[codec.size:]
+	}
+	if len(values) < int(elements) && len(values) > 0 {
+		//部分应答，补读剩余元素
+		result, err := p.ReadTag(p.offsetTagName(tagName, len(values)), elements-uint16(len(values)))
+		if err != nil {
+			return values, err
+		}
+		values = append(values, result.Values...)
+	}
+	return values, nil
+}
+
+//WriteString 写入 STRING 或自定义字符串类型标签
+func (p *PLC) WriteString(tagName string, value string) error {
+	raw, err := p.ReadRaw(tagName, 1)
+	if err != nil {
+		return err
+	}
+	if raw.DType != types.STRUCT {
+		return errors.New(tagName + " 不是字符串类型")
+	}
+	stringType := p.stringType(tagName, raw.Handle)
+	if stringType == nil {
+		return errors.New(tagName + " 不是字符串类型")
+	}
+	if err = stringType.EncodeTo(raw.Data, value); err != nil {
+		return err
+	}
+	return p.WriteRaw(tagName, raw)
+}
@@ -0,0 +1,57 @@
+package gologix
+
+import (
+	"github.com/wj008/gologix/types"
+	"testing"
+)
+
+func TestStringTypes(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTemplate(3, buildSimTemplate(0x0fce, 88, "STRING", []simMember{
+		{0, uint16(types.DINT), 0, "LEN"},
+		{82, uint16(types.SINT), 4, "DATA"},
+	}))
+	sim.AddTemplate(5, buildSimTemplate(0x3333, 24, "STRING20", []simMember{
+		{0, uint16(types.DINT), 0, "LEN"},
+		{20, uint16(types.SINT), 4, "DATA"},
+	}))
+	names := make([]byte, 0, 88*3)
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		element, _ := types.LogixString.Encode(name)
+		names = append(names, element...)
+	}
+	sim.AddStruct("Names", 3, names)
+	short := &types.StringType{Handle: 0x3333, Size: 24, DataOffset: 4, Capacity: 20}
+	element, _ := short.Encode("short")
+	sim.AddStruct("Label", 5, element)
+	sim.AddTag("Count", types.DINT, []int32{7})
+	plc := connectSim(t, sim, ConnectionOptions{})
+
+	values, err := plc.ReadValues("Names[0]", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[0].String() != "alpha" || values[2].String() != "gamma" {
+		t.Fatalf("STRING 数组读取错误 %v", values)
+	}
+	label, err := plc.ReadString("Label")
+	if err != nil || label != "short" {
+		t.Fatalf("自定义字符串读取错误 %q %v", label, err)
+	}
+	if err = plc.WriteString("Label", "a much longer label!"); err != nil {
+		t.Fatal(err)
+	}
+	if err = plc.WriteString("Label", "this label is far too long"); err == nil {
+		t.Fatal("超出容量应返回错误")
+	}
+	if err = plc.WriteString("Names[1]", "delta"); err != nil {
+		t.Fatal(err)
+	}
+	multi, err := plc.MultiReadTag([]string{"Names[1]", "Label", "Count"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if multi["Names[1]"].Value != "delta" || multi["Label"].Value != "a much longer label!" || multi["Count"].Value != int32(7) {
+		t.Fatalf("批量读取错误 %v %v %v", multi["Names[1]"], multi["Label"], multi["Count"])
+	}
+}
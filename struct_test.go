@@ -0,0 +1,121 @@
+package gologix
+
+import (
+	"bytes"
+	"github.com/wj008/gologix/internal/plcsim"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/types"
+	"strings"
+	"testing"
+)
+
+type testPoint struct {
+	X int16 `plc:"X,offset=0"`
+	Y int16 `plc:"Y,offset=2"`
+}
+
+type testMotor struct {
+	Running bool      `plc:"Running,offset=0,bit=0"`
+	Fault   bool      `plc:"Fault,offset=0,bit=3"`
+	Speed   float32   `plc:"Speed,offset=4"`
+	Counts  [3]int32  `plc:"Counts,offset=8"`
+	Pos     testPoint `plc:"Pos,offset=20"`
+}
+
+//simMember 模板成员定义
+type simMember struct {
+	Info   uint16
+	Type   uint16
+	Offset uint32
+	Name   string
+}
+
+func buildSimTemplate(handle uint16, size uint32, name string, members []simMember) *plcsim.Template {
+	buffer := new(bytes.Buffer)
+	for _, member := range members {
+		lib.WriteByte(buffer, member.Info)
+		lib.WriteByte(buffer, member.Type)
+		lib.WriteByte(buffer, member.Offset)
+	}
+	buffer.WriteString(name + ";n\x00")
+	for _, member := range members {
+		buffer.WriteString(member.Name + "\x00")
+	}
+	return &plcsim.Template{Handle: handle, Size: size, MemberCount: uint16(len(members)), Definition: buffer.Bytes()}
+}
+
+func TestReadIntoWriteFrom(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTemplate(2, buildSimTemplate(0x2222, 4, "POINT", []simMember{
+		{0, uint16(types.INT), 0, "X"},
+		{0, uint16(types.INT), 2, "Y"},
+	}))
+	sim.AddTemplate(1, buildSimTemplate(0x1111, 24, "MOTOR", []simMember{
+		{0, uint16(types.SINT), 0, "ZZZZZZZZZZMOTOR0"},
+		{0, uint16(types.BOOL), 0, "Running"},
+		{3, uint16(types.BOOL), 0, "Fault"},
+		{0, uint16(types.REAL), 4, "Speed"},
+		{3, uint16(types.DINT), 8, "Counts"},
+		{0, 0x8002, 20, "Pos"},
+	}))
+	motor := testMotor{Running: true, Speed: 12.5, Counts: [3]int32{1, 2, 3}, Pos: testPoint{X: -4, Y: 9}}
+	data, err := types.Marshal(&motor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 24 {
+		t.Fatalf("结构体长度错误 %d", len(data))
+	}
+	//未映射的位在写入后应保留
+	data[0] |= 0x20
+	sim.AddStruct("Motor1", 1, data)
+	plc := connectSim(t, sim, ConnectionOptions{})
+
+	got := testMotor{}
+	if err = plc.ReadInto("Motor1", &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != motor {
+		t.Fatalf("读取结果错误 %+v", got)
+	}
+	got.Running = false
+	got.Fault = true
+	got.Pos.Y = 100
+	if err = plc.WriteFrom("Motor1", &got); err != nil {
+		t.Fatal(err)
+	}
+	again := testMotor{}
+	if err = plc.ReadInto("Motor1", &again); err != nil {
+		t.Fatal(err)
+	}
+	if again != got {
+		t.Fatalf("写入结果错误 %+v", again)
+	}
+	raw, err := plc.ReadRaw("Motor1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Data[0] != 0x28 || raw.Handle != 0x1111 {
+		t.Fatalf("原始数据错误 % x 句柄 %x", raw.Data, raw.Handle)
+	}
+
+	symbols, err := plc.ListTags("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) != 1 || symbols[0].Name != "Motor1" || !symbols[0].IsStruct() || symbols[0].TemplateID != 1 {
+		t.Fatalf("标签列表错误 %+v", symbols)
+	}
+	source, err := plc.GenerateStruct(symbols[0].TemplateID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"type MOTOR struct", "type POINT struct", "`plc:\"Fault,offset=0,bit=3\"`", "[3]int32", "Pos "} {
+		if !strings.Contains(source, want) {
+			t.Fatalf("生成代码缺少 %q\n%s", want, source)
+		}
+	}
+	if strings.Contains(source, "ZZZZ") {
+		t.Fatalf("生成代码不应包含隐藏成员\n%s", source)
+	}
+}
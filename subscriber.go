@@ -0,0 +1,483 @@
+package gologix
+
+import (
+	"errors"
+	"github.com/wj008/gologix/types"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Quality 数据质量
+type Quality uint8
+
+const (
+	QualityGood Quality = iota
+	QualityBad
+)
+
+func (q Quality) String() string {
+	if q == QualityGood {
+		return "Good"
+	}
+	return "Bad"
+}
+
+//Deadband 死区，数值变化未超过死区时不触发事件，两者都为0时任何变化都触发
+type Deadband struct {
+	Absolute float64 //绝对值死区
+	Percent  float64 //相对上次值的百分比死区
+}
+
+//ChangeEvent 标签变化事件
+type ChangeEvent struct {
+	Tag      string
+	Time     time.Time
+	DType    types.DataType
+	OldValue interface{}
+	NewValue interface{}
+	Values   []Value //读取到的所有元素，质量为 Bad 时为空
+	Quality  Quality
+	Status   uint8
+	Err      error
+}
+
+//Overrun 扫描超时，一次扫描用时超过扫描周期
+type Overrun struct {
+	Rate    time.Duration
+	Elapsed time.Duration
+	Time    time.Time
+	Tags    int
+}
+
+//TagReader 订阅的数据源，PLC 与 pool.Client 都可以作为数据源
+type TagReader interface {
+	MultiReadTags(requests []ReadRequest) (map[string]*TagResult, error)
+}
+
+//SubscribeOptions 订阅参数
+type SubscribeOptions struct {
+	Elements uint16   //读取的元素数量 默认 1
+	Deadband Deadband //单个元素时的数值死区
+	Always   bool     //每次扫描都触发事件，不论是否变化
+}
+
+//Subscription 订阅句柄，同一标签可以被多个句柄以不同的周期与死区订阅
+type Subscription struct {
+	rate     time.Duration
+	options  SubscribeOptions
+	tags     []string
+	states   map[string]*tagState
+	onChange func([]ChangeEvent)
+}
+
+//tagState 单个标签上次触发事件时的结果
+type tagState struct {
+	value    interface{}
+	values   []Value
+	quality  Quality
+	errText  string
+	reported bool
+}
+
+//scanGroup 相同扫描周期的订阅，同一标签只读取一次
+type scanGroup struct {
+	rate time.Duration
+	subs map[*Subscription]bool
+	stop chan struct{}
+	wake chan struct{}
+}
+
+//poke 立即扫描一次
+func (g *scanGroup) poke() {
+	select {
+	case g.wake <- struct{}{}:
+	default:
+	}
+}
+
+//Subscriber 基于 MultiReadTags 的轮询订阅引擎
+type Subscriber struct {
+	reader    TagReader
+	mutex     sync.Mutex
+	groups    map[time.Duration]*scanGroup
+	tags      map[string]*Subscription //Subscribe 按标签订阅的句柄
+	events    chan ChangeEvent
+	running   bool
+	wg        sync.WaitGroup
+	dropped   uint64
+	overruns  uint64
+	OnChange  func(ChangeEvent)
+	OnOverrun func(Overrun)
+}
+
+//NewSubscriber 创建订阅引擎，buffer 为事件通道容量
+func NewSubscriber(reader TagReader, buffer int) *Subscriber {
+	if buffer <= 0 {
+		buffer = 256
+	}
+	return &Subscriber{
+		reader: reader,
+		groups: make(map[time.Duration]*scanGroup),
+		tags:   make(map[string]*Subscription),
+		events: make(chan ChangeEvent, buffer),
+	}
+}
+
+//Events 变化事件通道，通道已满时事件会被丢弃
+func (s *Subscriber) Events() <-chan ChangeEvent {
+	return s.events
+}
+
+//Subscribe 订阅标签，事件发送到 Events 与 OnChange，同一标签重复订阅会移到新的扫描周期
+func (s *Subscriber) Subscribe(tag string, rate time.Duration, deadband Deadband) error {
+	sub, err := newSubscription([]string{tag}, rate, SubscribeOptions{Deadband: deadband}, s.emit)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if old, ok := s.tags[tag]; ok {
+		s.removeLocked(old)
+	}
+	s.tags[tag] = sub
+	s.addLocked(sub)
+	return nil
+}
+
+//Unsubscribe 取消 Subscribe 的订阅
+func (s *Subscriber) Unsubscribe(tag string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if sub, ok := s.tags[tag]; ok {
+		s.removeLocked(sub)
+		delete(s.tags, tag)
+	}
+}
+
+//Add 订阅一组标签，每次扫描后变化的标签通过 onChange 一起通知，首次扫描通知所有标签。
+//onChange 在扫描协程中调用，不可阻塞；Remove 时正在进行的扫描仍可能通知一次
+func (s *Subscriber) Add(tags []string, rate time.Duration, options SubscribeOptions, onChange func([]ChangeEvent)) (*Subscription, error) {
+	sub, err := newSubscription(tags, rate, options, onChange)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.addLocked(sub)
+	return sub, nil
+}
+
+//Remove 取消 Add 的订阅
+func (s *Subscriber) Remove(sub *Subscription) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.removeLocked(sub)
+}
+
+//Refresh 所有扫描组立即扫描一次，如写入后尽快得到新值
+func (s *Subscriber) Refresh() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, group := range s.groups {
+		group.poke()
+	}
+}
+
+func newSubscription(tags []string, rate time.Duration, options SubscribeOptions, onChange func([]ChangeEvent)) (*Subscription, error) {
+	if rate <= 0 {
+		return nil, errors.New("扫描周期必须大于0")
+	}
+	if options.Deadband.Absolute < 0 || options.Deadband.Percent < 0 {
+		return nil, errors.New("死区不能为负数")
+	}
+	if len(tags) == 0 {
+		return nil, errors.New("订阅的标签为空")
+	}
+	if options.Elements == 0 {
+		options.Elements = 1
+	}
+	sub := &Subscription{rate: rate, options: options, states: make(map[string]*tagState), onChange: onChange}
+	for _, tag := range tags {
+		if _, ok := sub.states[tag]; !ok {
+			sub.states[tag] = &tagState{}
+			sub.tags = append(sub.tags, tag)
+		}
+	}
+	return sub, nil
+}
+
+//addLocked 加入扫描组，已在扫描的组立即扫描一次，需持有 mutex
+func (s *Subscriber) addLocked(sub *Subscription) {
+	group, ok := s.groups[sub.rate]
+	if !ok {
+		group = &scanGroup{rate: sub.rate, subs: make(map[*Subscription]bool), wake: make(chan struct{}, 1)}
+		s.groups[sub.rate] = group
+		if s.running {
+			s.startGroup(group)
+		}
+	} else {
+		group.poke()
+	}
+	group.subs[sub] = true
+}
+
+//removeLocked 从扫描组删除，组为空时停止扫描，需持有 mutex
+func (s *Subscriber) removeLocked(sub *Subscription) {
+	group, ok := s.groups[sub.rate]
+	if !ok || !group.subs[sub] {
+		return
+	}
+	delete(group.subs, sub)
+	if len(group.subs) == 0 {
+		if group.stop != nil {
+			close(group.stop)
+		}
+		delete(s.groups, sub.rate)
+	}
+}
+
+//emit Subscribe 订阅的事件发送到 OnChange 与事件通道
+func (s *Subscriber) emit(events []ChangeEvent) {
+	s.mutex.Lock()
+	onChange := s.OnChange
+	s.mutex.Unlock()
+	for _, event := range events {
+		if onChange != nil {
+			onChange(event)
+		}
+		select {
+		case s.events <- event:
+		default:
+			s.mutex.Lock()
+			s.dropped++
+			s.mutex.Unlock()
+		}
+	}
+}
+
+//Start 开始扫描
+func (s *Subscriber) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	for _, group := range s.groups {
+		s.startGroup(group)
+	}
+}
+
+//Stop 停止扫描并等待扫描协程退出
+func (s *Subscriber) Stop() {
+	s.mutex.Lock()
+	if !s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = false
+	for _, group := range s.groups {
+		if group.stop != nil {
+			close(group.stop)
+			group.stop = nil
+		}
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+//Stats 获取丢弃事件数与扫描超时次数
+func (s *Subscriber) Stats() (dropped uint64, overruns uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.dropped, s.overruns
+}
+
+//startGroup 启动扫描协程，需持有 mutex
+func (s *Subscriber) startGroup(group *scanGroup) {
+	stop := make(chan struct{})
+	group.stop = stop
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(group.rate)
+		defer ticker.Stop()
+		for {
+			s.scan(group)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case <-group.wake:
+			}
+		}
+	}()
+}
+
+//notice 一个订阅在一次扫描中的事件
+type notice struct {
+	onChange func([]ChangeEvent)
+	events   []ChangeEvent
+}
+
+//scan 扫描一次标签组，同一标签按最大元素数量读取一次
+func (s *Subscriber) scan(group *scanGroup) {
+	s.mutex.Lock()
+	elements := make(map[string]uint16)
+	for sub := range group.subs {
+		for _, tag := range sub.tags {
+			if sub.options.Elements > elements[tag] {
+				elements[tag] = sub.options.Elements
+			}
+		}
+	}
+	s.mutex.Unlock()
+	if len(elements) == 0 {
+		return
+	}
+	requests := make([]ReadRequest, 0, len(elements))
+	for tag, count := range elements {
+		requests = append(requests, ReadRequest{Tag: tag, Elements: count})
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Tag < requests[j].Tag
+	})
+	start := time.Now()
+	results, err := s.reader.MultiReadTags(requests)
+	now := time.Now()
+	elapsed := now.Sub(start)
+
+	notices := make([]notice, 0)
+	s.mutex.Lock()
+	for sub := range group.subs {
+		var events []ChangeEvent
+		for _, tag := range sub.tags {
+			//读取期间加入的订阅在下次扫描时通知
+			if elements[tag] < sub.options.Elements {
+				continue
+			}
+			state := sub.states[tag]
+			event := state.event(tag, now, results[tag], err, sub.options.Elements)
+			if !sub.options.Always && !state.changed(event, sub.options.Deadband) {
+				continue
+			}
+			state.update(event)
+			events = append(events, event)
+		}
+		if len(events) > 0 && sub.onChange != nil {
+			notices = append(notices, notice{onChange: sub.onChange, events: events})
+		}
+	}
+	overrun := elapsed > group.rate
+	if overrun {
+		s.overruns++
+	}
+	onOverrun := s.OnOverrun
+	s.mutex.Unlock()
+
+	for _, n := range notices {
+		n.onChange(n.events)
+	}
+	if overrun && onOverrun != nil {
+		onOverrun(Overrun{Rate: group.rate, Elapsed: elapsed, Time: now, Tags: len(requests)})
+	}
+}
+
+//event 由读取结果生成事件，读取失败时保留上次的数值
+func (t *tagState) event(tag string, now time.Time, result *TagResult, err error, elements uint16) ChangeEvent {
+	event := ChangeEvent{Tag: tag, Time: now, OldValue: t.value, NewValue: t.value, Quality: QualityBad, Err: err}
+	if err != nil {
+		return event
+	}
+	if result != nil {
+		event.DType, event.Status = result.DType, result.Status
+	}
+	values, err := result.Elements(elements)
+	if err != nil {
+		event.Err = err
+		return event
+	}
+	event.Quality, event.Values, event.NewValue = QualityGood, values, values[0].Data
+	return event
+}
+
+//update 记录触发事件的结果
+func (t *tagState) update(event ChangeEvent) {
+	t.reported = true
+	t.quality = event.Quality
+	t.errText = errorText(event.Err)
+	t.value = event.NewValue
+	t.values = event.Values
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+//changed 判断是否需要触发事件，质量为 Bad 时错误变化也触发，多个元素时比较是否相等
+func (t *tagState) changed(event ChangeEvent, deadband Deadband) bool {
+	if !t.reported || t.quality != event.Quality {
+		return true
+	}
+	if event.Quality == QualityBad {
+		return t.errText != errorText(event.Err)
+	}
+	if len(event.Values) > 1 {
+		return !reflect.DeepEqual(t.values, event.Values)
+	}
+	oldValue, ok1 := toFloat64(t.value)
+	newValue, ok2 := toFloat64(event.NewValue)
+	if !ok1 || !ok2 {
+		return !reflect.DeepEqual(t.value, event.NewValue)
+	}
+	diff := math.Abs(newValue - oldValue)
+	if diff == 0 {
+		return false
+	}
+	if deadband.Absolute > 0 && diff <= deadband.Absolute {
+		return false
+	}
+	if deadband.Percent > 0 {
+		if oldValue == 0 {
+			return true
+		}
+		if diff/math.Abs(oldValue)*100 <= deadband.Percent {
+			return false
+		}
+	}
+	return true
+}
+
+//toFloat64 数值转换，布尔值不参与死区计算
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,109 @@
+package gologix
+
+import (
+	"github.com/wj008/gologix/types"
+	"testing"
+	"time"
+)
+
+func TestSubscriberDeadband(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTag("P_REAL", types.REAL, []float32{10, 20})
+	sim.AddTag("A_DINT", types.DINT, []int32{1})
+	plc := connectSim(t, sim, ConnectionOptions{})
+	sub := NewSubscriber(plc, 16)
+	if err := sub.Subscribe("P_REAL[0]", 10*time.Millisecond, Deadband{Absolute: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Subscribe("A_DINT", 10*time.Millisecond, Deadband{}); err != nil {
+		t.Fatal(err)
+	}
+	sub.Start()
+	defer sub.Stop()
+
+	next := func() ChangeEvent {
+		select {
+		case event := <-sub.Events():
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("等待事件超时")
+		}
+		return ChangeEvent{}
+	}
+	initial := map[string]interface{}{}
+	for i := 0; i < 2; i++ {
+		event := next()
+		if event.Quality != QualityGood || event.OldValue != nil {
+			t.Fatalf("首次事件错误 %+v", event)
+		}
+		initial[event.Tag] = event.NewValue
+	}
+	if initial["P_REAL[0]"] != float32(10) || initial["A_DINT"] != int32(1) {
+		t.Fatalf("初始值错误 %v", initial)
+	}
+	//死区内的变化不触发
+	sim.AddTag("P_REAL", types.REAL, []float32{10.5, 20})
+	time.Sleep(50 * time.Millisecond)
+	sim.AddTag("P_REAL", types.REAL, []float32{12, 20})
+	event := next()
+	if event.Tag != "P_REAL[0]" || event.OldValue != float32(10) || event.NewValue != float32(12) {
+		t.Fatalf("变化事件错误 %+v", event)
+	}
+	//标签删除后质量变差
+	sim.RemoveTag("A_DINT")
+	event = next()
+	if event.Tag != "A_DINT" || event.Quality != QualityBad {
+		t.Fatalf("质量事件错误 %+v", event)
+	}
+}
+
+func TestSubscriberShared(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTag("Trend", types.DINT, []int32{1, 2, 3})
+	plc := connectSim(t, sim, ConnectionOptions{})
+	sub := NewSubscriber(plc, 16)
+	sub.Start()
+	defer sub.Stop()
+	changes := make(chan []ChangeEvent, 16)
+	samples := make(chan []ChangeEvent, 16)
+	onChange := func(events []ChangeEvent) {
+		changes <- events
+	}
+	onSample := func(events []ChangeEvent) {
+		select {
+		case samples <- events:
+		default:
+		}
+	}
+	//同一标签被两个句柄以不同元素数量订阅
+	if _, err := sub.Add([]string{"Trend", "Missing"}, 10*time.Millisecond, SubscribeOptions{Elements: 3}, onChange); err != nil {
+		t.Fatal(err)
+	}
+	always, err := sub.Add([]string{"Trend"}, 10*time.Millisecond, SubscribeOptions{Always: true}, onSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(ch chan []ChangeEvent) []ChangeEvent {
+		select {
+		case events := <-ch:
+			return events
+		case <-time.After(2 * time.Second):
+			t.Fatal("等待事件超时")
+		}
+		return nil
+	}
+	events := next(changes)
+	if len(events) != 2 || len(events[0].Values) != 3 || events[0].Values[2].Data != int32(3) || events[1].Quality != QualityBad {
+		t.Fatalf("首次事件错误 %+v", events)
+	}
+	for i := 0; i < 3; i++ {
+		if events = next(samples); len(events) != 1 || events[0].NewValue != int32(1) {
+			t.Fatalf("周期事件错误 %+v", events)
+		}
+	}
+	sub.Remove(always)
+	sim.AddTag("Trend", types.DINT, []int32{1, 2, 4})
+	if events = next(changes); len(events) != 1 || events[0].Values[2].Data != int32(4) {
+		t.Fatalf("变化事件错误 %+v", events)
+	}
+}
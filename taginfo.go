@@ -0,0 +1,193 @@
+package gologix
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/types"
+	"strings"
+)
+
+//符号对象属性: 9 常量标志, 10 外部访问
+const (
+	symbolAttrConstant       = 0x09
+	symbolAttrExternalAccess = 0x0a
+)
+
+//ErrNotWritable 开启 CheckAccess 时写入只读、无访问权限或常量标签
+var ErrNotWritable = errors.New("标签不能写入")
+
+//ExternalAccess 标签外部访问权限
+type ExternalAccess uint8
+
+const (
+	ExternalAccessReadWrite ExternalAccess = 0
+	ExternalAccessReadOnly  ExternalAccess = 2
+	ExternalAccessNone      ExternalAccess = 3
+)
+
+func (a ExternalAccess) String() string {
+	switch a {
+	case ExternalAccessReadWrite:
+		return "Read/Write"
+	case ExternalAccessReadOnly:
+		return "Read Only"
+	case ExternalAccessNone:
+		return "None"
+	default:
+		return "Unknown"
+	}
+}
+
+//TagInfo 标签元数据，成员路径的访问权限与常量标志继承自所属标签
+type TagInfo struct {
+	Name           string
+	DType          types.DataType
+	Handle         uint16 //结构体句柄，仅结构体有效
+	TemplateID     uint16
+	Dims           []uint32 //数组维度，非数组为空
+	ElementSize    uint16
+	ExternalAccess ExternalAccess
+	Constant       bool
+}
+
+//IsStruct 是否为结构体
+func (t *TagInfo) IsStruct() bool {
+	return t.DType == types.STRUCT
+}
+
+//Writable 外部是否可写入
+func (t *TagInfo) Writable() bool {
+	return t.ExternalAccess == ExternalAccessReadWrite && !t.Constant
+}
+
+//TagInfo 读取标签元数据: 数据类型、结构体句柄、数组维度、元素长度、外部访问与常量标志，结果会被缓存
+func (p *PLC) TagInfo(tagName string) (*TagInfo, error) {
+	key := tagInfoKey(tagName)
+	p.mutex.Lock()
+	cached, ok := p.tagInfos[key]
+	p.mutex.Unlock()
+	if ok {
+		return cached.clone(tagName), nil
+	}
+	symbol, err := p.LookupSymbol(tagName)
+	if err != nil {
+		return nil, err
+	}
+	p.Println("TagInfo", tagName)
+	scope, path := splitScope(tagName)
+	request := &enip.MessageRouterRequest{
+		Service:     enip.ServiceGetAttributeList,
+		RequestPath: symbolPath(scope, classSymbol, symbol.Instance),
+		RequestData: []byte{0x02, 0x00, symbolAttrConstant, 0x00, symbolAttrExternalAccess, 0x00},
+	}
+	res, err := p.sendRequest(request.Buffer(), trafficRead, true)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status != 0 {
+		return nil, statusError(tagName, res.Status)
+	}
+	attributes, err := parseAttributeList(res.Data, map[uint16]int{symbolAttrConstant: 1, symbolAttrExternalAccess: 1})
+	if err != nil {
+		return nil, err
+	}
+	info := &TagInfo{
+		Name:           tagName,
+		DType:          symbol.DType,
+		TemplateID:     symbol.TemplateID,
+		Dims:           append([]uint32(nil), symbol.Dims...),
+		ElementSize:    symbol.ElementSize,
+		ExternalAccess: ExternalAccess(attributes[symbolAttrExternalAccess]),
+		Constant:       attributes[symbolAttrConstant] != 0,
+	}
+	//沿成员路径查找成员类型
+	parts := strings.Split(path, ".")
+	for _, part := range parts[1:] {
+		if lib.IsInteger(part) {
+			info.DType, info.TemplateID, info.Dims, info.ElementSize = types.BOOL, 0, nil, 1
+			break
+		}
+		if !info.IsStruct() {
+			return nil, errors.New(part + " 不是结构体成员")
+		}
+		template, err := p.ReadTemplate(info.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+		if pos := strings.Index(part, "["); pos >= 0 {
+			part = part[:pos]
+		}
+		var found *TemplateMember
+		for _, member := range template.Members {
+			if strings.EqualFold(member.Name, part) && !member.Hidden {
+				found = member
+				break
+			}
+		}
+		if found == nil {
+			return nil, errors.New("没有找到成员 " + part)
+		}
+		info.DType, info.TemplateID, info.Dims = found.DType, found.TemplateID, nil
+		info.ElementSize = types.GetByteCount(found.DType)
+		if found.ArraySize > 0 {
+			info.Dims = []uint32{uint32(found.ArraySize)}
+		}
+	}
+	if info.IsStruct() {
+		template, err := p.ReadTemplate(info.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+		info.Handle = template.Handle
+		info.ElementSize = uint16(template.Size)
+	}
+	p.mutex.Lock()
+	p.tagInfos[key] = info
+	p.mutex.Unlock()
+	return info.clone(tagName), nil
+}
+
+//clone 复制缓存的元数据，调用方修改返回值不影响缓存
+func (t *TagInfo) clone(name string) *TagInfo {
+	info := *t
+	info.Name = name
+	info.Dims = append([]uint32(nil), t.Dims...)
+	return &info
+}
+
+//tagInfoKey 缓存键，忽略数组下标
+func tagInfoKey(tagName string) string {
+	builder := strings.Builder{}
+	depth := 0
+	for _, char := range strings.ToLower(tagName) {
+		switch {
+		case char == '[':
+			depth++
+		case char == ']':
+			depth--
+		case depth == 0:
+			builder.WriteRune(char)
+		}
+	}
+	return builder.String()
+}
+
+//checkWritable 启用 CheckAccess 时检查标签是否可写入
+func (p *PLC) checkWritable(tagName string) error {
+	if !p.CheckAccess {
+		return nil
+	}
+	info, err := p.TagInfo(tagName)
+	if err != nil {
+		return err
+	}
+	if info.Constant {
+		return fmt.Errorf("%s 为常量: %w", tagName, ErrNotWritable)
+	}
+	if info.ExternalAccess != ExternalAccessReadWrite {
+		return fmt.Errorf("%s 外部访问为 %s: %w", tagName, info.ExternalAccess, ErrNotWritable)
+	}
+	return nil
+}
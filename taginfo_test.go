@@ -0,0 +1,84 @@
+package gologix
+
+import (
+	"github.com/wj008/gologix/types"
+	"testing"
+)
+
+func TestTagInfo(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTemplate(2, buildSimTemplate(0x2222, 4, "POINT", []simMember{
+		{0, uint16(types.INT), 0, "X"},
+		{0, uint16(types.INT), 2, "Y"},
+	}))
+	sim.AddTemplate(1, buildSimTemplate(0x1111, 24, "MOTOR", []simMember{
+		{0, uint16(types.SINT), 0, "ZZZZZZZZZZMOTOR0"},
+		{0, uint16(types.BOOL), 0, "Running"},
+		{0, uint16(types.REAL), 4, "Speed"},
+		{3, uint16(types.DINT), 8, "Counts"},
+		{0, 0x8002, 20, "Pos"},
+	}))
+	sim.AddStruct("Motor1", 1, make([]byte, 24))
+	sim.AddArray("Grid", types.DINT, []uint32{2, 3}, make([]int32, 6))
+	sim.AddTag("Setpoint", types.REAL, []float32{0})
+	sim.AddTag("Limit", types.DINT, []int32{100})
+	sim.AddTag("Status", types.DINT, []int32{0})
+	sim.SetAccess("Limit", uint8(ExternalAccessReadWrite), true)
+	sim.SetAccess("Status", uint8(ExternalAccessReadOnly), false)
+	plc := connectSim(t, sim, ConnectionOptions{})
+
+	info, err := plc.TagInfo("Grid[1,2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DType != types.DINT || len(info.Dims) != 2 || info.Dims[1] != 3 || info.ElementSize != 4 || !info.Writable() {
+		t.Fatalf("Grid 信息错误 %+v", info)
+	}
+	//修改返回值不影响缓存
+	info.Dims[1], info.DType = 0, types.NULL
+	if info, err = plc.TagInfo("Grid"); err != nil || info.DType != types.DINT || info.Dims[1] != 3 {
+		t.Fatalf("缓存被修改 %+v %v", info, err)
+	}
+	info, err = plc.TagInfo("Motor1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsStruct() || info.Handle != 0x1111 || info.ElementSize != 24 {
+		t.Fatalf("Motor1 信息错误 %+v", info)
+	}
+	info, err = plc.TagInfo("Motor1.Pos")
+	if err != nil || info.Handle != 0x2222 || info.ElementSize != 4 {
+		t.Fatalf("Motor1.Pos 信息错误 %+v %v", info, err)
+	}
+	info, err = plc.TagInfo("Motor1.Counts")
+	if err != nil || info.DType != types.DINT || len(info.Dims) != 1 || info.Dims[0] != 3 {
+		t.Fatalf("Motor1.Counts 信息错误 %+v %v", info, err)
+	}
+	info, _ = plc.TagInfo("Status")
+	if info.ExternalAccess != ExternalAccessReadOnly || info.Writable() {
+		t.Fatalf("Status 访问权限错误 %s", info.ExternalAccess)
+	}
+	info, _ = plc.TagInfo("Limit")
+	if !info.Constant {
+		t.Fatal("Limit 应为常量")
+	}
+
+	//未开启检查时直接发送
+	if err = plc.WriteTag("Status", 1); err != nil {
+		t.Fatal(err)
+	}
+	plc.CheckAccess = true
+	if err = plc.WriteTag("Status", 2); err == nil {
+		t.Fatal("只读标签写入应返回错误")
+	}
+	if err = plc.WriteTag("Limit.0", true); err == nil {
+		t.Fatal("常量标签写入应返回错误")
+	}
+	if err = plc.WriteTag("Setpoint", 1.5); err != nil {
+		t.Fatal(err)
+	}
+	status, _ := plc.ReadInt32("Status")
+	if status != 1 {
+		t.Fatalf("只读标签不应被写入 %d", status)
+	}
+}
@@ -0,0 +1,426 @@
+package gologix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/epath"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/types"
+	"go/format"
+	"strings"
+	"unicode"
+)
+
+const (
+	classSymbol   = 0x6b
+	classTemplate = 0x6c
+)
+
+//SymbolInfo 控制器中的标签符号
+type SymbolInfo struct {
+	Name        string
+	Instance    uint32
+	Type        uint16         //原始符号类型
+	DType       types.DataType //基本类型，结构体为 STRUCT
+	TemplateID  uint16         //结构体模板实例ID
+	ElementSize uint16
+	Dims        []uint32 //数组维度，非数组为空
+	System      bool
+}
+
+//IsStruct 是否为结构体
+func (s *SymbolInfo) IsStruct() bool {
+	return s.DType == types.STRUCT
+}
+
+//parseSymbolType 解析符号类型: 第15位结构体，13-14位维数，12位系统标签，低12位为类型或模板ID
+func (s *SymbolInfo) parseSymbolType() {
+	s.System = s.Type&0x1000 != 0
+	if s.Type&0x8000 != 0 {
+		s.DType = types.STRUCT
+		s.TemplateID = s.Type & 0x0fff
+	} else {
+		s.DType = types.DataType(s.Type & 0x00ff)
+	}
+}
+
+//TemplateMember 模板成员
+type TemplateMember struct {
+	Name       string
+	DType      types.DataType //基本类型，结构体为 STRUCT
+	TemplateID uint16         //结构体成员的模板实例ID
+	ArraySize  uint16         //数组长度，BIT_STRING 为 DWORD 数量
+	Bit        int            //BOOL 成员的位号，其他为 -1
+	Offset     uint32
+	Hidden     bool //存放 BOOL 的隐藏成员
+}
+
+//Template 结构体模板(UDT)定义
+type Template struct {
+	ID      uint16
+	Handle  uint16 //结构体句柄(CRC)，与读取应答中的句柄一致
+	Name    string
+	Size    uint32 //结构体数据长度
+	Members []*TemplateMember
+}
+
+//symbolPath 符号对象路径，program 非空时为程序作用域
+func symbolPath(program string, class uint32, instance uint32) []byte {
+	path := epath.Path{}
+	if program != "" {
+		path = append(path, &epath.SymbolicSegment{Name: program})
+	}
+	path = append(path,
+		&epath.LogicalSegment{Kind: epath.LogicalTypeClassID, Value: class},
+		&epath.LogicalSegment{Kind: epath.LogicalTypeInstanceID, Value: instance},
+	)
+	return path.Bytes(true)
+}
+
+//ListTags 列出控制器作用域的标签，program 非空(如 Program:MainProgram)时列出程序标签
+func (p *PLC) ListTags(program string) ([]*SymbolInfo, error) {
+	p.Println("ListTags", program)
+	symbols := make([]*SymbolInfo, 0)
+	instance := uint32(0)
+	for {
+		//属性: 2 符号类型, 7 元素长度, 8 数组维度, 1 名称
+		request := &enip.MessageRouterRequest{
+			Service:     enip.ServiceGetInstanceAttributeList,
+			RequestPath: symbolPath(program, classSymbol, instance),
+			RequestData: []byte{0x04, 0x00, 0x02, 0x00, 0x07, 0x00, 0x08, 0x00, 0x01, 0x00},
+		}
+		res, err := p.sendRequest(request.Buffer(), trafficRead, true)
+		if err != nil {
+			return nil, err
+		}
+		if res.Status != 0 && res.Status != 6 {
+			return nil, statusError("ListTags", res.Status)
+		}
+		items, last, err := parseSymbolList(res.Data)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if program != "" {
+				item.Name = program + "." + item.Name
+			}
+			symbols = append(symbols, item)
+		}
+		if res.Status == 0 || len(items) == 0 {
+			return symbols, nil
+		}
+		instance = last + 1
+	}
+}
+
+//parseSymbolList 解析符号实例属性列表，返回最后一个实例ID
+func parseSymbolList(data []byte) ([]*SymbolInfo, uint32, error) {
+	items := make([]*SymbolInfo, 0)
+	last := uint32(0)
+	reader := bytes.NewReader(data)
+	for reader.Len() > 0 {
+		if reader.Len() < 22 {
+			return nil, 0, errors.New("符号列表数据不完整")
+		}
+		item := &SymbolInfo{}
+		dims := [3]uint32{}
+		nameLen := uint16(0)
+		lib.ReadByte(reader, &item.Instance)
+		lib.ReadByte(reader, &item.Type)
+		lib.ReadByte(reader, &item.ElementSize)
+		lib.ReadByte(reader, &dims)
+		lib.ReadByte(reader, &nameLen)
+		if reader.Len() < int(nameLen) {
+			return nil, 0, errors.New("符号列表数据不完整")
+		}
+		name := make([]byte, nameLen)
+		lib.ReadByte(reader, name)
+		item.Name = string(name)
+		item.parseSymbolType()
+		for _, dim := range dims {
+			if dim > 0 {
+				item.Dims = append(item.Dims, dim)
+			}
+		}
+		last = item.Instance
+		items = append(items, item)
+	}
+	return items, last, nil
+}
+
+//ReadTemplate 读取结构体模板定义，结果会被缓存
+func (p *PLC) ReadTemplate(id uint16) (*Template, error) {
+	p.mutex.Lock()
+	template, ok := p.templates[id]
+	p.mutex.Unlock()
+	if ok {
+		return template, nil
+	}
+	p.Println("ReadTemplate", id)
+	//属性: 4 定义长度(字), 5 结构体长度, 2 成员数量, 1 结构体句柄
+	request := &enip.MessageRouterRequest{
+		Service:     enip.ServiceGetAttributeList,
+		RequestPath: symbolPath("", classTemplate, uint32(id)),
+		RequestData: []byte{0x04, 0x00, 0x04, 0x00, 0x05, 0x00, 0x02, 0x00, 0x01, 0x00},
+	}
+	res, err := p.sendRequest(request.Buffer(), trafficRead, true)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status != 0 {
+		return nil, statusError("ReadTemplate", res.Status)
+	}
+	attributes, err := parseAttributeList(res.Data, map[uint16]int{4: 4, 5: 4})
+	if err != nil {
+		return nil, err
+	}
+	definitionSize := attributes[4]
+	memberCount := int(attributes[2])
+	template = &Template{ID: id, Handle: uint16(attributes[1]), Size: attributes[5]}
+	if definitionSize*4 < 21 {
+		return nil, errors.New("模板定义长度不正确")
+	}
+	total := definitionSize*4 - 21
+	data := make([]byte, 0, total)
+	for uint32(len(data)) < total {
+		requestData := new(bytes.Buffer)
+		lib.WriteByte(requestData, uint32(len(data)))
+		lib.WriteByte(requestData, uint16(total-uint32(len(data))))
+		request = &enip.MessageRouterRequest{
+			Service:     enip.ServiceReadTemplate,
+			RequestPath: symbolPath("", classTemplate, uint32(id)),
+			RequestData: requestData.Bytes(),
+		}
+		res, err = p.sendRequest(request.Buffer(), trafficRead, true)
+		if err != nil {
+			return nil, err
+		}
+		if res.Status != 0 && res.Status != 6 {
+			return nil, statusError("ReadTemplate", res.Status)
+		}
+		data = append(data, res.Data...)
+		if res.Status == 0 || len(res.Data) == 0 {
+			break
+		}
+	}
+	if err = template.parse(data, memberCount); err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	p.templates[id] = template
+	p.mutex.Unlock()
+	return template, nil
+}
+
+//parseAttributeList 解析 Get Attribute List 应答，返回属性ID与数值，sizes 指定属性长度，默认2字节
+func parseAttributeList(data []byte, sizes map[uint16]int) (map[uint16]uint32, error) {
+	if len(data) < 2 {
+		return nil, errors.New("属性列表数据不完整")
+	}
+	count := int(binary.LittleEndian.Uint16(data))
+	values := make(map[uint16]uint32)
+	pos := 2
+	for i := 0; i < count; i++ {
+		if pos+4 > len(data) {
+			return nil, errors.New("属性列表数据不完整")
+		}
+		id := binary.LittleEndian.Uint16(data[pos:])
+		status := binary.LittleEndian.Uint16(data[pos+2:])
+		pos += 4
+		if status != 0 {
+			return nil, fmt.Errorf("读取属性 %d 失败 0x%x", id, status)
+		}
+		size, ok := sizes[id]
+		if !ok {
+			size = 2
+		}
+		if pos+size > len(data) {
+			return nil, errors.New("属性列表数据不完整")
+		}
+		switch size {
+		case 1:
+			values[id] = uint32(data[pos])
+		case 4:
+			values[id] = binary.LittleEndian.Uint32(data[pos:])
+		default:
+			values[id] = uint32(binary.LittleEndian.Uint16(data[pos:]))
+		}
+		pos += size
+	}
+	return values, nil
+}
+
+//IsString 是否为字符串类型(STRING 或自定义字符串)，读取时解析为 string
+func (t *Template) IsString() bool {
+	return stringTypeOf(t) != nil
+}
+
+//parse 解析模板定义: 每个成员8字节(信息、类型、偏移量)，之后为以0结尾的模板名称与成员名称
+func (t *Template) parse(data []byte, memberCount int) error {
+	if len(data) < memberCount*8 {
+		return errors.New("模板定义数据不完整")
+	}
+	reader := bytes.NewReader(data)
+	t.Members = make([]*TemplateMember, 0, memberCount)
+	for i := 0; i < memberCount; i++ {
+		var info, memberType uint16
+		member := &TemplateMember{Bit: -1}
+		lib.ReadByte(reader, &info)
+		lib.ReadByte(reader, &memberType)
+		lib.ReadByte(reader, &member.Offset)
+		if memberType&0x8000 != 0 {
+			member.DType = types.STRUCT
+			member.TemplateID = memberType & 0x0fff
+			member.ArraySize = info
+		} else {
+			member.DType = types.DataType(memberType & 0x00ff)
+			if member.DType == types.BOOL {
+				member.Bit = int(info)
+			} else {
+				member.ArraySize = info
+			}
+		}
+		t.Members = append(t.Members, member)
+	}
+	names := strings.Split(string(data[memberCount*8:]), "\x00")
+	if len(names) == 0 || names[0] == "" {
+		return errors.New("模板名称为空")
+	}
+	t.Name = strings.SplitN(names[0], ";", 2)[0]
+	for i, member := range t.Members {
+		if i+1 < len(names) {
+			member.Name = names[i+1]
+		}
+		member.Hidden = member.Name == "" || strings.HasPrefix(member.Name, "ZZZZZZZZZZ") || strings.HasPrefix(member.Name, "__")
+	}
+	return nil
+}
+
+//GenerateStruct 读取模板及其嵌套模板，生成带 plc 字段标签的 Go 结构体代码
+func (p *PLC) GenerateStruct(id uint16) (string, error) {
+	templates := make([]*Template, 0)
+	seen := make(map[uint16]bool)
+	queue := []uint16{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		template, err := p.ReadTemplate(current)
+		if err != nil {
+			return "", err
+		}
+		templates = append(templates, template)
+		for _, member := range template.Members {
+			if member.DType == types.STRUCT && !member.Hidden {
+				queue = append(queue, member.TemplateID)
+			}
+		}
+	}
+	return GenerateGoStructs(templates)
+}
+
+//GenerateGoStructs 根据模板生成 Go 结构体代码，嵌套模板需包含在 templates 中
+func GenerateGoStructs(templates []*Template) (string, error) {
+	byID := make(map[uint16]*Template)
+	for _, template := range templates {
+		byID[template.ID] = template
+	}
+	buffer := new(bytes.Buffer)
+	for _, template := range templates {
+		fmt.Fprintf(buffer, "//%s 模板 %s, 句柄 0x%04x, 长度 %d\n", goName(template.Name), template.Name, template.Handle, template.Size)
+		fmt.Fprintf(buffer, "type %s struct {\n", goName(template.Name))
+		for _, member := range template.Members {
+			if member.Hidden {
+				continue
+			}
+			goType, options, err := memberGoType(member, byID)
+			if err != nil {
+				fmt.Fprintf(buffer, "//%s %v\n", member.Name, err)
+				continue
+			}
+			fmt.Fprintf(buffer, "%s %s `plc:\"%s,offset=%d%s\"`\n", goName(member.Name), goType, member.Name, member.Offset, options)
+		}
+		buffer.WriteString("}\n\n")
+	}
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return "", err
+	}
+	return string(source), nil
+}
+
+//memberGoType 模板成员对应的 Go 类型与附加标签
+func memberGoType(member *TemplateMember, byID map[uint16]*Template) (string, string, error) {
+	array := func(goType string) string {
+		if member.ArraySize > 0 {
+			return fmt.Sprintf("[%d]%s", member.ArraySize, goType)
+		}
+		return goType
+	}
+	switch member.DType {
+	case types.STRUCT:
+		nested, ok := byID[member.TemplateID]
+		if !ok {
+			return "", "", fmt.Errorf("缺少模板 %d", member.TemplateID)
+		}
+		options := ""
+		if member.ArraySize > 0 {
+			options = fmt.Sprintf(",stride=%d", nested.Size)
+		}
+		return array(goName(nested.Name)), options, nil
+	case types.BOOL:
+		return "bool", fmt.Sprintf(",bit=%d", member.Bit), nil
+	case types.BIT_STRING:
+		size := member.ArraySize
+		if size == 0 {
+			size = 1
+		}
+		return fmt.Sprintf("[%d]bool", int(size)*32), "", nil
+	case types.SINT:
+		return array("int8"), "", nil
+	case types.USINT:
+		return array("uint8"), "", nil
+	case types.INT:
+		return array("int16"), "", nil
+	case types.UINT:
+		return array("uint16"), "", nil
+	case types.DINT:
+		return array("int32"), "", nil
+	case types.UDINT:
+		return array("uint32"), "", nil
+	case types.LINT:
+		return array("int64"), "", nil
+	case types.ULINT:
+		return array("uint64"), "", nil
+	case types.REAL:
+		return array("float32"), "", nil
+	case types.LREAL:
+		return array("float64"), "", nil
+	default:
+		return "", "", fmt.Errorf("不支持的类型 %s", member.DType)
+	}
+}
+
+//goName 转换为可导出的 Go 标识符
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	buffer := new(strings.Builder)
+	for _, part := range parts {
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		buffer.WriteString(string(runes))
+	}
+	result := buffer.String()
+	if result == "" || unicode.IsDigit([]rune(result)[0]) {
+		result = "X" + result
+	}
+	return result
+}
@@ -3,8 +3,10 @@ package types
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"github.com/wj008/gologix/lib"
 	"io"
+	"strconv"
 	"strings"
 )
 
@@ -47,17 +49,92 @@ const (
 	STRINGAB        DataType = 0xfce
 )
 
+func (t DataType) String() string {
+	switch t {
+	case NULL:
+		return "NULL"
+	case BOOL:
+		return "BOOL"
+	case SINT:
+		return "SINT"
+	case INT:
+		return "INT"
+	case DINT:
+		return "DINT"
+	case LINT:
+		return "LINT"
+	case USINT:
+		return "USINT"
+	case UINT:
+		return "UINT"
+	case UDINT:
+		return "UDINT"
+	case ULINT:
+		return "ULINT"
+	case REAL:
+		return "REAL"
+	case LREAL:
+		return "LREAL"
+	case STIME:
+		return "STIME"
+	case DATE:
+		return "DATE"
+	case TIME_AND_DAY:
+		return "TIME_AND_DAY"
+	case DATE_AND_STRING:
+		return "DATE_AND_STRING"
+	case STRING:
+		return "STRING"
+	case WORD:
+		return "WORD"
+	case DWORD:
+		return "DWORD"
+	case BIT_STRING:
+		return "BIT_STRING"
+	case LWORD:
+		return "LWORD"
+	case STRING2:
+		return "STRING2"
+	case FTIME:
+		return "FTIME"
+	case LTIME:
+		return "LTIME"
+	case ITIME:
+		return "ITIME"
+	case STRINGN:
+		return "STRINGN"
+	case SHORT_STRING:
+		return "SHORT_STRING"
+	case TIME:
+		return "TIME"
+	case EPATH:
+		return "EPATH"
+	case ENGUNIT:
+		return "ENGUNIT"
+	case STRINGI:
+		return "STRINGI"
+	case STRUCT:
+		return "STRUCT"
+	case STRINGAB:
+		return "STRINGAB"
+	default:
+		return "0x" + strconv.FormatUint(uint64(t), 16)
+	}
+}
+
 func GetByteCount(dataType DataType) uint16 {
 	switch dataType {
 	case NULL:
 		return 0
 	case SINT, USINT, BOOL:
 		return 1
-	case INT, UINT:
+	case INT, UINT, DATE, ITIME:
 		return 2
-	case DINT, UDINT, REAL, BIT_STRING:
+	case DINT, UDINT, REAL, BIT_STRING, STIME, TIME_AND_DAY, FTIME, TIME:
 		return 4
-	case LINT, ULINT, LREAL:
+	case DATE_AND_STRING:
+		return 6
+	case LINT, ULINT, LREAL, LTIME:
 		return 8
 	case STRUCT:
 		return 88
@@ -66,7 +143,13 @@ func GetByteCount(dataType DataType) uint16 {
 	}
 }
 
-func GetTypeValue(reader io.Reader, dataType DataType) (interface{}, uint32, error) {
+func GetTypeValue(reader io.Reader, dataType DataType) (value interface{}, size uint32, err error) {
+	//数据不完整时 lib.ReadByte 会 panic
+	defer func() {
+		if r := recover(); r != nil {
+			value, size, err = nil, 0, fmt.Errorf("%s 数据不完整: %v", dataType, r)
+		}
+	}()
 	switch dataType {
 	case NULL:
 		return nil, 0, errors.New("返回类型为NULL，读取失败")
@@ -120,26 +203,16 @@ func GetTypeValue(reader io.Reader, dataType DataType) (interface{}, uint32, err
 		_tp1 := uint16(0)
 		lib.ReadByte(reader, &_tp1)
 		offset += 2
-		if _tp1 == 0xfce {
-			_len := uint32(0)
-			lib.ReadByte(reader, &_len)
-			offset += 4
-			buf := make([]byte, _len)
-			lib.ReadByte(reader, buf)
-			offset += _len
-			return string(buf), offset, nil
+		if _tp1 == LogixString.Handle {
+			result, size, err := readLogixString(reader)
+			return result, offset + size, err
 		} else {
 			return nil, offset, errors.New("读取结构体信息失败")
 		}
-	case SHORT_STRING: //218
-		offset := uint32(0)
-		_len := uint8(0)
-		lib.ReadByte(reader, &_len)
-		offset += 1
-		buf := make([]byte, _len)
-		lib.ReadByte(reader, buf)
-		offset += uint32(_len)
-		return string(buf), offset, nil
+	case SHORT_STRING, STRING, STRING2, STRINGN, STRINGI: //218
+		return readCIPString(reader, dataType)
+	case STIME, DATE, TIME_AND_DAY, DATE_AND_STRING, FTIME, LTIME, ITIME, TIME:
+		return readTimeValue(reader, dataType)
 	default:
 		return nil, 0, errors.New("没有找到正确的数据类型")
 	}
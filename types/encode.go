@@ -0,0 +1,274 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/lib"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+//integerRange 整数类型的范围与长度
+type integerRange struct {
+	min  int64
+	max  uint64
+	size int
+}
+
+var integerRanges = map[DataType]integerRange{
+	SINT:       {math.MinInt8, math.MaxInt8, 1},
+	INT:        {math.MinInt16, math.MaxInt16, 2},
+	DINT:       {math.MinInt32, math.MaxInt32, 4},
+	LINT:       {math.MinInt64, math.MaxInt64, 8},
+	USINT:      {0, math.MaxUint8, 1},
+	UINT:       {0, math.MaxUint16, 2},
+	UDINT:      {0, math.MaxUint32, 4},
+	ULINT:      {0, math.MaxUint64, 8},
+	WORD:       {0, math.MaxUint16, 2},
+	DWORD:      {0, math.MaxUint32, 4},
+	BIT_STRING: {0, math.MaxUint32, 4},
+	LWORD:      {0, math.MaxUint64, 8},
+}
+
+//EncodeError 编码错误
+type EncodeError struct {
+	DType DataType
+	Value interface{}
+	Err   error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("%v 无法编码为 %s: %v", e.Value, e.DType, e.Err)
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	ErrOutOfRange    = errors.New("超出范围")
+	ErrPrecisionLoss = errors.New("精度丢失")
+	ErrTypeMismatch  = errors.New("类型不匹配")
+)
+
+//integerOf 宽松转换为整数: 支持各类整数、整数值的浮点数与数字字符串，
+//大于 MaxInt64 的无符号数通过 big 返回
+func integerOf(value interface{}) (n int64, big uint64, isBig bool, err error) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), 0, false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return 0, u, true, nil
+		}
+		return int64(u), 0, false, nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, 0, false, ErrPrecisionLoss
+		}
+		if f >= -(1<<63) && f < 1<<63 {
+			return int64(f), 0, false, nil
+		}
+		if f >= 0 && f < 1<<64 {
+			return 0, uint64(f), true, nil
+		}
+		return 0, 0, false, ErrOutOfRange
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, 0, false, nil
+		}
+		return 0, 0, false, nil
+	case reflect.String:
+		text := strings.TrimSpace(rv.String())
+		if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+			return i, 0, false, nil
+		}
+		if u, err := strconv.ParseUint(text, 0, 64); err == nil {
+			return 0, u, true, nil
+		}
+		return 0, 0, false, ErrTypeMismatch
+	default:
+		return 0, 0, false, ErrTypeMismatch
+	}
+}
+
+//floatOf 宽松转换为浮点数，整数超出 mantissa 位数时返回精度丢失
+func floatOf(value interface{}, mantissa uint) (float64, error) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		if err != nil {
+			return 0, ErrTypeMismatch
+		}
+		return f, nil
+	}
+	n, big, isBig, err := integerOf(value)
+	if err != nil {
+		return 0, err
+	}
+	limit := uint64(1) << mantissa
+	if isBig {
+		if big > limit {
+			return 0, ErrPrecisionLoss
+		}
+		return float64(big), nil
+	}
+	if n > int64(limit) || n < -int64(limit) {
+		return 0, ErrPrecisionLoss
+	}
+	return float64(n), nil
+}
+
+//Encode 按数据类型编码单个数值，超出范围或精度丢失时返回错误而不是截断
+func Encode(w io.Writer, dataType DataType, value interface{}) error {
+	if err := encode(w, dataType, value); err != nil {
+		var encodeErr *EncodeError
+		if errors.As(err, &encodeErr) {
+			return err
+		}
+		return &EncodeError{DType: dataType, Value: value, Err: err}
+	}
+	return nil
+}
+
+func encode(w io.Writer, dataType DataType, value interface{}) error {
+	if value == nil {
+		return ErrTypeMismatch
+	}
+	if t, ok := value.(time.Time); ok && dataType == LINT {
+		return EncodeTime(w, dataType, t)
+	}
+	if IsTimeType(dataType) {
+		return EncodeTime(w, dataType, value)
+	}
+	if r, ok := integerRanges[dataType]; ok {
+		n, big, isBig, err := integerOf(value)
+		if err != nil {
+			return err
+		}
+		if isBig && big > r.max || !isBig && (n < r.min || n >= 0 && uint64(n) > r.max) {
+			return ErrOutOfRange
+		}
+		u := uint64(n)
+		if isBig {
+			u = big
+		}
+		switch r.size {
+		case 1:
+			lib.WriteByte(w, uint8(u))
+		case 2:
+			lib.WriteByte(w, uint16(u))
+		case 4:
+			lib.WriteByte(w, uint32(u))
+		default:
+			lib.WriteByte(w, u)
+		}
+		return nil
+	}
+	switch dataType {
+	case BOOL:
+		b, ok := value.(bool)
+		if !ok {
+			n, _, isBig, err := integerOf(value)
+			if err != nil || isBig || n < 0 || n > 1 {
+				return ErrTypeMismatch
+			}
+			b = n == 1
+		}
+		if b {
+			lib.WriteByte(w, uint8(0xff))
+		} else {
+			lib.WriteByte(w, uint8(0))
+		}
+		return nil
+	case REAL:
+		f, err := floatOf(value, 24)
+		if err != nil {
+			return err
+		}
+		if !math.IsInf(f, 0) && !math.IsNaN(f) && math.Abs(f) > math.MaxFloat32 {
+			return ErrOutOfRange
+		}
+		if f != 0 && float32(f) == 0 {
+			return ErrPrecisionLoss
+		}
+		lib.WriteByte(w, float32(f))
+		return nil
+	case LREAL:
+		f, err := floatOf(value, 53)
+		if err != nil {
+			return err
+		}
+		lib.WriteByte(w, f)
+		return nil
+	case STRING, SHORT_STRING, STRING2, STRINGN, STRINGI:
+		text, ok := value.(string)
+		if !ok {
+			return ErrTypeMismatch
+		}
+		return encodeCIPString(w, dataType, text)
+	case STRUCT:
+		return errors.New("结构体请使用 MarshalTo 或 StringType 编码")
+	default:
+		return fmt.Errorf("不支持的数据类型 %s", dataType)
+	}
+}
+
+//encodeCIPString 编码 CIP 字符串类型，STRINGI 编码为单个 eng 语言的 SHORT_STRING
+func encodeCIPString(w io.Writer, dataType DataType, text string) error {
+	switch dataType {
+	case STRING:
+		if len(text) > math.MaxUint16 {
+			return ErrOutOfRange
+		}
+		lib.WriteByte(w, uint16(len(text)))
+		lib.WriteByte(w, []byte(text))
+	case SHORT_STRING:
+		if len(text) > math.MaxUint8 {
+			return ErrOutOfRange
+		}
+		lib.WriteByte(w, uint8(len(text)))
+		lib.WriteByte(w, []byte(text))
+	case STRING2:
+		chars := utf16.Encode([]rune(text))
+		if len(chars) > math.MaxUint16 {
+			return ErrOutOfRange
+		}
+		lib.WriteByte(w, uint16(len(chars)))
+		lib.WriteByte(w, chars)
+	case STRINGN:
+		//包含非单字节字符时使用 UTF-16
+		chars := utf16.Encode([]rune(text))
+		if len(chars) == len(text) {
+			if len(text) > math.MaxUint16 {
+				return ErrOutOfRange
+			}
+			lib.WriteByte(w, []uint16{1, uint16(len(text))})
+			lib.WriteByte(w, []byte(text))
+		} else {
+			if len(chars) > math.MaxUint16 {
+				return ErrOutOfRange
+			}
+			lib.WriteByte(w, []uint16{2, uint16(len(chars))})
+			lib.WriteByte(w, chars)
+		}
+	case STRINGI:
+		lib.WriteByte(w, uint8(1))
+		lib.WriteByte(w, []byte("eng"))
+		lib.WriteByte(w, uint8(SHORT_STRING))
+		lib.WriteByte(w, uint16(4))
+		return encodeCIPString(w, SHORT_STRING, text)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEncodeRange(t *testing.T) {
+	cases := []struct {
+		dataType DataType
+		value    interface{}
+		want     []byte
+		err      error
+	}{
+		{DINT, 70000, []byte{0x70, 0x11, 0x01, 0x00}, nil},
+		{SINT, 128, nil, ErrOutOfRange},
+		{USINT, -1, nil, ErrOutOfRange},
+		{INT, 2.5, nil, ErrPrecisionLoss},
+		{INT, float64(-2), []byte{0xfe, 0xff}, nil},
+		{ULINT, uint64(math.MaxUint64), bytes.Repeat([]byte{0xff}, 8), nil},
+		{REAL, 1.5, []byte{0, 0, 0xc0, 0x3f}, nil},
+		{REAL, 1e39, nil, ErrOutOfRange},
+		{REAL, 1 << 25, nil, ErrPrecisionLoss},
+		{DINT, "0x10", []byte{0x10, 0, 0, 0}, nil},
+		{BOOL, true, []byte{0xff}, nil},
+		{DINT, "abc", nil, ErrTypeMismatch},
+	}
+	for _, c := range cases {
+		buffer := new(bytes.Buffer)
+		err := Encode(buffer, c.dataType, c.value)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Fatalf("%s %v 应返回 %v，实际 %v", c.dataType, c.value, c.err, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(buffer.Bytes(), c.want) {
+			t.Fatalf("%s %v 编码错误 % x %v", c.dataType, c.value, buffer.Bytes(), err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/lib"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//fieldSpec 结构体字段的 plc 标签，格式 `plc:"Member,offset=4"`，BOOL 成员 `plc:"Flag,offset=8,bit=3"`，
+//结构体数组可用 stride 指定元素间隔，未指定时按嵌套结构体大小4字节对齐，time.Time 字段按 LINT 微秒时间戳处理
+type fieldSpec struct {
+	name   string
+	offset int
+	bit    int
+	stride int
+}
+
+//parseFieldTag 解析 plc 标签，返回 nil 表示忽略该字段
+func parseFieldTag(field reflect.StructField) (*fieldSpec, error) {
+	tag, ok := field.Tag.Lookup("plc")
+	if !ok || tag == "-" {
+		return nil, nil
+	}
+	parts := strings.Split(tag, ",")
+	spec := &fieldSpec{name: parts[0], offset: -1, bit: -1}
+	if spec.name == "" {
+		spec.name = field.Name
+	}
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("字段 %s 标签格式错误: %s", field.Name, part)
+		}
+		number, err := strconv.Atoi(kv[1])
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("字段 %s 标签数值错误: %s", field.Name, part)
+		}
+		switch kv[0] {
+		case "offset":
+			spec.offset = number
+		case "bit":
+			spec.bit = number
+		case "stride":
+			spec.stride = number
+		default:
+			return nil, fmt.Errorf("字段 %s 不支持的标签: %s", field.Name, kv[0])
+		}
+	}
+	if spec.offset < 0 {
+		return nil, fmt.Errorf("字段 %s 缺少 offset", field.Name)
+	}
+	return spec, nil
+}
+
+//SizeOf 按 plc 标签计算 Go 类型对应的 PLC 数据长度，结构体按4字节对齐
+func SizeOf(t reflect.Type) (int, error) {
+	return sizeOf(t, -1, 0)
+}
+
+func sizeOf(t reflect.Type, bit int, stride int) (int, error) {
+	if t == timeType {
+		return 8, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if bit >= 0 {
+			return bit/8 + 1, nil
+		}
+		return 1, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return int(t.Size()), nil
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Bool {
+			//BOOL 数组按 DWORD 存放
+			if bit < 0 {
+				bit = 0
+			}
+			return (bit + t.Len() + 31) / 32 * 4, nil
+		}
+		elemSize, err := elementStride(t.Elem(), stride)
+		if err != nil {
+			return 0, err
+		}
+		return elemSize * t.Len(), nil
+	case reflect.Struct:
+		size := 0
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			spec, err := parseFieldTag(field)
+			if err != nil {
+				return 0, err
+			}
+			if spec == nil {
+				continue
+			}
+			fieldSize, err := sizeOf(field.Type, spec.bit, spec.stride)
+			if err != nil {
+				return 0, err
+			}
+			if spec.offset+fieldSize > size {
+				size = spec.offset + fieldSize
+			}
+		}
+		return (size + 3) / 4 * 4, nil
+	default:
+		return 0, fmt.Errorf("不支持的字段类型 %s", t)
+	}
+}
+
+//elementStride 数组元素间隔
+func elementStride(t reflect.Type, stride int) (int, error) {
+	if stride > 0 {
+		return stride, nil
+	}
+	return sizeOf(t, -1, 0)
+}
+
+//Unmarshal 按结构体字段的 plc 标签解析 UDT 原始数据，v 必须为指针
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("Unmarshal 需要非空指针")
+	}
+	return codec(data, 0, -1, 0, rv.Elem(), false)
+}
+
+//MarshalTo 将 v 按 plc 标签写入原始数据，未映射的字节保持不变
+func MarshalTo(data []byte, v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if !rv.IsValid() {
+		return errors.New("MarshalTo 数据为空")
+	}
+	return codec(data, 0, -1, 0, rv, true)
+}
+
+//Marshal 将 v 按 plc 标签编码为原始数据，填充字节为0
+func Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if !rv.IsValid() {
+		return nil, errors.New("Marshal 数据为空")
+	}
+	size, err := SizeOf(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if err = codec(data, 0, -1, 0, rv, true); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+//codec 解析或编码单个值
+func codec(data []byte, offset int, bit int, stride int, rv reflect.Value, encode bool) error {
+	if rv.Type() == timeType {
+		//time.Time 字段按 Logix 系统时间(LINT 微秒)编码
+		if offset+8 > len(data) {
+			return fmt.Errorf("偏移量 %d 超出数据长度 %d", offset+8, len(data))
+		}
+		if encode {
+			binary.LittleEndian.PutUint64(data[offset:], uint64(ToLogixTime(rv.Interface().(time.Time))))
+		} else {
+			rv.Set(reflect.ValueOf(LogixTime(int64(binary.LittleEndian.Uint64(data[offset:])))))
+		}
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		pos := offset
+		mask := byte(0xff)
+		if bit >= 0 {
+			pos += bit / 8
+			mask = 1 << uint(bit%8)
+		}
+		if pos >= len(data) {
+			return fmt.Errorf("偏移量 %d 超出数据长度 %d", pos, len(data))
+		}
+		if !encode {
+			rv.SetBool(data[pos]&mask != 0)
+		} else if rv.Bool() {
+			if bit >= 0 {
+				data[pos] |= mask
+			} else {
+				data[pos] = 1
+			}
+		} else {
+			data[pos] &^= mask
+		}
+		return nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		size := int(rv.Type().Size())
+		if offset+size > len(data) {
+			return fmt.Errorf("偏移量 %d 超出数据长度 %d", offset+size, len(data))
+		}
+		if encode {
+			buffer := new(bytes.Buffer)
+			lib.WriteByte(buffer, rv.Interface())
+			copy(data[offset:], buffer.Bytes())
+		} else {
+			target := reflect.New(rv.Type())
+			lib.ReadByte(bytes.NewReader(data[offset:offset+size]), target.Interface())
+			rv.Set(target.Elem())
+		}
+		return nil
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Bool {
+			if bit < 0 {
+				bit = 0
+			}
+			for i := 0; i < rv.Len(); i++ {
+				pos := bit + i
+				if err := codec(data, offset+pos/8, pos%8, 0, rv.Index(i), encode); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		elemSize, err := elementStride(rv.Type().Elem(), stride)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err = codec(data, offset+i*elemSize, -1, 0, rv.Index(i), encode); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			spec, err := parseFieldTag(field)
+			if err != nil {
+				return err
+			}
+			if spec == nil {
+				continue
+			}
+			if field.PkgPath != "" {
+				return fmt.Errorf("字段 %s 不可导出", field.Name)
+			}
+			if err = codec(data, offset+spec.offset, spec.bit, spec.stride, rv.Field(i), encode); err != nil {
+				return fmt.Errorf("%s: %w", spec.name, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的字段类型 %s", rv.Type())
+	}
+}
@@ -0,0 +1,149 @@
+package types
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/lib"
+	"io"
+	"unicode/utf16"
+)
+
+//StringType Logix 字符串结构体: LEN(DINT) 与 DATA(SINT[n])，STRING 为 DATA[82] 共88字节
+type StringType struct {
+	Name       string
+	Handle     uint16 //结构体句柄
+	Size       int    //单个元素长度(含填充)
+	LenOffset  int    //LEN 成员偏移量
+	DataOffset int    //DATA 成员偏移量
+	Capacity   int    //DATA 最大字符数
+}
+
+//LogixString 标准 STRING 类型
+var LogixString = &StringType{Name: "STRING", Handle: 0x0fce, Size: 88, LenOffset: 0, DataOffset: 4, Capacity: 82}
+
+//Decode 解析单个字符串元素
+func (s *StringType) Decode(data []byte) (string, error) {
+	if len(data) < s.DataOffset || len(data) < s.LenOffset+4 {
+		return "", errors.New("字符串数据不完整")
+	}
+	length := int(int32(binary.LittleEndian.Uint32(data[s.LenOffset:])))
+	if length < 0 || length > s.Capacity {
+		return "", fmt.Errorf("%s 长度 %d 超出范围", s.Name, length)
+	}
+	if s.DataOffset+length > len(data) {
+		return "", errors.New("字符串数据不完整")
+	}
+	return string(data[s.DataOffset : s.DataOffset+length]), nil
+}
+
+//EncodeTo 将字符串写入单个元素，未使用的字符清零
+func (s *StringType) EncodeTo(data []byte, value string) error {
+	if len(value) > s.Capacity {
+		return fmt.Errorf("字符串长度 %d 超出 %s 容量 %d", len(value), s.Name, s.Capacity)
+	}
+	if len(data) < s.DataOffset+s.Capacity || len(data) < s.LenOffset+4 {
+		return errors.New("字符串数据长度不足")
+	}
+	binary.LittleEndian.PutUint32(data[s.LenOffset:], uint32(len(value)))
+	area := data[s.DataOffset : s.DataOffset+s.Capacity]
+	for i := range area {
+		area[i] = 0
+	}
+	copy(area, value)
+	return nil
+}
+
+//Encode 编码单个字符串元素
+func (s *StringType) Encode(value string) ([]byte, error) {
+	data := make([]byte, s.Size)
+	if err := s.EncodeTo(data, value); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+//readCIPString 读取 CIP 字符串类型
+func readCIPString(reader io.Reader, dataType DataType) (string, uint32, error) {
+	switch dataType {
+	case STRING:
+		//UINT 长度 + 单字节字符
+		length := uint16(0)
+		lib.ReadByte(reader, &length)
+		buf := make([]byte, length)
+		lib.ReadByte(reader, buf)
+		return string(buf), 2 + uint32(length), nil
+	case SHORT_STRING:
+		length := uint8(0)
+		lib.ReadByte(reader, &length)
+		buf := make([]byte, length)
+		lib.ReadByte(reader, buf)
+		return string(buf), 1 + uint32(length), nil
+	case STRING2:
+		//UINT 长度 + UTF-16 字符
+		length := uint16(0)
+		lib.ReadByte(reader, &length)
+		chars := make([]uint16, length)
+		lib.ReadByte(reader, chars)
+		return string(utf16.Decode(chars)), 2 + uint32(length)*2, nil
+	case STRINGN:
+		//UINT 字符宽度 + UINT 字符数量
+		var width, length uint16
+		lib.ReadByte(reader, &width)
+		lib.ReadByte(reader, &length)
+		offset := uint32(4) + uint32(width)*uint32(length)
+		switch width {
+		case 1:
+			buf := make([]byte, length)
+			lib.ReadByte(reader, buf)
+			return string(buf), offset, nil
+		case 2:
+			chars := make([]uint16, length)
+			lib.ReadByte(reader, chars)
+			return string(utf16.Decode(chars)), offset, nil
+		case 4:
+			chars := make([]uint32, length)
+			lib.ReadByte(reader, chars)
+			runes := make([]rune, length)
+			for i, char := range chars {
+				runes[i] = rune(char)
+			}
+			return string(runes), offset, nil
+		default:
+			return "", offset, fmt.Errorf("STRINGN 字符宽度 %d 不正确", width)
+		}
+	case STRINGI:
+		//USINT 数量，每项为语言(3字节)、类型、字符集与字符串，返回第一项
+		count := uint8(0)
+		lib.ReadByte(reader, &count)
+		offset := uint32(1)
+		result := ""
+		for i := 0; i < int(count); i++ {
+			header := struct {
+				Language [3]byte
+				Type     uint8
+				CharSet  uint16
+			}{}
+			lib.ReadByte(reader, &header)
+			value, size, err := readCIPString(reader, DataType(header.Type))
+			if err != nil {
+				return "", offset, err
+			}
+			offset += 6 + size
+			if i == 0 {
+				result = value
+			}
+		}
+		return result, offset, nil
+	default:
+		return "", 0, fmt.Errorf("%s 不是字符串类型", dataType)
+	}
+}
+
+//readLogixString 读取 STRING 结构体元素，reader 已跳过结构体句柄
+func readLogixString(reader io.Reader) (string, uint32, error) {
+	buf := make([]byte, LogixString.Size)
+	lib.ReadByte(reader, buf)
+	value, err := LogixString.Decode(buf)
+	return value, uint32(LogixString.Size), err
+}
@@ -0,0 +1,33 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCIPStrings(t *testing.T) {
+	cases := []struct {
+		dataType DataType
+		data     []byte
+		want     string
+	}{
+		{STRING, []byte{3, 0, 'a', 'b', 'c'}, "abc"},
+		{SHORT_STRING, []byte{2, 'h', 'i'}, "hi"},
+		{STRING2, []byte{2, 0, 0x2d, 0x4e, 0x87, 0x65}, "中文"},
+		{STRINGN, []byte{1, 0, 2, 0, 'o', 'k'}, "ok"},
+		{STRINGN, []byte{4, 0, 1, 0, 0x00, 0xf6, 0x01, 0x00}, "\U0001f600"},
+		{STRINGI, []byte{2, 'e', 'n', 'g', 0xda, 4, 0, 2, 'e', 'n', 'z', 'h', 'o', 0xd0, 4, 0, 1, 0, 'x'}, "en"},
+	}
+	for _, c := range cases {
+		value, size, err := GetTypeValue(bytes.NewReader(c.data), c.dataType)
+		if err != nil {
+			t.Fatalf("%s 解析失败 %v", c.dataType, err)
+		}
+		if value != c.want || int(size) != len(c.data) {
+			t.Fatalf("%s 解析错误 %q 长度 %d", c.dataType, value, size)
+		}
+	}
+	if _, _, err := GetTypeValue(bytes.NewReader([]byte{9, 0, 'a'}), STRING); err == nil {
+		t.Fatal("数据不完整应返回错误")
+	}
+}
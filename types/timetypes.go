@@ -0,0 +1,149 @@
+package types
+
+import (
+	"fmt"
+	"github.com/wj008/gologix/lib"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+const (
+	DATE_AND_TIME = DATE_AND_STRING //CIP 日期时间，与 DATE_AND_STRING 为同一类型码
+	TIME_OF_DAY   = TIME_AND_DAY    //CIP 当天时间，与 TIME_AND_DAY 为同一类型码
+)
+
+//cipDateEpoch CIP DATE 起始日期
+var cipDateEpoch = time.Date(1972, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//LogixTime Logix 系统时间(LINT, 1970年起的微秒数)转换为 UTC 时间
+func LogixTime(us int64) time.Time {
+	return time.UnixMicro(us).UTC()
+}
+
+//ToLogixTime 时间转换为 Logix 系统时间微秒数
+func ToLogixTime(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+//IsTimeType 是否为时间或时长类型
+func IsTimeType(dataType DataType) bool {
+	switch dataType {
+	case STIME, DATE, TIME_AND_DAY, DATE_AND_TIME, FTIME, LTIME, ITIME, TIME:
+		return true
+	default:
+		return false
+	}
+}
+
+//readTimeValue 读取时间类型: DATE 与 DATE_AND_TIME 为 time.Time，其他为 time.Duration
+func readTimeValue(reader io.Reader, dataType DataType) (interface{}, uint32, error) {
+	switch dataType {
+	case DATE:
+		//UINT 1972-01-01 起的天数
+		days := uint16(0)
+		lib.ReadByte(reader, &days)
+		return cipDateEpoch.AddDate(0, 0, int(days)), 2, nil
+	case TIME_AND_DAY:
+		//UDINT 当天的毫秒数
+		ms := uint32(0)
+		lib.ReadByte(reader, &ms)
+		return time.Duration(ms) * time.Millisecond, 4, nil
+	case DATE_AND_TIME:
+		//TIME_OF_DAY(UDINT 毫秒) + DATE(UINT 天)
+		ms := uint32(0)
+		days := uint16(0)
+		lib.ReadByte(reader, &ms)
+		lib.ReadByte(reader, &days)
+		return cipDateEpoch.AddDate(0, 0, int(days)).Add(time.Duration(ms) * time.Millisecond), 6, nil
+	case ITIME:
+		//INT 毫秒
+		ms := int16(0)
+		lib.ReadByte(reader, &ms)
+		return time.Duration(ms) * time.Millisecond, 2, nil
+	case STIME, TIME:
+		//DINT 毫秒
+		ms := int32(0)
+		lib.ReadByte(reader, &ms)
+		return time.Duration(ms) * time.Millisecond, 4, nil
+	case FTIME:
+		//DINT 微秒
+		us := int32(0)
+		lib.ReadByte(reader, &us)
+		return time.Duration(us) * time.Microsecond, 4, nil
+	case LTIME:
+		//LINT 微秒
+		us := int64(0)
+		lib.ReadByte(reader, &us)
+		if us > math.MaxInt64/int64(time.Microsecond) || us < math.MinInt64/int64(time.Microsecond) {
+			return nil, 8, fmt.Errorf("LTIME %d 超出 time.Duration 范围", us)
+		}
+		return time.Duration(us) * time.Microsecond, 8, nil
+	default:
+		return nil, 0, fmt.Errorf("%s 不是时间类型", dataType)
+	}
+}
+
+//EncodeTime 编码时间类型，DATE/DATE_AND_TIME 接受 time.Time，时长类型接受 time.Duration，
+//LINT 接受 time.Time 并按 Logix 系统时间编码，低于类型精度的部分被舍去
+func EncodeTime(w io.Writer, dataType DataType, value interface{}) error {
+	switch dataType {
+	case DATE, DATE_AND_TIME, LINT:
+		t, ok := value.(time.Time)
+		if !ok {
+			return fmt.Errorf("%s 需要 time.Time，实际为 %T", dataType, value)
+		}
+		if dataType == LINT {
+			lib.WriteByte(w, ToLogixTime(t))
+			return nil
+		}
+		t = t.UTC()
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		days := int64(day.Sub(cipDateEpoch) / (24 * time.Hour))
+		if day.Before(cipDateEpoch) || days > math.MaxUint16 {
+			return fmt.Errorf("%s 超出范围: %s", dataType, t)
+		}
+		if dataType == DATE_AND_TIME {
+			lib.WriteByte(w, uint32(t.Sub(day)/time.Millisecond))
+		}
+		lib.WriteByte(w, uint16(days))
+		return nil
+	}
+	d, ok := value.(time.Duration)
+	if !ok {
+		return fmt.Errorf("%s 需要 time.Duration，实际为 %T", dataType, value)
+	}
+	switch dataType {
+	case TIME_AND_DAY:
+		if d < 0 || d >= 24*time.Hour {
+			return fmt.Errorf("TIME_OF_DAY 超出范围: %s", d)
+		}
+		lib.WriteByte(w, uint32(d/time.Millisecond))
+	case ITIME:
+		ms := int64(d / time.Millisecond)
+		if ms < math.MinInt16 || ms > math.MaxInt16 {
+			return fmt.Errorf("ITIME 超出范围: %s", d)
+		}
+		lib.WriteByte(w, int16(ms))
+	case STIME, TIME:
+		ms := int64(d / time.Millisecond)
+		if ms < math.MinInt32 || ms > math.MaxInt32 {
+			return fmt.Errorf("%s 超出范围: %s", dataType, d)
+		}
+		lib.WriteByte(w, int32(ms))
+	case FTIME:
+		us := int64(d / time.Microsecond)
+		if us < math.MinInt32 || us > math.MaxInt32 {
+			return fmt.Errorf("FTIME 超出范围: %s", d)
+		}
+		lib.WriteByte(w, int32(us))
+	case LTIME:
+		lib.WriteByte(w, int64(d/time.Microsecond))
+	default:
+		return fmt.Errorf("%s 不是时间类型", dataType)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTimeTypes(t *testing.T) {
+	stamp := time.Date(2024, 5, 6, 7, 8, 9, 123000000, time.UTC)
+	cases := []struct {
+		dataType DataType
+		value    interface{}
+		size     int
+	}{
+		{DATE, time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), 2},
+		{DATE_AND_TIME, stamp, 6},
+		{TIME_OF_DAY, 7*time.Hour + 8*time.Minute, 4},
+		{ITIME, -1500 * time.Millisecond, 2},
+		{TIME, 90 * time.Minute, 4},
+		{STIME, 3 * time.Second, 4},
+		{FTIME, 1234 * time.Microsecond, 4},
+		{LTIME, 48 * time.Hour, 8},
+	}
+	for _, c := range cases {
+		buffer := new(bytes.Buffer)
+		if err := EncodeTime(buffer, c.dataType, c.value); err != nil {
+			t.Fatalf("%s 编码失败 %v", c.dataType, err)
+		}
+		if buffer.Len() != c.size {
+			t.Fatalf("%s 编码长度错误 %d", c.dataType, buffer.Len())
+		}
+		value, size, err := GetTypeValue(buffer, c.dataType)
+		if err != nil || int(size) != c.size {
+			t.Fatalf("%s 解析失败 %v", c.dataType, err)
+		}
+		if got, ok := value.(time.Time); ok {
+			if !got.Equal(c.value.(time.Time)) {
+				t.Fatalf("%s 时间错误 %s", c.dataType, got)
+			}
+		} else if value != c.value {
+			t.Fatalf("%s 时长错误 %v", c.dataType, value)
+		}
+	}
+	if err := EncodeTime(new(bytes.Buffer), ITIME, time.Hour); err == nil {
+		t.Fatal("ITIME 超出范围应返回错误")
+	}
+	if LogixTime(ToLogixTime(stamp)) != stamp {
+		t.Fatal("Logix 时间转换错误")
+	}
+}
@@ -0,0 +1,402 @@
+package gologix
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/types"
+	"math"
+	"time"
+)
+
+//Value 带类型的标签数值
+type Value struct {
+	DType types.DataType
+	Data  interface{}
+}
+
+//IsNil 是否没有数值
+func (v Value) IsNil() bool {
+	return v.Data == nil
+}
+
+func (v Value) conversionError(to string) error {
+	return &ConversionError{DType: v.DType, Value: v.Data, To: to}
+}
+
+//Int 转换为有符号整数，布尔值转换为 0/1
+func (v Value) Int() (int64, error) {
+	switch data := v.Data.(type) {
+	case bool:
+		if data {
+			return 1, nil
+		}
+		return 0, nil
+	case int8:
+		return int64(data), nil
+	case int16:
+		return int64(data), nil
+	case int32:
+		return int64(data), nil
+	case int64:
+		return data, nil
+	case uint8:
+		return int64(data), nil
+	case uint16:
+		return int64(data), nil
+	case uint32:
+		return int64(data), nil
+	case uint64:
+		if data > math.MaxInt64 {
+			return 0, v.conversionError("int64")
+		}
+		return int64(data), nil
+	default:
+		return 0, v.conversionError("int64")
+	}
+}
+
+//Uint 转换为无符号整数，负数无法转换
+func (v Value) Uint() (uint64, error) {
+	if data, ok := v.Data.(uint64); ok {
+		return data, nil
+	}
+	number, err := v.Int()
+	if err != nil || number < 0 {
+		return 0, v.conversionError("uint64")
+	}
+	return uint64(number), nil
+}
+
+//Float 转换为浮点数
+func (v Value) Float() (float64, error) {
+	switch data := v.Data.(type) {
+	case float32:
+		return float64(data), nil
+	case float64:
+		return data, nil
+	case uint64:
+		return float64(data), nil
+	}
+	number, err := v.Int()
+	if err != nil {
+		return 0, v.conversionError("float64")
+	}
+	return float64(number), nil
+}
+
+//Bool 转换为布尔值，整数非0为真
+func (v Value) Bool() (bool, error) {
+	if data, ok := v.Data.(bool); ok {
+		return data, nil
+	}
+	if _, ok := v.Data.(uint64); ok {
+		number, _ := v.Uint()
+		return number != 0, nil
+	}
+	number, err := v.Int()
+	if err != nil {
+		return false, v.conversionError("bool")
+	}
+	return number != 0, nil
+}
+
+//String 转换为字符串，非字符串类型返回格式化结果
+func (v Value) String() string {
+	switch data := v.Data.(type) {
+	case nil:
+		return ""
+	case string:
+		return data
+	default:
+		return fmt.Sprint(data)
+	}
+}
+
+//Time 转换为时间，64位整数按 Logix 系统时间(1970年起的微秒数)解析
+func (v Value) Time() (time.Time, error) {
+	switch data := v.Data.(type) {
+	case time.Time:
+		return data, nil
+	case int64:
+		return types.LogixTime(data), nil
+	case uint64:
+		if data > math.MaxInt64 {
+			return time.Time{}, v.conversionError("time.Time")
+		}
+		return types.LogixTime(int64(data)), nil
+	default:
+		return time.Time{}, v.conversionError("time.Time")
+	}
+}
+
+//Duration 转换为时长，仅时长类型可转换
+func (v Value) Duration() (time.Duration, error) {
+	if data, ok := v.Data.(time.Duration); ok {
+		return data, nil
+	}
+	return 0, v.conversionError("time.Duration")
+}
+
+//Raw 转换为小端字节数据
+func (v Value) Raw() ([]byte, error) {
+	switch data := v.Data.(type) {
+	case nil:
+		return nil, v.conversionError("[]byte")
+	case []byte:
+		return data, nil
+	case string:
+		return []byte(data), nil
+	case bool:
+		if data {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64:
+		buffer := new(bytes.Buffer)
+		lib.WriteByte(buffer, data)
+		return buffer.Bytes(), nil
+	default:
+		return nil, v.conversionError("[]byte")
+	}
+}
+
+//Typed 带类型的数值
+func (v *TagValue) Typed() Value {
+	return Value{DType: v.DType, Data: v.Value}
+}
+
+//Typed 带类型的数值列表
+func (r *TagResult) Typed() []Value {
+	values := make([]Value, 0, len(r.Values))
+	for _, data := range r.Values {
+		values = append(values, Value{DType: r.DType, Data: data})
+	}
+	return values
+}
+
+//Elements 前 n 个元素，批量读取的结果中没有该标签、标签读取失败或元素数量不足时返回错误
+func (r *TagResult) Elements(n uint16) ([]Value, error) {
+	switch {
+	case r == nil:
+		return nil, errors.New("没有读取到数据")
+	case r.Err != nil:
+		return nil, r.Err
+	case len(r.Values) < int(n):
+		return nil, errors.New("返回的元素数量不足")
+	}
+	return r.Typed()[:n], nil
+}
+
+//ReadValues 读取多个元素
+func (p *PLC) ReadValues(tagName string, elements uint16) ([]Value, error) {
+	result, err := p.ReadTag(tagName, elements)
+	if err != nil {
+		return nil, err
+	}
+	return result.Elements(elements)
+}
+
+//ReadValue 读取单个元素
+func (p *PLC) ReadValue(tagName string) (Value, error) {
+	values, err := p.ReadValues(tagName, 1)
+	if err != nil {
+		return Value{}, err
+	}
+	return values[0], nil
+}
+
+//ReadBools 读取布尔数组，位数组与整数位访问按位展开
+func (p *PLC) ReadBools(tagName string, elements uint16) ([]bool, error) {
+	values, err := p.ReadValues(tagName, elements)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]bool, 0, len(values))
+	for _, value := range values {
+		item, err := value.Bool()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+//ReadBool 读取布尔值
+func (p *PLC) ReadBool(tagName string) (bool, error) {
+	values, err := p.ReadBools(tagName, 1)
+	if err != nil {
+		return false, err
+	}
+	return values[0], nil
+}
+
+//ReadInts 读取整数数组
+func (p *PLC) ReadInts(tagName string, elements uint16) ([]int64, error) {
+	values, err := p.ReadValues(tagName, elements)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int64, 0, len(values))
+	for _, value := range values {
+		item, err := value.Int()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+//ReadInt 读取整数
+func (p *PLC) ReadInt(tagName string) (int64, error) {
+	values, err := p.ReadInts(tagName, 1)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+//ReadInt32s 读取 DINT 数组，超出范围的数值返回错误
+func (p *PLC) ReadInt32s(tagName string, elements uint16) ([]int32, error) {
+	values, err := p.ReadValues(tagName, elements)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int32, 0, len(values))
+	for _, value := range values {
+		item, err := value.Int()
+		if err != nil {
+			return nil, err
+		}
+		if item < math.MinInt32 || item > math.MaxInt32 {
+			return nil, value.conversionError("int32")
+		}
+		ret = append(ret, int32(item))
+	}
+	return ret, nil
+}
+
+//ReadInt32 读取 DINT
+func (p *PLC) ReadInt32(tagName string) (int32, error) {
+	values, err := p.ReadInt32s(tagName, 1)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+//ReadFloat64s 读取浮点数组
+func (p *PLC) ReadFloat64s(tagName string, elements uint16) ([]float64, error) {
+	values, err := p.ReadValues(tagName, elements)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]float64, 0, len(values))
+	for _, value := range values {
+		item, err := value.Float()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+//ReadFloat64 读取浮点数
+func (p *PLC) ReadFloat64(tagName string) (float64, error) {
+	values, err := p.ReadFloat64s(tagName, 1)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+//ReadFloat32s 读取 REAL 数组
+func (p *PLC) ReadFloat32s(tagName string, elements uint16) ([]float32, error) {
+	values, err := p.ReadValues(tagName, elements)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]float32, 0, len(values))
+	for _, value := range values {
+		if item, ok := value.Data.(float32); ok {
+			ret = append(ret, item)
+			continue
+		}
+		item, err := value.Float()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, float32(item))
+	}
+	return ret, nil
+}
+
+//ReadFloat32 读取 REAL
+func (p *PLC) ReadFloat32(tagName string) (float32, error) {
+	values, err := p.ReadFloat32s(tagName, 1)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+//ReadString 读取字符串
+func (p *PLC) ReadString(tagName string) (string, error) {
+	value, err := p.ReadValue(tagName)
+	if err != nil {
+		return "", err
+	}
+	if value.IsNil() {
+		return "", value.conversionError("string")
+	}
+	return value.String(), nil
+}
+
+//ReadTime 读取时间，DATE/DATE_AND_TIME 直接转换，LINT 按 Logix 系统时间(微秒)转换
+func (p *PLC) ReadTime(tagName string) (time.Time, error) {
+	value, err := p.ReadValue(tagName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, ok := value.Data.(int64); ok && value.DType != types.LINT {
+		return time.Time{}, value.conversionError("time.Time")
+	}
+	return value.Time()
+}
+
+//ReadDuration 读取时长类型
+func (p *PLC) ReadDuration(tagName string) (time.Duration, error) {
+	value, err := p.ReadValue(tagName)
+	if err != nil {
+		return 0, err
+	}
+	return value.Duration()
+}
+
+//writeTimeValue 编码并写入时间或时长
+func (p *PLC) writeTimeValue(tagName string, value interface{}) error {
+	baseTag, _ := lib.ParseTagName(tagName)
+	dataType, err := p.ReadPartialTag(baseTag)
+	if err != nil {
+		return err
+	}
+	buffer := new(bytes.Buffer)
+	if err = types.EncodeTime(buffer, dataType, value); err != nil {
+		return err
+	}
+	return p.WriteRaw(tagName, &RawTag{DType: dataType, Elements: 1, Data: buffer.Bytes()})
+}
+
+//WriteTime 写入时间，LINT 标签按 Logix 系统时间(微秒)编码
+func (p *PLC) WriteTime(tagName string, value time.Time) error {
+	return p.writeTimeValue(tagName, value)
+}
+
+//WriteDuration 写入时长类型
+func (p *PLC) WriteDuration(tagName string, value time.Duration) error {
+	return p.writeTimeValue(tagName, value)
+}
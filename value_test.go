@@ -0,0 +1,83 @@
+package gologix
+
+import (
+	"errors"
+	"github.com/wj008/gologix/types"
+	"testing"
+	"time"
+)
+
+func TestValueConversion(t *testing.T) {
+	if v, err := (Value{DType: types.SINT, Data: int8(-3)}).Int(); err != nil || v != -3 {
+		t.Fatalf("Int 转换错误 %v %v", v, err)
+	}
+	if _, err := (Value{DType: types.REAL, Data: float32(1.5)}).Int(); err == nil {
+		t.Fatal("REAL 不应转换为整数")
+	}
+	if _, err := (Value{DType: types.DINT, Data: int32(-1)}).Uint(); err == nil {
+		t.Fatal("负数不应转换为无符号整数")
+	}
+	if v, err := (Value{DType: types.DINT, Data: int32(2)}).Bool(); err != nil || !v {
+		t.Fatalf("Bool 转换错误 %v %v", v, err)
+	}
+	tm, err := (Value{DType: types.LINT, Data: int64(1500000)}).Time()
+	if err != nil || tm.Unix() != 1 || tm.Nanosecond() != 500000000 {
+		t.Fatalf("Time 转换错误 %v %v", tm, err)
+	}
+	raw, err := (Value{DType: types.INT, Data: int16(0x0102)}).Raw()
+	if err != nil || len(raw) != 2 || raw[0] != 0x02 {
+		t.Fatalf("Raw 转换错误 % x %v", raw, err)
+	}
+}
+
+func TestTypedRead(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTag("P_REAL", types.REAL, []float32{1.5, 2.5, 3.5})
+	sim.AddTag("Flags", types.DINT, []int32{0x08})
+	plc := connectSim(t, sim, ConnectionOptions{})
+	reals, err := plc.ReadFloat32s("P_REAL[1]", 2)
+	if err != nil || len(reals) != 2 || reals[1] != 3.5 {
+		t.Fatalf("ReadFloat32s 错误 %v %v", reals, err)
+	}
+	on, err := plc.ReadBool("Flags.3")
+	if err != nil || !on {
+		t.Fatalf("ReadBool 错误 %v %v", on, err)
+	}
+	values, err := plc.MultiReadTag([]string{"P_REAL[0]", "P_REAL[9]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tagErr *TagError
+	if !errors.As(values["P_REAL[9]"].Err, &tagErr) || tagErr.Kind != TagErrorStatus || tagErr.Status != 0x05 {
+		t.Fatalf("越界标签应返回状态错误 %+v", values["P_REAL[9]"])
+	}
+	if values["P_REAL[0]"].Err != nil || values["P_REAL[0]"].Typed().String() != "1.5" {
+		t.Fatalf("读取错误 %+v", values["P_REAL[0]"])
+	}
+}
+
+func TestTimeRead(t *testing.T) {
+	sim := newSimPLC(t)
+	stamp := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+	sim.AddTag("Stamp", types.LINT, []int64{types.ToLogixTime(stamp)})
+	sim.AddTag("Delay", types.TIME, []int32{2500})
+	plc := connectSim(t, sim, ConnectionOptions{})
+	got, err := plc.ReadTime("Stamp")
+	if err != nil || !got.Equal(stamp) {
+		t.Fatalf("ReadTime 错误 %s %v", got, err)
+	}
+	next := stamp.Add(time.Hour)
+	if err = plc.WriteTime("Stamp", next); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = plc.ReadTime("Stamp"); !got.Equal(next) {
+		t.Fatalf("WriteTime 错误 %s", got)
+	}
+	if err = plc.WriteDuration("Delay", 4*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	delay, err := plc.ReadDuration("Delay")
+	if err != nil || delay != 4*time.Second {
+		t.Fatalf("ReadDuration 错误 %s %v", delay, err)
+	}
+}
@@ -0,0 +1,80 @@
+package gologix
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/wj008/gologix/enip"
+	"github.com/wj008/gologix/lib"
+	"github.com/wj008/gologix/types"
+	"strings"
+)
+
+//WriteTag 写入节点数据，多个数值从指定元素开始连续写入，位访问与位数组元素只能写入单个布尔值
+func (p *PLC) WriteTag(tagName string, values ...interface{}) error {
+	if len(values) == 0 {
+		return errors.New("写入的数据为空")
+	}
+	if len(values) > 0xffff {
+		return errors.New("写入的元素数量过多")
+	}
+	baseTag, _ := lib.ParseTagName(tagName)
+	dataType, err := p.ReadPartialTag(baseTag)
+	if err != nil {
+		return err
+	}
+	p.Println("WriteTag", tagName, values)
+	if lib.IsBitWord(tagName) || dataType == types.BIT_STRING && strings.HasSuffix(tagName, "]") {
+		if len(values) != 1 {
+			return errors.New("位写入只支持单个数值")
+		}
+		return p.writeBit(tagName, dataType, values[0])
+	}
+	if dataType == types.STRUCT {
+		if text, ok := values[0].(string); ok && len(values) == 1 {
+			return p.WriteString(tagName, text)
+		}
+		return errors.New(tagName + " 为结构体，请使用 WriteFrom 或 WriteRaw")
+	}
+	buffer := new(bytes.Buffer)
+	for i, value := range values {
+		if err = types.Encode(buffer, dataType, value); err != nil {
+			return fmt.Errorf("%s 第 %d 个元素: %w", tagName, i, err)
+		}
+	}
+	return p.WriteRaw(tagName, &RawTag{DType: dataType, Elements: uint16(len(values)), Data: buffer.Bytes()})
+}
+
+//writeBit 通过读改写服务修改单个位
+func (p *PLC) writeBit(tagName string, dataType types.DataType, value interface{}) error {
+	if err := p.checkWritable(tagName); err != nil {
+		return err
+	}
+	buffer := new(bytes.Buffer)
+	if err := types.Encode(buffer, types.BOOL, value); err != nil {
+		return err
+	}
+	on := buffer.Bytes()[0] != 0
+	_, indexs := lib.ParseTagName(tagName)
+	size := int(types.GetByteCount(dataType))
+	if size == 0 {
+		return errors.New(tagName + " 不支持位写入")
+	}
+	bit := indexs[0] % (size * 8)
+	orMask := make([]byte, size)
+	andMask := bytes.Repeat([]byte{0xff}, size)
+	if on {
+		orMask[bit/8] |= 1 << uint(bit%8)
+	} else {
+		andMask[bit/8] &^= 1 << uint(bit%8)
+	}
+	tagData := enip.BuildTagIOI(tagName, dataType)
+	res, err := p.sendRequest(enip.AddReadModifyWriteIOI(tagData, orMask, andMask), trafficWrite, true)
+	if err != nil {
+		return err
+	}
+	if res.Status != 0 {
+		return statusError(tagName, res.Status)
+	}
+	return nil
+}
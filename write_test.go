@@ -0,0 +1,38 @@
+package gologix
+
+import (
+	"github.com/wj008/gologix/types"
+	"testing"
+)
+
+func TestWriteTag(t *testing.T) {
+	sim := newSimPLC(t)
+	sim.AddTag("P_REAL", types.REAL, []float32{0, 0, 0})
+	sim.AddTag("Flags", types.DINT, []int32{0x01})
+	sim.AddTag("Bits", types.BIT_STRING, []uint32{0, 0})
+	plc := connectSim(t, sim, ConnectionOptions{})
+	if err := plc.WriteTag("P_REAL[1]", 1.5, 2); err != nil {
+		t.Fatal(err)
+	}
+	reals, err := plc.ReadFloat32s("P_REAL[0]", 3)
+	if err != nil || reals[1] != 1.5 || reals[2] != 2 {
+		t.Fatalf("写入数组错误 %v %v", reals, err)
+	}
+	if err = plc.WriteTag("Flags", int64(1)<<40); err == nil {
+		t.Fatal("超出 DINT 范围应返回错误")
+	}
+	if err = plc.WriteTag("Flags.4", true); err != nil {
+		t.Fatal(err)
+	}
+	if err = plc.WriteTag("Flags.0", false); err != nil {
+		t.Fatal(err)
+	}
+	if err = plc.WriteTag("Bits[33]", 1); err != nil {
+		t.Fatal(err)
+	}
+	flags, _ := plc.ReadInt32("Flags")
+	bits, _ := plc.ReadBools("Bits[32]", 3)
+	if flags != 0x10 || len(bits) != 3 || !bits[1] || bits[0] {
+		t.Fatalf("位写入错误 %x %v", flags, bits)
+	}
+}